@@ -14,13 +14,22 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/docker-faas/docker-faas/pkg/auth"
+	"github.com/docker-faas/docker-faas/pkg/builder"
+	"github.com/docker-faas/docker-faas/pkg/clientip"
 	"github.com/docker-faas/docker-faas/pkg/config"
 	"github.com/docker-faas/docker-faas/pkg/gateway"
+	"github.com/docker-faas/docker-faas/pkg/imagepolicy"
+	"github.com/docker-faas/docker-faas/pkg/logstore"
 	"github.com/docker-faas/docker-faas/pkg/metrics"
 	"github.com/docker-faas/docker-faas/pkg/middleware"
+	"github.com/docker-faas/docker-faas/pkg/pipeline"
 	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/registryauth"
 	"github.com/docker-faas/docker-faas/pkg/router"
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	"github.com/docker-faas/docker-faas/pkg/stats"
 	"github.com/docker-faas/docker-faas/pkg/store"
+	"github.com/docker-faas/docker-faas/pkg/tlsconfig"
 )
 
 func main() {
@@ -50,26 +59,181 @@ func main() {
 	}
 	defer st.Close()
 
-	// Initialize Docker provider
-	dockerProvider, err := provider.NewDockerProvider(cfg.DockerHost, cfg.FunctionsNetwork, cfg.DebugBindAddress, logger)
+	securityPolicy := &provider.SecurityPolicy{
+		AllowedCapabilities:     cfg.SecurityAllowedCapabilities,
+		AllowRoot:               cfg.SecurityAllowRoot,
+		AllowUnconfined:         cfg.SecurityAllowUnconfined,
+		AllowInlineSeccomp:      cfg.SecurityAllowInlineSeccomp,
+		SeccompProfileDir:       cfg.SecuritySeccompProfileDir,
+		AllowedAppArmorProfiles: cfg.SecurityAppArmorProfiles,
+		DefaultPidsLimit:        int64(cfg.SecurityDefaultPidsLimit),
+		MaxPidsLimit:            int64(cfg.SecurityMaxPidsLimit),
+		AllowedBindPaths:        cfg.SecurityAllowedBindPaths,
+	}
+
+	// Registry logins used for image pulls; passwords are sealed once the
+	// secrets keyring is configured below
+	registryCredentials := registryauth.NewCredentials(st)
+
+	// Initialize function provider
+	var functionProvider gateway.Provider
+	var dockerProvider *provider.DockerProvider
+	// drainingProvider drains replicas through the router before stopping them
+	var drainingProvider *provider.DockerProvider
+	switch cfg.Provider {
+	case "docker":
+		dockerProvider, err = provider.NewDockerProvider(cfg.DockerHost, cfg.FunctionsNetwork, cfg.DebugBindAddress, logger)
+		if err != nil {
+			logger.Fatalf("Failed to initialize Docker provider: %v", err)
+		}
+		defer dockerProvider.Close()
+		dockerProvider.SetSecurityPolicy(securityPolicy)
+		dockerProvider.SetRegistryAuth(registryCredentials)
+		dockerProvider.SetCrashLoopPolicy(provider.CrashLoopPolicy{
+			Threshold:  cfg.CrashLoopThreshold,
+			Window:     cfg.CrashLoopWindow,
+			Backoff:    cfg.CrashLoopBackoff,
+			MaxBackoff: cfg.CrashLoopMaxBackoff,
+			LogLines:   cfg.CrashLoopLogLines,
+		})
+		if cfg.ContainerEventsEnabled {
+			watchCtx, stopContainerWatch := context.WithCancel(context.Background())
+			defer stopContainerWatch()
+			dockerProvider.EnableContainerWatcher(watchCtx, cfg.ContainerEventsHistory)
+		}
+		functionProvider = dockerProvider
+		drainingProvider = dockerProvider
+	case "swarm":
+		swarmProvider, err := provider.NewSwarmProvider(cfg.DockerHost, cfg.FunctionsNetwork, provider.SwarmOptions{
+			UpdateParallelism:   uint64(max(cfg.SwarmUpdateParallelism, 0)),
+			UpdateDelay:         cfg.SwarmUpdateDelay,
+			UpdateMonitor:       cfg.SwarmUpdateMonitor,
+			UpdateFailureAction: cfg.SwarmUpdateFailureAction,
+			UpdateOrder:         cfg.SwarmUpdateOrder,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("Failed to initialize Swarm provider: %v", err)
+		}
+		defer swarmProvider.Close()
+		swarmProvider.SetSecurityPolicy(securityPolicy)
+		swarmProvider.SetRegistryAuth(registryCredentials)
+		functionProvider = swarmProvider
+		drainingProvider = swarmProvider.DockerProvider
+	case "local":
+		localProvider, err := provider.NewLocalProvider(provider.LocalOptions{
+			SecretsPath: cfg.LocalSecretsPath,
+			WorkDir:     cfg.LocalWorkDir,
+			ExecTimeout: cfg.ExecTimeout,
+			LogLines:    cfg.LocalLogLines,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("Failed to initialize local provider: %v", err)
+		}
+		defer localProvider.Close()
+		functionProvider = localProvider
+		logger.Warn("Using the local process provider: functions run as unisolated processes on this host")
+	default:
+		logger.Fatalf("Unknown PROVIDER %q: must be docker, swarm or local", cfg.Provider)
+	}
+
+	// Secrets runtime directory and encryption at rest
+	secretManager := functionProvider.GetSecretManager()
+	if err := secretManager.SetRuntimePath(cfg.SecretsRuntimePath); err != nil {
+		logger.Fatalf("Failed to configure secrets runtime path: %v", err)
+	}
+	secretManager.SetAutoCreate(cfg.SecretsAutoCreate)
+	if cfg.SecretsBackend != secrets.BackendFile {
+		backend, err := newSecretBackend(cfg, logger)
+		if err != nil {
+			logger.Fatalf("Failed to initialize %s secret backend: %v", cfg.SecretsBackend, err)
+		}
+		if err := secretManager.SetBackend(backend); err != nil {
+			logger.Fatalf("Failed to configure secret backend: %v", err)
+		}
+	}
+	masterKey, err := secrets.LoadMasterKey(cfg.SecretsMasterKey, cfg.SecretsMasterKeyFile)
 	if err != nil {
-		logger.Fatalf("Failed to initialize Docker provider: %v", err)
+		logger.Fatalf("Failed to load secrets master key: %v", err)
+	}
+	var keyring *secrets.Keyring
+	if masterKey != nil {
+		previousKey, err := secrets.LoadMasterKey("", cfg.SecretsPreviousMasterKeyFile)
+		if err != nil {
+			logger.Fatalf("Failed to load previous secrets master key: %v", err)
+		}
+		keyring, err = secrets.NewKeyring(masterKey, previousKey)
+		if err != nil {
+			logger.Fatalf("Failed to initialize secrets keyring: %v", err)
+		}
+	}
+	if keyring != nil && cfg.SecretsBackend != secrets.BackendFile {
+		logger.Warnf("SECRETS_MASTER_KEY is ignored by the %s secret backend and only encrypts registry credentials", cfg.SecretsBackend)
+	} else if keyring != nil {
+		if err := secretManager.EnableEncryption(keyring); err != nil {
+			logger.Fatalf("Failed to enable secrets encryption: %v", err)
+		}
+		if _, err := secretManager.MigrateSecrets(); err != nil {
+			logger.Fatalf("Failed to migrate secrets to current master key: %v", err)
+		}
+	} else if cfg.SecretsBackend == secrets.BackendFile {
+		logger.Warn("SECRETS_MASTER_KEY is not set; secrets are stored unencrypted")
+	}
+	if keyring != nil {
+		registryCredentials.EnableEncryption(keyring)
+		if migrated, err := registryCredentials.Migrate(); err != nil {
+			logger.Fatalf("Failed to migrate registry credentials to current master key: %v", err)
+		} else if migrated > 0 {
+			logger.Infof("Encrypted %d registry credentials with the current master key", migrated)
+		}
+	} else {
+		logger.Warn("SECRETS_MASTER_KEY is not set; registry credentials are stored unencrypted")
 	}
-	defer dockerProvider.Close()
 
 	// Initialize router
-	rt := router.NewRouter(dockerProvider, logger, cfg.ReadTimeout, cfg.WriteTimeout, cfg.ExecTimeout)
+	rt := router.NewRouter(functionProvider, logger, cfg.ReadTimeout, cfg.WriteTimeout, cfg.ExecTimeout)
+	rt.SetQueueDefaults(cfg.FunctionQueueSize, cfg.FunctionQueueTimeout)
+	if drainingProvider != nil {
+		// Replicas are drained through the router before they are stopped
+		drainingProvider.SetDrainer(rt)
+		drainingProvider.SetDrainGracePeriod(cfg.DrainGracePeriod)
+	}
 
 	// Initialize gateway
-	gw := gateway.NewGateway(st, dockerProvider, rt, logger, cfg.FunctionsNetwork)
+	gw := gateway.NewGateway(st, functionProvider, rt, logger, cfg.FunctionsNetwork)
 	authManager := auth.NewManager(cfg.AuthTokenTTL)
 	gw.SetAuth(authManager, cfg.AuthUser, cfg.AuthPassword)
 	gw.SetBuildTracker(gateway.NewBuildTracker(cfg.BuildHistoryLimit, cfg.BuildHistoryRetention))
 	gw.SetBuildOutputLimit(cfg.BuildOutputLimit)
+	gw.SetPipelineHistory(pipeline.NewHistory(cfg.PipelineHistoryLimit))
+	gw.SetSecurityPolicy(securityPolicy)
+	gw.SetRegistryCredentials(registryCredentials)
+	if dockerClient := functionProvider.DockerClient(); dockerClient != nil {
+		gw.SetVolumeManager(provider.NewVolumeManager(dockerClient))
+	}
+	imagePolicy, err := imagepolicy.NewPolicy(imagepolicy.Options{
+		AllowedRepositories: cfg.ImageAllowedRepositories,
+		RequireDigest:       cfg.ImageRequireDigest,
+		ResolveDigest:       cfg.ImageResolveDigest,
+		PublicKeyFiles:      cfg.ImageTrustPublicKeys,
+		InsecureRegistries:  cfg.ImageInsecureRegistries,
+	})
+	if err != nil {
+		logger.Fatalf("Failed to initialize image trust policy: %v", err)
+	}
+	imagePolicy.SetRegistryLogin(func(image string) (string, string) {
+		auth, err := registryCredentials.Lookup(image)
+		if err != nil || auth == nil {
+			return "", ""
+		}
+		return auth.Username, auth.Password
+	})
+	if imagePolicy.Enabled() {
+		gw.SetImagePolicy(imagePolicy)
+	}
 
 	// Network reconciliation
 	var reconciler *provider.NetworkReconciler
-	if cfg.ReconcileFunctionNetworks && dockerProvider.CanConnectGateway() {
+	if cfg.ReconcileFunctionNetworks && functionProvider.CanConnectGateway() {
 		listFunctionNetworks := func() ([]string, error) {
 			functions, err := st.ListFunctions()
 			if err != nil {
@@ -85,8 +249,8 @@ func main() {
 		}
 
 		reconciler = provider.NewNetworkReconciler(
-			dockerProvider.DockerClient(),
-			dockerProvider.GetGatewayID(),
+			functionProvider.DockerClient(),
+			functionProvider.GetGatewayID(),
 			logger,
 			cfg.ReconcileIntervalSeconds,
 			listFunctionNetworks,
@@ -105,10 +269,69 @@ func main() {
 		}
 	}
 
+	// Function state reconciliation
+	var stateReconciler *provider.StateReconciler
+	if cfg.ReconcileFunctions && dockerProvider != nil {
+		stateReconciler = provider.NewStateReconciler(dockerProvider, gw.DesiredFunctions, provider.StateReconcilerOptions{
+			Interval:      time.Duration(cfg.ReconcileIntervalSeconds) * time.Second,
+			GracePeriod:   cfg.ReconcileGracePeriod,
+			RemoveOrphans: cfg.ReconcileRemoveOrphans,
+		}, logger)
+		gw.SetStateReconciler(stateReconciler)
+
+		ctx := context.Background()
+		report, err := stateReconciler.Reconcile(ctx, false)
+		if err != nil {
+			logger.Errorf("Startup function reconciliation failed: %v", err)
+		} else if len(report.Actions) > 0 {
+			logger.Infof("Startup reconciliation: %d function repairs", len(report.Actions))
+		}
+		stateReconciler.StartPeriodic(ctx)
+	}
+
+	// Function log retention
+	var logCollector *logstore.Collector
+	var logStore *logstore.Store
+	if cfg.LogStoreEnabled {
+		retentionSize, err := provider.ParseMemoryQuantity(cfg.LogRetentionSize)
+		if err != nil {
+			logger.Fatalf("Invalid LOG_RETENTION_SIZE: %v", err)
+		}
+		logStore, err = logstore.Open(cfg.LogStorePath, logstore.Retention{MaxSize: retentionSize, MaxAge: cfg.LogRetentionAge}, logger)
+		if err != nil {
+			logger.Fatalf("Failed to open log store: %v", err)
+		}
+		gw.SetLogStore(logStore)
+		logCollector = logstore.NewCollector(logStore, functionProvider, gw.FunctionAnnotations, cfg.LogCollectInterval, logger)
+		logCollector.Start(context.Background())
+	}
+
+	// Replica resource usage stats, read from Docker. Swarm tasks are not
+	// covered: the stats API only reaches containers on the manager's node.
+	var statsSampler *stats.Sampler
+	if dockerProvider != nil {
+		statsSampler = stats.NewSampler(functionProvider, provider.NewStatsReader(dockerProvider.DockerClient()), gw.FunctionAnnotations, cfg.StatsInterval, cfg.StatsHistorySize, logger)
+		gw.SetStatsSampler(statsSampler)
+		if cfg.StatsInterval > 0 {
+			statsSampler.Start(context.Background())
+		}
+	}
+
+	// Garbage collection of images built by /system/builds
+	var imageCollector *builder.ImageCollector
+	if dockerClient := functionProvider.DockerClient(); dockerClient != nil {
+		imageCollector = builder.NewImageCollector(dockerClient, gw.FunctionImages, cfg.ImageGCKeepRevisions, cfg.ImageGCInterval, logger)
+		gw.SetImageCollector(imageCollector)
+		if cfg.ImageGCInterval > 0 {
+			imageCollector.Start(context.Background())
+		}
+	}
+
 	gw.SetConfigView(&gateway.ConfigView{
 		AuthEnabled:                  cfg.AuthEnabled,
 		RequireAuthForFunctions:      cfg.RequireAuthForFunctions,
 		CORSAllowedOrigins:           cfg.CORSAllowedOrigins,
+		Provider:                     cfg.Provider,
 		FunctionsNetwork:             cfg.FunctionsNetwork,
 		DefaultReplicas:              cfg.DefaultReplicas,
 		MaxReplicas:                  cfg.MaxReplicas,
@@ -121,6 +344,9 @@ func main() {
 		BuildHistoryLimit:            cfg.BuildHistoryLimit,
 		BuildHistoryRetentionSeconds: int(cfg.BuildHistoryRetention.Seconds()),
 		BuildOutputLimit:             cfg.BuildOutputLimit,
+		SecretsBackend:               cfg.SecretsBackend,
+		TLSEnabled:                   cfg.TLSCertFile != "",
+		TLSClientAuth:                cfg.TLSClientAuth,
 	})
 
 	// Setup HTTP router
@@ -138,9 +364,17 @@ func main() {
 	r.HandleFunc("/system/builds/inspect", gw.HandleInspectBuild).Methods("POST")
 	r.HandleFunc("/system/builds/stream", gw.HandleBuildStream).Methods("GET")
 	r.HandleFunc("/system/builds/{id}", gw.HandleGetBuild).Methods("GET")
+	r.HandleFunc("/system/images/gc", gw.HandleImageGCPlan).Methods("GET")
+	r.HandleFunc("/system/images/gc", gw.HandleImageGC).Methods("POST")
+	r.HandleFunc("/system/function/{name}", gw.HandleGetFunction).Methods("GET")
 	r.HandleFunc("/system/function/{name}/containers", gw.HandleFunctionContainers).Methods("GET")
+	r.HandleFunc("/system/function/{name}/events", gw.HandleFunctionEvents).Methods("GET")
+	r.HandleFunc("/system/function/{name}/stats", gw.HandleFunctionStats).Methods("GET")
 	r.HandleFunc("/system/scale-function/{name}", gw.HandleScaleFunction).Methods("POST")
 	r.HandleFunc("/system/logs", gw.HandleGetLogs).Methods("GET")
+	r.HandleFunc("/system/logs/search", gw.HandleSearchLogs).Methods("GET")
+	r.HandleFunc("/system/reconcile", gw.HandleReconcilePlan).Methods("GET")
+	r.HandleFunc("/system/reconcile", gw.HandleReconcile).Methods("POST")
 	r.HandleFunc("/system/function-async/{name}", gw.HandleInvokeFunctionAsync).Methods("POST", "GET", "PUT", "DELETE", "PATCH")
 	r.Handle("/system/metrics", promhttp.Handler()).Methods("GET")
 	r.HandleFunc("/system/config", gw.HandleConfig).Methods("GET")
@@ -154,20 +388,64 @@ func main() {
 	r.HandleFunc("/system/secrets", gw.HandleUpdateSecret).Methods("PUT")
 	r.HandleFunc("/system/secrets", gw.HandleDeleteSecret).Methods("DELETE")
 	r.HandleFunc("/system/secrets", gw.HandleListSecrets).Methods("GET")
-	r.HandleFunc("/system/secrets/{name}", gw.HandleGetSecret).Methods("GET")
+	r.HandleFunc("/system/secrets/{name:.+}", gw.HandleGetSecret).Methods("GET")
+	r.HandleFunc("/system/registries", gw.HandleCreateRegistry).Methods("POST")
+	r.HandleFunc("/system/registries", gw.HandleUpdateRegistry).Methods("PUT")
+	r.HandleFunc("/system/registries", gw.HandleDeleteRegistry).Methods("DELETE")
+	r.HandleFunc("/system/registries", gw.HandleListRegistries).Methods("GET")
+	r.HandleFunc("/system/volumes", gw.HandleCreateVolume).Methods("POST")
+	r.HandleFunc("/system/volumes", gw.HandleDeleteVolume).Methods("DELETE")
+	r.HandleFunc("/system/volumes", gw.HandleListVolumes).Methods("GET")
+	r.HandleFunc("/system/pipelines", gw.HandleCreatePipeline).Methods("POST")
+	r.HandleFunc("/system/pipelines", gw.HandleUpdatePipeline).Methods("PUT")
+	r.HandleFunc("/system/pipelines", gw.HandleDeletePipeline).Methods("DELETE")
+	r.HandleFunc("/system/pipelines", gw.HandleListPipelines).Methods("GET")
+	r.HandleFunc("/system/pipelines/{name}", gw.HandleGetPipeline).Methods("GET")
+	r.HandleFunc("/system/pipelines/{name}/runs", gw.HandleListPipelineRuns).Methods("GET")
+	r.HandleFunc("/system/pipelines/{name}/runs/{id}", gw.HandleGetPipelineRun).Methods("GET")
 
 	// Function invocation
 	r.HandleFunc("/function/{name}", gw.HandleInvokeFunction).Methods("POST", "GET", "PUT", "DELETE", "PATCH")
 	r.HandleFunc("/async-function/{name}", gw.HandleInvokeFunctionAsync).Methods("POST", "GET", "PUT", "DELETE", "PATCH")
+	r.HandleFunc("/pipeline/{name}", gw.HandleInvokePipeline).Methods("POST", "GET", "PUT", "DELETE", "PATCH")
 
 	// Health check
 	r.HandleFunc("/healthz", gw.HandleHealthz).Methods("GET")
 
 	// Apply middleware
+	clientIPResolver, err := clientip.NewResolver(cfg.TrustedProxies)
+	if err != nil {
+		logger.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
 	corsMiddleware := middleware.NewCORSMiddleware(cfg.CORSAllowedOrigins)
 	loggingMiddleware := middleware.NewLoggingMiddleware(logger)
 	authRateLimiter := middleware.NewAuthRateLimiter(cfg.AuthRateLimit, cfg.AuthRateWindow)
 	authMiddleware := middleware.NewBasicAuthMiddleware(cfg.AuthUser, cfg.AuthPassword, cfg.AuthEnabled, cfg.RequireAuthForFunctions, authRateLimiter, authManager, logger)
+	certIdentities, err := tlsconfig.ParseIdentityMap(cfg.TLSClientIdentities)
+	if err != nil {
+		logger.Fatalf("Invalid TLS_CLIENT_IDENTITIES: %v", err)
+	}
+	for name, identity := range certIdentities {
+		if identity != cfg.AuthUser {
+			logger.Warnf("TLS_CLIENT_IDENTITIES maps %s to %s, which is not AUTH_USER; its requests will be refused", name, identity)
+		}
+	}
+	authMiddleware.SetClientCertIdentities(certIdentities)
+
+	// IP access rules (reloadable from IP_ACCESS_RULES_FILE)
+	accessRules := middleware.DefaultAccessRules(cfg.RequireAuthForFunctions)
+	if len(cfg.SystemAllowedCIDRs) > 0 {
+		accessRules = append(accessRules, middleware.AccessRule{Path: "/system/", Allow: cfg.SystemAllowedCIDRs})
+	}
+	accessPolicy, err := middleware.NewAccessPolicy(accessRules, cfg.AccessRulesFile, logger)
+	if err != nil {
+		logger.Fatalf("Failed to load IP access rules: %v", err)
+	}
+	authMiddleware.SetAccessPolicy(accessPolicy)
+	gw.SetRouteAccess(accessPolicy)
+	accessCtx, stopAccessWatch := context.WithCancel(context.Background())
+	defer stopAccessWatch()
+	go accessPolicy.Watch(accessCtx, cfg.AccessRulesReloadPeriod)
 
 	// Create separate router for UI (no auth)
 	uiRouter := mux.NewRouter()
@@ -188,7 +466,8 @@ func main() {
 	})
 	mainRouter.PathPrefix("/").Handler(corsMiddleware.Middleware(loggingMiddleware.Middleware(authMiddleware.Middleware(r))))
 
-	handler := mainRouter
+	// Resolve the client IP before any middleware that logs or limits by it
+	handler := clientIPResolver.Middleware(accessPolicy.Middleware(mainRouter))
 
 	// Setup HTTP server
 	srv := &http.Server{
@@ -199,6 +478,29 @@ func main() {
 		IdleTimeout:  120 * time.Second,
 	}
 
+	// Configure TLS with certificate hot-reload
+	tlsCtx, stopTLSWatch := context.WithCancel(context.Background())
+	defer stopTLSWatch()
+
+	var tlsReloader *tlsconfig.Reloader
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		tlsReloader, err = tlsconfig.NewReloader(tlsconfig.Options{
+			CertFile:     cfg.TLSCertFile,
+			KeyFile:      cfg.TLSKeyFile,
+			ClientCAFile: cfg.TLSClientCAFile,
+			ClientAuth:   cfg.TLSClientAuth,
+			MinVersion:   cfg.TLSMinVersion,
+			CipherSuites: cfg.TLSCipherSuites,
+		}, logger)
+		if err != nil {
+			logger.Fatalf("Failed to configure TLS: %v", err)
+		}
+		srv.TLSConfig = tlsReloader.TLSConfig()
+		go tlsReloader.Watch(tlsCtx, cfg.TLSReloadInterval)
+	} else if cfg.MetricsTLS || cfg.TLSRedirectPort != "" {
+		logger.Fatal("METRICS_TLS_ENABLED and TLS_REDIRECT_HTTP_PORT require TLS_CERT_FILE and TLS_KEY_FILE")
+	}
+
 	// Start metrics server if enabled
 	if cfg.MetricsEnabled {
 		metricsRouter := http.NewServeMux()
@@ -208,19 +510,38 @@ func main() {
 			Addr:    fmt.Sprintf(":%s", cfg.MetricsPort),
 			Handler: metricsRouter,
 		}
+		if cfg.MetricsTLS {
+			metricsSrv.TLSConfig = tlsReloader.TLSConfig()
+		}
 
 		go func() {
-			logger.Infof("Metrics server listening on :%s", cfg.MetricsPort)
-			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logger.Infof("Metrics server listening on :%s (tls=%v)", cfg.MetricsPort, cfg.MetricsTLS)
+			if err := serve(metricsSrv); err != nil && err != http.ErrServerClosed {
 				logger.Errorf("Metrics server error: %v", err)
 			}
 		}()
 	}
 
+	// Redirect plain HTTP to the HTTPS listener
+	var redirectSrv *http.Server
+	if cfg.TLSRedirectPort != "" {
+		redirectSrv = &http.Server{
+			Addr:        fmt.Sprintf(":%s", cfg.TLSRedirectPort),
+			Handler:     tlsconfig.RedirectHandler(cfg.GatewayPort),
+			ReadTimeout: cfg.ReadTimeout,
+		}
+		go func() {
+			logger.Infof("HTTP redirect listening on :%s", cfg.TLSRedirectPort)
+			if err := redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.Errorf("HTTP redirect server error: %v", err)
+			}
+		}()
+	}
+
 	// Start server in goroutine
 	go func() {
-		logger.Infof("Gateway server listening on :%s", cfg.GatewayPort)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		logger.Infof("Gateway server listening on :%s (tls=%v)", cfg.GatewayPort, srv.TLSConfig != nil)
+		if err := serve(srv); err != nil && err != http.ErrServerClosed {
 			logger.Fatalf("Server error: %v", err)
 		}
 	}()
@@ -232,10 +553,25 @@ func main() {
 
 	logger.Info("Shutting down server...")
 
-	// Stop reconciler if running
+	// Stop reconcilers if running
+	if stateReconciler != nil {
+		stateReconciler.Stop()
+	}
 	if reconciler != nil {
 		reconciler.Stop()
 	}
+	if statsSampler != nil {
+		statsSampler.Stop()
+	}
+	if imageCollector != nil {
+		imageCollector.Stop()
+	}
+	if logCollector != nil {
+		logCollector.Stop()
+		if err := logStore.Close(); err != nil {
+			logger.Warnf("Failed to close log store: %v", err)
+		}
+	}
 
 	// Graceful shutdown
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
@@ -244,6 +580,40 @@ func main() {
 	if err := srv.Shutdown(shutdownCtx); err != nil {
 		logger.Errorf("Server shutdown error: %v", err)
 	}
+	if redirectSrv != nil {
+		redirectSrv.Shutdown(shutdownCtx)
+	}
 
 	logger.Info("Server stopped")
 }
+
+// serve starts a server over TLS when it has a TLS configuration
+func serve(srv *http.Server) error {
+	if srv.TLSConfig != nil {
+		return srv.ListenAndServeTLS("", "")
+	}
+	return srv.ListenAndServe()
+}
+
+// newSecretBackend builds the secret backend selected by SECRETS_BACKEND
+func newSecretBackend(cfg *config.Config, logger *logrus.Logger) (secrets.SecretBackend, error) {
+	switch cfg.SecretsBackend {
+	case secrets.BackendVault:
+		return secrets.NewVaultBackend(secrets.VaultConfig{
+			Address:      cfg.VaultAddress,
+			Token:        cfg.VaultToken,
+			RoleID:       cfg.VaultRoleID,
+			SecretID:     cfg.VaultSecretID,
+			AppRoleMount: cfg.VaultAppRoleMount,
+			Namespace:    cfg.VaultNamespace,
+			Mount:        cfg.VaultKVMount,
+			PathPrefix:   cfg.VaultPathPrefix,
+		}, logger)
+	case secrets.BackendEnv:
+		return secrets.NewEnvBackend(cfg.SecretsEnvPrefix), nil
+	case secrets.BackendDirectory:
+		return secrets.NewDirectoryBackend(cfg.SecretsDirectoryPath)
+	default:
+		return nil, fmt.Errorf("unknown secret backend %q", cfg.SecretsBackend)
+	}
+}
@@ -13,8 +13,15 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
-// BuildImage builds a Docker image from a context directory.
-func BuildImage(ctx context.Context, dockerClient *client.Client, contextDir, dockerfile, imageName string, logger *logrus.Logger, output io.Writer) error {
+const (
+	// LabelBuild marks images built by the gateway
+	LabelBuild = "com.docker-faas.build"
+	// LabelBuildFunction records the function an image was built for
+	LabelBuildFunction = "com.docker-faas.build.function"
+)
+
+// BuildImage builds a Docker image for a function from a context directory.
+func BuildImage(ctx context.Context, dockerClient *client.Client, contextDir, dockerfile, imageName, functionName string, logger *logrus.Logger, output io.Writer) error {
 	tar, err := archive.TarWithOptions(contextDir, &archive.TarOptions{})
 	if err != nil {
 		return fmt.Errorf("failed to create build context: %w", err)
@@ -25,6 +32,10 @@ func BuildImage(ctx context.Context, dockerClient *client.Client, contextDir, do
 		Tags:       []string{imageName},
 		Remove:     true,
 		Dockerfile: dockerfile,
+		Labels: map[string]string{
+			LabelBuild:         "true",
+			LabelBuildFunction: functionName,
+		},
 	}
 
 	response, err := dockerClient.ImageBuild(ctx, tar, options)
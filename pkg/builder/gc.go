@@ -0,0 +1,334 @@
+package builder
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// builtImageRepositoryPrefix is the repository every built image is tagged in
+	builtImageRepositoryPrefix = "docker-faas/"
+
+	// Reasons reported for kept images
+	ImageGCReasonDeployed      = "deployed"
+	ImageGCReasonInUse         = "in use"
+	ImageGCReasonRecent        = "recent"
+	ImageGCReasonTaggedOutside = "tagged outside " + builtImageRepositoryPrefix
+)
+
+// imageAPI is the subset of the Docker client used to collect built images
+type imageAPI interface {
+	ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error)
+	ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error)
+	ImagesPrune(ctx context.Context, pruneFilters filters.Args) (image.PruneReport, error)
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+}
+
+// ReferencedImagesFunc returns the images, by reference or digest, that
+// deployed functions use
+type ReferencedImagesFunc func() ([]string, error)
+
+// ImageCollector removes images built for functions that are no longer
+// needed. It keeps the images deployed functions reference, the newest
+// revisions of each function and any image a container uses.
+type ImageCollector struct {
+	api        imageAPI
+	referenced ReferencedImagesFunc
+	keep       int
+	interval   time.Duration
+	logger     *logrus.Logger
+
+	mu     sync.Mutex // one collection at a time
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewImageCollector creates a collector keeping the newest keep images of
+// each function. At least one is always kept, so an image that was just
+// built is not removed before it is deployed.
+func NewImageCollector(api imageAPI, referenced ReferencedImagesFunc, keep int, interval time.Duration, logger *logrus.Logger) *ImageCollector {
+	if keep < 1 {
+		keep = 1
+	}
+	return &ImageCollector{
+		api:        api,
+		referenced: referenced,
+		keep:       keep,
+		interval:   interval,
+		logger:     logger,
+	}
+}
+
+// Start collects every interval until ctx is cancelled or Stop is called
+func (c *ImageCollector) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		c.logger.Infof("Built image garbage collection started (interval: %s, keep: %d)", c.interval, c.keep)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if _, err := c.Collect(ctx, false); err != nil {
+					c.logger.Warnf("Built image garbage collection failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop ends periodic collection
+func (c *ImageCollector) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
+
+// Collect removes the built images that are no longer needed and prunes
+// untagged build images. With dryRun set it only reports what it would remove.
+// Failed removals are reported on their image.
+func (c *ImageCollector) Collect(ctx context.Context, dryRun bool) (*types.ImageGCReport, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	report := &types.ImageGCReport{
+		DryRun:        dryRun,
+		StartedAt:     time.Now(),
+		KeepRevisions: c.keep,
+		Removed:       []types.BuiltImage{},
+		Kept:          []types.BuiltImage{},
+	}
+
+	refs, err := c.referenced()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load functions: %w", err)
+	}
+	referenced := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		if ref != "" {
+			referenced[ref] = true
+		}
+	}
+	images, err := c.api.ImageList(ctx, image.ListOptions{SharedSize: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list images: %w", err)
+	}
+	containers, err := c.api.ContainerList(ctx, container.ListOptions{All: true})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	inUse := make(map[string]bool, len(containers))
+	for _, ctr := range containers {
+		inUse[ctr.ImageID] = true
+	}
+
+	remove, kept := planImageGC(images, referenced, inUse, c.keep)
+	report.Kept = kept
+	removed := 0
+	for _, img := range remove {
+		if !dryRun {
+			// Without Force, Docker refuses to remove an image that a
+			// container created since the listing uses
+			if _, err := c.api.ImageRemove(ctx, img.ID, image.RemoveOptions{PruneChildren: true}); err != nil {
+				img.Error = err.Error()
+				c.logger.Warnf("Failed to remove built image %s of %s: %v", shortImageID(img.ID), img.Function, err)
+				report.Removed = append(report.Removed, img)
+				continue
+			}
+			c.logger.Infof("Removed built image %s of %s (%s)", shortImageID(img.ID), img.Function, strings.Join(img.Tags, ", "))
+			removed++
+		}
+		report.ReclaimedBytes += img.Size
+		report.Removed = append(report.Removed, img)
+	}
+
+	// A build image loses its tag when another build of the same function is
+	// tagged within the same second; those and their layers are pruned. Docker
+	// skips untagged images that containers use.
+	dangling := filters.NewArgs(filters.Arg("dangling", "true"), filters.Arg("label", LabelBuild))
+	untagged, err := c.api.ImageList(ctx, image.ListOptions{Filters: dangling, SharedSize: true})
+	if err != nil {
+		c.logger.Warnf("Failed to list untagged build images: %v", err)
+	}
+	var prunable []image.Summary
+	for _, img := range untagged {
+		if !inUse[img.ID] {
+			prunable = append(prunable, img)
+		}
+	}
+	if len(prunable) > 0 {
+		if dryRun {
+			report.DanglingImages = len(prunable)
+			for _, img := range prunable {
+				report.ReclaimedBytes += uniqueSize(img)
+			}
+		} else if pruned, err := c.api.ImagesPrune(ctx, dangling); err != nil {
+			c.logger.Warnf("Failed to prune untagged build images: %v", err)
+		} else {
+			report.DanglingImages = len(prunable)
+			report.ReclaimedBytes += int64(pruned.SpaceReclaimed)
+		}
+	}
+
+	if !dryRun {
+		metrics.RecordImageGC(removed+report.DanglingImages, report.ReclaimedBytes)
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// planImageGC splits the built images into those to remove and those to keep.
+// Within each function's repository images are ranked newest first; the
+// first keep images are kept along with any that are deployed, used by a
+// container or tagged in another repository.
+func planImageGC(images []image.Summary, referenced, inUse map[string]bool, keep int) (remove, kept []types.BuiltImage) {
+	byRepository := make(map[string][]image.Summary)
+	for _, img := range images {
+		if repository, ok := builtImageRepository(img); ok {
+			byRepository[repository] = append(byRepository[repository], img)
+		}
+	}
+
+	repositories := make([]string, 0, len(byRepository))
+	for repository := range byRepository {
+		repositories = append(repositories, repository)
+	}
+	sort.Strings(repositories)
+
+	kept = []types.BuiltImage{}
+	for _, repository := range repositories {
+		revisions := byRepository[repository]
+		sort.Slice(revisions, func(i, j int) bool {
+			if revisions[i].Created != revisions[j].Created {
+				return revisions[i].Created > revisions[j].Created
+			}
+			return revisions[i].ID < revisions[j].ID
+		})
+
+		for i, img := range revisions {
+			built := types.BuiltImage{
+				ID:       img.ID,
+				Function: img.Labels[LabelBuildFunction],
+				Tags:     img.RepoTags,
+				Created:  time.Unix(img.Created, 0).UTC(),
+				Size:     uniqueSize(img),
+			}
+			if built.Function == "" {
+				built.Function = strings.TrimPrefix(repository, builtImageRepositoryPrefix)
+			}
+
+			switch {
+			case isReferenced(img, referenced):
+				built.Reason = ImageGCReasonDeployed
+			case inUse[img.ID]:
+				built.Reason = ImageGCReasonInUse
+			case i < keep:
+				built.Reason = ImageGCReasonRecent
+			case taggedOutside(img):
+				built.Reason = ImageGCReasonTaggedOutside
+			default:
+				remove = append(remove, built)
+				continue
+			}
+			kept = append(kept, built)
+		}
+	}
+	return remove, kept
+}
+
+// builtImageRepository returns the repository of a built image: one labelled
+// by the builder or, for images built before the label was added, tagged the
+// way buildImageTag tags them
+func builtImageRepository(img image.Summary) (string, bool) {
+	labelled := img.Labels[LabelBuild] == "true"
+	for _, tag := range img.RepoTags {
+		repository, version, ok := splitTag(tag)
+		if !ok || !strings.HasPrefix(repository, builtImageRepositoryPrefix) {
+			continue
+		}
+		if labelled || isUnixTimestamp(version) {
+			return repository, true
+		}
+	}
+	return "", false
+}
+
+func isReferenced(img image.Summary, referenced map[string]bool) bool {
+	if referenced[img.ID] {
+		return true
+	}
+	for _, ref := range append(append([]string(nil), img.RepoTags...), img.RepoDigests...) {
+		if referenced[ref] {
+			return true
+		}
+	}
+	return false
+}
+
+// taggedOutside reports whether an image was also tagged by someone else, in
+// which case it is no longer the builder's to remove
+func taggedOutside(img image.Summary) bool {
+	for _, tag := range img.RepoTags {
+		if !strings.HasPrefix(tag, builtImageRepositoryPrefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitTag splits repository:tag, allowing for a registry port
+func splitTag(ref string) (string, string, bool) {
+	i := strings.LastIndex(ref, ":")
+	if i < 0 || strings.Contains(ref[i:], "/") {
+		return "", "", false
+	}
+	return ref[:i], ref[i+1:], true
+}
+
+func isUnixTimestamp(version string) bool {
+	if version == "" {
+		return false
+	}
+	for _, r := range version {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// uniqueSize is the space removing the image frees: the layers it does not
+// share with other images, when Docker computed the shared size
+func uniqueSize(img image.Summary) int64 {
+	if img.SharedSize >= 0 && img.SharedSize <= img.Size {
+		return img.Size - img.SharedSize
+	}
+	return img.Size
+}
+
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -0,0 +1,162 @@
+package builder
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/image"
+	"github.com/sirupsen/logrus"
+)
+
+type fakeImageAPI struct {
+	images     []image.Summary
+	dangling   []image.Summary
+	containers []container.Summary
+	failRemove map[string]bool
+	removed    []string
+	pruned     int
+}
+
+func (f *fakeImageAPI) ImageList(ctx context.Context, options image.ListOptions) ([]image.Summary, error) {
+	if options.Filters.Contains("dangling") {
+		return f.dangling, nil
+	}
+	return f.images, nil
+}
+
+func (f *fakeImageAPI) ImageRemove(ctx context.Context, imageID string, options image.RemoveOptions) ([]image.DeleteResponse, error) {
+	if f.failRemove[imageID] {
+		return nil, errors.New("conflict: unable to remove repository reference")
+	}
+	f.removed = append(f.removed, imageID)
+	return []image.DeleteResponse{{Deleted: imageID}}, nil
+}
+
+func (f *fakeImageAPI) ImagesPrune(ctx context.Context, pruneFilters filters.Args) (image.PruneReport, error) {
+	f.pruned++
+	return image.PruneReport{SpaceReclaimed: 500}, nil
+}
+
+func (f *fakeImageAPI) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	return f.containers, nil
+}
+
+func builtImage(id, tag string, created int64, labelled bool) image.Summary {
+	img := image.Summary{ID: id, RepoTags: []string{tag}, Created: created, Size: 1000, SharedSize: 400}
+	if labelled {
+		img.Labels = map[string]string{LabelBuild: "true", LabelBuildFunction: "api"}
+	}
+	return img
+}
+
+func newTestImageCollector(api *fakeImageAPI, keep int) *ImageCollector {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	referenced := func() ([]string, error) {
+		return []string{"docker-faas/api:2", ""}, nil
+	}
+	return NewImageCollector(api, referenced, keep, time.Hour, logger)
+}
+
+func TestImageCollector_Collect(t *testing.T) {
+	outside := builtImage("api-0", "docker-faas/api:0", 0, true)
+	outside.RepoTags = append(outside.RepoTags, "acme/api:prod")
+	api := &fakeImageAPI{
+		images: []image.Summary{
+			outside,
+			builtImage("api-1", "docker-faas/api:1", 1, true),
+			builtImage("api-2", "docker-faas/api:2", 2, true),
+			builtImage("api-3", "docker-faas/api:3", 3, true),
+			builtImage("api-4", "docker-faas/api:4", 4, true),
+			builtImage("api-5", "docker-faas/api:5", 5, true),
+			builtImage("old-1", "docker-faas/old:1600000000", 1, false),
+			builtImage("old-2", "docker-faas/old:1600000100", 2, false),
+			builtImage("web", "docker-faas/web:latest", 1, false),
+			builtImage("redis", "redis:7", 1, false),
+		},
+		dangling: []image.Summary{
+			{ID: "untagged-1", Size: 300, SharedSize: -1},
+			{ID: "untagged-2", Size: 300, SharedSize: -1},
+		},
+		containers: []container.Summary{{ImageID: "api-1"}, {ImageID: "untagged-2"}},
+	}
+	collector := newTestImageCollector(api, 2)
+	ctx := context.Background()
+
+	plan, err := collector.Collect(ctx, true)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if len(api.removed) != 0 || api.pruned != 0 {
+		t.Fatalf("expected a dry run to remove nothing, removed %v and pruned %d times", api.removed, api.pruned)
+	}
+
+	// Newest two of each function are recent; api-2 is deployed, api-1 is
+	// used by a container and api-0 is also tagged outside docker-faas/
+	reasons := map[string]string{}
+	for _, img := range plan.Kept {
+		reasons[img.ID] = img.Reason
+	}
+	want := map[string]string{
+		"api-5": ImageGCReasonRecent,
+		"api-4": ImageGCReasonRecent,
+		"api-2": ImageGCReasonDeployed,
+		"api-1": ImageGCReasonInUse,
+		"api-0": ImageGCReasonTaggedOutside,
+		"old-2": ImageGCReasonRecent,
+		"old-1": ImageGCReasonRecent,
+	}
+	if len(reasons) != len(want) {
+		t.Fatalf("expected kept images %v, got %v", want, reasons)
+	}
+	for id, reason := range want {
+		if reasons[id] != reason {
+			t.Fatalf("expected %s kept as %q, got %q", id, reason, reasons[id])
+		}
+	}
+	if len(plan.Removed) != 1 || plan.Removed[0].ID != "api-3" || plan.Removed[0].Function != "api" {
+		t.Fatalf("expected only api-3 to be removed, got %+v", plan.Removed)
+	}
+	// 600 unique bytes of api-3 plus the untagged image no container uses
+	if plan.DanglingImages != 1 || plan.ReclaimedBytes != 900 {
+		t.Fatalf("unexpected dangling images or reclaimed space: %+v", plan)
+	}
+
+	report, err := collector.Collect(ctx, false)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(api.removed) != 1 || api.removed[0] != "api-3" || api.pruned != 1 {
+		t.Fatalf("expected api-3 removed and untagged images pruned, removed %v and pruned %d times", api.removed, api.pruned)
+	}
+	if report.ReclaimedBytes != 1100 || report.DryRun {
+		t.Fatalf("expected removed and pruned space reported, got %+v", report)
+	}
+}
+
+func TestImageCollector_RemoveFailure(t *testing.T) {
+	api := &fakeImageAPI{
+		images: []image.Summary{
+			builtImage("api-1", "docker-faas/api:1", 1, true),
+			builtImage("api-3", "docker-faas/api:3", 3, true),
+		},
+		failRemove: map[string]bool{"api-1": true},
+	}
+
+	// A keep below one still keeps the newest image
+	report, err := newTestImageCollector(api, 0).Collect(context.Background(), false)
+	if err != nil {
+		t.Fatalf("collect: %v", err)
+	}
+	if len(report.Kept) != 1 || report.Kept[0].ID != "api-3" || report.KeepRevisions != 1 {
+		t.Fatalf("expected the newest image kept, got %+v", report.Kept)
+	}
+	if len(report.Removed) != 1 || report.Removed[0].Error == "" || report.ReclaimedBytes != 0 {
+		t.Fatalf("expected the failed removal reported without reclaimed space, got %+v", report)
+	}
+}
@@ -17,11 +17,14 @@ type Manifest struct {
 	Dependencies           []string                 `yaml:"dependencies"`
 	Env                    map[string]string        `yaml:"env"`
 	Labels                 map[string]string        `yaml:"labels"`
+	Annotations            map[string]string        `yaml:"annotations"`
 	Secrets                []string                 `yaml:"secrets"`
 	Limits                 *types.FunctionLimits    `yaml:"limits"`
 	Requests               *types.FunctionResources `yaml:"requests"`
 	ReadOnlyRootFilesystem bool                     `yaml:"readOnlyRootFilesystem"`
 	Debug                  bool                     `yaml:"debug"`
+	Security               *types.FunctionSecurity  `yaml:"security"`
+	Volumes                []types.FunctionVolume   `yaml:"volumes"`
 	Network                string                   `yaml:"network"`
 	Build                  []string                 `yaml:"build"`
 }
@@ -0,0 +1,266 @@
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver derives the real client IP of a request, honouring forwarding
+// headers only when they were added by a trusted proxy
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+type details struct {
+	clientIP string
+	peer     string
+	trusted  bool
+}
+
+type contextKey struct{}
+
+// NewResolver parses a list of trusted proxy CIDRs. Plain IPs are accepted as
+// single-address ranges.
+func NewResolver(cidrs []string) (*Resolver, error) {
+	trusted, err := ParseCIDRs(cidrs)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{trusted: trusted}, nil
+}
+
+// ParseCIDRs parses CIDR ranges and plain IP addresses
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	networks := make([]*net.IPNet, 0, len(values))
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address or CIDR %q", value)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid IP address or CIDR %q", value)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// Contains reports whether ip falls within any of the networks
+func Contains(networks []*net.IPNet, ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(parsed) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rules is a compiled allow/deny list. Deny entries win; when allow entries
+// exist, only matching addresses are permitted.
+type Rules struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// NewRules parses allow and deny CIDR lists
+func NewRules(allow, deny []string) (Rules, error) {
+	allowNets, err := ParseCIDRs(allow)
+	if err != nil {
+		return Rules{}, err
+	}
+	denyNets, err := ParseCIDRs(deny)
+	if err != nil {
+		return Rules{}, err
+	}
+	return Rules{allow: allowNets, deny: denyNets}, nil
+}
+
+// Empty reports whether the rules restrict nothing
+func (r Rules) Empty() bool {
+	return len(r.allow) == 0 && len(r.deny) == 0
+}
+
+// Allowed reports whether ip may pass the rules
+func (r Rules) Allowed(ip string) bool {
+	if Contains(r.deny, ip) {
+		return false
+	}
+	if len(r.allow) > 0 {
+		return Contains(r.allow, ip)
+	}
+	return true
+}
+
+// Middleware resolves the client IP once and stores it in the request context
+func (res *Resolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, res.resolve(r))))
+	})
+}
+
+func (res *Resolver) resolve(r *http.Request) details {
+	peer := remoteHost(r.RemoteAddr)
+	d := details{clientIP: peer, peer: peer}
+	if res == nil || !Contains(res.trusted, peer) {
+		return d
+	}
+	d.trusted = true
+
+	// Walk the chain from the nearest hop, stopping at the first address
+	// that is not one of our proxies
+	chain := forwardedFor(r.Header)
+	for i := len(chain) - 1; i >= 0; i-- {
+		if !Contains(res.trusted, d.clientIP) {
+			break
+		}
+		hop := parseHop(chain[i])
+		if hop == "" {
+			break
+		}
+		d.clientIP = hop
+	}
+	return d
+}
+
+// FromRequest returns the client IP resolved by the middleware, falling back
+// to the connection's remote address
+func FromRequest(r *http.Request) string {
+	if d, ok := r.Context().Value(contextKey{}).(details); ok {
+		return d.clientIP
+	}
+	return remoteHost(r.RemoteAddr)
+}
+
+// ForwardHeaders adds this hop to the forwarding headers in dst, which were
+// copied from r. Headers supplied by untrusted peers are replaced rather
+// than extended so callers cannot forge the chain.
+func ForwardHeaders(dst http.Header, r *http.Request) {
+	d, ok := r.Context().Value(contextKey{}).(details)
+	if !ok {
+		peer := remoteHost(r.RemoteAddr)
+		d = details{clientIP: peer, peer: peer}
+	}
+	if !d.trusted {
+		for _, header := range []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto", "X-Real-Ip"} {
+			dst.Del(header)
+		}
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+
+	if d.peer != "" {
+		chain := strings.Join(dst.Values("X-Forwarded-For"), ", ")
+		if chain != "" {
+			chain += ", "
+		}
+		dst.Set("X-Forwarded-For", chain+d.peer)
+	}
+	if dst.Get("X-Forwarded-Host") == "" && r.Host != "" {
+		dst.Set("X-Forwarded-Host", r.Host)
+	}
+	if dst.Get("X-Forwarded-Proto") == "" {
+		dst.Set("X-Forwarded-Proto", proto)
+	}
+	if d.clientIP != "" {
+		dst.Set("X-Real-Ip", d.clientIP)
+	}
+
+	element := make([]string, 0, 3)
+	if d.peer != "" {
+		element = append(element, "for="+forwardedNode(d.peer))
+	}
+	if r.Host != "" {
+		element = append(element, "host="+quoteForwarded(r.Host))
+	}
+	element = append(element, "proto="+proto)
+	forwarded := strings.Join(dst.Values("Forwarded"), ", ")
+	if forwarded != "" {
+		forwarded += ", "
+	}
+	dst.Set("Forwarded", forwarded+strings.Join(element, ";"))
+}
+
+// forwardedFor returns the hop chain from the RFC 7239 Forwarded header,
+// or from X-Forwarded-For when Forwarded is absent
+func forwardedFor(header http.Header) []string {
+	if values := header.Values("Forwarded"); len(values) > 0 {
+		var chain []string
+		for _, element := range strings.Split(strings.Join(values, ","), ",") {
+			node := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					node = value
+				}
+			}
+			chain = append(chain, node)
+		}
+		return chain
+	}
+
+	var chain []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		chain = append(chain, strings.Split(value, ",")...)
+	}
+	return chain
+}
+
+// parseHop extracts an IP from a forwarding entry such as 203.0.113.7,
+// "[2001:db8::1]:4711" or 198.51.100.2:8080. Obfuscated or unknown
+// identifiers return an empty string.
+func parseHop(value string) string {
+	value = strings.Trim(strings.TrimSpace(value), `"`)
+	if host, _, err := net.SplitHostPort(value); err == nil {
+		value = host
+	}
+	ip := net.ParseIP(strings.Trim(value, "[]"))
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	return ip
+}
+
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, `:[]"; ,=`) {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+	return value
+}
+
+func remoteHost(remoteAddr string) string {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err == nil && host != "" {
+		return host
+	}
+	return remoteAddr
+}
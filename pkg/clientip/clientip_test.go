@@ -0,0 +1,100 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func resolveThrough(t *testing.T, res *Resolver, r *http.Request) *http.Request {
+	t.Helper()
+	var resolved *http.Request
+	res.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		resolved = r
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	return resolved
+}
+
+func TestResolver_ClientIP(t *testing.T) {
+	res, err := NewResolver([]string{"10.0.0.0/8", "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer cannot spoof", "203.0.113.7:5000", map[string]string{"X-Forwarded-For": "1.2.3.4"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.5:5000", map[string]string{"X-Forwarded-For": "198.51.100.9"}, "198.51.100.9"},
+		{"spoofed entry before real client", "10.0.0.5:5000", map[string]string{"X-Forwarded-For": "1.2.3.4, 198.51.100.9, 10.0.0.6"}, "198.51.100.9"},
+		{"all hops trusted", "10.0.0.5:5000", map[string]string{"X-Forwarded-For": "10.0.0.7, 192.0.2.1"}, "10.0.0.7"},
+		{"rfc 7239 forwarded", "10.0.0.5:5000", map[string]string{"Forwarded": `for="[2001:db8::1]:4711";proto=https, for=10.0.0.6`}, "2001:db8::1"},
+		{"obfuscated node stops the walk", "10.0.0.5:5000", map[string]string{"Forwarded": "for=_hidden, for=10.0.0.6"}, "10.0.0.6"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tc.remoteAddr
+			for key, value := range tc.headers {
+				req.Header.Set(key, value)
+			}
+			if got := FromRequest(resolveThrough(t, res, req)); got != tc.want {
+				t.Fatalf("expected client IP %s, got %s", tc.want, got)
+			}
+		})
+	}
+
+	if _, err := NewResolver([]string{"not-a-cidr"}); err == nil {
+		t.Fatalf("expected error for invalid CIDR")
+	}
+}
+
+func TestForwardHeaders(t *testing.T) {
+	res, err := NewResolver([]string{"10.0.0.0/8"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	trusted := httptest.NewRequest(http.MethodGet, "/", nil)
+	trusted.RemoteAddr = "10.0.0.5:5000"
+	trusted.Host = "gateway.example.com"
+	trusted.Header.Set("X-Forwarded-For", "198.51.100.9")
+	trusted.Header.Set("X-Forwarded-Proto", "https")
+	trusted.Header.Set("Forwarded", "for=198.51.100.9;proto=https")
+	trusted = resolveThrough(t, res, trusted)
+
+	out := trusted.Header.Clone()
+	ForwardHeaders(out, trusted)
+	if got := out.Get("X-Forwarded-For"); got != "198.51.100.9, 10.0.0.5" {
+		t.Fatalf("expected chain to be appended, got %q", got)
+	}
+	if got := out.Get("X-Forwarded-Proto"); got != "https" {
+		t.Fatalf("expected proxy proto to be kept, got %q", got)
+	}
+	if got := out.Get("Forwarded"); got != "for=198.51.100.9;proto=https, for=10.0.0.5;host=gateway.example.com;proto=http" {
+		t.Fatalf("unexpected Forwarded header %q", got)
+	}
+	if got := out.Get("X-Real-Ip"); got != "198.51.100.9" {
+		t.Fatalf("expected X-Real-Ip to carry the client, got %q", got)
+	}
+
+	untrusted := httptest.NewRequest(http.MethodGet, "/", nil)
+	untrusted.RemoteAddr = "[2001:db8::7]:5000"
+	untrusted.Host = "gateway.example.com"
+	untrusted.Header.Set("X-Forwarded-For", "1.2.3.4")
+	untrusted.Header.Set("Forwarded", "for=1.2.3.4")
+	untrusted = resolveThrough(t, res, untrusted)
+
+	out = untrusted.Header.Clone()
+	ForwardHeaders(out, untrusted)
+	if got := out.Get("X-Forwarded-For"); got != "2001:db8::7" {
+		t.Fatalf("expected forged chain to be replaced, got %q", got)
+	}
+	if got := out.Get("Forwarded"); got != `for="[2001:db8::7]";host=gateway.example.com;proto=http` {
+		t.Fatalf("unexpected Forwarded header %q", got)
+	}
+}
@@ -15,11 +15,79 @@ type Config struct {
 	WriteTimeout       time.Duration
 	ExecTimeout        time.Duration
 	CORSAllowedOrigins []string
+	TrustedProxies     []string
+
+	// IP access control
+	SystemAllowedCIDRs      []string
+	AccessRulesFile         string
+	AccessRulesReloadPeriod time.Duration
+
+	// TLS
+	TLSCertFile         string
+	TLSKeyFile          string
+	TLSMinVersion       string
+	TLSCipherSuites     []string
+	TLSClientCAFile     string
+	TLSClientAuth       string
+	TLSClientIdentities []string
+	TLSReloadInterval   time.Duration
+	TLSRedirectPort     string
+
+	// Invocation queue for functions with a max-inflight limit
+	FunctionQueueSize    int
+	FunctionQueueTimeout time.Duration
+
+	// Function provider: docker, swarm or local
+	Provider string
 
 	// Docker settings
 	DockerHost       string
 	FunctionsNetwork string
 
+	// Docker event watcher for live container state
+	ContainerEventsEnabled bool
+	ContainerEventsHistory int
+
+	// Crash loop detection
+	CrashLoopThreshold  int
+	CrashLoopWindow     time.Duration
+	CrashLoopBackoff    time.Duration
+	CrashLoopMaxBackoff time.Duration
+	CrashLoopLogLines   int
+
+	// Draining of replicas before they are stopped
+	DrainGracePeriod time.Duration
+
+	// Swarm rolling updates
+	SwarmUpdateParallelism   int
+	SwarmUpdateDelay         time.Duration
+	SwarmUpdateMonitor       time.Duration
+	SwarmUpdateFailureAction string
+	SwarmUpdateOrder         string
+
+	// Local process provider
+	LocalWorkDir     string
+	LocalSecretsPath string
+	LocalLogLines    int
+
+	// Function security policy
+	SecurityAllowedCapabilities []string
+	SecurityAllowRoot           bool
+	SecurityAllowUnconfined     bool
+	SecurityAllowInlineSeccomp  bool
+	SecuritySeccompProfileDir   string
+	SecurityAppArmorProfiles    []string
+	SecurityDefaultPidsLimit    int
+	SecurityMaxPidsLimit        int
+	SecurityAllowedBindPaths    []string
+
+	// Image trust policy
+	ImageAllowedRepositories []string
+	ImageRequireDigest       bool
+	ImageResolveDigest       bool
+	ImageTrustPublicKeys     []string
+	ImageInsecureRegistries  []string
+
 	// Authentication
 	AuthEnabled             bool
 	AuthUser                string
@@ -35,10 +103,22 @@ type Config struct {
 	// Metrics
 	MetricsEnabled bool
 	MetricsPort    string
+	MetricsTLS     bool
 
 	// Logging
 	LogLevel string
 
+	// Function log retention
+	LogStoreEnabled    bool
+	LogStorePath       string
+	LogRetentionSize   string
+	LogRetentionAge    time.Duration
+	LogCollectInterval time.Duration
+
+	// Replica resource usage stats
+	StatsInterval    time.Duration
+	StatsHistorySize int
+
 	// Defaults
 	DefaultReplicas int
 	MaxReplicas     int
@@ -51,9 +131,41 @@ type Config struct {
 	BuildHistoryRetention time.Duration
 	BuildOutputLimit      int
 
+	// Built image garbage collection
+	ImageGCInterval      time.Duration
+	ImageGCKeepRevisions int
+
+	// Pipeline run history
+	PipelineHistoryLimit int
+
 	// Network reconciliation
 	ReconcileFunctionNetworks bool
 	ReconcileIntervalSeconds  int
+
+	// Function state reconciliation
+	ReconcileFunctions     bool
+	ReconcileRemoveOrphans bool
+	ReconcileGracePeriod   time.Duration
+
+	// Secrets encryption
+	SecretsMasterKey             string
+	SecretsMasterKeyFile         string
+	SecretsPreviousMasterKeyFile string
+	SecretsRuntimePath           string
+	SecretsAutoCreate            bool
+
+	// Secret backend
+	SecretsBackend       string
+	SecretsEnvPrefix     string
+	SecretsDirectoryPath string
+	VaultAddress         string
+	VaultToken           string
+	VaultRoleID          string
+	VaultSecretID        string
+	VaultAppRoleMount    string
+	VaultNamespace       string
+	VaultKVMount         string
+	VaultPathPrefix      string
 }
 
 // LoadConfig loads configuration from environment variables
@@ -66,32 +178,108 @@ func LoadConfig() *Config {
 	}
 
 	return &Config{
-		GatewayPort:             getEnv("GATEWAY_PORT", "8080"),
-		ReadTimeout:             getDurationEnv("READ_TIMEOUT", 60*time.Second),
-		WriteTimeout:            getDurationEnv("WRITE_TIMEOUT", 60*time.Second),
-		ExecTimeout:             getDurationEnv("EXEC_TIMEOUT", 60*time.Second),
-		CORSAllowedOrigins:      corsAllowedOrigins,
-		DockerHost:              getEnv("DOCKER_HOST", ""),
-		FunctionsNetwork:        getEnv("FUNCTIONS_NETWORK", "docker-faas-net"),
-		AuthEnabled:             authEnabled,
-		AuthUser:                getEnv("AUTH_USER", "admin"),
-		AuthPassword:            getEnv("AUTH_PASSWORD", "admin"),
-		RequireAuthForFunctions: getBoolEnv("REQUIRE_AUTH_FOR_FUNCTIONS", true),
-		AuthRateLimit:           getIntEnv("AUTH_RATE_LIMIT", 10),
-		AuthRateWindow:          getDurationEnv("AUTH_RATE_WINDOW", time.Minute),
-		AuthTokenTTL:            getDurationEnv("AUTH_TOKEN_TTL", 30*time.Minute),
-		StateDBPath:             getEnv("STATE_DB_PATH", "docker-faas.db"),
-		MetricsEnabled:          getBoolEnv("METRICS_ENABLED", true),
-		MetricsPort:             getEnv("METRICS_PORT", "9090"),
-		LogLevel:                logLevel,
-		DefaultReplicas:         getIntEnv("DEFAULT_REPLICAS", 1),
-		MaxReplicas:             getIntEnv("MAX_REPLICAS", 10),
-		DebugBindAddress:        getEnv("DEBUG_BIND_ADDRESS", "127.0.0.1"),
-		BuildHistoryLimit:         getIntEnv("BUILD_HISTORY_LIMIT", 100),
-		BuildHistoryRetention:     getDurationEnv("BUILD_HISTORY_RETENTION", 24*time.Hour),
-		BuildOutputLimit:          getIntEnv("BUILD_OUTPUT_LIMIT", 200*1024),
-		ReconcileFunctionNetworks: getBoolEnv("RECONCILE_FUNCTION_NETWORKS", true),
-		ReconcileIntervalSeconds:  getIntEnv("RECONCILE_INTERVAL_SECONDS", 60),
+		GatewayPort:                  getEnv("GATEWAY_PORT", "8080"),
+		ReadTimeout:                  getDurationEnv("READ_TIMEOUT", 60*time.Second),
+		WriteTimeout:                 getDurationEnv("WRITE_TIMEOUT", 60*time.Second),
+		ExecTimeout:                  getDurationEnv("EXEC_TIMEOUT", 60*time.Second),
+		CORSAllowedOrigins:           corsAllowedOrigins,
+		TrustedProxies:               getCSVEnv("TRUSTED_PROXIES"),
+		SystemAllowedCIDRs:           getCSVEnv("SYSTEM_ALLOWED_CIDRS"),
+		AccessRulesFile:              getEnv("IP_ACCESS_RULES_FILE", ""),
+		AccessRulesReloadPeriod:      getDurationEnv("IP_ACCESS_RELOAD_INTERVAL", 30*time.Second),
+		TLSCertFile:                  getEnv("TLS_CERT_FILE", ""),
+		TLSKeyFile:                   getEnv("TLS_KEY_FILE", ""),
+		TLSMinVersion:                getEnv("TLS_MIN_VERSION", "1.2"),
+		TLSCipherSuites:              getCSVEnv("TLS_CIPHER_SUITES"),
+		TLSClientCAFile:              getEnv("TLS_CLIENT_CA_FILE", ""),
+		TLSClientAuth:                getEnv("TLS_CLIENT_AUTH", ""),
+		TLSClientIdentities:          getCSVEnv("TLS_CLIENT_IDENTITIES"),
+		TLSReloadInterval:            getDurationEnv("TLS_RELOAD_INTERVAL", 30*time.Second),
+		TLSRedirectPort:              getEnv("TLS_REDIRECT_HTTP_PORT", ""),
+		FunctionQueueSize:            getIntEnv("FUNCTION_QUEUE_SIZE", 100),
+		FunctionQueueTimeout:         getDurationEnv("FUNCTION_QUEUE_TIMEOUT", 30*time.Second),
+		Provider:                     strings.ToLower(getEnv("PROVIDER", "docker")),
+		DockerHost:                   getEnv("DOCKER_HOST", ""),
+		FunctionsNetwork:             getEnv("FUNCTIONS_NETWORK", "docker-faas-net"),
+		ContainerEventsEnabled:       getBoolEnv("CONTAINER_EVENTS_ENABLED", true),
+		ContainerEventsHistory:       getIntEnv("CONTAINER_EVENTS_HISTORY", 100),
+		CrashLoopThreshold:           getIntEnv("CRASH_LOOP_THRESHOLD", 3),
+		CrashLoopWindow:              getDurationEnv("CRASH_LOOP_WINDOW", 5*time.Minute),
+		CrashLoopBackoff:             getDurationEnv("CRASH_LOOP_BACKOFF", 10*time.Second),
+		CrashLoopMaxBackoff:          getDurationEnv("CRASH_LOOP_MAX_BACKOFF", 5*time.Minute),
+		CrashLoopLogLines:            getIntEnv("CRASH_LOOP_LOG_LINES", 20),
+		DrainGracePeriod:             getDurationEnv("DRAIN_GRACE_PERIOD", 30*time.Second),
+		SwarmUpdateParallelism:       getIntEnv("SWARM_UPDATE_PARALLELISM", 1),
+		SwarmUpdateDelay:             getDurationEnv("SWARM_UPDATE_DELAY", 5*time.Second),
+		SwarmUpdateMonitor:           getDurationEnv("SWARM_UPDATE_MONITOR", 10*time.Second),
+		SwarmUpdateFailureAction:     getEnv("SWARM_UPDATE_FAILURE_ACTION", "rollback"),
+		SwarmUpdateOrder:             getEnv("SWARM_UPDATE_ORDER", "start-first"),
+		LocalWorkDir:                 getEnv("LOCAL_WORKDIR", ""),
+		LocalSecretsPath:             getEnv("LOCAL_SECRETS_PATH", ""),
+		LocalLogLines:                getIntEnv("LOCAL_LOG_LINES", 1000),
+		SecurityAllowedCapabilities:  getCSVEnvDefault("SECURITY_ALLOWED_CAPABILITIES", []string{"NET_BIND_SERVICE"}),
+		SecurityAllowRoot:            getBoolEnv("SECURITY_ALLOW_ROOT", false),
+		SecurityAllowUnconfined:      getBoolEnv("SECURITY_ALLOW_UNCONFINED", false),
+		SecurityAllowInlineSeccomp:   getBoolEnv("SECURITY_ALLOW_INLINE_SECCOMP", false),
+		SecuritySeccompProfileDir:    getEnv("SECURITY_SECCOMP_PROFILE_DIR", ""),
+		SecurityAppArmorProfiles:     getCSVEnv("SECURITY_APPARMOR_PROFILES"),
+		SecurityDefaultPidsLimit:     getIntEnv("SECURITY_DEFAULT_PIDS_LIMIT", 0),
+		SecurityMaxPidsLimit:         getIntEnv("SECURITY_MAX_PIDS_LIMIT", 0),
+		SecurityAllowedBindPaths:     getCSVEnv("SECURITY_ALLOWED_BIND_PATHS"),
+		ImageAllowedRepositories:     getCSVEnv("IMAGE_ALLOWED_REPOSITORIES"),
+		ImageRequireDigest:           getBoolEnv("IMAGE_REQUIRE_DIGEST", false),
+		ImageResolveDigest:           getBoolEnv("IMAGE_RESOLVE_DIGEST", false),
+		ImageTrustPublicKeys:         getCSVEnv("IMAGE_TRUST_PUBLIC_KEYS"),
+		ImageInsecureRegistries:      getCSVEnv("IMAGE_INSECURE_REGISTRIES"),
+		AuthEnabled:                  authEnabled,
+		AuthUser:                     getEnv("AUTH_USER", "admin"),
+		AuthPassword:                 getEnv("AUTH_PASSWORD", "admin"),
+		RequireAuthForFunctions:      getBoolEnv("REQUIRE_AUTH_FOR_FUNCTIONS", true),
+		AuthRateLimit:                getIntEnv("AUTH_RATE_LIMIT", 10),
+		AuthRateWindow:               getDurationEnv("AUTH_RATE_WINDOW", time.Minute),
+		AuthTokenTTL:                 getDurationEnv("AUTH_TOKEN_TTL", 30*time.Minute),
+		StateDBPath:                  getEnv("STATE_DB_PATH", "docker-faas.db"),
+		MetricsEnabled:               getBoolEnv("METRICS_ENABLED", true),
+		MetricsPort:                  getEnv("METRICS_PORT", "9090"),
+		MetricsTLS:                   getBoolEnv("METRICS_TLS_ENABLED", false),
+		LogLevel:                     logLevel,
+		LogStoreEnabled:              getBoolEnv("LOG_STORE_ENABLED", true),
+		LogStorePath:                 getEnv("LOG_STORE_PATH", "logs"),
+		LogRetentionSize:             getEnv("LOG_RETENTION_SIZE", "64Mi"),
+		LogRetentionAge:              getDurationEnv("LOG_RETENTION_AGE", 7*24*time.Hour),
+		LogCollectInterval:           getDurationEnv("LOG_COLLECT_INTERVAL", 5*time.Second),
+		StatsInterval:                getDurationEnv("STATS_INTERVAL", 15*time.Second),
+		StatsHistorySize:             getIntEnv("STATS_HISTORY_SIZE", 60),
+		DefaultReplicas:              getIntEnv("DEFAULT_REPLICAS", 1),
+		MaxReplicas:                  getIntEnv("MAX_REPLICAS", 10),
+		DebugBindAddress:             getEnv("DEBUG_BIND_ADDRESS", "127.0.0.1"),
+		BuildHistoryLimit:            getIntEnv("BUILD_HISTORY_LIMIT", 100),
+		BuildHistoryRetention:        getDurationEnv("BUILD_HISTORY_RETENTION", 24*time.Hour),
+		BuildOutputLimit:             getIntEnv("BUILD_OUTPUT_LIMIT", 200*1024),
+		ImageGCInterval:              getDurationEnv("IMAGE_GC_INTERVAL", 24*time.Hour),
+		ImageGCKeepRevisions:         getIntEnv("IMAGE_GC_KEEP_REVISIONS", 3),
+		PipelineHistoryLimit:         getIntEnv("PIPELINE_HISTORY_LIMIT", 100),
+		ReconcileFunctionNetworks:    getBoolEnv("RECONCILE_FUNCTION_NETWORKS", true),
+		ReconcileIntervalSeconds:     getIntEnv("RECONCILE_INTERVAL_SECONDS", 60),
+		ReconcileFunctions:           getBoolEnv("RECONCILE_FUNCTIONS", true),
+		ReconcileRemoveOrphans:       getBoolEnv("RECONCILE_REMOVE_ORPHANS", false),
+		ReconcileGracePeriod:         getDurationEnv("RECONCILE_GRACE_PERIOD", 30*time.Second),
+		SecretsMasterKey:             getEnv("SECRETS_MASTER_KEY", ""),
+		SecretsMasterKeyFile:         getEnv("SECRETS_MASTER_KEY_FILE", ""),
+		SecretsPreviousMasterKeyFile: getEnv("SECRETS_PREVIOUS_MASTER_KEY_FILE", ""),
+		SecretsRuntimePath:           getEnv("SECRETS_RUNTIME_PATH", "/run/docker-faas/secrets"),
+		SecretsAutoCreate:            getBoolEnv("SECRETS_AUTO_CREATE", false),
+		SecretsBackend:               strings.ToLower(getEnv("SECRETS_BACKEND", "file")),
+		SecretsEnvPrefix:             getEnv("SECRETS_ENV_PREFIX", "FAAS_SECRET_"),
+		SecretsDirectoryPath:         getEnv("SECRETS_DIRECTORY_PATH", "/run/secrets"),
+		VaultAddress:                 getEnv("VAULT_ADDR", ""),
+		VaultToken:                   getEnv("VAULT_TOKEN", ""),
+		VaultRoleID:                  getEnv("VAULT_ROLE_ID", ""),
+		VaultSecretID:                getEnv("VAULT_SECRET_ID", ""),
+		VaultAppRoleMount:            getEnv("VAULT_APPROLE_MOUNT", "approle"),
+		VaultNamespace:               getEnv("VAULT_NAMESPACE", ""),
+		VaultKVMount:                 getEnv("VAULT_KV_MOUNT", "secret"),
+		VaultPathPrefix:              getEnv("VAULT_PATH_PREFIX", ""),
 	}
 }
 
@@ -120,6 +308,13 @@ func getCSVEnv(key string) []string {
 	return values
 }
 
+func getCSVEnvDefault(key string, defaultValue []string) []string {
+	if _, ok := os.LookupEnv(key); ok {
+		return getCSVEnv(key)
+	}
+	return defaultValue
+}
+
 func getBoolEnv(key string, defaultValue bool) bool {
 	value := os.Getenv(key)
 	if value == "" {
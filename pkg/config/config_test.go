@@ -29,6 +29,7 @@ func TestLoadConfig(t *testing.T) {
 		assert.Equal(t, 10, cfg.MaxReplicas)
 		assert.Equal(t, true, cfg.ReconcileFunctionNetworks)
 		assert.Equal(t, 60, cfg.ReconcileIntervalSeconds)
+		assert.Equal(t, false, cfg.ReconcileRemoveOrphans)
 	})
 
 	t.Run("CustomValues", func(t *testing.T) {
@@ -5,10 +5,11 @@ import (
 	"context"
 	"io"
 	"net/http"
-	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/store"
 )
 
 // HandleInvokeFunctionAsync handles POST /async-function/{name} and fire-and-forget invocations.
@@ -22,7 +23,18 @@ func (g *Gateway) HandleInvokeFunctionAsync(w http.ResponseWriter, r *http.Reque
 	// Get function metadata
 	fn, err := g.store.GetFunction(functionName)
 	if err != nil {
-		http.Error(w, "Function not found", http.StatusNotFound)
+		// Callers the route rules reject get 403 whether or not the function exists
+		if g.enforceIPAccess(w, r, functionName, nil) {
+			http.Error(w, "Function not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	annotations := store.DecodeMap(fn.Annotations)
+	if !g.enforceIPAccess(w, r, functionName, annotations) {
+		return
+	}
+	if !g.enforceInvocationLimits(w, r, functionName, annotations) {
 		return
 	}
 
@@ -34,11 +46,10 @@ func (g *Gateway) HandleInvokeFunctionAsync(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	availableReplicas := 0
-	for _, c := range containers {
-		if strings.Contains(c.Status, "running") || strings.Contains(c.Status, "Up") {
-			availableReplicas++
-		}
+	availableReplicas, backoff := replicaAvailability(containers, time.Now())
+	if availableReplicas == 0 && backoff > 0 {
+		writeCrashLoopBackoff(w, functionName, backoff)
+		return
 	}
 
 	if availableReplicas == 0 {
@@ -78,8 +89,11 @@ func (g *Gateway) HandleInvokeFunctionAsync(w http.ResponseWriter, r *http.Reque
 	}
 	headers.Set("X-Call-Id", callID)
 
+	// Keep the request's values (such as the resolved client IP) but not its cancellation
+	routeCtx := g.concurrencyContext(context.WithoutCancel(r.Context()), fn)
+	remoteAddr, host, tlsState := r.RemoteAddr, r.Host, r.TLS
 	go func(method string, payload []byte, hdr http.Header) {
-		req, err := http.NewRequestWithContext(context.Background(), method, "/", bytes.NewReader(payload))
+		req, err := http.NewRequestWithContext(routeCtx, method, "/", bytes.NewReader(payload))
 		if err != nil {
 			g.logger.Errorf("Async invoke failed to create request for %s: %v", functionName, err)
 			return
@@ -89,8 +103,11 @@ func (g *Gateway) HandleInvokeFunctionAsync(w http.ResponseWriter, r *http.Reque
 				req.Header.Add(key, value)
 			}
 		}
+		req.RemoteAddr = remoteAddr
+		req.Host = host
+		req.TLS = tlsState
 
-		resp, err := g.router.RouteRequest(context.Background(), functionName, req)
+		resp, err := g.router.RouteRequest(routeCtx, functionName, req)
 		if err != nil {
 			g.logger.Errorf("Async invoke failed for %s: %v", functionName, err)
 			return
@@ -14,6 +14,7 @@ type ConfigView struct {
 	AuthEnabled                  bool     `json:"authEnabled"`
 	RequireAuthForFunctions      bool     `json:"requireAuthForFunctions"`
 	CORSAllowedOrigins           []string `json:"corsAllowedOrigins"`
+	Provider                     string   `json:"provider"`
 	FunctionsNetwork             string   `json:"functionsNetwork"`
 	DefaultReplicas              int      `json:"defaultReplicas"`
 	MaxReplicas                  int      `json:"maxReplicas"`
@@ -26,4 +27,7 @@ type ConfigView struct {
 	BuildHistoryLimit            int      `json:"buildHistoryLimit"`
 	BuildHistoryRetentionSeconds int      `json:"buildHistoryRetentionSeconds"`
 	BuildOutputLimit             int      `json:"buildOutputLimit"`
+	SecretsBackend               string   `json:"secretsBackend"`
+	TLSEnabled                   bool     `json:"tlsEnabled"`
+	TLSClientAuth                string   `json:"tlsClientAuth,omitempty"`
 }
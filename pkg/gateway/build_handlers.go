@@ -20,6 +20,7 @@ import (
 	"unicode/utf8"
 
 	"github.com/docker-faas/docker-faas/pkg/builder"
+	"github.com/docker-faas/docker-faas/pkg/imagepolicy"
 	"github.com/docker-faas/docker-faas/pkg/metrics"
 	"github.com/docker-faas/docker-faas/pkg/provider"
 	"github.com/docker-faas/docker-faas/pkg/store"
@@ -75,6 +76,11 @@ type buildResponse struct {
 func (g *Gateway) HandleBuildFunction(w http.ResponseWriter, r *http.Request) {
 	start := time.Now()
 
+	if g.provider.DockerClient() == nil {
+		http.Error(w, "Image builds require the Docker provider", http.StatusNotImplemented)
+		return
+	}
+
 	req, tempDir, cleanup, err := g.parseBuildRequest(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -82,6 +88,17 @@ func (g *Gateway) HandleBuildFunction(w http.ResponseWriter, r *http.Request) {
 	}
 	defer cleanup()
 
+	deploy := true
+	if req.Deploy != nil {
+		deploy = *req.Deploy
+	}
+	if deploy {
+		if err := g.checkBuiltImagePolicy(); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
 	buildEntry := BuildEntry{
 		Name:       req.Name,
 		SourceType: req.Source.Type,
@@ -169,7 +186,7 @@ func (g *Gateway) HandleBuildFunction(w http.ResponseWriter, r *http.Request) {
 
 	imageName := buildImageTag(name)
 	output := newLimitedBuffer(g.buildOutputLimit)
-	if err := builder.BuildImage(r.Context(), g.provider.DockerClient(), contextDir, dockerfile, imageName, g.logger, output); err != nil {
+	if err := builder.BuildImage(r.Context(), g.provider.DockerClient(), contextDir, dockerfile, imageName, name, g.logger, output); err != nil {
 		g.logger.Errorf("Build failed: %v", err)
 		if g.builds != nil {
 			durationMs := int64(time.Since(start).Milliseconds())
@@ -191,11 +208,6 @@ func (g *Gateway) HandleBuildFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deploy := true
-	if req.Deploy != nil {
-		deploy = *req.Deploy
-	}
-
 	updated := false
 	if deploy {
 		updated, err = g.deployBuiltImage(r.Context(), name, imageName, manifest)
@@ -534,7 +546,21 @@ func (g *Gateway) loadManifest(contextDir string, source buildSourceSpec) (*buil
 	return nil, nil
 }
 
+// checkBuiltImagePolicy rejects deploying built images while an image trust
+// policy is enabled. A built image exists only locally, so it has no
+// registry digest or signature the policy could check.
+func (g *Gateway) checkBuiltImagePolicy() error {
+	if g.imagePolicy != nil {
+		return fmt.Errorf("images built from source cannot be deployed while an image trust policy is enabled: %w", imagepolicy.ErrPolicyViolation)
+	}
+	return nil
+}
+
 func (g *Gateway) deployBuiltImage(ctx context.Context, name, image string, manifest *builder.Manifest) (bool, error) {
+	if err := g.checkBuiltImagePolicy(); err != nil {
+		return false, err
+	}
+
 	deployment := types.FunctionDeployment{
 		Service: name,
 		Image:   image,
@@ -545,11 +571,27 @@ func (g *Gateway) deployBuiltImage(ctx context.Context, name, image string, mani
 		deployment.EnvProcess = manifest.Command
 		deployment.EnvVars = manifest.Env
 		deployment.Labels = manifest.Labels
+		deployment.Annotations = manifest.Annotations
 		deployment.Secrets = manifest.Secrets
 		deployment.Limits = manifest.Limits
 		deployment.Requests = manifest.Requests
 		deployment.ReadOnlyRootFilesystem = manifest.ReadOnlyRootFilesystem
 		deployment.Debug = manifest.Debug
+		deployment.Security = manifest.Security
+		deployment.Volumes = manifest.Volumes
+	}
+
+	if err := validateInvocationSettings(&deployment); err != nil {
+		return false, err
+	}
+	if err := provider.ValidateResources(deployment.Limits, deployment.Requests); err != nil {
+		return false, fmt.Errorf("invalid resources: %w", err)
+	}
+	if _, err := g.validateSecurity(deployment.Security); err != nil {
+		return false, err
+	}
+	if _, err := g.validateVolumes(ctx, &deployment); err != nil {
+		return false, err
 	}
 
 	if deployment.Network == "" {
@@ -563,6 +605,9 @@ func (g *Gateway) deployBuiltImage(ctx context.Context, name, image string, mani
 		}
 
 		existing.Image = deployment.Image
+		existing.ImageDigest = ""
+		// Built images only exist locally
+		existing.PullPolicy = ""
 		existing.EnvProcess = deployment.EnvProcess
 		envVars, err := store.EncodeMap(deployment.EnvVars)
 		if err != nil {
@@ -572,17 +617,32 @@ func (g *Gateway) deployBuiltImage(ctx context.Context, name, image string, mani
 		if err != nil {
 			return true, fmt.Errorf("failed to encode labels: %w", err)
 		}
+		annotations, err := store.EncodeMap(deployment.Annotations)
+		if err != nil {
+			return true, fmt.Errorf("failed to encode annotations: %w", err)
+		}
 		secretsJSON, err := store.EncodeSlice(deployment.Secrets)
 		if err != nil {
 			return true, fmt.Errorf("failed to encode secrets: %w", err)
 		}
+		security, err := encodeSecurity(deployment.Security)
+		if err != nil {
+			return true, err
+		}
+		volumes, err := encodeVolumes(deployment.Volumes)
+		if err != nil {
+			return true, err
+		}
 
 		existing.EnvVars = envVars
 		existing.Labels = labels
+		existing.Annotations = annotations
 		existing.Secrets = secretsJSON
 		existing.Network = deployment.Network
 		existing.ReadOnly = deployment.ReadOnlyRootFilesystem
 		existing.Debug = deployment.Debug
+		existing.Security = security
+		existing.Volumes = volumes
 
 		if deployment.Limits != nil {
 			limitsJSON, err := json.Marshal(deployment.Limits)
@@ -620,22 +680,37 @@ func (g *Gateway) deployBuiltImage(ctx context.Context, name, image string, mani
 	if err != nil {
 		return false, fmt.Errorf("failed to encode labels: %w", err)
 	}
+	annotations, err := store.EncodeMap(deployment.Annotations)
+	if err != nil {
+		return false, fmt.Errorf("failed to encode annotations: %w", err)
+	}
 	secretsJSON, err := store.EncodeSlice(deployment.Secrets)
 	if err != nil {
 		return false, fmt.Errorf("failed to encode secrets: %w", err)
 	}
+	security, err := encodeSecurity(deployment.Security)
+	if err != nil {
+		return false, err
+	}
+	volumes, err := encodeVolumes(deployment.Volumes)
+	if err != nil {
+		return false, err
+	}
 
 	metadata := &types.FunctionMetadata{
-		Name:       deployment.Service,
-		Image:      deployment.Image,
-		EnvProcess: deployment.EnvProcess,
-		EnvVars:    envVars,
-		Labels:     labels,
-		Secrets:    secretsJSON,
-		Network:    deployment.Network,
-		Replicas:   replicas,
-		ReadOnly:   deployment.ReadOnlyRootFilesystem,
-		Debug:      deployment.Debug,
+		Name:        deployment.Service,
+		Image:       deployment.Image,
+		EnvProcess:  deployment.EnvProcess,
+		EnvVars:     envVars,
+		Labels:      labels,
+		Annotations: annotations,
+		Secrets:     secretsJSON,
+		Network:     deployment.Network,
+		Replicas:    replicas,
+		ReadOnly:    deployment.ReadOnlyRootFilesystem,
+		Debug:       deployment.Debug,
+		Security:    security,
+		Volumes:     volumes,
 	}
 
 	if deployment.Limits != nil {
@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/builder"
+	"github.com/docker-faas/docker-faas/pkg/imagepolicy"
+	"github.com/docker-faas/docker-faas/pkg/router"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestDeployBuiltImage_ValidatesManifestSettings(t *testing.T) {
+	invalid := []map[string]string{
+		{AnnotationRateLimitRPS: "fast"},
+		{AnnotationIPAllow: "10.0.0.0/33"},
+		{router.AnnotationMaxInflight: "-1"},
+	}
+	for _, annotations := range invalid {
+		fs := &fakeStore{functions: map[string]*types.FunctionMetadata{}}
+		fp := &fakeProvider{}
+		gw := newTestGateway(fs, fp, &fakeRouter{})
+
+		manifest := &builder.Manifest{Annotations: annotations}
+		if _, err := gw.deployBuiltImage(context.Background(), "hello", "docker-faas/hello:1", manifest); err == nil {
+			t.Fatalf("expected annotations %v to be rejected", annotations)
+		}
+		if fp.deployCalled || len(fs.functions) != 0 {
+			t.Fatalf("expected nothing deployed or stored for %v", annotations)
+		}
+	}
+}
+
+func TestDeployBuiltImage_RejectedByImagePolicy(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{}}
+	fp := &fakeProvider{}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+	gw.SetImagePolicy(fakeImagePolicy{})
+
+	_, err := gw.deployBuiltImage(context.Background(), "hello", "docker-faas/hello:1", nil)
+	if !errors.Is(err, imagepolicy.ErrPolicyViolation) {
+		t.Fatalf("expected a policy violation, got %v", err)
+	}
+	if fp.deployCalled || len(fs.functions) != 0 {
+		t.Fatalf("expected the built image not to be deployed")
+	}
+}
@@ -14,7 +14,9 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/pipeline"
 	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/registryauth"
 	"github.com/docker-faas/docker-faas/pkg/store"
 	"github.com/docker-faas/docker-faas/pkg/types"
 )
@@ -32,6 +34,17 @@ type Gateway struct {
 	authMgr          AuthManager
 	config           *ConfigView
 	buildOutputLimit int
+	limits           *InvocationLimiter
+	routeAccess      RouteAccess
+	securityPolicy   *provider.SecurityPolicy
+	imagePolicy      ImagePolicy
+	registries       *registryauth.Credentials
+	reconciler       StateReconciler
+	logStore         LogSearcher
+	volumes          VolumeManager
+	pipelineRuns     *pipeline.History
+	stats            StatsSampler
+	images           ImageCollector
 }
 
 // NewGateway creates a new gateway instance
@@ -44,6 +57,8 @@ func NewGateway(store Store, provider Provider, router Router, logger *logrus.Lo
 		network:          network,
 		builds:           NewBuildTracker(100, 0),
 		buildOutputLimit: 200 * 1024,
+		limits:           NewInvocationLimiter(),
+		pipelineRuns:     pipeline.NewHistory(100),
 	}
 }
 
@@ -64,6 +79,24 @@ func (g *Gateway) SetBuildTracker(tracker *BuildTracker) {
 	g.builds = tracker
 }
 
+// SetRouteAccess configures the route IP rules applied to function invocations
+// that have no IP annotations of their own.
+func (g *Gateway) SetRouteAccess(access RouteAccess) {
+	g.routeAccess = access
+}
+
+// SetSecurityPolicy configures which security options functions may request.
+func (g *Gateway) SetSecurityPolicy(policy *provider.SecurityPolicy) {
+	if policy != nil {
+		g.securityPolicy = policy
+	}
+}
+
+// SetImagePolicy configures the trust policy images must satisfy before deploy.
+func (g *Gateway) SetImagePolicy(policy ImagePolicy) {
+	g.imagePolicy = policy
+}
+
 // SetBuildOutputLimit configures the max build output bytes retained.
 func (g *Gateway) SetBuildOutputLimit(limit int) {
 	if limit > 0 {
@@ -96,62 +129,114 @@ func (g *Gateway) HandleListFunctions(w http.ResponseWriter, r *http.Request) {
 
 	statuses := make([]types.FunctionStatus, 0, len(functions))
 	for _, fn := range functions {
-		containers, err := g.provider.GetFunctionContainers(r.Context(), fn.Name)
+		status, err := g.functionStatus(r.Context(), fn, false)
 		if err != nil {
 			g.logger.Warnf("Failed to get containers for function %s: %v", fn.Name, err)
 			continue
 		}
+		statuses = append(statuses, *status)
+	}
 
-		availableReplicas := 0
-		for _, c := range containers {
-			if strings.Contains(c.Status, "running") || strings.Contains(c.Status, "Up") {
-				availableReplicas++
-			}
-		}
+	g.writeJSON(w, http.StatusOK, statuses)
+}
 
-		var limits *types.FunctionLimits
-		if fn.Limits != "" {
-			var parsed types.FunctionLimits
-			if err := json.Unmarshal([]byte(fn.Limits), &parsed); err == nil {
-				limits = &parsed
-			} else {
-				g.logger.Warnf("Failed to parse limits for %s: %v", fn.Name, err)
-			}
+// HandleGetFunction handles GET /system/function/{name}. Unlike the list, it
+// includes the log tail of a crash-looping replica.
+func (g *Gateway) HandleGetFunction(w http.ResponseWriter, r *http.Request) {
+	functionName := normalizeFunctionName(mux.Vars(r)["name"])
+	if err := validateFunctionName(functionName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fn, err := g.store.GetFunction(functionName)
+	if err != nil {
+		http.Error(w, "Function not found", http.StatusNotFound)
+		return
+	}
+	status, err := g.functionStatus(r.Context(), fn, true)
+	if err != nil {
+		g.logger.Errorf("Failed to get containers for function %s: %v", functionName, err)
+		http.Error(w, "Failed to get containers", http.StatusInternalServerError)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, status)
+}
+
+// functionStatus describes a deployed function and its replicas; includeLogs
+// adds the log tail of a crash-looping replica, which is read from the provider
+func (g *Gateway) functionStatus(ctx context.Context, fn *types.FunctionMetadata, includeLogs bool) (*types.FunctionStatus, error) {
+	containers, err := g.provider.GetFunctionContainers(ctx, fn.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	availableReplicas := 0
+	for _, c := range containers {
+		if strings.Contains(c.Status, "running") || strings.Contains(c.Status, "Up") {
+			availableReplicas++
 		}
+	}
 
-		var requests *types.FunctionResources
-		if fn.Requests != "" {
-			var parsed types.FunctionResources
-			if err := json.Unmarshal([]byte(fn.Requests), &parsed); err == nil {
-				requests = &parsed
-			} else {
-				g.logger.Warnf("Failed to parse requests for %s: %v", fn.Name, err)
-			}
+	var limits *types.FunctionLimits
+	if fn.Limits != "" {
+		var parsed types.FunctionLimits
+		if err := json.Unmarshal([]byte(fn.Limits), &parsed); err == nil {
+			limits = &parsed
+		} else {
+			g.logger.Warnf("Failed to parse limits for %s: %v", fn.Name, err)
 		}
+	}
 
-		status := types.FunctionStatus{
-			Name:                   fn.Name,
-			Image:                  fn.Image,
-			Replicas:               fn.Replicas,
-			AvailableReplicas:      availableReplicas,
-			EnvProcess:             fn.EnvProcess,
-			EnvVars:                store.DecodeMap(fn.EnvVars),
-			Labels:                 store.DecodeMap(fn.Labels),
-			Annotations:            make(map[string]string),
-			Secrets:                store.DecodeSlice(fn.Secrets),
-			Network:                fn.Network,
-			Limits:                 limits,
-			Requests:               requests,
-			ReadOnlyRootFilesystem: fn.ReadOnly,
-			Debug:                  fn.Debug,
-			CreatedAt:              fn.CreatedAt,
-			UpdatedAt:              fn.UpdatedAt,
+	var requests *types.FunctionResources
+	if fn.Requests != "" {
+		var parsed types.FunctionResources
+		if err := json.Unmarshal([]byte(fn.Requests), &parsed); err == nil {
+			requests = &parsed
+		} else {
+			g.logger.Warnf("Failed to parse requests for %s: %v", fn.Name, err)
 		}
+	}
 
-		statuses = append(statuses, status)
+	security, err := decodeSecurity(fn.Security)
+	if err != nil {
+		g.logger.Warnf("Failed to parse security for %s: %v", fn.Name, err)
+	}
+	volumes, err := decodeVolumes(fn.Volumes)
+	if err != nil {
+		g.logger.Warnf("Failed to parse volumes for %s: %v", fn.Name, err)
 	}
 
-	g.writeJSON(w, http.StatusOK, statuses)
+	status := types.FunctionStatus{
+		Name:                   fn.Name,
+		Image:                  fn.Image,
+		Replicas:               fn.Replicas,
+		AvailableReplicas:      availableReplicas,
+		EnvProcess:             fn.EnvProcess,
+		EnvVars:                store.DecodeMap(fn.EnvVars),
+		Labels:                 store.DecodeMap(fn.Labels),
+		Annotations:            store.DecodeMap(fn.Annotations),
+		Secrets:                store.DecodeSlice(fn.Secrets),
+		Network:                fn.Network,
+		Limits:                 limits,
+		Requests:               requests,
+		ReadOnlyRootFilesystem: fn.ReadOnly,
+		Debug:                  fn.Debug,
+		Security:               security,
+		ImageDigest:            fn.ImageDigest,
+		Constraints:            store.DecodeSlice(fn.Constraints),
+		PullPolicy:             fn.PullPolicy,
+		Volumes:                volumes,
+		ImagePull:              g.provider.ImagePullStatus(fn.Name),
+		CreatedAt:              fn.CreatedAt,
+		UpdatedAt:              fn.UpdatedAt,
+	}
+	if crashLoop := g.provider.CrashLoopStatus(ctx, fn.Name, includeLogs); crashLoop != nil {
+		status.Degraded = true
+		status.CrashLoop = crashLoop
+	}
+	return &status, nil
 }
 
 // HandleFunctionContainers handles GET /system/function/<name>/containers
@@ -178,6 +263,28 @@ func (g *Gateway) HandleFunctionContainers(w http.ResponseWriter, r *http.Reques
 	g.writeJSON(w, http.StatusOK, containers)
 }
 
+// HandleFunctionEvents handles GET /system/function/{name}/events
+func (g *Gateway) HandleFunctionEvents(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	functionName := normalizeFunctionName(vars["name"])
+
+	if functionName == "" {
+		http.Error(w, "Function name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateFunctionName(functionName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	events := g.provider.GetFunctionEvents(functionName)
+	if events == nil {
+		events = []types.FunctionEvent{}
+	}
+
+	g.writeJSON(w, http.StatusOK, events)
+}
+
 // HandleDeployFunction handles POST /system/functions
 func (g *Gateway) HandleDeployFunction(w http.ResponseWriter, r *http.Request) {
 	var deployment types.FunctionDeployment
@@ -195,6 +302,37 @@ func (g *Gateway) HandleDeployFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateInvocationSettings(&deployment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := provider.ValidateResources(deployment.Limits, deployment.Requests); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid resources: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := provider.ValidatePullPolicy(deployment.PullPolicy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, err := g.validateSecurity(deployment.Security); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if status, err := g.validateVolumes(r.Context(), &deployment); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := g.validateSecretsAvailable(deployment.Secrets); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imageDigest, status, err := g.enforceImagePolicy(r.Context(), &deployment)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	g.logger.Infof("Deploying function: %s (image: %s)", deployment.Service, deployment.Image)
 
 	// Set network if not specified
@@ -215,7 +353,7 @@ func (g *Gateway) HandleDeployFunction(w http.ResponseWriter, r *http.Request) {
 	// Deploy function containers
 	if err := g.provider.DeployFunction(r.Context(), &deployment, replicas); err != nil {
 		g.logger.Errorf("Failed to deploy function: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to deploy function: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to deploy function: %v", err), deployErrorStatus(err))
 		return
 	}
 
@@ -230,23 +368,49 @@ func (g *Gateway) HandleDeployFunction(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to encode labels: %v", err), http.StatusBadRequest)
 		return
 	}
+	annotations, err := store.EncodeMap(deployment.Annotations)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode annotations: %v", err), http.StatusBadRequest)
+		return
+	}
 	secretsJSON, err := store.EncodeSlice(deployment.Secrets)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode secrets: %v", err), http.StatusBadRequest)
 		return
 	}
+	constraints, err := store.EncodeSlice(deployment.Constraints)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode constraints: %v", err), http.StatusBadRequest)
+		return
+	}
+	security, err := encodeSecurity(deployment.Security)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	volumes, err := encodeVolumes(deployment.Volumes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	metadata := &types.FunctionMetadata{
-		Name:       deployment.Service,
-		Image:      deployment.Image,
-		EnvProcess: deployment.EnvProcess,
-		EnvVars:    envVars,
-		Labels:     labels,
-		Secrets:    secretsJSON,
-		Network:    deployment.Network,
-		Replicas:   replicas,
-		ReadOnly:   deployment.ReadOnlyRootFilesystem,
-		Debug:      deployment.Debug,
+		Name:        deployment.Service,
+		Image:       deployment.Image,
+		EnvProcess:  deployment.EnvProcess,
+		EnvVars:     envVars,
+		Labels:      labels,
+		Annotations: annotations,
+		Secrets:     secretsJSON,
+		Constraints: constraints,
+		Network:     deployment.Network,
+		Replicas:    replicas,
+		ReadOnly:    deployment.ReadOnlyRootFilesystem,
+		Debug:       deployment.Debug,
+		Security:    security,
+		ImageDigest: imageDigest,
+		PullPolicy:  deployment.PullPolicy,
+		Volumes:     volumes,
 	}
 
 	if deployment.Limits != nil {
@@ -280,8 +444,7 @@ func (g *Gateway) HandleDeployFunction(w http.ResponseWriter, r *http.Request) {
 	metrics.UpdateFunctionsDeployed(len(functions))
 	metrics.UpdateFunctionReplicas(deployment.Service, replicas)
 
-	w.WriteHeader(http.StatusAccepted)
-	w.Write([]byte("Function deployed successfully"))
+	g.writeDeployResult(w, r, deployment.Service, "Function deployed successfully")
 }
 
 // HandleUpdateFunction handles PUT /system/functions
@@ -301,6 +464,37 @@ func (g *Gateway) HandleUpdateFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := validateInvocationSettings(&deployment); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := provider.ValidateResources(deployment.Limits, deployment.Requests); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid resources: %v", err), http.StatusBadRequest)
+		return
+	}
+	if err := provider.ValidatePullPolicy(deployment.PullPolicy); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if status, err := g.validateSecurity(deployment.Security); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if status, err := g.validateVolumes(r.Context(), &deployment); err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	if err := g.validateSecretsAvailable(deployment.Secrets); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	imageDigest, status, err := g.enforceImagePolicy(r.Context(), &deployment)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
 	g.logger.Infof("Updating function: %s (image: %s)", deployment.Service, deployment.Image)
 
 	// Get existing function
@@ -322,12 +516,13 @@ func (g *Gateway) HandleUpdateFunction(w http.ResponseWriter, r *http.Request) {
 	// Update function containers
 	if err := g.provider.UpdateFunction(r.Context(), &deployment, existing.Replicas); err != nil {
 		g.logger.Errorf("Failed to update function: %v", err)
-		http.Error(w, fmt.Sprintf("Failed to update function: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to update function: %v", err), deployErrorStatus(err))
 		return
 	}
 
 	// Update function metadata
 	existing.Image = deployment.Image
+	existing.ImageDigest = imageDigest
 	existing.EnvProcess = deployment.EnvProcess
 	envVars, err := store.EncodeMap(deployment.EnvVars)
 	if err != nil {
@@ -339,18 +534,43 @@ func (g *Gateway) HandleUpdateFunction(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("Failed to encode labels: %v", err), http.StatusBadRequest)
 		return
 	}
+	annotations, err := store.EncodeMap(deployment.Annotations)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode annotations: %v", err), http.StatusBadRequest)
+		return
+	}
 	secretsJSON, err := store.EncodeSlice(deployment.Secrets)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Failed to encode secrets: %v", err), http.StatusBadRequest)
 		return
 	}
+	constraints, err := store.EncodeSlice(deployment.Constraints)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode constraints: %v", err), http.StatusBadRequest)
+		return
+	}
+	security, err := encodeSecurity(deployment.Security)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	volumes, err := encodeVolumes(deployment.Volumes)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	existing.EnvVars = envVars
 	existing.Labels = labels
+	existing.Annotations = annotations
 	existing.Secrets = secretsJSON
+	existing.Constraints = constraints
 	existing.Network = deployment.Network
 	existing.ReadOnly = deployment.ReadOnlyRootFilesystem
 	existing.Debug = deployment.Debug
+	existing.Security = security
+	existing.PullPolicy = deployment.PullPolicy
+	existing.Volumes = volumes
 
 	if deployment.Limits != nil {
 		limitsJSON, err := json.Marshal(deployment.Limits)
@@ -376,8 +596,7 @@ func (g *Gateway) HandleUpdateFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	w.WriteHeader(http.StatusAccepted)
-	w.Write([]byte("Function updated successfully"))
+	g.writeDeployResult(w, r, deployment.Service, "Function updated successfully")
 }
 
 // HandleDeleteFunction handles DELETE /system/functions
@@ -431,6 +650,7 @@ func (g *Gateway) HandleDeleteFunction(w http.ResponseWriter, r *http.Request) {
 	if err := g.provider.CleanupFunctionNetwork(r.Context(), metadata.Name, metadata.Network); err != nil {
 		g.logger.Warnf("Failed to cleanup function network: %v", err)
 	}
+	g.router.ForgetFunction(functionName)
 
 	// Update metrics
 	functions, _ := g.store.ListFunctions()
@@ -502,16 +722,11 @@ func (g *Gateway) HandleScaleFunction(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Build deployment spec
-	deployment := &types.FunctionDeployment{
-		Service:                metadata.Name,
-		Image:                  metadata.Image,
-		Network:                metadata.Network,
-		EnvProcess:             metadata.EnvProcess,
-		EnvVars:                store.DecodeMap(metadata.EnvVars),
-		Labels:                 store.DecodeMap(metadata.Labels),
-		Secrets:                store.DecodeSlice(metadata.Secrets),
-		ReadOnlyRootFilesystem: metadata.ReadOnly,
-		Debug:                  metadata.Debug,
+	deployment, err := deploymentFromMetadata(metadata)
+	if err != nil {
+		g.logger.Errorf("Failed to scale function %s: %v", metadata.Name, err)
+		http.Error(w, "Failed to read function spec", http.StatusInternalServerError)
+		return
 	}
 
 	// Scale function
@@ -535,9 +750,13 @@ func (g *Gateway) HandleScaleFunction(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Function scaled successfully"))
 }
 
-// HandleGetLogs handles GET /system/logs?name=<function>
+// HandleGetLogs handles GET /system/logs?name=<function>. Lines from all
+// replicas are merged by timestamp. Clients that pass follow, as faas-cli
+// does, or accept application/x-ndjson get OpenFaaS log messages as NDJSON;
+// others get plain text.
 func (g *Gateway) HandleGetLogs(w http.ResponseWriter, r *http.Request) {
-	functionName := normalizeFunctionName(r.URL.Query().Get("name"))
+	query := r.URL.Query()
+	functionName := normalizeFunctionName(query.Get("name"))
 	if functionName == "" {
 		http.Error(w, "name parameter is required", http.StatusBadRequest)
 		return
@@ -547,23 +766,80 @@ func (g *Gateway) HandleGetLogs(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tail := 100
-	if tailStr := r.URL.Query().Get("tail"); tailStr != "" {
-		if t, err := strconv.Atoi(tailStr); err == nil {
-			tail = t
+	request := types.LogRequest{Name: functionName, Instance: query.Get("instance"), Tail: 100}
+	if tailStr := query.Get("tail"); tailStr != "" {
+		tail, err := strconv.Atoi(tailStr)
+		if err != nil {
+			http.Error(w, "invalid tail parameter", http.StatusBadRequest)
+			return
 		}
+		request.Tail = tail
 	}
+	if sinceStr := query.Get("since"); sinceStr != "" {
+		since, err := parseLogTime("since", sinceStr, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		request.Since = &since
+	}
+	if followStr := query.Get("follow"); followStr != "" {
+		follow, err := strconv.ParseBool(followStr)
+		if err != nil {
+			http.Error(w, "invalid follow parameter", http.StatusBadRequest)
+			return
+		}
+		request.Follow = follow
+	}
+	ndjson := query.Has("follow") || strings.Contains(r.Header.Get("Accept"), "application/x-ndjson")
 
-	logs, err := g.provider.GetContainerLogs(r.Context(), functionName, tail)
+	messages, err := g.provider.GetFunctionLogs(r.Context(), request)
 	if err != nil {
 		g.logger.Errorf("Failed to get logs: %v", err)
 		http.Error(w, fmt.Sprintf("Failed to get logs: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "text/plain")
+	if ndjson {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	} else {
+		w.Header().Set("Content-Type", "text/plain")
+	}
+	if request.Follow {
+		// A followed stream outlives the server's write timeout
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			g.logger.Debugf("Failed to clear write deadline for log stream: %v", err)
+		}
+	}
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(logs))
+
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for message := range messages {
+		if ndjson {
+			err = encoder.Encode(message)
+		} else {
+			_, err = fmt.Fprintf(w, "%s %s %s\n", message.Timestamp.Format(time.RFC3339Nano), message.Instance, message.Text)
+		}
+		// The provider stops sending once the request context is cancelled
+		if err != nil {
+			return
+		}
+		if request.Follow && flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+// parseLogTime accepts an RFC 3339 time or a duration before now
+func parseLogTime(param, raw string, now time.Time) (time.Time, error) {
+	if since, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+		return since, nil
+	}
+	if age, err := time.ParseDuration(raw); err == nil && age >= 0 {
+		return now.Add(-age), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid %s parameter %q: expected an RFC 3339 time or a duration", param, raw)
 }
 
 // HandleInvokeFunction handles POST /function/<name>
@@ -585,7 +861,18 @@ func (g *Gateway) HandleInvokeFunction(w http.ResponseWriter, r *http.Request) {
 	// Get function metadata
 	fn, err := g.store.GetFunction(functionName)
 	if err != nil {
-		http.Error(w, "Function not found", http.StatusNotFound)
+		// Callers the route rules reject get 403 whether or not the function exists
+		if g.enforceIPAccess(w, r, functionName, nil) {
+			http.Error(w, "Function not found", http.StatusNotFound)
+		}
+		return
+	}
+
+	annotations := store.DecodeMap(fn.Annotations)
+	if !g.enforceIPAccess(w, r, functionName, annotations) {
+		return
+	}
+	if !g.enforceInvocationLimits(w, r, functionName, annotations) {
 		return
 	}
 
@@ -597,11 +884,10 @@ func (g *Gateway) HandleInvokeFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	availableReplicas := 0
-	for _, c := range containers {
-		if strings.Contains(c.Status, "running") || strings.Contains(c.Status, "Up") {
-			availableReplicas++
-		}
+	availableReplicas, backoff := replicaAvailability(containers, time.Now())
+	if availableReplicas == 0 && backoff > 0 {
+		writeCrashLoopBackoff(w, functionName, backoff)
+		return
 	}
 
 	if availableReplicas == 0 {
@@ -639,19 +925,31 @@ func (g *Gateway) HandleInvokeFunction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Copy headers
+	// Copy headers and the caller's connection details for forwarding headers
 	for key, values := range r.Header {
 		for _, value := range values {
 			req.Header.Add(key, value)
 		}
 	}
+	req.RemoteAddr = r.RemoteAddr
+	req.Host = r.Host
+	req.TLS = r.TLS
+
+	// Every invocation carries a call ID that functions can log for search
+	callID := req.Header.Get("X-Call-Id")
+	if callID == "" {
+		callID = generateCallID()
+		req.Header.Set("X-Call-Id", callID)
+	}
+	w.Header().Set("X-Call-Id", callID)
 
 	// Route request
-	resp, err := g.router.RouteRequest(r.Context(), functionName, req)
+	resp, err := g.router.RouteRequest(g.concurrencyContext(r.Context(), fn), functionName, req)
 	if err != nil {
 		g.logger.Errorf("Failed to invoke function %s: %v", functionName, err)
-		metrics.RecordFunctionInvocation(functionName, http.StatusInternalServerError, time.Since(startTime).Seconds())
-		http.Error(w, fmt.Sprintf("Failed to invoke function: %v", err), http.StatusInternalServerError)
+		status := routeErrorStatus(err)
+		metrics.RecordFunctionInvocation(functionName, status, time.Since(startTime).Seconds())
+		http.Error(w, fmt.Sprintf("Failed to invoke function: %v", err), status)
 		return
 	}
 	defer resp.Body.Close()
@@ -662,6 +960,7 @@ func (g *Gateway) HandleInvokeFunction(w http.ResponseWriter, r *http.Request) {
 			w.Header().Add(key, value)
 		}
 	}
+	w.Header().Set("X-Call-Id", callID)
 
 	// Copy response body
 	w.WriteHeader(resp.StatusCode)
@@ -737,9 +1036,17 @@ func (g *Gateway) HandleHealthz(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("Unhealthy"))
 }
 
-// scaleFromZero scales a function from zero replicas to one replica
-func (g *Gateway) scaleFromZero(ctx context.Context, fn *types.FunctionMetadata) error {
-	// Build deployment spec from stored metadata
+// deploymentFromMetadata rebuilds the deployment spec of a stored function
+func deploymentFromMetadata(fn *types.FunctionMetadata) (*types.FunctionDeployment, error) {
+	security, err := decodeSecurity(fn.Security)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := decodeVolumes(fn.Volumes)
+	if err != nil {
+		return nil, err
+	}
+
 	deployment := &types.FunctionDeployment{
 		Service:                fn.Name,
 		Image:                  fn.Image,
@@ -747,26 +1054,85 @@ func (g *Gateway) scaleFromZero(ctx context.Context, fn *types.FunctionMetadata)
 		EnvProcess:             fn.EnvProcess,
 		EnvVars:                store.DecodeMap(fn.EnvVars),
 		Labels:                 store.DecodeMap(fn.Labels),
+		Annotations:            store.DecodeMap(fn.Annotations),
 		Secrets:                store.DecodeSlice(fn.Secrets),
+		Constraints:            store.DecodeSlice(fn.Constraints),
 		ReadOnlyRootFilesystem: fn.ReadOnly,
 		Debug:                  fn.Debug,
+		Security:               security,
+		PullPolicy:             fn.PullPolicy,
+		Volumes:                volumes,
 	}
 
-	// Parse limits if present
 	if fn.Limits != "" {
 		var limits types.FunctionLimits
-		if err := json.Unmarshal([]byte(fn.Limits), &limits); err == nil {
-			deployment.Limits = &limits
+		if err := json.Unmarshal([]byte(fn.Limits), &limits); err != nil {
+			return nil, fmt.Errorf("failed to parse limits: %w", err)
 		}
+		deployment.Limits = &limits
 	}
-
-	// Parse requests if present
 	if fn.Requests != "" {
 		var requests types.FunctionResources
-		if err := json.Unmarshal([]byte(fn.Requests), &requests); err == nil {
-			deployment.Requests = &requests
+		if err := json.Unmarshal([]byte(fn.Requests), &requests); err != nil {
+			return nil, fmt.Errorf("failed to parse requests: %w", err)
+		}
+		deployment.Requests = &requests
+	}
+	return deployment, nil
+}
+
+// replicaAvailability counts the replicas that can take requests. When none
+// can because replicas are in crash-loop backoff, it also returns how long
+// until the first of them leaves backoff; those replicas still exist, so the
+// function must not be scaled from zero.
+func replicaAvailability(containers []*types.Container, now time.Time) (int, time.Duration) {
+	available := 0
+	var backoff time.Duration
+	for _, c := range containers {
+		if c.Status == provider.StatusCrashLoopBackoff {
+			wait := time.Second
+			if c.BackoffUntil != nil && c.BackoffUntil.Sub(now) > wait {
+				wait = c.BackoffUntil.Sub(now)
+			}
+			if backoff == 0 || wait < backoff {
+				backoff = wait
+			}
+			continue
+		}
+		if strings.Contains(c.Status, "running") || strings.Contains(c.Status, "Up") {
+			available++
 		}
 	}
+	if available > 0 {
+		return available, 0
+	}
+	return 0, backoff
+}
+
+// crashLoopBackoffError reports that every replica of a function is in
+// crash-loop backoff
+type crashLoopBackoffError struct {
+	function   string
+	retryAfter time.Duration
+}
+
+func (e *crashLoopBackoffError) Error() string {
+	return fmt.Sprintf("function %s is crash looping, retry in %ds", e.function, ceilSeconds(e.retryAfter))
+}
+
+// writeCrashLoopBackoff rejects a call to a function whose replicas are all
+// in crash-loop backoff
+func writeCrashLoopBackoff(w http.ResponseWriter, functionName string, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(retryAfter)))
+	http.Error(w, (&crashLoopBackoffError{function: functionName, retryAfter: retryAfter}).Error(), http.StatusServiceUnavailable)
+}
+
+// scaleFromZero scales a function from zero replicas to one replica
+func (g *Gateway) scaleFromZero(ctx context.Context, fn *types.FunctionMetadata) error {
+	deployment, err := deploymentFromMetadata(fn)
+	if err != nil {
+		return err
+	}
 
 	// Scale to 1 replica
 	targetReplicas := 1
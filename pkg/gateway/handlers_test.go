@@ -10,6 +10,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/client"
 	"github.com/gorilla/mux"
@@ -30,6 +31,11 @@ type fakeStore struct {
 	deleteErr         error
 
 	lastCreated *types.FunctionMetadata
+
+	secrets    map[string]*types.SecretMetadata
+	secretErr  error
+	registries map[string]*types.RegistryCredential
+	pipelines  map[string]*types.PipelineMetadata
 }
 
 func (s *fakeStore) ListFunctions() ([]*types.FunctionMetadata, error) {
@@ -96,6 +102,119 @@ func (s *fakeStore) UpdateReplicas(name string, replicas int) error {
 	return nil
 }
 
+func (s *fakeStore) UpsertSecretMetadata(metadata *types.SecretMetadata) error {
+	if s.secretErr != nil {
+		return s.secretErr
+	}
+	if s.secrets == nil {
+		s.secrets = make(map[string]*types.SecretMetadata)
+	}
+	stored := *metadata
+	stored.Version = 1
+	if existing, ok := s.secrets[metadata.Name]; ok {
+		stored.Version = existing.Version + 1
+		stored.CreatedAt = existing.CreatedAt
+	}
+	s.secrets[metadata.Name] = &stored
+	return nil
+}
+
+func (s *fakeStore) GetSecretMetadata(name string) (*types.SecretMetadata, error) {
+	if meta, ok := s.secrets[name]; ok {
+		return meta, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (s *fakeStore) ListSecretMetadata() ([]*types.SecretMetadata, error) {
+	results := make([]*types.SecretMetadata, 0, len(s.secrets))
+	for _, meta := range s.secrets {
+		results = append(results, meta)
+	}
+	return results, nil
+}
+
+func (s *fakeStore) DeleteSecretMetadata(name string) error {
+	delete(s.secrets, name)
+	return nil
+}
+
+func (s *fakeStore) CreatePipeline(metadata *types.PipelineMetadata) error {
+	if s.pipelines == nil {
+		s.pipelines = make(map[string]*types.PipelineMetadata)
+	}
+	stored := *metadata
+	stored.CreatedAt = time.Now()
+	stored.UpdatedAt = stored.CreatedAt
+	s.pipelines[metadata.Name] = &stored
+	metadata.CreatedAt, metadata.UpdatedAt = stored.CreatedAt, stored.UpdatedAt
+	return nil
+}
+
+func (s *fakeStore) GetPipeline(name string) (*types.PipelineMetadata, error) {
+	if metadata, ok := s.pipelines[name]; ok {
+		return metadata, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (s *fakeStore) ListPipelines() ([]*types.PipelineMetadata, error) {
+	results := make([]*types.PipelineMetadata, 0, len(s.pipelines))
+	for _, metadata := range s.pipelines {
+		results = append(results, metadata)
+	}
+	return results, nil
+}
+
+func (s *fakeStore) UpdatePipeline(metadata *types.PipelineMetadata) error {
+	existing, ok := s.pipelines[metadata.Name]
+	if !ok {
+		return errors.New("not found")
+	}
+	stored := *metadata
+	stored.CreatedAt = existing.CreatedAt
+	stored.UpdatedAt = time.Now()
+	s.pipelines[metadata.Name] = &stored
+	metadata.UpdatedAt = stored.UpdatedAt
+	return nil
+}
+
+func (s *fakeStore) DeletePipeline(name string) error {
+	delete(s.pipelines, name)
+	return nil
+}
+
+func (s *fakeStore) UpsertRegistryCredential(credential *types.RegistryCredential) error {
+	if s.registries == nil {
+		s.registries = make(map[string]*types.RegistryCredential)
+	}
+	stored := *credential
+	s.registries[credential.Server] = &stored
+	return nil
+}
+
+func (s *fakeStore) GetRegistryCredential(server string) (*types.RegistryCredential, error) {
+	if credential, ok := s.registries[server]; ok {
+		stored := *credential
+		return &stored, nil
+	}
+	return nil, errors.New("not found")
+}
+
+func (s *fakeStore) ListRegistryCredentials() ([]*types.RegistryCredential, error) {
+	results := make([]*types.RegistryCredential, 0, len(s.registries))
+	for _, credential := range s.registries {
+		stored := *credential
+		results = append(results, &stored)
+	}
+	return results, nil
+}
+
+func (s *fakeStore) DeleteRegistryCredential(server string) error {
+	delete(s.registries, server)
+	return nil
+}
+
 func (s *fakeStore) HealthCheck(ctx context.Context) error {
 	return nil
 }
@@ -111,6 +230,11 @@ type fakeProvider struct {
 	healthErr     error
 	networkErr    error
 	containers    []*types.Container
+	secretManager *secrets.SecretManager
+	imagePull     *types.ImagePullStatus
+	events        map[string][]types.FunctionEvent
+	crashLoop     *types.CrashLoopStatus
+	logs          []types.LogMessage
 
 	deployCalled       bool
 	scaleCalled        bool
@@ -118,6 +242,7 @@ type fakeProvider struct {
 	lastDeployReplicas int
 	lastScale          *types.FunctionDeployment
 	lastScaleReplicas  int
+	lastLogs           types.LogRequest
 }
 
 func (p *fakeProvider) DeployFunction(ctx context.Context, deployment *types.FunctionDeployment, replicas int) error {
@@ -152,11 +277,17 @@ func (p *fakeProvider) GetFunctionContainers(ctx context.Context, functionName s
 	return []*types.Container{}, nil
 }
 
-func (p *fakeProvider) GetContainerLogs(ctx context.Context, functionName string, tail int) (string, error) {
+func (p *fakeProvider) GetFunctionLogs(ctx context.Context, request types.LogRequest) (<-chan types.LogMessage, error) {
+	p.lastLogs = request
 	if p.getLogsErr != nil {
-		return "", p.getLogsErr
+		return nil, p.getLogsErr
 	}
-	return "", nil
+	messages := make(chan types.LogMessage, len(p.logs))
+	for _, message := range p.logs {
+		messages <- message
+	}
+	close(messages)
+	return messages, nil
 }
 
 func (p *fakeProvider) CleanupFunctionNetwork(ctx context.Context, functionName, networkName string) error {
@@ -176,7 +307,7 @@ func (p *fakeProvider) DockerClient() *client.Client {
 }
 
 func (p *fakeProvider) GetSecretManager() *secrets.SecretManager {
-	return nil
+	return p.secretManager
 }
 
 func (p *fakeProvider) GetGatewayID() string {
@@ -187,6 +318,23 @@ func (p *fakeProvider) CanConnectGateway() bool {
 	return false
 }
 
+func (p *fakeProvider) ImagePullStatus(functionName string) *types.ImagePullStatus {
+	return p.imagePull
+}
+
+func (p *fakeProvider) GetFunctionEvents(functionName string) []types.FunctionEvent {
+	return p.events[functionName]
+}
+
+func (p *fakeProvider) CrashLoopStatus(ctx context.Context, functionName string, includeLogs bool) *types.CrashLoopStatus {
+	if p.crashLoop == nil || includeLogs {
+		return p.crashLoop
+	}
+	status := *p.crashLoop
+	status.LogTail = ""
+	return &status
+}
+
 type fakeRouter struct {
 	resp         *http.Response
 	err          error
@@ -203,6 +351,8 @@ func (r *fakeRouter) RouteRequest(ctx context.Context, functionName string, req
 	return r.resp, nil
 }
 
+func (r *fakeRouter) ForgetFunction(functionName string) {}
+
 func newTestGateway(store Store, provider Provider, router Router) *Gateway {
 	logger := logrus.New()
 	logger.SetOutput(io.Discard)
@@ -281,6 +431,55 @@ func TestHandleScaleFunction_UpdatesReplicas(t *testing.T) {
 	}
 }
 
+func TestHandleScaleFunction_KeepsResources(t *testing.T) {
+	fs := &fakeStore{
+		functions: map[string]*types.FunctionMetadata{
+			"hello": {
+				Name:        "hello",
+				Image:       "example/hello:latest",
+				Replicas:    1,
+				Limits:      `{"memory":"256m","cpuset":"0"}`,
+				Requests:    `{"memory":"128m"}`,
+				Constraints: `["node.role==worker"]`,
+			},
+		},
+	}
+	fp := &fakeProvider{}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	req := httptest.NewRequest(http.MethodPost, "/system/scale-function/hello", strings.NewReader(`{"serviceName":"hello","replicas":2}`))
+	recorder := httptest.NewRecorder()
+	gw.HandleScaleFunction(recorder, req)
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, recorder.Code)
+	}
+	if fp.lastScale.Limits == nil || fp.lastScale.Limits.CPUSet != "0" || fp.lastScale.Requests == nil || fp.lastScale.Requests.Memory != "128m" {
+		t.Fatalf("expected new replicas to keep limits and requests, got %+v", fp.lastScale)
+	}
+	if len(fp.lastScale.Constraints) != 1 || fp.lastScale.Constraints[0] != "node.role==worker" {
+		t.Fatalf("expected new replicas to keep placement constraints, got %v", fp.lastScale.Constraints)
+	}
+}
+
+func TestHandleDeployFunction_RejectsMalformedResources(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	fp := &fakeProvider{}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	body := `{"service":"hello","image":"example/hello:latest","limits":{"memory":"lots"}}`
+	req := httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body))
+	recorder := httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, req)
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+	if !strings.Contains(recorder.Body.String(), "limits.memory") || fp.deployCalled {
+		t.Fatalf("expected a limits.memory validation error without deploying, got %q", recorder.Body.String())
+	}
+}
+
 func TestHandleInvokeFunction_RoutesRequest(t *testing.T) {
 	response := &http.Response{
 		StatusCode: http.StatusOK,
@@ -319,3 +518,152 @@ func TestHandleInvokeFunction_RoutesRequest(t *testing.T) {
 		t.Fatalf("expected router to receive original request method")
 	}
 }
+
+func TestHandleFunctionEvents(t *testing.T) {
+	exitCode := 137
+	fp := &fakeProvider{events: map[string][]types.FunctionEvent{
+		"hello": {{Action: "die", Container: "hello-0", ExitCode: &exitCode}},
+	}}
+	gw := newTestGateway(&fakeStore{}, fp, &fakeRouter{})
+
+	for name, expected := range map[string]int{"hello": 1, "quiet": 0} {
+		req := httptest.NewRequest(http.MethodGet, "/system/function/"+name+"/events", nil)
+		req = mux.SetURLVars(req, map[string]string{"name": name})
+		recorder := httptest.NewRecorder()
+
+		gw.HandleFunctionEvents(recorder, req)
+
+		if recorder.Code != http.StatusOK {
+			t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+		}
+		var events []types.FunctionEvent
+		if err := json.Unmarshal(recorder.Body.Bytes(), &events); err != nil {
+			t.Fatalf("decode events: %v (%s)", err, recorder.Body.String())
+		}
+		if len(events) != expected {
+			t.Fatalf("expected %d events for %s, got %+v", expected, name, events)
+		}
+	}
+}
+
+func TestHandleGetLogs(t *testing.T) {
+	timestamp := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	fp := &fakeProvider{logs: []types.LogMessage{
+		{Name: "hello", Instance: "hello-0", Timestamp: timestamp, Text: "started", Stream: "stdout"},
+		{Name: "hello", Instance: "hello-1", Timestamp: timestamp.Add(time.Second), Text: "failed", Stream: "stderr"},
+	}}
+	gw := newTestGateway(&fakeStore{}, fp, &fakeRouter{})
+
+	// faas-cli always passes follow and reads NDJSON
+	recorder := httptest.NewRecorder()
+	gw.HandleGetLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs?name=hello&tail=5&since=2024-05-01T09:00:00Z&follow=false", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected NDJSON, got %d %q", recorder.Code, recorder.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSpace(recorder.Body.String()), "\n")
+	var message types.LogMessage
+	if len(lines) != 2 || json.Unmarshal([]byte(lines[1]), &message) != nil || message.Instance != "hello-1" || message.Text != "failed" {
+		t.Fatalf("unexpected log messages: %q", lines)
+	}
+	if fp.lastLogs.Tail != 5 || fp.lastLogs.Follow || fp.lastLogs.Since == nil || !fp.lastLogs.Since.Equal(timestamp.Add(-time.Hour)) {
+		t.Fatalf("unexpected log request: %+v", fp.lastLogs)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleGetLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs?name=hello", nil))
+	if body := recorder.Body.String(); !strings.Contains(body, "2024-05-01T10:00:01Z hello-1 failed\n") || fp.lastLogs.Tail != 100 {
+		t.Fatalf("expected plain text lines with instances, got %q", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleGetLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs?name=hello&instance=hello-1", nil))
+	if recorder.Code != http.StatusOK || fp.lastLogs.Instance != "hello-1" {
+		t.Fatalf("expected logs of one replica to be requested, got %d %+v", recorder.Code, fp.lastLogs)
+	}
+
+	for _, query := range []string{"since=yesterday", "follow=maybe", "tail=many"} {
+		recorder = httptest.NewRecorder()
+		gw.HandleGetLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs?name=hello&"+query, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", query, recorder.Code)
+		}
+	}
+}
+
+func TestHandleListFunctions_ReportsCrashLoop(t *testing.T) {
+	exitCode := 1
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"hello": {Name: "hello", Image: "alpine:latest", Replicas: 2},
+	}}
+	fp := &fakeProvider{
+		containers: []*types.Container{
+			{Name: "hello-0", Status: "running"},
+			{Name: "hello-1", Status: provider.StatusCrashLoopBackoff, CrashLoop: true, RestartCount: 6},
+		},
+		crashLoop: &types.CrashLoopStatus{Replicas: []string{"hello-1"}, Restarts: 4, ExitCode: &exitCode, LogTail: "panic: boom\n"},
+	}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	recorder := httptest.NewRecorder()
+	gw.HandleListFunctions(recorder, httptest.NewRequest(http.MethodGet, "/system/functions", nil))
+
+	var statuses []types.FunctionStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &statuses); err != nil {
+		t.Fatalf("decode functions: %v", err)
+	}
+	if len(statuses) != 1 || statuses[0].AvailableReplicas != 1 || !statuses[0].Degraded {
+		t.Fatalf("expected a degraded function with one available replica, got %+v", statuses)
+	}
+	if crashLoop := statuses[0].CrashLoop; crashLoop == nil || *crashLoop.ExitCode != 1 || crashLoop.LogTail != "" {
+		t.Fatalf("expected the crash loop status without logs, got %+v", crashLoop)
+	}
+
+	// Logs are only read for a single function
+	recorder = httptest.NewRecorder()
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/function/hello", nil), map[string]string{"name": "hello"})
+	gw.HandleGetFunction(recorder, req)
+	var status types.FunctionStatus
+	if err := json.Unmarshal(recorder.Body.Bytes(), &status); err != nil {
+		t.Fatalf("decode function: %v", err)
+	}
+	if !status.Degraded || status.CrashLoop == nil || status.CrashLoop.LogTail != "panic: boom\n" {
+		t.Fatalf("expected the crash loop status with logs, got %+v", status)
+	}
+
+	recorder = httptest.NewRecorder()
+	req = mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/function/missing", nil), map[string]string{"name": "missing"})
+	gw.HandleGetFunction(recorder, req)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a missing function, got %d", recorder.Code)
+	}
+}
+
+func TestHandleInvokeFunction_AllReplicasInBackoff(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"hello": {Name: "hello", Image: "alpine:latest", Replicas: 3},
+	}}
+	soon, later := time.Now().Add(20*time.Second), time.Now().Add(time.Minute)
+	fp := &fakeProvider{
+		containers: []*types.Container{
+			{Name: "hello-0", Status: provider.StatusCrashLoopBackoff, CrashLoop: true, BackoffUntil: &later},
+			{Name: "hello-1", Status: provider.StatusCrashLoopBackoff, CrashLoop: true, BackoffUntil: &soon},
+			{Name: "hello-2", Status: provider.StatusCrashLoopBackoff, CrashLoop: true, BackoffUntil: &later},
+		},
+	}
+	fr := &fakeRouter{}
+	gw := newTestGateway(fs, fp, fr)
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/function/hello", nil), map[string]string{"name": "hello"})
+	recorder := httptest.NewRecorder()
+	gw.HandleInvokeFunction(recorder, req)
+
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status %d, got %d", http.StatusServiceUnavailable, recorder.Code)
+	}
+	if retryAfter := recorder.Header().Get("Retry-After"); retryAfter != "20" {
+		t.Fatalf("expected Retry-After of the first replica leaving backoff, got %q", retryAfter)
+	}
+	if fp.scaleCalled || fs.functions["hello"].Replicas != 3 || fr.lastFunction != "" {
+		t.Fatalf("expected the function to be neither scaled nor called, replicas %d", fs.functions["hello"].Replicas)
+	}
+}
@@ -0,0 +1,56 @@
+package gateway
+
+import (
+	"net/http"
+)
+
+// SetImageCollector configures garbage collection of built images.
+func (g *Gateway) SetImageCollector(collector ImageCollector) {
+	g.images = collector
+}
+
+// FunctionImages returns the images, by reference and digest, of every stored
+// function, which image garbage collection must keep.
+func (g *Gateway) FunctionImages() ([]string, error) {
+	functions, err := g.store.ListFunctions()
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]string, 0, len(functions))
+	for _, fn := range functions {
+		images = append(images, fn.Image)
+		if fn.ImageDigest != "" {
+			images = append(images, fn.ImageDigest)
+		}
+	}
+	return images, nil
+}
+
+// HandleImageGCPlan handles GET /system/images/gc and reports the built images
+// a collection would remove, without removing them
+func (g *Gateway) HandleImageGCPlan(w http.ResponseWriter, r *http.Request) {
+	g.collectImages(w, r, true)
+}
+
+// HandleImageGC handles POST /system/images/gc and removes the built images
+// that are no longer needed
+func (g *Gateway) HandleImageGC(w http.ResponseWriter, r *http.Request) {
+	g.collectImages(w, r, false)
+}
+
+func (g *Gateway) collectImages(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	if g.images == nil {
+		http.Error(w, "Image garbage collection is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	report, err := g.images.Collect(r.Context(), dryRun)
+	if err != nil {
+		g.logger.Errorf("Image garbage collection failed: %v", err)
+		http.Error(w, "Image garbage collection failed", http.StatusInternalServerError)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, report)
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeImageCollector struct {
+	dryRuns []bool
+}
+
+func (c *fakeImageCollector) Collect(ctx context.Context, dryRun bool) (*types.ImageGCReport, error) {
+	c.dryRuns = append(c.dryRuns, dryRun)
+	return &types.ImageGCReport{
+		DryRun:         dryRun,
+		KeepRevisions:  3,
+		Removed:        []types.BuiltImage{{ID: "sha256:abc", Function: "hello", Tags: []string{"docker-faas/hello:1"}, Size: 1024}},
+		ReclaimedBytes: 1024,
+	}, nil
+}
+
+func TestImageGCHandlers(t *testing.T) {
+	gw := newTestGateway(&fakeStore{}, &fakeProvider{}, &fakeRouter{})
+
+	recorder := httptest.NewRecorder()
+	gw.HandleImageGC(recorder, httptest.NewRequest(http.MethodPost, "/system/images/gc", nil))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status %d without a collector, got %d", http.StatusNotImplemented, recorder.Code)
+	}
+
+	collector := &fakeImageCollector{}
+	gw.SetImageCollector(collector)
+
+	recorder = httptest.NewRecorder()
+	gw.HandleImageGCPlan(recorder, httptest.NewRequest(http.MethodGet, "/system/images/gc", nil))
+	var report types.ImageGCReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if !report.DryRun || len(report.Removed) != 1 || report.ReclaimedBytes != 1024 {
+		t.Fatalf("unexpected dry-run report: %+v", report)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleImageGC(recorder, httptest.NewRequest(http.MethodPost, "/system/images/gc", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if len(collector.dryRuns) != 2 || !collector.dryRuns[0] || collector.dryRuns[1] {
+		t.Fatalf("expected a dry run followed by a real collection, got %v", collector.dryRuns)
+	}
+}
+
+func TestFunctionImages(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"hello":  {Name: "hello", Image: "docker-faas/hello:1700000000"},
+		"pinned": {Name: "pinned", Image: "acme/api:1", ImageDigest: "acme/api@sha256:0123"},
+	}}
+	gw := newTestGateway(fs, &fakeProvider{}, &fakeRouter{})
+
+	images, err := gw.FunctionImages()
+	if err != nil {
+		t.Fatalf("function images: %v", err)
+	}
+	sort.Strings(images)
+	if len(images) != 3 || images[0] != "acme/api:1" || images[1] != "acme/api@sha256:0123" || images[2] != "docker-faas/hello:1700000000" {
+		t.Fatalf("unexpected function images: %v", images)
+	}
+}
@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/docker-faas/docker-faas/pkg/imagepolicy"
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// enforceImagePolicy checks the deployment image against the trust policy and
+// pins it to the resolved digest. It returns the digest to record, or the
+// HTTP status to reject the deployment with.
+func (g *Gateway) enforceImagePolicy(ctx context.Context, deployment *types.FunctionDeployment) (string, int, error) {
+	if g.imagePolicy == nil {
+		return imagepolicy.DigestOf(deployment.Image), http.StatusOK, nil
+	}
+
+	decision, err := g.imagePolicy.Evaluate(ctx, deployment.Image)
+	if err != nil {
+		g.logger.Warnf("Image %s for %s rejected: %v", deployment.Image, deployment.Service, err)
+		switch {
+		case errors.Is(err, imagepolicy.ErrPolicyViolation):
+			metrics.RecordImagePolicyRejection(deployment.Service)
+			return "", http.StatusForbidden, err
+		case errors.Is(err, imagepolicy.ErrInvalidImage):
+			return "", http.StatusBadRequest, err
+		default:
+			return "", http.StatusBadGateway, err
+		}
+	}
+
+	if decision.Image != deployment.Image {
+		g.logger.Infof("Pinned image for %s to %s", deployment.Service, decision.Image)
+		deployment.Image = decision.Image
+	}
+	return decision.Digest, http.StatusOK, nil
+}
@@ -0,0 +1,55 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/imagepolicy"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeImagePolicy struct{}
+
+func (fakeImagePolicy) Evaluate(ctx context.Context, image string) (*imagepolicy.Decision, error) {
+	if strings.HasPrefix(image, "untrusted/") {
+		return nil, fmt.Errorf("repository not allowed: %w", imagepolicy.ErrPolicyViolation)
+	}
+	digest := "sha256:" + strings.Repeat("b", 64)
+	return &imagepolicy.Decision{Image: image + "@" + digest, Digest: digest}, nil
+}
+
+func TestHandleDeployFunction_ImagePolicy(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	fp := &fakeProvider{}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+	gw.SetImagePolicy(fakeImagePolicy{})
+
+	deploy := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		gw.HandleDeployFunction(recorder, req)
+		return recorder.Code
+	}
+
+	if code := deploy(`{"service":"bad","image":"untrusted/app:1"}`); code != http.StatusForbidden {
+		t.Fatalf("expected untrusted image to be forbidden, got %d", code)
+	}
+	if fp.deployCalled {
+		t.Fatalf("expected rejected image not to be deployed")
+	}
+
+	if code := deploy(`{"service":"good","image":"acme/app:1"}`); code != http.StatusAccepted {
+		t.Fatalf("expected trusted image to deploy, got %d", code)
+	}
+	pinned := "acme/app:1@sha256:" + strings.Repeat("b", 64)
+	if fp.lastDeploy.Image != pinned {
+		t.Fatalf("expected provider to deploy pinned image, got %s", fp.lastDeploy.Image)
+	}
+	if fs.lastCreated.Image != pinned || fs.lastCreated.ImageDigest != "sha256:"+strings.Repeat("b", 64) {
+		t.Fatalf("expected pinned image and digest to be stored, got %+v", fs.lastCreated)
+	}
+}
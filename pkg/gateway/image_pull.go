@@ -0,0 +1,40 @@
+package gateway
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// deployResponse is returned by deploy and update to clients that accept JSON
+type deployResponse struct {
+	Message   string                 `json:"message"`
+	ImagePull *types.ImagePullStatus `json:"imagePull,omitempty"`
+}
+
+// deployErrorStatus maps a provider deploy error to an HTTP status; image
+// pull failures are upstream registry errors
+func deployErrorStatus(err error) int {
+	if errors.Is(err, provider.ErrImagePull) {
+		return http.StatusBadGateway
+	}
+	return http.StatusInternalServerError
+}
+
+// writeDeployResult reports a successful deploy or update, including the
+// image pull outcome for clients that accept JSON
+func (g *Gateway) writeDeployResult(w http.ResponseWriter, r *http.Request, functionName, message string) {
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		g.writeJSON(w, http.StatusAccepted, deployResponse{
+			Message:   message,
+			ImagePull: g.provider.ImagePullStatus(functionName),
+		})
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte(message))
+}
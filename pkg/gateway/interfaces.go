@@ -6,6 +6,9 @@ import (
 
 	"github.com/docker/docker/client"
 
+	"github.com/docker-faas/docker-faas/pkg/clientip"
+	"github.com/docker-faas/docker-faas/pkg/imagepolicy"
+	"github.com/docker-faas/docker-faas/pkg/logstore"
 	"github.com/docker-faas/docker-faas/pkg/secrets"
 	"github.com/docker-faas/docker-faas/pkg/types"
 )
@@ -18,6 +21,15 @@ type Store interface {
 	UpdateFunction(metadata *types.FunctionMetadata) error
 	DeleteFunction(name string) error
 	UpdateReplicas(name string, replicas int) error
+	UpsertSecretMetadata(metadata *types.SecretMetadata) error
+	GetSecretMetadata(name string) (*types.SecretMetadata, error)
+	ListSecretMetadata() ([]*types.SecretMetadata, error)
+	DeleteSecretMetadata(name string) error
+	CreatePipeline(metadata *types.PipelineMetadata) error
+	GetPipeline(name string) (*types.PipelineMetadata, error)
+	ListPipelines() ([]*types.PipelineMetadata, error)
+	UpdatePipeline(metadata *types.PipelineMetadata) error
+	DeletePipeline(name string) error
 	HealthCheck(ctx context.Context) error
 }
 
@@ -28,7 +40,7 @@ type Provider interface {
 	RemoveFunction(ctx context.Context, functionName string) error
 	ScaleFunction(ctx context.Context, deployment *types.FunctionDeployment, targetReplicas int) error
 	GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error)
-	GetContainerLogs(ctx context.Context, functionName string, tail int) (string, error)
+	GetFunctionLogs(ctx context.Context, request types.LogRequest) (<-chan types.LogMessage, error)
 	CleanupFunctionNetwork(ctx context.Context, functionName, networkName string) error
 	HealthCheck(ctx context.Context) error
 	CheckNetwork(ctx context.Context) error
@@ -36,9 +48,52 @@ type Provider interface {
 	GetSecretManager() *secrets.SecretManager
 	GetGatewayID() string
 	CanConnectGateway() bool
+	ImagePullStatus(functionName string) *types.ImagePullStatus
+	GetFunctionEvents(functionName string) []types.FunctionEvent
+	CrashLoopStatus(ctx context.Context, functionName string, includeLogs bool) *types.CrashLoopStatus
+}
+
+// RouteAccess resolves the route-level IP rules for a request path.
+type RouteAccess interface {
+	RouteRules(path string) (clientip.Rules, string, bool)
+}
+
+// ImagePolicy decides whether an image may be deployed.
+type ImagePolicy interface {
+	Evaluate(ctx context.Context, image string) (*imagepolicy.Decision, error)
+}
+
+// StateReconciler repairs drift between stored functions and their containers.
+type StateReconciler interface {
+	Reconcile(ctx context.Context, dryRun bool) (*types.ReconcileReport, error)
+}
+
+// LogSearcher searches the retained logs of functions.
+type LogSearcher interface {
+	Query(query logstore.Query) ([]types.LogMessage, error)
+}
+
+// VolumeManager manages the named volumes functions mount.
+type VolumeManager interface {
+	List(ctx context.Context) ([]*types.VolumeInfo, error)
+	Create(ctx context.Context, name, owner string, labels map[string]string) (*types.VolumeInfo, error)
+	Remove(ctx context.Context, name string) error
+	Check(ctx context.Context, functionName string, volumes []types.FunctionVolume) error
+}
+
+// StatsSampler reports the resource usage of function replicas.
+type StatsSampler interface {
+	Live(ctx context.Context, functionName string) ([]types.ReplicaStats, error)
+	History(functionName string) map[string][]types.StatsSample
+}
+
+// ImageCollector removes built images that are no longer needed.
+type ImageCollector interface {
+	Collect(ctx context.Context, dryRun bool) (*types.ImageGCReport, error)
 }
 
 // Router defines the routing operations used by the gateway.
 type Router interface {
 	RouteRequest(ctx context.Context, functionName string, req *http.Request) (*http.Response, error)
+	ForgetFunction(functionName string)
 }
@@ -0,0 +1,392 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/clientip"
+	"github.com/docker-faas/docker-faas/pkg/logstore"
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/middleware"
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/router"
+	"github.com/docker-faas/docker-faas/pkg/store"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// AnnotationRateLimitRPS sets the sustained invocations per second for a function
+	AnnotationRateLimitRPS = "com.docker-faas.ratelimit.rps"
+	// AnnotationRateLimitBurst sets the token bucket size (defaults to the rounded-up rps)
+	AnnotationRateLimitBurst = "com.docker-faas.ratelimit.burst"
+	// AnnotationRateLimitKey selects how callers share buckets: global, ip,
+	// api-key (the authenticated caller) or header:<name>
+	AnnotationRateLimitKey = "com.docker-faas.ratelimit.key"
+	// AnnotationQuotaDaily sets the invocations allowed per caller per UTC day
+	AnnotationQuotaDaily = "com.docker-faas.quota.daily"
+
+	rateLimitKeyGlobal = "global"
+	rateLimitKeyIP     = "ip"
+	rateLimitKeyAPIKey = "api-key"
+	rateLimitKeyHeader = "header:"
+
+	// limiterIdleTTL is how long an unused bucket is kept
+	limiterIdleTTL = 10 * time.Minute
+	// maxQuotaCounters bounds the callers whose quota is tracked per gateway
+	maxQuotaCounters = 100000
+)
+
+// InvocationLimits is the per-function limit configuration parsed from annotations
+type InvocationLimits struct {
+	RPS        float64
+	Burst      int
+	Key        string
+	DailyQuota int
+}
+
+// Enabled reports whether any limit is configured
+func (l InvocationLimits) Enabled() bool {
+	return l.RPS > 0 || l.DailyQuota > 0
+}
+
+// ParseInvocationLimits reads rate limit and quota annotations
+func ParseInvocationLimits(annotations map[string]string) (InvocationLimits, error) {
+	limits := InvocationLimits{Key: rateLimitKeyGlobal}
+
+	if raw := strings.TrimSpace(annotations[AnnotationRateLimitRPS]); raw != "" {
+		rps, err := strconv.ParseFloat(raw, 64)
+		if err != nil || rps <= 0 || math.IsInf(rps, 0) || math.IsNaN(rps) {
+			return limits, fmt.Errorf("invalid %s: %q", AnnotationRateLimitRPS, raw)
+		}
+		limits.RPS = rps
+		limits.Burst = int(math.Ceil(rps))
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationRateLimitBurst]); raw != "" {
+		burst, err := strconv.Atoi(raw)
+		if err != nil || burst <= 0 {
+			return limits, fmt.Errorf("invalid %s: %q", AnnotationRateLimitBurst, raw)
+		}
+		if limits.RPS == 0 {
+			return limits, fmt.Errorf("%s requires %s", AnnotationRateLimitBurst, AnnotationRateLimitRPS)
+		}
+		limits.Burst = burst
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationRateLimitKey]); raw != "" {
+		key := strings.ToLower(raw)
+		switch {
+		case key == rateLimitKeyGlobal, key == rateLimitKeyIP, key == rateLimitKeyAPIKey:
+			limits.Key = key
+		case strings.HasPrefix(key, rateLimitKeyHeader) && len(key) > len(rateLimitKeyHeader):
+			limits.Key = rateLimitKeyHeader + http.CanonicalHeaderKey(strings.TrimSpace(raw[len(rateLimitKeyHeader):]))
+		default:
+			return limits, fmt.Errorf("invalid %s: %q (use global, ip, api-key or header:<name>)", AnnotationRateLimitKey, raw)
+		}
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationQuotaDaily]); raw != "" {
+		quota, err := strconv.Atoi(raw)
+		if err != nil || quota <= 0 {
+			return limits, fmt.Errorf("invalid %s: %q", AnnotationQuotaDaily, raw)
+		}
+		limits.DailyQuota = quota
+	}
+
+	return limits, nil
+}
+
+// LimitDecision describes the outcome of an invocation limit check
+type LimitDecision struct {
+	Allowed    bool
+	Reason     string
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// InvocationLimiter enforces per-function token buckets and daily quotas
+type InvocationLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	quotas    map[string]*quotaCounter
+	maxQuotas int
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type tokenBucket struct {
+	rps      float64
+	burst    int
+	tokens   float64
+	lastSeen time.Time
+}
+
+type quotaCounter struct {
+	day      string
+	count    int
+	lastSeen time.Time
+}
+
+// NewInvocationLimiter creates an empty invocation limiter
+func NewInvocationLimiter() *InvocationLimiter {
+	return &InvocationLimiter{
+		buckets:   make(map[string]*tokenBucket),
+		quotas:    make(map[string]*quotaCounter),
+		maxQuotas: maxQuotaCounters,
+		now:       time.Now,
+	}
+}
+
+// Allow checks and consumes the function's rate limit and then its daily quota
+func (l *InvocationLimiter) Allow(functionName string, limits InvocationLimits, r *http.Request) LimitDecision {
+	decision := LimitDecision{Allowed: true}
+	if l == nil || !limits.Enabled() {
+		return decision
+	}
+
+	now := l.now()
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now)
+
+	bucketKey := functionName + "|" + rateLimitCaller(limits.Key, r)
+	if limits.RPS > 0 {
+		decision = l.takeToken(bucketKey, limits, now)
+		if !decision.Allowed {
+			return decision
+		}
+	}
+
+	if limits.DailyQuota > 0 {
+		key := functionName + "|" + quotaCaller(r)
+		quota := l.consumeQuota(key, limits.DailyQuota, now)
+		if !quota.Allowed && limits.RPS > 0 {
+			// A rejected invocation does not use up the caller's rate limit
+			l.refundToken(bucketKey)
+		}
+		if !quota.Allowed || limits.RPS == 0 {
+			return quota
+		}
+	}
+
+	return decision
+}
+
+// takeToken refills and consumes a token. Callers must hold l.mu.
+func (l *InvocationLimiter) takeToken(key string, limits InvocationLimits, now time.Time) LimitDecision {
+	bucket := l.buckets[key]
+	if bucket == nil || bucket.rps != limits.RPS || bucket.burst != limits.Burst {
+		bucket = &tokenBucket{rps: limits.RPS, burst: limits.Burst, tokens: float64(limits.Burst), lastSeen: now}
+		l.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.lastSeen).Seconds()
+	if elapsed > 0 {
+		bucket.tokens = math.Min(float64(bucket.burst), bucket.tokens+elapsed*bucket.rps)
+	}
+	bucket.lastSeen = now
+
+	decision := LimitDecision{Reason: "rate_limit", Limit: bucket.burst}
+	if bucket.tokens < 1 {
+		decision.RetryAfter = secondsDuration((1 - bucket.tokens) / bucket.rps)
+		decision.Reset = secondsDuration((float64(bucket.burst) - bucket.tokens) / bucket.rps)
+		return decision
+	}
+
+	bucket.tokens--
+	decision.Allowed = true
+	decision.Remaining = int(bucket.tokens)
+	decision.Reset = secondsDuration((float64(bucket.burst) - bucket.tokens) / bucket.rps)
+	return decision
+}
+
+// refundToken returns a token taken by takeToken. Callers must hold l.mu.
+func (l *InvocationLimiter) refundToken(key string) {
+	if bucket := l.buckets[key]; bucket != nil {
+		bucket.tokens = math.Min(float64(bucket.burst), bucket.tokens+1)
+	}
+}
+
+// consumeQuota counts an invocation against the caller's daily quota. Callers must hold l.mu.
+func (l *InvocationLimiter) consumeQuota(key string, quota int, now time.Time) LimitDecision {
+	utc := now.UTC()
+	day := utc.Format("2006-01-02")
+	midnight := time.Date(utc.Year(), utc.Month(), utc.Day()+1, 0, 0, 0, 0, time.UTC)
+
+	counter := l.quotas[key]
+	if counter == nil || counter.day != day {
+		if counter == nil && len(l.quotas) >= l.maxQuotas {
+			l.evictQuota(day)
+		}
+		counter = &quotaCounter{day: day}
+		l.quotas[key] = counter
+	}
+	counter.lastSeen = now
+
+	decision := LimitDecision{Reason: "quota", Limit: quota, Reset: midnight.Sub(utc)}
+	if counter.count >= quota {
+		decision.RetryAfter = decision.Reset
+		return decision
+	}
+
+	counter.count++
+	decision.Allowed = true
+	decision.Remaining = quota - counter.count
+	return decision
+}
+
+// evictQuota makes room for a new quota counter by dropping the counters of
+// previous days or, failing that, the least recently used one. Callers must
+// hold l.mu.
+func (l *InvocationLimiter) evictQuota(today string) {
+	var oldestKey string
+	var oldest time.Time
+	for key, counter := range l.quotas {
+		if counter.day != today {
+			delete(l.quotas, key)
+			continue
+		}
+		if oldestKey == "" || counter.lastSeen.Before(oldest) {
+			oldestKey, oldest = key, counter.lastSeen
+		}
+	}
+	if len(l.quotas) >= l.maxQuotas {
+		delete(l.quotas, oldestKey)
+	}
+}
+
+// sweep drops full idle buckets and stale quota counters. Callers must hold l.mu.
+func (l *InvocationLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < time.Minute {
+		return
+	}
+	l.lastSweep = now
+
+	for key, bucket := range l.buckets {
+		if now.Sub(bucket.lastSeen) > limiterIdleTTL {
+			delete(l.buckets, key)
+		}
+	}
+	today := now.UTC().Format("2006-01-02")
+	for key, counter := range l.quotas {
+		if counter.day != today {
+			delete(l.quotas, key)
+		}
+	}
+}
+
+// enforceInvocationLimits applies the function's rate limit and quota,
+// writing rate limit headers and a 429 response when the call is rejected
+func (g *Gateway) enforceInvocationLimits(w http.ResponseWriter, r *http.Request, functionName string, annotations map[string]string) bool {
+	limits, err := ParseInvocationLimits(annotations)
+	if err != nil {
+		g.logger.Warnf("Ignoring invalid rate limit annotations for %s: %v", functionName, err)
+		return true
+	}
+	if !limits.Enabled() {
+		return true
+	}
+
+	decision := g.limits.Allow(functionName, limits, r)
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	if decision.Allowed {
+		return true
+	}
+
+	metrics.RecordFunctionRateLimited(functionName, decision.Reason)
+	w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+	if decision.Reason == "quota" {
+		http.Error(w, "Daily invocation quota exceeded", http.StatusTooManyRequests)
+	} else {
+		http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	}
+	return false
+}
+
+// validateInvocationSettings checks the rate limit, quota, concurrency, IP, stop and log retention settings of a deployment
+func validateInvocationSettings(deployment *types.FunctionDeployment) error {
+	if _, err := ParseInvocationLimits(deployment.Annotations); err != nil {
+		return err
+	}
+	if _, err := router.ParseConcurrencyLimits(deployment.Annotations, deployment.EnvVars); err != nil {
+		return err
+	}
+	if _, err := ParseFunctionIPRules(deployment.Annotations); err != nil {
+		return err
+	}
+	if _, err := provider.ParseStopSettings(deployment.Annotations); err != nil {
+		return err
+	}
+	if _, err := logstore.ParseRetention(deployment.Annotations, logstore.Retention{}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// concurrencyContext attaches the function's max-inflight settings for the router
+func (g *Gateway) concurrencyContext(ctx context.Context, fn *types.FunctionMetadata) context.Context {
+	limits, err := router.ParseConcurrencyLimits(store.DecodeMap(fn.Annotations), store.DecodeMap(fn.EnvVars))
+	if err != nil {
+		g.logger.Warnf("Ignoring invalid concurrency settings for %s: %v", fn.Name, err)
+		return ctx
+	}
+	return router.WithConcurrencyLimits(ctx, limits)
+}
+
+// routeErrorStatus maps a routing failure to the response status code
+func routeErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, router.ErrQueueFull):
+		return http.StatusTooManyRequests
+	case errors.Is(err, router.ErrQueueTimeout):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// rateLimitCaller returns the bucket key for a caller under a key mode
+func rateLimitCaller(mode string, r *http.Request) string {
+	switch {
+	case mode == rateLimitKeyIP:
+		return "ip:" + clientip.FromRequest(r)
+	case mode == rateLimitKeyAPIKey:
+		return quotaCaller(r)
+	case strings.HasPrefix(mode, rateLimitKeyHeader):
+		return mode + "=" + r.Header.Get(strings.TrimPrefix(mode, rateLimitKeyHeader))
+	default:
+		return rateLimitKeyGlobal
+	}
+}
+
+// quotaCaller identifies the caller by the identity it authenticated as,
+// falling back to the client IP for anonymous calls. Credentials the caller
+// merely sends are not used, so new values cannot reset a limit.
+func quotaCaller(r *http.Request) string {
+	if identity, ok := middleware.IdentityFromRequest(r); ok {
+		return "identity:" + identity
+	}
+	return "ip:" + clientip.FromRequest(r)
+}
+
+func secondsDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second))
+}
+
+func ceilSeconds(d time.Duration) int {
+	if d <= 0 {
+		return 0
+	}
+	return int(math.Ceil(d.Seconds()))
+}
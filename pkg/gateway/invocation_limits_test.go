@@ -0,0 +1,245 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/middleware"
+	"github.com/docker-faas/docker-faas/pkg/router"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestParseInvocationLimits(t *testing.T) {
+	limits, err := ParseInvocationLimits(map[string]string{
+		AnnotationRateLimitRPS: "2.5",
+		AnnotationRateLimitKey: "header:x-tenant",
+		AnnotationQuotaDaily:   "1000",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits.RPS != 2.5 || limits.Burst != 3 || limits.Key != "header:X-Tenant" || limits.DailyQuota != 1000 {
+		t.Fatalf("unexpected limits: %#v", limits)
+	}
+
+	invalid := []map[string]string{
+		{AnnotationRateLimitRPS: "0"},
+		{AnnotationRateLimitRPS: "fast"},
+		{AnnotationRateLimitBurst: "5"},
+		{AnnotationRateLimitRPS: "1", AnnotationRateLimitKey: "cookie"},
+		{AnnotationQuotaDaily: "-1"},
+	}
+	for _, annotations := range invalid {
+		if _, err := ParseInvocationLimits(annotations); err == nil {
+			t.Fatalf("expected error for %v", annotations)
+		}
+	}
+}
+
+func TestInvocationLimiter_TokenBucket(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewInvocationLimiter()
+	limiter.now = func() time.Time { return now }
+
+	limits := InvocationLimits{RPS: 1, Burst: 2, Key: rateLimitKeyIP}
+	req := httptest.NewRequest(http.MethodPost, "/function/hello", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	other := httptest.NewRequest(http.MethodPost, "/function/hello", nil)
+	other.RemoteAddr = "10.0.0.2:1234"
+
+	for i := 0; i < 2; i++ {
+		if decision := limiter.Allow("hello", limits, req); !decision.Allowed {
+			t.Fatalf("expected call %d to be allowed", i+1)
+		}
+	}
+	decision := limiter.Allow("hello", limits, req)
+	if decision.Allowed {
+		t.Fatalf("expected third call to be rate limited")
+	}
+	if decision.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %v", decision.RetryAfter)
+	}
+	if !limiter.Allow("hello", limits, other).Allowed {
+		t.Fatalf("expected a different client IP to have its own bucket")
+	}
+
+	now = now.Add(time.Second)
+	if !limiter.Allow("hello", limits, req).Allowed {
+		t.Fatalf("expected bucket to refill after one second")
+	}
+}
+
+func TestInvocationLimiter_DailyQuota(t *testing.T) {
+	now := time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)
+	limiter := NewInvocationLimiter()
+	limiter.now = func() time.Time { return now }
+
+	limits := InvocationLimits{DailyQuota: 1, Key: rateLimitKeyGlobal}
+	alice := middleware.WithIdentity(httptest.NewRequest(http.MethodPost, "/function/hello", nil), "alice")
+	bob := middleware.WithIdentity(httptest.NewRequest(http.MethodPost, "/function/hello", nil), "bob")
+
+	if !limiter.Allow("hello", limits, alice).Allowed {
+		t.Fatalf("expected first call to be allowed")
+	}
+	decision := limiter.Allow("hello", limits, alice)
+	if decision.Allowed || decision.Reason != "quota" {
+		t.Fatalf("expected quota rejection, got %#v", decision)
+	}
+	if decision.RetryAfter != time.Minute {
+		t.Fatalf("expected retry after midnight (1m), got %v", decision.RetryAfter)
+	}
+	if !limiter.Allow("hello", limits, bob).Allowed {
+		t.Fatalf("expected a different identity to have its own quota")
+	}
+
+	now = now.Add(time.Minute)
+	if !limiter.Allow("hello", limits, alice).Allowed {
+		t.Fatalf("expected quota to reset at midnight UTC")
+	}
+}
+
+func TestInvocationLimiter_QuotaIgnoresUnauthenticatedKeys(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewInvocationLimiter()
+	limiter.now = func() time.Time { return now }
+
+	limits := InvocationLimits{RPS: 10, Burst: 10, Key: rateLimitKeyAPIKey, DailyQuota: 1}
+	call := func(apiKey string) LimitDecision {
+		req := httptest.NewRequest(http.MethodPost, "/function/hello", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		req.Header.Set("X-API-Key", apiKey)
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+		return limiter.Allow("hello", limits, req)
+	}
+
+	if !call("first").Allowed {
+		t.Fatalf("expected first call to be allowed")
+	}
+	if decision := call("second"); decision.Allowed {
+		t.Fatalf("expected a new unverified key to share the client IP quota")
+	}
+}
+
+func TestInvocationLimiter_QuotaCountersAreBounded(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewInvocationLimiter()
+	limiter.now = func() time.Time { return now }
+	limiter.maxQuotas = 2
+
+	limits := InvocationLimits{DailyQuota: 5, Key: rateLimitKeyGlobal}
+	for _, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+		req := httptest.NewRequest(http.MethodPost, "/function/hello", nil)
+		req.RemoteAddr = ip + ":1234"
+		limiter.Allow("hello", limits, req)
+		now = now.Add(time.Second)
+	}
+
+	if len(limiter.quotas) != 2 || limiter.quotas["hello|ip:10.0.0.1"] == nil || limiter.quotas["hello|ip:10.0.0.3"] == nil {
+		t.Fatalf("expected the least recently used counter to be evicted, got %v", limiter.quotas)
+	}
+}
+
+func TestInvocationLimiter_QuotaRejectionKeepsRateLimitToken(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewInvocationLimiter()
+	limiter.now = func() time.Time { return now }
+
+	// Both callers share one bucket of two tokens
+	limits := InvocationLimits{RPS: 1, Burst: 2, Key: rateLimitKeyGlobal, DailyQuota: 1}
+	alice := middleware.WithIdentity(httptest.NewRequest(http.MethodPost, "/function/hello", nil), "alice")
+	bob := middleware.WithIdentity(httptest.NewRequest(http.MethodPost, "/function/hello", nil), "bob")
+
+	if !limiter.Allow("hello", limits, alice).Allowed {
+		t.Fatalf("expected first call to be allowed")
+	}
+	if decision := limiter.Allow("hello", limits, alice); decision.Allowed || decision.Reason != "quota" {
+		t.Fatalf("expected quota rejection, got %#v", decision)
+	}
+	if decision := limiter.Allow("hello", limits, bob); !decision.Allowed {
+		t.Fatalf("expected the quota rejection to leave a token for bob, got %#v", decision)
+	}
+}
+
+func TestHandleInvokeFunction_RateLimited(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"hello": {
+			Name:        "hello",
+			Image:       "alpine:latest",
+			Replicas:    1,
+			Annotations: `{"com.docker-faas.ratelimit.rps":"1"}`,
+		},
+	}}
+	fp := &fakeProvider{containers: []*types.Container{{Name: "hello", Status: "running"}}}
+	fr := &fakeRouter{resp: &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("pong"))}}
+	gw := newTestGateway(fs, fp, fr)
+
+	invoke := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/function/hello", strings.NewReader("ping"))
+		req = mux.SetURLVars(req, map[string]string{"name": "hello"})
+		recorder := httptest.NewRecorder()
+		gw.HandleInvokeFunction(recorder, req)
+		return recorder
+	}
+
+	first := invoke()
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, first.Code)
+	}
+	if first.Header().Get("X-RateLimit-Limit") != "1" || first.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Fatalf("expected rate limit headers, got %v", first.Header())
+	}
+
+	second := invoke()
+	if second.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, second.Code)
+	}
+	if second.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected Retry-After header")
+	}
+}
+
+func TestHandleInvokeFunction_QueueFull(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"hello": {
+			Name:        "hello",
+			Image:       "alpine:latest",
+			Replicas:    1,
+			Annotations: `{"com.docker-faas.max-inflight":"1"}`,
+		},
+	}}
+	fp := &fakeProvider{containers: []*types.Container{{Name: "hello", Status: "running"}}}
+	fr := &fakeRouter{err: router.ErrQueueFull}
+	gw := newTestGateway(fs, fp, fr)
+
+	req := httptest.NewRequest(http.MethodPost, "/function/hello", strings.NewReader("ping"))
+	req = mux.SetURLVars(req, map[string]string{"name": "hello"})
+	recorder := httptest.NewRecorder()
+	gw.HandleInvokeFunction(recorder, req)
+
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected status %d, got %d", http.StatusTooManyRequests, recorder.Code)
+	}
+}
+
+func TestHandleDeployFunction_RejectsInvalidMaxInflight(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	fp := &fakeProvider{}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	body := `{"service":"hello","image":"example/hello:latest","envVars":{"max_inflight":"many"}}`
+	recorder := httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body)))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+	if fp.deployCalled {
+		t.Fatalf("expected provider deploy not to be called")
+	}
+}
@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/docker-faas/docker-faas/pkg/clientip"
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+)
+
+const (
+	// AnnotationIPAllow lists the CIDRs allowed to invoke a function (comma-separated)
+	AnnotationIPAllow = "com.docker-faas.ip.allow"
+	// AnnotationIPDeny lists the CIDRs denied from invoking a function (comma-separated)
+	AnnotationIPDeny = "com.docker-faas.ip.deny"
+)
+
+// ParseFunctionIPRules reads the IP allow/deny annotations of a function
+func ParseFunctionIPRules(annotations map[string]string) (clientip.Rules, error) {
+	rules, err := clientip.NewRules(splitCSV(annotations[AnnotationIPAllow]), splitCSV(annotations[AnnotationIPDeny]))
+	if err != nil {
+		return rules, fmt.Errorf("invalid %s/%s: %w", AnnotationIPAllow, AnnotationIPDeny, err)
+	}
+	return rules, nil
+}
+
+// enforceIPAccess applies the function's IP annotations, or the route rules
+// when the function has none, writing a 403 response when the caller is
+// rejected. Callers check a missing function with nil annotations before
+// reporting it, so a caller the route rules reject cannot tell which
+// functions exist.
+func (g *Gateway) enforceIPAccess(w http.ResponseWriter, r *http.Request, functionName string, annotations map[string]string) bool {
+	rules, err := ParseFunctionIPRules(annotations)
+	if err != nil {
+		g.logger.Warnf("Ignoring invalid IP annotations for %s: %v", functionName, err)
+	}
+
+	scope, name := "function", functionName
+	if rules.Empty() {
+		if g.routeAccess == nil {
+			return true
+		}
+		routeRules, route, ok := g.routeAccess.RouteRules(r.URL.Path)
+		if !ok {
+			return true
+		}
+		rules, scope, name = routeRules, "route", route
+	}
+
+	ip := clientip.FromRequest(r)
+	if rules.Allowed(ip) {
+		return true
+	}
+
+	g.logger.Warnf("Invocation of %s denied for %s by %s rules", functionName, ip, scope)
+	metrics.RecordAccessDenied(scope, name)
+	http.Error(w, "Forbidden", http.StatusForbidden)
+	return false
+}
+
+func splitCSV(value string) []string {
+	var values []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
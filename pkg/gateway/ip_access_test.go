@@ -0,0 +1,70 @@
+package gateway
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/clientip"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeRouteAccess struct {
+	rules clientip.Rules
+}
+
+func (a fakeRouteAccess) RouteRules(path string) (clientip.Rules, string, bool) {
+	return a.rules, "/function/", !a.rules.Empty()
+}
+
+func TestHandleInvokeFunction_IPAccess(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"internal": {Name: "internal", Image: "alpine:latest", Replicas: 1, Annotations: `{"com.docker-faas.ip.deny":"203.0.113.0/24"}`},
+		"public":   {Name: "public", Image: "alpine:latest", Replicas: 1, Annotations: `{"com.docker-faas.ip.allow":"0.0.0.0/0"}`},
+		"plain":    {Name: "plain", Image: "alpine:latest", Replicas: 1},
+	}}
+	fp := &fakeProvider{containers: []*types.Container{{Name: "fn", Status: "running"}}}
+	fr := &fakeRouter{resp: &http.Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader("ok"))}}
+	gw := newTestGateway(fs, fp, fr)
+	routeRules, err := clientip.NewRules([]string{"10.0.0.0/8"}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	gw.SetRouteAccess(fakeRouteAccess{rules: routeRules})
+
+	invoke := func(name string) int {
+		req := httptest.NewRequest(http.MethodPost, "/function/"+name, strings.NewReader("ping"))
+		req.RemoteAddr = "203.0.113.7:5000"
+		req = mux.SetURLVars(req, map[string]string{"name": name})
+		recorder := httptest.NewRecorder()
+		gw.HandleInvokeFunction(recorder, req)
+		return recorder.Code
+	}
+
+	if code := invoke("internal"); code != http.StatusForbidden {
+		t.Fatalf("expected function deny list to reject the caller, got %d", code)
+	}
+	if code := invoke("plain"); code != http.StatusForbidden {
+		t.Fatalf("expected route rules to apply without annotations, got %d", code)
+	}
+	if code := invoke("public"); code != http.StatusOK {
+		t.Fatalf("expected function allow list to replace the route rules, got %d", code)
+	}
+	// A rejected caller cannot tell a missing function from a protected one
+	if code := invoke("missing"); code != http.StatusForbidden {
+		t.Fatalf("expected route rules to apply to a missing function, got %d", code)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/async-function/missing", nil)
+	req.RemoteAddr = "10.1.2.3:5000"
+	req = mux.SetURLVars(req, map[string]string{"name": "missing"})
+	recorder := httptest.NewRecorder()
+	gw.HandleInvokeFunctionAsync(recorder, req)
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected an admitted caller to get 404 for a missing function, got %d", recorder.Code)
+	}
+}
@@ -0,0 +1,86 @@
+package gateway
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/logstore"
+	"github.com/docker-faas/docker-faas/pkg/store"
+)
+
+// defaultLogSearchLimit is how many lines a log search returns by default
+const defaultLogSearchLimit = 1000
+
+// SetLogStore configures the store searched by GET /system/logs/search.
+func (g *Gateway) SetLogStore(logs LogSearcher) {
+	g.logStore = logs
+}
+
+// FunctionAnnotations returns the annotations of every stored function, which
+// carry their log retention settings.
+func (g *Gateway) FunctionAnnotations() (map[string]map[string]string, error) {
+	functions, err := g.store.ListFunctions()
+	if err != nil {
+		return nil, err
+	}
+
+	annotations := make(map[string]map[string]string, len(functions))
+	for _, fn := range functions {
+		annotations[fn.Name] = store.DecodeMap(fn.Annotations)
+	}
+	return annotations, nil
+}
+
+// HandleSearchLogs handles GET /system/logs/search and searches retained logs
+// by function, replica, call ID, text and time range. Logs of removed
+// replicas and functions are included until their retention expires.
+func (g *Gateway) HandleSearchLogs(w http.ResponseWriter, r *http.Request) {
+	if g.logStore == nil {
+		http.Error(w, "Log retention is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	params := r.URL.Query()
+	query := logstore.Query{
+		Function: normalizeFunctionName(params.Get("name")),
+		Instance: params.Get("instance"),
+		CallID:   params.Get("callId"),
+		Text:     params.Get("q"),
+		Limit:    defaultLogSearchLimit,
+	}
+	if query.Function != "" {
+		if err := validateFunctionName(query.Function); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	now := time.Now()
+	for key, target := range map[string]*time.Time{"since": &query.Since, "until": &query.Until} {
+		if raw := params.Get(key); raw != "" {
+			value, err := parseLogTime(key, raw, now)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			*target = value
+		}
+	}
+	if raw := params.Get("limit"); raw != "" {
+		limit, err := strconv.Atoi(raw)
+		if err != nil || limit < 0 {
+			http.Error(w, "invalid limit parameter", http.StatusBadRequest)
+			return
+		}
+		query.Limit = limit
+	}
+
+	messages, err := g.logStore.Query(query)
+	if err != nil {
+		g.logger.Errorf("Failed to search logs: %v", err)
+		http.Error(w, "Failed to search logs", http.StatusInternalServerError)
+		return
+	}
+	g.writeJSON(w, http.StatusOK, messages)
+}
@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/logstore"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeLogSearcher struct {
+	last logstore.Query
+}
+
+func (s *fakeLogSearcher) Query(query logstore.Query) ([]types.LogMessage, error) {
+	s.last = query
+	return []types.LogMessage{{Name: "hello", Instance: "hello-0", Text: "boom", CallID: "abc"}}, nil
+}
+
+func TestHandleSearchLogs(t *testing.T) {
+	gw := newTestGateway(&fakeStore{}, &fakeProvider{}, &fakeRouter{})
+
+	recorder := httptest.NewRecorder()
+	gw.HandleSearchLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs/search?name=hello", nil))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status %d without a log store, got %d", http.StatusNotImplemented, recorder.Code)
+	}
+
+	searcher := &fakeLogSearcher{}
+	gw.SetLogStore(searcher)
+
+	recorder = httptest.NewRecorder()
+	gw.HandleSearchLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs/search?name=hello&instance=hello-0&callId=abc&q=boom&since=1h&until=2024-05-01T10:00:00Z&limit=5", nil))
+	var messages []types.LogMessage
+	if err := json.Unmarshal(recorder.Body.Bytes(), &messages); err != nil || len(messages) != 1 || messages[0].CallID != "abc" {
+		t.Fatalf("unexpected search response %d: %s", recorder.Code, recorder.Body.String())
+	}
+	query := searcher.last
+	if query.Function != "hello" || query.Instance != "hello-0" || query.CallID != "abc" || query.Text != "boom" || query.Limit != 5 || query.Since.IsZero() || query.Until.Year() != 2024 {
+		t.Fatalf("unexpected query: %+v", query)
+	}
+
+	for _, params := range []string{"since=later", "limit=-1", "name=../etc"} {
+		recorder = httptest.NewRecorder()
+		gw.HandleSearchLogs(recorder, httptest.NewRequest(http.MethodGet, "/system/logs/search?"+params, nil))
+		if recorder.Code != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", params, recorder.Code)
+		}
+	}
+}
@@ -0,0 +1,389 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/pipeline"
+	"github.com/docker-faas/docker-faas/pkg/store"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// SetPipelineHistory configures where recent pipeline runs are kept.
+func (g *Gateway) SetPipelineHistory(history *pipeline.History) {
+	g.pipelineRuns = history
+}
+
+// HandleListPipelines handles GET /system/pipelines
+func (g *Gateway) HandleListPipelines(w http.ResponseWriter, r *http.Request) {
+	stored, err := g.store.ListPipelines()
+	if err != nil {
+		g.logger.Errorf("Failed to list pipelines: %v", err)
+		http.Error(w, "Failed to list pipelines", http.StatusInternalServerError)
+		return
+	}
+
+	pipelines := make([]*types.Pipeline, 0, len(stored))
+	for _, metadata := range stored {
+		p, err := pipelineFromMetadata(metadata)
+		if err != nil {
+			g.logger.Warnf("Failed to parse pipeline %s: %v", metadata.Name, err)
+			continue
+		}
+		pipelines = append(pipelines, p)
+	}
+
+	g.writeJSON(w, http.StatusOK, pipelines)
+}
+
+// HandleGetPipeline handles GET /system/pipelines/{name}
+func (g *Gateway) HandleGetPipeline(w http.ResponseWriter, r *http.Request) {
+	p, ok := g.lookupPipeline(w, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+	g.writeJSON(w, http.StatusOK, p)
+}
+
+// HandleCreatePipeline handles POST /system/pipelines
+func (g *Gateway) HandleCreatePipeline(w http.ResponseWriter, r *http.Request) {
+	g.savePipeline(w, r, false)
+}
+
+// HandleUpdatePipeline handles PUT /system/pipelines
+func (g *Gateway) HandleUpdatePipeline(w http.ResponseWriter, r *http.Request) {
+	g.savePipeline(w, r, true)
+}
+
+func (g *Gateway) savePipeline(w http.ResponseWriter, r *http.Request, update bool) {
+	var p types.Pipeline
+	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := pipeline.Validate(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, step := range p.Steps {
+		if _, err := g.store.GetFunction(step.Function); err != nil {
+			http.Error(w, fmt.Sprintf("step %s: function %s not found", step.Name, step.Function), http.StatusBadRequest)
+			return
+		}
+	}
+
+	existing, err := g.store.GetPipeline(p.Name)
+	if update && err != nil {
+		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		return
+	}
+	if !update && err == nil {
+		http.Error(w, fmt.Sprintf("pipeline %s already exists", p.Name), http.StatusConflict)
+		return
+	}
+
+	metadata, err := pipelineMetadata(&p)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	status := http.StatusCreated
+	if update {
+		err = g.store.UpdatePipeline(metadata)
+		metadata.CreatedAt = existing.CreatedAt
+		status = http.StatusOK
+	} else {
+		err = g.store.CreatePipeline(metadata)
+	}
+	if err != nil {
+		g.logger.Errorf("Failed to save pipeline %s: %v", p.Name, err)
+		http.Error(w, "Failed to save pipeline", http.StatusInternalServerError)
+		return
+	}
+
+	p.CreatedAt = metadata.CreatedAt
+	p.UpdatedAt = metadata.UpdatedAt
+	g.logger.Infof("Saved pipeline %s with %d steps", p.Name, len(p.Steps))
+	g.writeJSON(w, status, &p)
+}
+
+// HandleDeletePipeline handles DELETE /system/pipelines
+func (g *Gateway) HandleDeletePipeline(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name parameter is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := g.store.GetPipeline(name); err != nil {
+		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		return
+	}
+
+	if err := g.store.DeletePipeline(name); err != nil {
+		g.logger.Errorf("Failed to delete pipeline %s: %v", name, err)
+		http.Error(w, "Failed to delete pipeline", http.StatusInternalServerError)
+		return
+	}
+	g.pipelineRuns.Forget(name)
+	metrics.DeletePipelineMetrics(name)
+
+	g.logger.Infof("Deleted pipeline %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleListPipelineRuns handles GET /system/pipelines/{name}/runs
+func (g *Gateway) HandleListPipelineRuns(w http.ResponseWriter, r *http.Request) {
+	p, ok := g.lookupPipeline(w, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+	g.writeJSON(w, http.StatusOK, g.pipelineRuns.List(p.Name))
+}
+
+// HandleGetPipelineRun handles GET /system/pipelines/{name}/runs/{id}
+func (g *Gateway) HandleGetPipelineRun(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	run, ok := g.pipelineRuns.Get(vars["name"], vars["id"])
+	if !ok {
+		http.Error(w, "Pipeline run not found", http.StatusNotFound)
+		return
+	}
+	g.writeJSON(w, http.StatusOK, run)
+}
+
+// HandleInvokePipeline handles /pipeline/{name}. The caller is checked against
+// the IP rules and invocation limits of every function in the pipeline before
+// the first step runs. With async=true the run continues in the background and
+// can be followed under /system/pipelines/{name}/runs/{callId}.
+func (g *Gateway) HandleInvokePipeline(w http.ResponseWriter, r *http.Request) {
+	p, ok := g.lookupPipeline(w, mux.Vars(r)["name"])
+	if !ok {
+		return
+	}
+
+	functions := make(map[string]*types.FunctionMetadata)
+	for _, name := range pipeline.Functions(p) {
+		fn, err := g.store.GetFunction(name)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Function %s not found", name), http.StatusNotFound)
+			return
+		}
+		annotations := store.DecodeMap(fn.Annotations)
+		if !g.enforceIPAccess(w, r, name, annotations) {
+			return
+		}
+		if !g.enforceInvocationLimits(w, r, name, annotations) {
+			return
+		}
+		functions[name] = fn
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	callID := r.Header.Get("X-Call-Id")
+	if callID == "" {
+		callID = generateCallID()
+	}
+	input := pipeline.Input{Method: r.Method, Header: r.Header.Clone(), Body: body}
+	executor := pipeline.NewExecutor(g.pipelineInvoker(r, p.Name, callID, functions), g.pipelineRuns)
+	w.Header().Set("X-Call-Id", callID)
+
+	if async, _ := strconv.ParseBool(r.URL.Query().Get("async")); async {
+		// Keep the request's values (such as the resolved client IP) but not its cancellation
+		ctx := context.WithoutCancel(r.Context())
+		go func() {
+			if _, run := executor.Run(ctx, p, callID, true, input); run.Status != pipeline.StatusSucceeded {
+				g.logger.Warnf("Async pipeline %s run %s failed: %s", p.Name, callID, run.Error)
+			}
+		}()
+		g.writeJSON(w, http.StatusAccepted, map[string]string{
+			"status": "accepted",
+			"callId": callID,
+		})
+		return
+	}
+
+	resp, run := executor.Run(r.Context(), p, callID, false, input)
+	w.Header().Set("X-Pipeline-Status", run.Status)
+	if resp == nil {
+		status := http.StatusBadGateway
+		if strings.HasPrefix(run.Error, "pipeline timed out") {
+			status = http.StatusGatewayTimeout
+		}
+		http.Error(w, fmt.Sprintf("Pipeline failed: %s", run.Error), status)
+		return
+	}
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+	w.Header().Set("X-Call-Id", callID)
+	w.WriteHeader(resp.StatusCode)
+	w.Write(resp.Body)
+}
+
+// pipelineInvoker invokes pipeline steps through the router like /function/
+// calls, scaling functions from zero and recording function metrics
+func (g *Gateway) pipelineInvoker(r *http.Request, pipelineName, callID string, functions map[string]*types.FunctionMetadata) pipeline.Invoker {
+	remoteAddr, host, tlsState := r.RemoteAddr, r.Host, r.TLS
+	return func(ctx context.Context, call pipeline.Call) (*pipeline.Response, error) {
+		fn := functions[call.Function]
+		startTime := time.Now()
+
+		if err := g.ensureFunctionRunning(ctx, fn); err != nil {
+			var backoff *crashLoopBackoffError
+			if !errors.As(err, &backoff) {
+				return nil, err
+			}
+			return &pipeline.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header: http.Header{
+					"Content-Type": []string{"text/plain; charset=utf-8"},
+					"Retry-After":  []string{strconv.Itoa(ceilSeconds(backoff.retryAfter))},
+				},
+				Body: []byte(err.Error()),
+			}, nil
+		}
+
+		req, err := http.NewRequestWithContext(ctx, call.Method, "/", bytes.NewReader(call.Body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = call.Header
+		req.Header.Set("X-Call-Id", callID)
+		req.Header.Set("X-Pipeline-Name", pipelineName)
+		req.Header.Set("X-Pipeline-Step", call.Step)
+		req.RemoteAddr = remoteAddr
+		req.Host = host
+		req.TLS = tlsState
+
+		resp, err := g.router.RouteRequest(g.concurrencyContext(ctx, fn), fn.Name, req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			g.logger.Errorf("Failed to invoke function %s for pipeline %s: %v", fn.Name, pipelineName, err)
+			status := routeErrorStatus(err)
+			metrics.RecordFunctionInvocation(fn.Name, status, time.Since(startTime).Seconds())
+			return &pipeline.Response{
+				StatusCode: status,
+				Header:     http.Header{"Content-Type": []string{"text/plain; charset=utf-8"}},
+				Body:       []byte(fmt.Sprintf("Failed to invoke function: %v", err)),
+			}, nil
+		}
+		defer resp.Body.Close()
+
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read response of %s: %w", fn.Name, err)
+		}
+		metrics.RecordFunctionInvocation(fn.Name, resp.StatusCode, time.Since(startTime).Seconds())
+		return &pipeline.Response{StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+	}
+}
+
+// ensureFunctionRunning scales a function from zero when it has no running
+// replica. Returns a *crashLoopBackoffError when every replica is backing off.
+func (g *Gateway) ensureFunctionRunning(ctx context.Context, fn *types.FunctionMetadata) error {
+	containers, err := g.provider.GetFunctionContainers(ctx, fn.Name)
+	if err != nil {
+		return fmt.Errorf("failed to get containers of %s: %w", fn.Name, err)
+	}
+	available, backoff := replicaAvailability(containers, time.Now())
+	if available > 0 {
+		return nil
+	}
+	if backoff > 0 {
+		return &crashLoopBackoffError{function: fn.Name, retryAfter: backoff}
+	}
+
+	g.logger.Infof("Scaling function %s from zero for pipeline step...", fn.Name)
+	if err := g.scaleFromZero(ctx, fn); err != nil {
+		return fmt.Errorf("failed to scale %s from zero: %w", fn.Name, err)
+	}
+	if err := g.waitForFunctionReady(ctx, fn.Name, 30*time.Second); err != nil {
+		return fmt.Errorf("function %s failed to start: %w", fn.Name, err)
+	}
+	return nil
+}
+
+// lookupPipeline loads a pipeline, writing an error response when it cannot
+func (g *Gateway) lookupPipeline(w http.ResponseWriter, name string) (*types.Pipeline, bool) {
+	if err := pipeline.ValidateName(name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	metadata, err := g.store.GetPipeline(name)
+	if err != nil {
+		http.Error(w, "Pipeline not found", http.StatusNotFound)
+		return nil, false
+	}
+	p, err := pipelineFromMetadata(metadata)
+	if err != nil {
+		g.logger.Errorf("Failed to parse pipeline %s: %v", name, err)
+		http.Error(w, "Failed to parse pipeline", http.StatusInternalServerError)
+		return nil, false
+	}
+	return p, true
+}
+
+// pipelineMetadata serializes a pipeline for the store
+func pipelineMetadata(p *types.Pipeline) (*types.PipelineMetadata, error) {
+	steps, err := json.Marshal(p.Steps)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode steps: %w", err)
+	}
+	metadata := &types.PipelineMetadata{
+		Name:        p.Name,
+		Description: p.Description,
+		Steps:       string(steps),
+		Timeout:     p.Timeout,
+	}
+	if len(p.PropagateHeaders) > 0 {
+		headers, err := json.Marshal(p.PropagateHeaders)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode propagated headers: %w", err)
+		}
+		metadata.PropagateHeaders = string(headers)
+	}
+	return metadata, nil
+}
+
+// pipelineFromMetadata parses a stored pipeline
+func pipelineFromMetadata(metadata *types.PipelineMetadata) (*types.Pipeline, error) {
+	p := &types.Pipeline{
+		Name:        metadata.Name,
+		Description: metadata.Description,
+		Timeout:     metadata.Timeout,
+		CreatedAt:   metadata.CreatedAt,
+		UpdatedAt:   metadata.UpdatedAt,
+	}
+	if err := json.Unmarshal([]byte(metadata.Steps), &p.Steps); err != nil {
+		return nil, fmt.Errorf("failed to parse steps: %w", err)
+	}
+	if metadata.PropagateHeaders != "" {
+		if err := json.Unmarshal([]byte(metadata.PropagateHeaders), &p.PropagateHeaders); err != nil {
+			return nil, fmt.Errorf("failed to parse propagated headers: %w", err)
+		}
+	}
+	return p, nil
+}
@@ -0,0 +1,210 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// pipelineRouter answers each function with "<function>(<body>)" and records
+// the headers every step was invoked with; "broken" returns 500
+type pipelineRouter struct {
+	mu      sync.Mutex
+	headers map[string]http.Header
+}
+
+func (r *pipelineRouter) ForgetFunction(functionName string) {}
+
+func (r *pipelineRouter) RouteRequest(ctx context.Context, functionName string, req *http.Request) (*http.Response, error) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	r.headers[req.Header.Get("X-Pipeline-Step")] = req.Header.Clone()
+	r.mu.Unlock()
+
+	status := http.StatusOK
+	if functionName == "broken" {
+		status = http.StatusInternalServerError
+	}
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader(functionName + "(" + string(body) + ")")),
+	}, nil
+}
+
+func newPipelineTestGateway() (*Gateway, *fakeStore, *pipelineRouter) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"resize": {Name: "resize", Image: "acme/resize:1"},
+		"tag":    {Name: "tag", Image: "acme/tag:1"},
+		"broken": {Name: "broken", Image: "acme/broken:1"},
+	}}
+	fp := &fakeProvider{containers: []*types.Container{{Name: "replica", Status: "running"}}}
+	fr := &pipelineRouter{headers: make(map[string]http.Header)}
+	return newTestGateway(fs, fp, fr), fs, fr
+}
+
+func invokePipeline(gw *Gateway, name, query, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/pipeline/"+name+query, strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"name": name})
+	recorder := httptest.NewRecorder()
+	gw.HandleInvokePipeline(recorder, req)
+	return recorder
+}
+
+func TestPipelineHandlers_Lifecycle(t *testing.T) {
+	gw, fs, _ := newPipelineTestGateway()
+
+	rejected := map[string]int{
+		`{"name":"images","steps":[]}`:                                                               http.StatusBadRequest,
+		`{"name":"images","steps":[{"name":"a","function":"missing"}]}`:                              http.StatusBadRequest,
+		`{"name":"images","steps":[{"name":"a","function":"resize","dependsOn":["b"]}]}`:             http.StatusBadRequest,
+		`{"name":"images","steps":[{"name":"a","function":"resize","timeout":"soon"}]}`:              http.StatusBadRequest,
+		`{"name":"images","steps":[{"name":"a","function":"resize"},{"name":"a","function":"tag"}]}`: http.StatusBadRequest,
+	}
+	for body, status := range rejected {
+		recorder := httptest.NewRecorder()
+		gw.HandleCreatePipeline(recorder, httptest.NewRequest(http.MethodPost, "/system/pipelines", strings.NewReader(body)))
+		if recorder.Code != status {
+			t.Fatalf("expected status %d for %s, got %d: %s", status, body, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	body := `{"name":"images","steps":[{"name":"resize","function":"resize"},{"name":"tag","function":"tag","timeout":"5s"}]}`
+	recorder := httptest.NewRecorder()
+	gw.HandleCreatePipeline(recorder, httptest.NewRequest(http.MethodPost, "/system/pipelines", strings.NewReader(body)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleCreatePipeline(recorder, httptest.NewRequest(http.MethodPost, "/system/pipelines", strings.NewReader(body)))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for duplicate, got %d", http.StatusConflict, recorder.Code)
+	}
+
+	update := `{"name":"images","description":"thumbnails","steps":[{"name":"resize","function":"resize"}]}`
+	recorder = httptest.NewRecorder()
+	gw.HandleUpdatePipeline(recorder, httptest.NewRequest(http.MethodPut, "/system/pipelines", strings.NewReader(update)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleUpdatePipeline(recorder, httptest.NewRequest(http.MethodPut, "/system/pipelines", strings.NewReader(strings.Replace(update, "images", "other", 1))))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing pipeline, got %d", http.StatusNotFound, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleListPipelines(recorder, httptest.NewRequest(http.MethodGet, "/system/pipelines", nil))
+	var pipelines []types.Pipeline
+	if err := json.Unmarshal(recorder.Body.Bytes(), &pipelines); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(pipelines) != 1 || pipelines[0].Description != "thumbnails" || len(pipelines[0].Steps) != 1 {
+		t.Fatalf("unexpected pipelines: %+v", pipelines)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleDeletePipeline(recorder, httptest.NewRequest(http.MethodDelete, "/system/pipelines?name=images", nil))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, recorder.Code)
+	}
+	if _, ok := fs.pipelines["images"]; ok {
+		t.Fatal("expected pipeline to be deleted")
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleDeletePipeline(recorder, httptest.NewRequest(http.MethodDelete, "/system/pipelines?name=images", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestHandleInvokePipeline(t *testing.T) {
+	gw, _, fr := newPipelineTestGateway()
+	body := `{"name":"images","steps":[{"name":"resize","function":"resize"},{"name":"tag","function":"tag"}]}`
+	recorder := httptest.NewRecorder()
+	gw.HandleCreatePipeline(recorder, httptest.NewRequest(http.MethodPost, "/system/pipelines", strings.NewReader(body)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create pipeline: %d %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = invokePipeline(gw, "images", "", "cat.png")
+	if recorder.Code != http.StatusOK || recorder.Body.String() != "tag(resize(cat.png))" {
+		t.Fatalf("unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+	callID := recorder.Header().Get("X-Call-Id")
+	if callID == "" || recorder.Header().Get("X-Pipeline-Status") != "succeeded" {
+		t.Fatalf("expected call ID and status headers, got %v", recorder.Header())
+	}
+	if step := fr.headers["tag"]; step.Get("X-Call-Id") != callID || step.Get("X-Pipeline-Name") != "images" {
+		t.Fatalf("expected steps to share the call ID, got %v", step)
+	}
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/pipelines/images/runs/"+callID, nil), map[string]string{"name": "images", "id": callID})
+	recorder = httptest.NewRecorder()
+	gw.HandleGetPipelineRun(recorder, req)
+	var run types.PipelineRun
+	if err := json.Unmarshal(recorder.Body.Bytes(), &run); err != nil {
+		t.Fatalf("decode run: %v", err)
+	}
+	if run.Status != "succeeded" || len(run.Steps) != 2 || run.Steps[1].StatusCode != http.StatusOK {
+		t.Fatalf("unexpected run: %+v", run)
+	}
+
+	// A failing step stops the pipeline and the remaining steps are skipped
+	failing := `{"name":"failing","steps":[{"name":"resize","function":"resize"},{"name":"broken","function":"broken"},{"name":"tag","function":"tag"}]}`
+	recorder = httptest.NewRecorder()
+	gw.HandleCreatePipeline(recorder, httptest.NewRequest(http.MethodPost, "/system/pipelines", bytes.NewReader([]byte(failing))))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("create pipeline: %d %s", recorder.Code, recorder.Body.String())
+	}
+	recorder = invokePipeline(gw, "failing", "", "cat.png")
+	if recorder.Code != http.StatusBadGateway || recorder.Header().Get("X-Pipeline-Status") != "failed" || !strings.Contains(recorder.Body.String(), "step broken failed") {
+		t.Fatalf("unexpected response %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Async runs are accepted immediately and recorded in the run history
+	recorder = invokePipeline(gw, "images", "?async=true", "dog.png")
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, recorder.Code)
+	}
+	asyncID := recorder.Header().Get("X-Call-Id")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if run, ok := gw.pipelineRuns.Get("images", asyncID); ok && run.Status == "succeeded" && run.Async {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("async pipeline run did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	recorder = invokePipeline(gw, "missing", "", "")
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing pipeline, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestHandleInvokePipeline_EnforcesFunctionAccess(t *testing.T) {
+	gw, fs, _ := newPipelineTestGateway()
+	fs.functions["tag"].Annotations = `{"com.docker-faas.ip.allow":"10.0.0.0/8"}`
+	body := `{"name":"images","steps":[{"name":"resize","function":"resize"},{"name":"tag","function":"tag"}]}`
+	recorder := httptest.NewRecorder()
+	gw.HandleCreatePipeline(recorder, httptest.NewRequest(http.MethodPost, "/system/pipelines", strings.NewReader(body)))
+
+	recorder = invokePipeline(gw, "images", "", "cat.png")
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d when a step's function denies the caller, got %d", http.StatusForbidden, recorder.Code)
+	}
+}
@@ -0,0 +1,59 @@
+package gateway
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/docker-faas/docker-faas/pkg/provider"
+)
+
+// SetStateReconciler configures the function state reconciler.
+func (g *Gateway) SetStateReconciler(reconciler StateReconciler) {
+	g.reconciler = reconciler
+}
+
+// DesiredFunctions returns the stored functions and their replica counts as
+// the state the reconciler should converge to.
+func (g *Gateway) DesiredFunctions() ([]provider.DesiredFunction, error) {
+	functions, err := g.store.ListFunctions()
+	if err != nil {
+		return nil, err
+	}
+
+	desired := make([]provider.DesiredFunction, 0, len(functions))
+	for _, fn := range functions {
+		deployment, err := deploymentFromMetadata(fn)
+		if err != nil {
+			return nil, fmt.Errorf("function %s: %w", fn.Name, err)
+		}
+		desired = append(desired, provider.DesiredFunction{Deployment: deployment, Replicas: fn.Replicas})
+	}
+	return desired, nil
+}
+
+// HandleReconcilePlan handles GET /system/reconcile and reports the repairs a
+// reconciliation pass would make without applying them
+func (g *Gateway) HandleReconcilePlan(w http.ResponseWriter, r *http.Request) {
+	g.reconcile(w, r, true)
+}
+
+// HandleReconcile handles POST /system/reconcile and runs a reconciliation pass
+func (g *Gateway) HandleReconcile(w http.ResponseWriter, r *http.Request) {
+	g.reconcile(w, r, false)
+}
+
+func (g *Gateway) reconcile(w http.ResponseWriter, r *http.Request, dryRun bool) {
+	if g.reconciler == nil {
+		http.Error(w, "Function reconciliation is not enabled", http.StatusNotImplemented)
+		return
+	}
+
+	report, err := g.reconciler.Reconcile(r.Context(), dryRun)
+	if err != nil {
+		g.logger.Errorf("Function reconciliation failed: %v", err)
+		http.Error(w, "Function reconciliation failed", http.StatusInternalServerError)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, report)
+}
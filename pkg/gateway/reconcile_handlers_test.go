@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeReconciler struct {
+	dryRuns []bool
+}
+
+func (r *fakeReconciler) Reconcile(ctx context.Context, dryRun bool) (*types.ReconcileReport, error) {
+	r.dryRuns = append(r.dryRuns, dryRun)
+	return &types.ReconcileReport{
+		DryRun:  dryRun,
+		Actions: []types.ReconcileAction{{Action: "create", Function: "hello", Container: "hello-1", Reason: "missing replica"}},
+	}, nil
+}
+
+func TestReconcileHandlers(t *testing.T) {
+	gw := newTestGateway(&fakeStore{}, &fakeProvider{}, &fakeRouter{})
+
+	recorder := httptest.NewRecorder()
+	gw.HandleReconcilePlan(recorder, httptest.NewRequest(http.MethodGet, "/system/reconcile", nil))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status %d without a reconciler, got %d", http.StatusNotImplemented, recorder.Code)
+	}
+
+	reconciler := &fakeReconciler{}
+	gw.SetStateReconciler(reconciler)
+
+	recorder = httptest.NewRecorder()
+	gw.HandleReconcilePlan(recorder, httptest.NewRequest(http.MethodGet, "/system/reconcile", nil))
+	var report types.ReconcileReport
+	if err := json.Unmarshal(recorder.Body.Bytes(), &report); err != nil {
+		t.Fatalf("decode report: %v", err)
+	}
+	if !report.DryRun || len(report.Actions) != 1 || report.Actions[0].Container != "hello-1" {
+		t.Fatalf("unexpected dry-run report: %+v", report)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleReconcile(recorder, httptest.NewRequest(http.MethodPost, "/system/reconcile", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	if len(reconciler.dryRuns) != 2 || !reconciler.dryRuns[0] || reconciler.dryRuns[1] {
+		t.Fatalf("expected a dry run followed by a real pass, got %v", reconciler.dryRuns)
+	}
+}
+
+func TestDesiredFunctions(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"hello": {Name: "hello", Image: "alpine:3.19", Network: "faas-hello", Replicas: 2, EnvVars: `{"A":"1"}`},
+	}}
+	gw := newTestGateway(fs, &fakeProvider{}, &fakeRouter{})
+
+	desired, err := gw.DesiredFunctions()
+	if err != nil {
+		t.Fatalf("desired functions: %v", err)
+	}
+	if len(desired) != 1 || desired[0].Replicas != 2 || desired[0].Deployment.Image != "alpine:3.19" || desired[0].Deployment.EnvVars["A"] != "1" {
+		t.Fatalf("unexpected desired state: %+v", desired)
+	}
+
+	fs.functions["broken"] = &types.FunctionMetadata{Name: "broken", Image: "alpine", Limits: "{"}
+	if _, err := gw.DesiredFunctions(); err == nil {
+		t.Fatalf("expected undecodable metadata to fail the desired state")
+	}
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/docker-faas/docker-faas/pkg/registryauth"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// RegistryRequest represents a registry credential create/update request
+type RegistryRequest struct {
+	Server   string `json:"server"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// SetRegistryCredentials configures the registry credential store.
+func (g *Gateway) SetRegistryCredentials(credentials *registryauth.Credentials) {
+	g.registries = credentials
+}
+
+// HandleListRegistries handles GET /system/registries
+func (g *Gateway) HandleListRegistries(w http.ResponseWriter, r *http.Request) {
+	if !g.registriesEnabled(w) {
+		return
+	}
+
+	credentials, err := g.registries.List()
+	if err != nil {
+		g.logger.Errorf("Failed to list registry credentials: %v", err)
+		http.Error(w, "Failed to list registry credentials", http.StatusInternalServerError)
+		return
+	}
+	if credentials == nil {
+		credentials = []*types.RegistryCredential{}
+	}
+
+	g.writeJSON(w, http.StatusOK, credentials)
+}
+
+// HandleCreateRegistry handles POST /system/registries
+func (g *Gateway) HandleCreateRegistry(w http.ResponseWriter, r *http.Request) {
+	g.saveRegistry(w, r, false)
+}
+
+// HandleUpdateRegistry handles PUT /system/registries
+func (g *Gateway) HandleUpdateRegistry(w http.ResponseWriter, r *http.Request) {
+	g.saveRegistry(w, r, true)
+}
+
+func (g *Gateway) saveRegistry(w http.ResponseWriter, r *http.Request, update bool) {
+	if !g.registriesEnabled(w) {
+		return
+	}
+
+	var req RegistryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Server == "" || req.Username == "" || req.Password == "" {
+		http.Error(w, "Server, username and password are required", http.StatusBadRequest)
+		return
+	}
+	if _, err := registryauth.NormalizeServer(req.Server); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	exists := g.registries.Exists(req.Server)
+	if update && !exists {
+		http.Error(w, "Registry credential not found", http.StatusNotFound)
+		return
+	}
+	if !update && exists {
+		http.Error(w, "Registry credential already exists, use PUT to update", http.StatusConflict)
+		return
+	}
+
+	credential, _, err := g.registries.Set(req.Server, req.Username, req.Password)
+	if err != nil {
+		g.logger.Errorf("Failed to store registry credential: %v", err)
+		http.Error(w, "Failed to store registry credential", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusCreated
+	if update {
+		status = http.StatusOK
+	}
+	g.writeJSON(w, status, credential)
+}
+
+// HandleDeleteRegistry handles DELETE /system/registries
+func (g *Gateway) HandleDeleteRegistry(w http.ResponseWriter, r *http.Request) {
+	if !g.registriesEnabled(w) {
+		return
+	}
+
+	server := r.URL.Query().Get("server")
+	if server == "" {
+		http.Error(w, "server parameter is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := g.registries.Delete(server); err != nil {
+		switch {
+		case errors.Is(err, registryauth.ErrNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, registryauth.ErrInvalidServer):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			g.logger.Errorf("Failed to delete registry credential: %v", err)
+			http.Error(w, "Failed to delete registry credential", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// registriesEnabled rejects the request when no credential store is configured
+func (g *Gateway) registriesEnabled(w http.ResponseWriter) bool {
+	if g.registries == nil {
+		http.Error(w, "Registry credentials are not configured", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,105 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/registryauth"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestRegistryHandlers_Lifecycle(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	gw := newTestGateway(fs, &fakeProvider{}, &fakeRouter{})
+	gw.SetRegistryCredentials(registryauth.NewCredentials(fs))
+
+	body := []byte(`{"server":"https://GHCR.io/","username":"ci","password":"s3cr3t"}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleCreateRegistry(recorder, httptest.NewRequest(http.MethodPost, "/system/registries", bytes.NewReader(body)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	if strings.Contains(recorder.Body.String(), "s3cr3t") {
+		t.Fatalf("password must not be returned: %s", recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleCreateRegistry(recorder, httptest.NewRequest(http.MethodPost, "/system/registries", bytes.NewReader(body)))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for duplicate, got %d", http.StatusConflict, recorder.Code)
+	}
+
+	update := []byte(`{"server":"ghcr.io","username":"bot","password":"rotated"}`)
+	recorder = httptest.NewRecorder()
+	gw.HandleUpdateRegistry(recorder, httptest.NewRequest(http.MethodPut, "/system/registries", bytes.NewReader(update)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleListRegistries(recorder, httptest.NewRequest(http.MethodGet, "/system/registries", nil))
+	var listed []map[string]interface{}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &listed); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(listed) != 1 || listed[0]["server"] != "ghcr.io" || listed[0]["username"] != "bot" || listed[0]["password"] != nil {
+		t.Fatalf("unexpected registries: %v", listed)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteRegistry(recorder, httptest.NewRequest(http.MethodDelete, "/system/registries?server=ghcr.io", nil))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteRegistry(recorder, httptest.NewRequest(http.MethodDelete, "/system/registries?server=ghcr.io", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestHandleDeployFunction_ReportsImagePull(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	fp := &fakeProvider{imagePull: &types.ImagePullStatus{Image: "ghcr.io/acme/api:1", Policy: provider.PullPolicyAlways, Status: provider.PullStatusPulled, Registry: "ghcr.io"}}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	invalid := []byte(`{"service":"api","image":"ghcr.io/acme/api:1","pullPolicy":"Sometimes"}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(invalid)))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid pull policy to be rejected, got %d", recorder.Code)
+	}
+
+	body := []byte(`{"service":"api","image":"ghcr.io/acme/api:1","pullPolicy":"Always"}`)
+	req := httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	recorder = httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, req)
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, recorder.Code)
+	}
+	var response deployResponse
+	if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if response.ImagePull == nil || response.ImagePull.Registry != "ghcr.io" {
+		t.Fatalf("expected pull status in response, got %+v", response)
+	}
+	if fp.lastDeploy.PullPolicy != provider.PullPolicyAlways || fs.lastCreated.PullPolicy != provider.PullPolicyAlways {
+		t.Fatalf("expected pull policy to reach the provider and store")
+	}
+
+	fp.deployErr = fmt.Errorf("%w: ghcr.io/acme/web:1: pull access denied", provider.ErrImagePull)
+	body = []byte(`{"service":"web","image":"ghcr.io/acme/web:1"}`)
+	recorder = httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(body)))
+	if recorder.Code != http.StatusBadGateway || !strings.Contains(recorder.Body.String(), "pull access denied") {
+		t.Fatalf("expected pull failure to return 502, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+}
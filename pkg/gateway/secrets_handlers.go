@@ -2,20 +2,49 @@ package gateway
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	"github.com/docker-faas/docker-faas/pkg/store"
+	"github.com/docker-faas/docker-faas/pkg/types"
 )
 
 // SecretRequest represents a secret create/update request
 type SecretRequest struct {
-	Name  string `json:"name"`
-	Value string `json:"value"`
+	Name        string            `json:"name"`
+	Value       string            `json:"value"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
 }
 
 // SecretResponse represents a secret in responses
 type SecretResponse struct {
-	Name string `json:"name"`
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Labels      map[string]string `json:"labels,omitempty"`
+	Version     int               `json:"version,omitempty"`
+	CreatedAt   time.Time         `json:"createdAt,omitempty"`
+	UpdatedAt   time.Time         `json:"updatedAt,omitempty"`
+}
+
+// SecretDetailResponse describes a secret and the functions that reference it
+type SecretDetailResponse struct {
+	SecretResponse
+	UsedBy []string `json:"usedBy"`
+}
+
+// SecretUpdateResponse reports a secret update and the functions that received it
+type SecretUpdateResponse struct {
+	SecretResponse
+	RefreshedFunctions []string `json:"refreshedFunctions"`
 }
 
 // HandleCreateSecret handles POST /system/secrets
@@ -31,14 +60,38 @@ func (g *Gateway) HandleCreateSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	labels, err := store.EncodeMap(req.Labels)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Failed to encode labels: %v", err), http.StatusBadRequest)
+		return
+	}
+
 	secretManager := g.provider.GetSecretManager()
 	if err := secretManager.CreateSecret(req.Name, req.Value); err != nil {
 		g.logger.Errorf("Failed to create secret: %v", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), secretErrorStatus(err, http.StatusInternalServerError))
+		return
+	}
+
+	// Drop metadata left behind by a secret removed outside the API
+	if err := g.store.DeleteSecretMetadata(req.Name); err != nil {
+		g.logger.Warnf("Failed to reset metadata for secret %s: %v", req.Name, err)
+	}
+	if err := g.store.UpsertSecretMetadata(&types.SecretMetadata{
+		Name:        req.Name,
+		Description: req.Description,
+		Labels:      labels,
+	}); err != nil {
+		g.logger.Errorf("Failed to store secret metadata: %v", err)
+		// Do not leave a secret behind that the API reports as not created
+		if err := secretManager.DeleteSecret(req.Name); err != nil {
+			g.logger.Errorf("Failed to remove secret %s after its metadata could not be stored: %v", req.Name, err)
+		}
+		http.Error(w, "Failed to store secret metadata", http.StatusInternalServerError)
 		return
 	}
 
-	g.writeJSON(w, http.StatusCreated, SecretResponse{Name: req.Name})
+	g.writeJSON(w, http.StatusCreated, g.secretResponse(req.Name))
 }
 
 // HandleUpdateSecret handles PUT /system/secrets
@@ -54,14 +107,52 @@ func (g *Gateway) HandleUpdateSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep existing description and labels unless the request replaces them
+	metadata := &types.SecretMetadata{Name: req.Name}
+	if existing, err := g.store.GetSecretMetadata(req.Name); err == nil {
+		metadata.Description = existing.Description
+		metadata.Labels = existing.Labels
+	}
+	if req.Description != "" {
+		metadata.Description = req.Description
+	}
+	if req.Labels != nil {
+		labels, err := store.EncodeMap(req.Labels)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to encode labels: %v", err), http.StatusBadRequest)
+			return
+		}
+		metadata.Labels = labels
+	}
+
 	secretManager := g.provider.GetSecretManager()
 	if err := secretManager.UpdateSecret(req.Name, req.Value); err != nil {
 		g.logger.Errorf("Failed to update secret: %v", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), secretErrorStatus(err, http.StatusNotFound))
+		return
+	}
+
+	// Push the new value into every running function that mounts it
+	refreshed, err := secretManager.RefreshMaterializedSecret(req.Name)
+	if err != nil {
+		g.logger.Errorf("Failed to refresh secret %s for running functions: %v", req.Name, err)
+		http.Error(w, fmt.Sprintf("Secret updated but refresh failed: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	g.writeJSON(w, http.StatusOK, SecretResponse{Name: req.Name})
+	if err := g.store.UpsertSecretMetadata(metadata); err != nil {
+		g.logger.Errorf("Failed to update secret metadata: %v", err)
+		http.Error(w, "Secret updated but its metadata could not be stored", http.StatusInternalServerError)
+		return
+	}
+	if refreshed == nil {
+		refreshed = []string{}
+	}
+
+	g.writeJSON(w, http.StatusOK, SecretUpdateResponse{
+		SecretResponse:     g.secretResponse(req.Name),
+		RefreshedFunctions: refreshed,
+	})
 }
 
 // HandleDeleteSecret handles DELETE /system/secrets
@@ -71,14 +162,33 @@ func (g *Gateway) HandleDeleteSecret(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "name parameter is required", http.StatusBadRequest)
 		return
 	}
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	usedBy, err := g.functionsUsingSecret(secretName)
+	if err != nil {
+		g.logger.Errorf("Failed to check secret usage: %v", err)
+		http.Error(w, "Failed to check secret usage", http.StatusInternalServerError)
+		return
+	}
+	if len(usedBy) > 0 && !force {
+		http.Error(w, fmt.Sprintf("secret %s is used by functions: %s (use force=true to delete anyway)", secretName, strings.Join(usedBy, ", ")), http.StatusConflict)
+		return
+	}
+	if len(usedBy) > 0 {
+		g.logger.Warnf("Force deleting secret %s still used by: %s", secretName, strings.Join(usedBy, ", "))
+	}
 
 	secretManager := g.provider.GetSecretManager()
 	if err := secretManager.DeleteSecret(secretName); err != nil {
 		g.logger.Errorf("Failed to delete secret: %v", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		http.Error(w, err.Error(), secretErrorStatus(err, http.StatusNotFound))
 		return
 	}
 
+	if err := g.store.DeleteSecretMetadata(secretName); err != nil {
+		g.logger.Warnf("Failed to delete metadata for secret %s: %v", secretName, err)
+	}
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
@@ -92,9 +202,18 @@ func (g *Gateway) HandleListSecrets(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	metadata := make(map[string]*types.SecretMetadata)
+	if stored, err := g.store.ListSecretMetadata(); err == nil {
+		for _, meta := range stored {
+			metadata[meta.Name] = meta
+		}
+	} else {
+		g.logger.Warnf("Failed to list secret metadata: %v", err)
+	}
+
 	secrets := make([]SecretResponse, 0, len(secretNames))
 	for _, name := range secretNames {
-		secrets = append(secrets, SecretResponse{Name: name})
+		secrets = append(secrets, newSecretResponse(name, metadata[name]))
 	}
 
 	g.writeJSON(w, http.StatusOK, secrets)
@@ -118,5 +237,82 @@ func (g *Gateway) HandleGetSecret(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	g.writeJSON(w, http.StatusOK, SecretResponse{Name: secretName})
+	usedBy, err := g.functionsUsingSecret(secretName)
+	if err != nil {
+		g.logger.Errorf("Failed to check secret usage: %v", err)
+		http.Error(w, "Failed to check secret usage", http.StatusInternalServerError)
+		return
+	}
+
+	g.writeJSON(w, http.StatusOK, SecretDetailResponse{
+		SecretResponse: g.secretResponse(secretName),
+		UsedBy:         usedBy,
+	})
+}
+
+// secretResponse builds a response from stored metadata, falling back to the name only
+func (g *Gateway) secretResponse(name string) SecretResponse {
+	metadata, err := g.store.GetSecretMetadata(name)
+	if err != nil {
+		return newSecretResponse(name, nil)
+	}
+	return newSecretResponse(name, metadata)
+}
+
+func newSecretResponse(name string, metadata *types.SecretMetadata) SecretResponse {
+	resp := SecretResponse{Name: name}
+	if metadata == nil {
+		return resp
+	}
+	resp.Description = metadata.Description
+	if metadata.Labels != "" {
+		resp.Labels = store.DecodeMap(metadata.Labels)
+	}
+	resp.Version = metadata.Version
+	resp.CreatedAt = metadata.CreatedAt
+	resp.UpdatedAt = metadata.UpdatedAt
+	return resp
+}
+
+// validateSecretsAvailable rejects references to missing secrets unless auto-create is enabled
+func (g *Gateway) validateSecretsAvailable(secretNames []string) error {
+	secretManager := g.provider.GetSecretManager()
+	if secretManager == nil || len(secretNames) == 0 || secretManager.AutoCreateEnabled() {
+		return nil
+	}
+	return secretManager.ValidateSecrets(secretNames)
+}
+
+// secretErrorStatus maps secret manager errors to HTTP status codes
+func secretErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, secrets.ErrReadOnlyBackend):
+		return http.StatusMethodNotAllowed
+	case errors.Is(err, secrets.ErrSecretExists):
+		return http.StatusConflict
+	case errors.Is(err, secrets.ErrSecretNotFound):
+		return http.StatusNotFound
+	}
+	return fallback
+}
+
+// functionsUsingSecret returns the sorted names of deployed functions that
+// reference a secret by its backend path
+func (g *Gateway) functionsUsingSecret(secretPath string) ([]string, error) {
+	functions, err := g.store.ListFunctions()
+	if err != nil {
+		return nil, err
+	}
+
+	usedBy := []string{}
+	for _, fn := range functions {
+		for _, raw := range store.DecodeSlice(fn.Secrets) {
+			if ref, err := secrets.ParseSecretRef(raw); err == nil && ref.Path == secretPath {
+				usedBy = append(usedBy, fn.Name)
+				break
+			}
+		}
+	}
+	sort.Strings(usedBy)
+	return usedBy, nil
 }
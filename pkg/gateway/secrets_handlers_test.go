@@ -0,0 +1,180 @@
+package gateway
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func newTestSecretManager(t *testing.T) *secrets.SecretManager {
+	t.Helper()
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	sm, err := secrets.NewSecretManager(filepath.Join(t.TempDir(), "secrets"), logger)
+	if err != nil {
+		t.Fatalf("failed to create secret manager: %v", err)
+	}
+	if err := sm.SetRuntimePath(filepath.Join(t.TempDir(), "runtime")); err != nil {
+		t.Fatalf("failed to set runtime path: %v", err)
+	}
+	return sm
+}
+
+func TestHandleDeleteSecret_RejectsSecretInUse(t *testing.T) {
+	sm := newTestSecretManager(t)
+	if err := sm.CreateSecret("db-password", "hunter2"); err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"api": {Name: "api", Image: "example/api:latest", Secrets: `["db-password"]`},
+	}}
+	gw := newTestGateway(fs, &fakeProvider{secretManager: sm}, &fakeRouter{})
+
+	req := httptest.NewRequest(http.MethodDelete, "/system/secrets?name=db-password", nil)
+	recorder := httptest.NewRecorder()
+	gw.HandleDeleteSecret(recorder, req)
+
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected status %d, got %d", http.StatusConflict, recorder.Code)
+	}
+	if !sm.SecretExists("db-password") {
+		t.Fatalf("expected secret to be kept")
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/system/secrets?name=db-password&force=true", nil)
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteSecret(recorder, req)
+
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, recorder.Code)
+	}
+	if sm.SecretExists("db-password") {
+		t.Fatalf("expected secret to be deleted")
+	}
+}
+
+func TestHandleGetSecret_ReportsMetadataAndUsage(t *testing.T) {
+	sm := newTestSecretManager(t)
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{
+		"worker": {Name: "worker", Image: "example/worker:latest", Secrets: `["api-key"]`},
+		"api":    {Name: "api", Image: "example/api:latest", Secrets: `["api-key","other"]`},
+		"web":    {Name: "web", Image: "example/web:latest"},
+	}}
+	gw := newTestGateway(fs, &fakeProvider{secretManager: sm}, &fakeRouter{})
+
+	create := []byte(`{"name":"api-key","value":"v1","description":"Upstream API key","labels":{"team":"core"}}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleCreateSecret(recorder, httptest.NewRequest(http.MethodPost, "/system/secrets", bytes.NewReader(create)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d", http.StatusCreated, recorder.Code)
+	}
+
+	update := []byte(`{"name":"api-key","value":"v2"}`)
+	recorder = httptest.NewRecorder()
+	gw.HandleUpdateSecret(recorder, httptest.NewRequest(http.MethodPut, "/system/secrets", bytes.NewReader(update)))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/system/secrets/api-key", nil)
+	req = mux.SetURLVars(req, map[string]string{"name": "api-key"})
+	recorder = httptest.NewRecorder()
+	gw.HandleGetSecret(recorder, req)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, recorder.Code)
+	}
+	var resp SecretDetailResponse
+	if err := json.NewDecoder(recorder.Body).Decode(&resp); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if resp.Version != 2 {
+		t.Fatalf("expected version 2, got %d", resp.Version)
+	}
+	if resp.Description != "Upstream API key" || resp.Labels["team"] != "core" {
+		t.Fatalf("expected metadata to be kept across updates, got %#v", resp.SecretResponse)
+	}
+	if len(resp.UsedBy) != 2 || resp.UsedBy[0] != "api" || resp.UsedBy[1] != "worker" {
+		t.Fatalf("expected usedBy [api worker], got %v", resp.UsedBy)
+	}
+}
+
+func TestHandleDeployFunction_RejectsMissingSecret(t *testing.T) {
+	sm := newTestSecretManager(t)
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	fp := &fakeProvider{secretManager: sm}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	body := []byte(`{"service":"hello","image":"example/hello:latest","secrets":["missing"]}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(body)))
+
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, recorder.Code)
+	}
+	if fp.deployCalled {
+		t.Fatalf("expected provider deploy not to be called")
+	}
+
+	sm.SetAutoCreate(true)
+	recorder = httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(body)))
+
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected status %d, got %d", http.StatusAccepted, recorder.Code)
+	}
+}
+
+func TestHandleCreateSecret_ReadOnlyBackend(t *testing.T) {
+	sm := newTestSecretManager(t)
+	if err := sm.SetBackend(secrets.NewEnvBackend("")); err != nil {
+		t.Fatalf("failed to set backend: %v", err)
+	}
+	gw := newTestGateway(&fakeStore{}, &fakeProvider{secretManager: sm}, &fakeRouter{})
+
+	body := []byte(`{"name":"api-key","value":"v1"}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleCreateSecret(recorder, httptest.NewRequest(http.MethodPost, "/system/secrets", bytes.NewReader(body)))
+
+	if recorder.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected status %d, got %d", http.StatusMethodNotAllowed, recorder.Code)
+	}
+}
+
+func TestHandleSecrets_MetadataFailure(t *testing.T) {
+	sm := newTestSecretManager(t)
+	fs := &fakeStore{secretErr: errors.New("database is locked")}
+	gw := newTestGateway(fs, &fakeProvider{secretManager: sm}, &fakeRouter{})
+
+	body := []byte(`{"name":"api-key","value":"v1"}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleCreateSecret(recorder, httptest.NewRequest(http.MethodPost, "/system/secrets", bytes.NewReader(body)))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+	if sm.SecretExists("api-key") {
+		t.Fatalf("expected the secret to be removed when its metadata is not stored")
+	}
+
+	if err := sm.CreateSecret("api-key", "v1"); err != nil {
+		t.Fatalf("failed to create secret: %v", err)
+	}
+	body = []byte(`{"name":"api-key","value":"v2"}`)
+	recorder = httptest.NewRecorder()
+	gw.HandleUpdateSecret(recorder, httptest.NewRequest(http.MethodPut, "/system/secrets", bytes.NewReader(body)))
+	if recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("expected status %d, got %d", http.StatusInternalServerError, recorder.Code)
+	}
+}
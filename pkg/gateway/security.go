@@ -0,0 +1,52 @@
+package gateway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// validateSecurity checks a deployment's security profile against the gateway
+// policy, returning the HTTP status to reject it with
+func (g *Gateway) validateSecurity(spec *types.FunctionSecurity) (int, error) {
+	policy := g.securityPolicy
+	if policy == nil {
+		policy = provider.DefaultSecurityPolicy()
+	}
+	if err := policy.Validate(spec); err != nil {
+		err = fmt.Errorf("invalid security profile: %w", err)
+		if errors.Is(err, provider.ErrSecurityPolicy) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// encodeSecurity serializes a security profile for the store
+func encodeSecurity(spec *types.FunctionSecurity) (string, error) {
+	if spec == nil {
+		return "", nil
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode security: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeSecurity parses a stored security profile
+func decodeSecurity(value string) (*types.FunctionSecurity, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var spec types.FunctionSecurity
+	if err := json.Unmarshal([]byte(value), &spec); err != nil {
+		return nil, fmt.Errorf("failed to parse security: %w", err)
+	}
+	return &spec, nil
+}
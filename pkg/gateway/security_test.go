@@ -0,0 +1,48 @@
+package gateway
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestHandleDeployFunction_SecurityPolicy(t *testing.T) {
+	deploy := func(gw *Gateway, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/system/functions", strings.NewReader(body))
+		recorder := httptest.NewRecorder()
+		gw.HandleDeployFunction(recorder, req)
+		return recorder.Code
+	}
+
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	fp := &fakeProvider{}
+	gw := newTestGateway(fs, fp, &fakeRouter{})
+
+	if code := deploy(gw, `{"service":"root","image":"alpine","security":{"runAsUser":"0"}}`); code != http.StatusForbidden {
+		t.Fatalf("expected root user to be forbidden, got %d", code)
+	}
+	if code := deploy(gw, `{"service":"caps","image":"alpine","security":{"capAdd":["SYS_ADMIN"]}}`); code != http.StatusForbidden {
+		t.Fatalf("expected SYS_ADMIN to be forbidden, got %d", code)
+	}
+	if code := deploy(gw, `{"service":"tmp","image":"alpine","security":{"tmpfs":{"tmp":""}}}`); code != http.StatusBadRequest {
+		t.Fatalf("expected relative tmpfs path to be rejected, got %d", code)
+	}
+	if fp.deployCalled {
+		t.Fatalf("expected rejected profiles not to be deployed")
+	}
+
+	body := `{"service":"safe","image":"alpine","readOnlyRootFilesystem":true,"security":{"runAsUser":"1000","capAdd":["cap_net_bind_service"],"pidsLimit":64,"tmpfs":{"/tmp":"size=64m"}}}`
+	if code := deploy(gw, body); code != http.StatusAccepted {
+		t.Fatalf("expected allowed profile to deploy, got %d", code)
+	}
+	if fp.lastDeploy.Security == nil || fp.lastDeploy.Security.RunAsUser != "1000" {
+		t.Fatalf("expected security profile to reach the provider, got %#v", fp.lastDeploy.Security)
+	}
+	stored, err := decodeSecurity(fs.lastCreated.Security)
+	if err != nil || stored == nil || *stored.PidsLimit != 64 || stored.Tmpfs["/tmp"] != "size=64m" {
+		t.Fatalf("expected security profile to be stored, got %#v (%v)", stored, err)
+	}
+}
@@ -0,0 +1,54 @@
+package gateway
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// SetStatsSampler configures the sampler behind /system/function/{name}/stats.
+func (g *Gateway) SetStatsSampler(sampler StatsSampler) {
+	g.stats = sampler
+}
+
+// HandleFunctionStats handles GET /system/function/{name}/stats and reports
+// the live CPU, memory, network and block I/O usage of each replica together
+// with the recent samples kept by the background sampler
+func (g *Gateway) HandleFunctionStats(w http.ResponseWriter, r *http.Request) {
+	if g.stats == nil {
+		http.Error(w, "Stats are not supported by this provider", http.StatusNotImplemented)
+		return
+	}
+
+	functionName := normalizeFunctionName(mux.Vars(r)["name"])
+	if functionName == "" {
+		http.Error(w, "Function name is required", http.StatusBadRequest)
+		return
+	}
+	if err := validateFunctionName(functionName); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := g.store.GetFunction(functionName); err != nil {
+		http.Error(w, "Function not found", http.StatusNotFound)
+		return
+	}
+
+	replicas, err := g.stats.Live(r.Context(), functionName)
+	if err != nil {
+		g.logger.Errorf("Failed to read stats of %s: %v", functionName, err)
+		http.Error(w, "Failed to read function stats", http.StatusInternalServerError)
+		return
+	}
+	if replicas == nil {
+		replicas = []types.ReplicaStats{}
+	}
+
+	g.writeJSON(w, http.StatusOK, types.FunctionStats{
+		Name:     functionName,
+		Replicas: replicas,
+		History:  g.stats.History(functionName),
+	})
+}
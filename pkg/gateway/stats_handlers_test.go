@@ -0,0 +1,65 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeStatsSampler struct {
+	replicas []types.ReplicaStats
+	history  map[string][]types.StatsSample
+}
+
+func (s *fakeStatsSampler) Live(ctx context.Context, functionName string) ([]types.ReplicaStats, error) {
+	return s.replicas, nil
+}
+
+func (s *fakeStatsSampler) History(functionName string) map[string][]types.StatsSample {
+	return s.history
+}
+
+func TestHandleFunctionStats(t *testing.T) {
+	fs := &fakeStore{functions: map[string]*types.FunctionMetadata{"api": {Name: "api", Image: "acme/api:1"}}}
+	gw := newTestGateway(fs, &fakeProvider{}, &fakeRouter{})
+
+	statsRequest := func(name string) *httptest.ResponseRecorder {
+		req := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/system/function/"+name+"/stats", nil), map[string]string{"name": name})
+		recorder := httptest.NewRecorder()
+		gw.HandleFunctionStats(recorder, req)
+		return recorder
+	}
+
+	if recorder := statsRequest("api"); recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status %d without a sampler, got %d", http.StatusNotImplemented, recorder.Code)
+	}
+
+	now := time.Now().UTC()
+	gw.SetStatsSampler(&fakeStatsSampler{
+		replicas: []types.ReplicaStats{{Replica: "api-1", CPUPercent: 12.5, MemoryUsage: 64 << 20, MemoryLimit: 128 << 20, MemoryPercent: 50}},
+		history:  map[string][]types.StatsSample{"api-1": {{Timestamp: now, CPUPercent: 10}, {Timestamp: now, CPUPercent: 12.5}}},
+	})
+
+	recorder := statsRequest("api")
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusOK, recorder.Code, recorder.Body.String())
+	}
+	var stats types.FunctionStats
+	if err := json.Unmarshal(recorder.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.Name != "api" || len(stats.Replicas) != 1 || stats.Replicas[0].MemoryPercent != 50 || len(stats.History["api-1"]) != 2 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+
+	if recorder := statsRequest("missing"); recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d for a missing function, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
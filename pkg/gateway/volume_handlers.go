@@ -0,0 +1,220 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// VolumeRequest represents a named volume create request
+type VolumeRequest struct {
+	Name   string            `json:"name"`
+	Owner  string            `json:"owner,omitempty"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// SetVolumeManager configures the manager behind /system/volumes.
+func (g *Gateway) SetVolumeManager(volumes VolumeManager) {
+	g.volumes = volumes
+}
+
+// HandleListVolumes handles GET /system/volumes
+func (g *Gateway) HandleListVolumes(w http.ResponseWriter, r *http.Request) {
+	if !g.volumesEnabled(w) {
+		return
+	}
+
+	volumes, err := g.volumes.List(r.Context())
+	if err != nil {
+		g.logger.Errorf("Failed to list volumes: %v", err)
+		http.Error(w, "Failed to list volumes", http.StatusInternalServerError)
+		return
+	}
+	usage, err := g.volumeUsage()
+	if err != nil {
+		g.logger.Errorf("Failed to check volume usage: %v", err)
+		http.Error(w, "Failed to check volume usage", http.StatusInternalServerError)
+		return
+	}
+	for _, volume := range volumes {
+		volume.UsedBy = usage[volume.Name]
+	}
+
+	g.writeJSON(w, http.StatusOK, volumes)
+}
+
+// HandleCreateVolume handles POST /system/volumes
+func (g *Gateway) HandleCreateVolume(w http.ResponseWriter, r *http.Request) {
+	if !g.volumesEnabled(w) {
+		return
+	}
+
+	var req VolumeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := provider.ValidateVolumeName(req.Name); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Owner != "" {
+		if err := validateFunctionName(req.Owner); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	volume, err := g.volumes.Create(r.Context(), req.Name, req.Owner, req.Labels)
+	if err != nil {
+		if errors.Is(err, provider.ErrVolumeExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		g.logger.Errorf("Failed to create volume: %v", err)
+		http.Error(w, "Failed to create volume", http.StatusInternalServerError)
+		return
+	}
+
+	g.logger.Infof("Created volume %s", volume.Name)
+	g.writeJSON(w, http.StatusCreated, volume)
+}
+
+// HandleDeleteVolume handles DELETE /system/volumes. Volumes referenced by a
+// function are kept unless force=true; mounted volumes are always kept.
+func (g *Gateway) HandleDeleteVolume(w http.ResponseWriter, r *http.Request) {
+	if !g.volumesEnabled(w) {
+		return
+	}
+
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name parameter is required", http.StatusBadRequest)
+		return
+	}
+	force, _ := strconv.ParseBool(r.URL.Query().Get("force"))
+
+	usage, err := g.volumeUsage()
+	if err != nil {
+		g.logger.Errorf("Failed to check volume usage: %v", err)
+		http.Error(w, "Failed to check volume usage", http.StatusInternalServerError)
+		return
+	}
+	if usedBy := usage[name]; len(usedBy) > 0 && !force {
+		http.Error(w, fmt.Sprintf("volume %s is used by functions: %s (use force=true to delete anyway)", name, strings.Join(usedBy, ", ")), http.StatusConflict)
+		return
+	}
+
+	if err := g.volumes.Remove(r.Context(), name); err != nil {
+		switch {
+		case errors.Is(err, provider.ErrVolumeNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+		case errors.Is(err, provider.ErrVolumeNotManaged):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, provider.ErrVolumeInUse):
+			http.Error(w, err.Error(), http.StatusConflict)
+		default:
+			g.logger.Errorf("Failed to delete volume: %v", err)
+			http.Error(w, "Failed to delete volume", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	g.logger.Infof("Deleted volume %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// volumesEnabled rejects the request when no volume manager is configured
+func (g *Gateway) volumesEnabled(w http.ResponseWriter) bool {
+	if g.volumes == nil {
+		http.Error(w, "Volumes are not supported by this provider", http.StatusNotImplemented)
+		return false
+	}
+	return true
+}
+
+// volumeUsage returns the sorted names of the functions mounting each named volume
+func (g *Gateway) volumeUsage() (map[string][]string, error) {
+	functions, err := g.store.ListFunctions()
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string][]string)
+	for _, fn := range functions {
+		volumes, err := decodeVolumes(fn.Volumes)
+		if err != nil {
+			g.logger.Warnf("Failed to parse volumes for %s: %v", fn.Name, err)
+			continue
+		}
+		for _, volume := range volumes {
+			if volume.Type == "" || volume.Type == provider.VolumeTypeVolume {
+				usage[volume.Source] = append(usage[volume.Source], fn.Name)
+			}
+		}
+	}
+	for _, usedBy := range usage {
+		sort.Strings(usedBy)
+	}
+	return usage, nil
+}
+
+// validateVolumes checks a deployment's volumes against the gateway policy,
+// returning the HTTP status to reject them with
+func (g *Gateway) validateVolumes(ctx context.Context, deployment *types.FunctionDeployment) (int, error) {
+	if len(deployment.Volumes) == 0 {
+		return http.StatusOK, nil
+	}
+	policy := g.securityPolicy
+	if policy == nil {
+		policy = provider.DefaultSecurityPolicy()
+	}
+	err := policy.ValidateVolumes(deployment.Volumes, deployment.Security)
+	if err == nil && g.volumes != nil {
+		// The provider checks ownership again when it creates containers
+		if err = g.volumes.Check(ctx, deployment.Service, deployment.Volumes); err != nil && !errors.Is(err, provider.ErrSecurityPolicy) {
+			g.logger.Warnf("Failed to check volumes of %s: %v", deployment.Service, err)
+			err = nil
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("invalid volumes: %w", err)
+		if errors.Is(err, provider.ErrSecurityPolicy) {
+			return http.StatusForbidden, err
+		}
+		return http.StatusBadRequest, err
+	}
+	return http.StatusOK, nil
+}
+
+// encodeVolumes serializes function volumes for the store
+func encodeVolumes(volumes []types.FunctionVolume) (string, error) {
+	if len(volumes) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(volumes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode volumes: %w", err)
+	}
+	return string(data), nil
+}
+
+// decodeVolumes parses stored function volumes
+func decodeVolumes(value string) ([]types.FunctionVolume, error) {
+	if value == "" {
+		return nil, nil
+	}
+	var volumes []types.FunctionVolume
+	if err := json.Unmarshal([]byte(value), &volumes); err != nil {
+		return nil, fmt.Errorf("failed to parse volumes: %w", err)
+	}
+	return volumes, nil
+}
@@ -0,0 +1,163 @@
+package gateway
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// fakeVolumeManager keeps volumes in memory; "foreign" is not gateway managed
+type fakeVolumeManager struct {
+	volumes map[string]*types.VolumeInfo
+}
+
+func (m *fakeVolumeManager) List(ctx context.Context) ([]*types.VolumeInfo, error) {
+	volumes := make([]*types.VolumeInfo, 0, len(m.volumes))
+	for _, v := range m.volumes {
+		volumes = append(volumes, v)
+	}
+	return volumes, nil
+}
+
+func (m *fakeVolumeManager) Create(ctx context.Context, name, owner string, labels map[string]string) (*types.VolumeInfo, error) {
+	if _, ok := m.volumes[name]; ok {
+		return nil, fmt.Errorf("volume %s: %w", name, provider.ErrVolumeExists)
+	}
+	m.volumes[name] = &types.VolumeInfo{Name: name, Driver: "local", Owner: owner, Labels: labels}
+	return m.volumes[name], nil
+}
+
+func (m *fakeVolumeManager) Remove(ctx context.Context, name string) error {
+	if name == "foreign" {
+		return fmt.Errorf("volume %s: %w", name, provider.ErrVolumeNotManaged)
+	}
+	if _, ok := m.volumes[name]; !ok {
+		return fmt.Errorf("volume %s: %w", name, provider.ErrVolumeNotFound)
+	}
+	delete(m.volumes, name)
+	return nil
+}
+
+func (m *fakeVolumeManager) Check(ctx context.Context, functionName string, volumes []types.FunctionVolume) error {
+	for _, v := range volumes {
+		if v.Source == "foreign" {
+			return fmt.Errorf("volume %s: %w", v.Source, provider.ErrVolumeNotManaged)
+		}
+	}
+	return nil
+}
+
+func TestVolumeHandlers_Lifecycle(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	gw := newTestGateway(fs, &fakeProvider{}, &fakeRouter{})
+
+	recorder := httptest.NewRecorder()
+	gw.HandleListVolumes(recorder, httptest.NewRequest(http.MethodGet, "/system/volumes", nil))
+	if recorder.Code != http.StatusNotImplemented {
+		t.Fatalf("expected status %d without a volume manager, got %d", http.StatusNotImplemented, recorder.Code)
+	}
+	gw.SetVolumeManager(&fakeVolumeManager{volumes: make(map[string]*types.VolumeInfo)})
+
+	body := []byte(`{"name":"cache","owner":"api"}`)
+	recorder = httptest.NewRecorder()
+	gw.HandleCreateVolume(recorder, httptest.NewRequest(http.MethodPost, "/system/volumes", bytes.NewReader(body)))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("expected status %d, got %d: %s", http.StatusCreated, recorder.Code, recorder.Body.String())
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleCreateVolume(recorder, httptest.NewRequest(http.MethodPost, "/system/volumes", bytes.NewReader(body)))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for duplicate, got %d", http.StatusConflict, recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleCreateVolume(recorder, httptest.NewRequest(http.MethodPost, "/system/volumes", bytes.NewReader([]byte(`{"name":"../cache"}`))))
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected status %d for an invalid name, got %d", http.StatusBadRequest, recorder.Code)
+	}
+
+	deploy := []byte(`{"service":"api","image":"acme/api:1","volumes":[{"source":"cache","target":"/data"},{"type":"tmpfs","target":"/scratch","size":"64Mi"}]}`)
+	recorder = httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(deploy)))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected deploy to succeed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleListVolumes(recorder, httptest.NewRequest(http.MethodGet, "/system/volumes", nil))
+	var volumes []types.VolumeInfo
+	if err := json.Unmarshal(recorder.Body.Bytes(), &volumes); err != nil {
+		t.Fatalf("decode list: %v", err)
+	}
+	if len(volumes) != 1 || volumes[0].Owner != "api" || len(volumes[0].UsedBy) != 1 || volumes[0].UsedBy[0] != "api" {
+		t.Fatalf("unexpected volumes: %+v", volumes)
+	}
+
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteVolume(recorder, httptest.NewRequest(http.MethodDelete, "/system/volumes?name=cache", nil))
+	if recorder.Code != http.StatusConflict {
+		t.Fatalf("expected status %d for a volume in use, got %d", http.StatusConflict, recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteVolume(recorder, httptest.NewRequest(http.MethodDelete, "/system/volumes?name=foreign", nil))
+	if recorder.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d for a foreign volume, got %d", http.StatusForbidden, recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteVolume(recorder, httptest.NewRequest(http.MethodDelete, "/system/volumes?name=cache&force=true", nil))
+	if recorder.Code != http.StatusNoContent {
+		t.Fatalf("expected status %d, got %d", http.StatusNoContent, recorder.Code)
+	}
+	recorder = httptest.NewRecorder()
+	gw.HandleDeleteVolume(recorder, httptest.NewRequest(http.MethodDelete, "/system/volumes?name=cache&force=true", nil))
+	if recorder.Code != http.StatusNotFound {
+		t.Fatalf("expected status %d, got %d", http.StatusNotFound, recorder.Code)
+	}
+}
+
+func TestHandleDeployFunction_Volumes(t *testing.T) {
+	fs := &fakeStore{functions: make(map[string]*types.FunctionMetadata)}
+	gw := newTestGateway(fs, &fakeProvider{}, &fakeRouter{})
+	gw.SetVolumeManager(&fakeVolumeManager{volumes: make(map[string]*types.VolumeInfo)})
+	policy := provider.DefaultSecurityPolicy()
+	policy.AllowedBindPaths = []string{"/srv/functions"}
+	gw.SetSecurityPolicy(policy)
+
+	rejected := map[string]int{
+		`[{"type":"bind","source":"/etc","target":"/host-etc"}]`:          http.StatusForbidden,
+		`[{"source":"foreign","target":"/data"}]`:                         http.StatusForbidden,
+		`[{"type":"tmpfs","target":"/var/openfaas/secrets"}]`:             http.StatusBadRequest,
+		`[{"source":"cache","target":"/data","size":"1Gi"}]`:              http.StatusBadRequest,
+		`[{"type":"bind","source":"/srv/functions","target":"relative"}]`: http.StatusBadRequest,
+	}
+	for volumes, status := range rejected {
+		body := []byte(`{"service":"api","image":"acme/api:1","volumes":` + volumes + `}`)
+		recorder := httptest.NewRecorder()
+		gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(body)))
+		if recorder.Code != status {
+			t.Fatalf("expected status %d for %s, got %d: %s", status, volumes, recorder.Code, recorder.Body.String())
+		}
+	}
+
+	body := []byte(`{"service":"api","image":"acme/api:1","volumes":[{"type":"bind","source":"/srv/functions/models","target":"/models","readOnly":true}]}`)
+	recorder := httptest.NewRecorder()
+	gw.HandleDeployFunction(recorder, httptest.NewRequest(http.MethodPost, "/system/functions", bytes.NewReader(body)))
+	if recorder.Code != http.StatusAccepted {
+		t.Fatalf("expected deploy to succeed, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	// Stored volumes are part of the spec used for scaling and reconciliation
+	deployment, err := deploymentFromMetadata(fs.functions["api"])
+	if err != nil {
+		t.Fatalf("deployment from metadata: %v", err)
+	}
+	if len(deployment.Volumes) != 1 || deployment.Volumes[0].Source != "/srv/functions/models" || !deployment.Volumes[0].ReadOnly {
+		t.Fatalf("unexpected stored volumes: %+v", deployment.Volumes)
+	}
+}
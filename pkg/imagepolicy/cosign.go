@@ -0,0 +1,153 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// cosignSignatureAnnotation holds the base64 signature on each signature layer
+const cosignSignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+type signatureManifest struct {
+	Layers []struct {
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// simpleSigningPayload is the signed payload cosign stores for an image
+type simpleSigningPayload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// LoadPublicKeys reads PEM-encoded ECDSA, RSA or Ed25519 public keys
+func LoadPublicKeys(files []string) ([]crypto.PublicKey, error) {
+	var keys []crypto.PublicKey
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read public key: %w", err)
+		}
+		found := false
+		for {
+			var block *pem.Block
+			block, data = pem.Decode(data)
+			if block == nil {
+				break
+			}
+			if block.Type != "PUBLIC KEY" {
+				continue
+			}
+			key, err := x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("invalid public key in %s: %w", file, err)
+			}
+			switch key.(type) {
+			case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+			default:
+				return nil, fmt.Errorf("unsupported public key type %T in %s", key, file)
+			}
+			keys = append(keys, key)
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("no public key found in %s", file)
+		}
+	}
+	return keys, nil
+}
+
+// verifySignature checks that a cosign signature for digest, stored in the
+// image repository under the sha256-<hex>.sig tag, verifies with one of keys
+func (p *Policy) verifySignature(ctx context.Context, named reference.Named, digest string) error {
+	tag := strings.Replace(digest, ":", "-", 1) + ".sig"
+	data, err := p.registry.manifest(ctx, named, tag)
+	if errors.Is(err, errNotFound) {
+		return fmt.Errorf("image %s@%s has no signature: %w", named.Name(), digest, ErrPolicyViolation)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to fetch signature: %w", err)
+	}
+
+	var manifest signatureManifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("invalid signature manifest: %w", err)
+	}
+	for _, layer := range manifest.Layers {
+		encoded := layer.Annotations[cosignSignatureAnnotation]
+		if encoded == "" {
+			continue
+		}
+		signature, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			continue
+		}
+		payload, err := p.registry.blob(ctx, named, layer.Digest)
+		if err != nil {
+			return fmt.Errorf("failed to fetch signature payload: %w", err)
+		}
+		if p.signedBy(payload, signature) && payloadMatches(payload, named, digest) {
+			return nil
+		}
+	}
+	return fmt.Errorf("image %s@%s has no signature from a trusted key: %w", named.Name(), digest, ErrPolicyViolation)
+}
+
+func (p *Policy) signedBy(payload, signature []byte) bool {
+	hash := sha256.Sum256(payload)
+	for _, key := range p.keys {
+		switch key := key.(type) {
+		case *ecdsa.PublicKey:
+			if ecdsa.VerifyASN1(key, hash[:], signature) {
+				return true
+			}
+		case *rsa.PublicKey:
+			if rsa.VerifyPKCS1v15(key, crypto.SHA256, hash[:], signature) == nil {
+				return true
+			}
+		case ed25519.PublicKey:
+			if ed25519.Verify(key, payload, signature) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// payloadMatches checks that a signed payload names this repository and digest
+func payloadMatches(payload []byte, named reference.Named, digest string) bool {
+	var signed simpleSigningPayload
+	if err := json.Unmarshal(payload, &signed); err != nil {
+		return false
+	}
+	if signed.Critical.Image.DockerManifestDigest != digest {
+		return false
+	}
+	signedRef, err := reference.ParseNormalizedNamed(signed.Critical.Identity.DockerReference)
+	if err != nil {
+		return false
+	}
+	return signedRef.Name() == named.Name()
+}
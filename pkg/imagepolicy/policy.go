@@ -0,0 +1,167 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+var (
+	// ErrPolicyViolation is returned when an image is not permitted by the policy
+	ErrPolicyViolation = errors.New("image rejected by trust policy")
+	// ErrInvalidImage is returned when an image reference cannot be parsed
+	ErrInvalidImage = errors.New("invalid image reference")
+)
+
+// Options configures an image trust policy
+type Options struct {
+	// AllowedRepositories are patterns matched against the fully qualified
+	// repository, e.g. docker.io/library/* or ghcr.io/acme/**. Empty allows all.
+	AllowedRepositories []string
+	// RequireDigest rejects references that are not pinned by digest
+	RequireDigest bool
+	// ResolveDigest pins tag references to the digest they currently resolve to
+	ResolveDigest bool
+	// PublicKeyFiles are PEM public keys; when set, images must carry a
+	// cosign signature from one of them and are deployed by the verified digest
+	PublicKeyFiles []string
+	// InsecureRegistries are reached over plain HTTP
+	InsecureRegistries []string
+}
+
+// Policy restricts which images may be deployed
+type Policy struct {
+	allowed       []string
+	requireDigest bool
+	resolveDigest bool
+	keys          []crypto.PublicKey
+	registry      *registryClient
+}
+
+// Decision is the outcome of evaluating an image
+type Decision struct {
+	// Image is the reference to deploy, pinned by digest when resolved
+	Image string
+	// Digest is the manifest digest, when known
+	Digest string
+}
+
+// NewPolicy builds a policy, loading the configured public keys
+func NewPolicy(opts Options) (*Policy, error) {
+	for _, pattern := range opts.AllowedRepositories {
+		if _, err := path.Match(strings.TrimSuffix(pattern, "/**"), ""); err != nil {
+			return nil, fmt.Errorf("invalid repository pattern %q: %w", pattern, err)
+		}
+	}
+	keys, err := LoadPublicKeys(opts.PublicKeyFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Policy{
+		allowed:       opts.AllowedRepositories,
+		requireDigest: opts.RequireDigest,
+		resolveDigest: opts.ResolveDigest,
+		keys:          keys,
+		registry:      newRegistryClient(opts.InsecureRegistries),
+	}, nil
+}
+
+// SetRegistryLogin supplies the registry login used when resolving digests
+// and fetching signatures from private repositories
+func (p *Policy) SetRegistryLogin(login func(image string) (username, password string)) {
+	p.registry.login = login
+}
+
+// Enabled reports whether the policy restricts anything
+func (p *Policy) Enabled() bool {
+	return len(p.allowed) > 0 || p.requireDigest || p.resolveDigest || len(p.keys) > 0
+}
+
+// Evaluate checks an image against the policy, resolving its digest and
+// verifying its signature when configured
+func (p *Policy) Evaluate(ctx context.Context, image string) (*Decision, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidImage, image, err)
+	}
+	named = reference.TagNameOnly(named)
+
+	if !p.repositoryAllowed(named.Name()) {
+		return nil, fmt.Errorf("repository %s is not in the allowed list: %w", named.Name(), ErrPolicyViolation)
+	}
+
+	decision := &Decision{Image: image, Digest: DigestOf(image)}
+	if decision.Digest == "" {
+		if p.requireDigest && !p.resolveDigest {
+			return nil, fmt.Errorf("image %s must be pinned by digest: %w", image, ErrPolicyViolation)
+		}
+		if p.resolveDigest || len(p.keys) > 0 {
+			tag := "latest"
+			if tagged, ok := named.(reference.Tagged); ok {
+				tag = tagged.Tag()
+			}
+			digest, err := p.registry.manifestDigest(ctx, named, tag)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve digest for %s: %w", image, err)
+			}
+			decision.Digest = digest
+			// A verified image is deployed by digest, so re-pushing the tag
+			// after verification cannot swap in an unsigned image
+			decision.Image = reference.FamiliarString(named) + "@" + digest
+		}
+	}
+
+	if len(p.keys) > 0 {
+		if err := p.verifySignature(ctx, named, decision.Digest); err != nil {
+			return nil, err
+		}
+	}
+	return decision, nil
+}
+
+// repositoryAllowed matches a repository against the allowed patterns. A
+// trailing /** matches any depth below the prefix.
+func (p *Policy) repositoryAllowed(name string) bool {
+	if len(p.allowed) == 0 {
+		return true
+	}
+	for _, pattern := range p.allowed {
+		if prefix, ok := strings.CutSuffix(pattern, "/**"); ok {
+			if matchPrefix(prefix, name) {
+				return true
+			}
+			continue
+		}
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPrefix(prefix, name string) bool {
+	depth := strings.Count(prefix, "/") + 1
+	parts := strings.SplitN(name, "/", depth+1)
+	if len(parts) <= depth {
+		return false
+	}
+	matched, _ := path.Match(prefix, strings.Join(parts[:depth], "/"))
+	return matched
+}
+
+// DigestOf returns the digest an image reference is pinned to, if any
+func DigestOf(image string) string {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return ""
+	}
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String()
+	}
+	return ""
+}
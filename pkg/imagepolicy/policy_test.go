@@ -0,0 +1,238 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/distribution/reference"
+)
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func writePublicKey(t *testing.T, key *ecdsa.PrivateKey) string {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatalf("marshal public key: %v", err)
+	}
+	file := filepath.Join(t.TempDir(), "cosign.pub")
+	if err := os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600); err != nil {
+		t.Fatalf("write public key: %v", err)
+	}
+	return file
+}
+
+// newTestRegistry serves one image tag behind bearer token auth, signed by
+// signer when it is not nil
+func newTestRegistry(t *testing.T, signer *ecdsa.PrivateKey) (*httptest.Server, string) {
+	t.Helper()
+	manifest := []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.manifest.v1+json","layers":[]}`)
+	digest := sha256Digest(manifest)
+	objects := map[string][]byte{"/v2/acme/app/manifests/1.0": manifest}
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if r.URL.Query().Get("scope") != "repository:acme/app:pull" {
+				http.Error(w, "bad scope", http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"token":"pull-token"}`))
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer pull-token" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test"`, srv.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		body, ok := objects[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Docker-Content-Digest", sha256Digest(body))
+		if r.Method != http.MethodHead {
+			w.Write(body)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	if signer != nil {
+		host := strings.TrimPrefix(srv.URL, "http://")
+		payload := []byte(fmt.Sprintf(`{"critical":{"identity":{"docker-reference":"%s/acme/app"},"image":{"docker-manifest-digest":"%s"},"type":"cosign container image signature"},"optional":null}`, host, digest))
+		hash := sha256.Sum256(payload)
+		signature, err := ecdsa.SignASN1(rand.Reader, signer, hash[:])
+		if err != nil {
+			t.Fatalf("sign payload: %v", err)
+		}
+		sigManifest, _ := json.Marshal(map[string]interface{}{
+			"schemaVersion": 2,
+			"layers": []map[string]interface{}{{
+				"mediaType":   "application/vnd.dev.cosign.simplesigning.v1+json",
+				"digest":      sha256Digest(payload),
+				"annotations": map[string]string{cosignSignatureAnnotation: base64.StdEncoding.EncodeToString(signature)},
+			}},
+		})
+		objects["/v2/acme/app/manifests/"+strings.Replace(digest, ":", "-", 1)+".sig"] = sigManifest
+		objects["/v2/acme/app/blobs/"+sha256Digest(payload)] = payload
+	}
+	return srv, digest
+}
+
+func TestPolicy_AllowedRepositories(t *testing.T) {
+	policy, err := NewPolicy(Options{AllowedRepositories: []string{"docker.io/library/*", "ghcr.io/acme/**"}})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+
+	allowed := []string{"alpine", "alpine:3.19", "docker.io/library/nginx:latest", "ghcr.io/acme/app:1", "ghcr.io/acme/team/app"}
+	for _, image := range allowed {
+		if _, err := policy.Evaluate(context.Background(), image); err != nil {
+			t.Fatalf("expected %s to be allowed: %v", image, err)
+		}
+	}
+	rejected := []string{"evil/alpine", "ghcr.io/other/app", "ghcr.io/acme", "quay.io/acme/app"}
+	for _, image := range rejected {
+		if _, err := policy.Evaluate(context.Background(), image); !errors.Is(err, ErrPolicyViolation) {
+			t.Fatalf("expected %s to be rejected, got %v", image, err)
+		}
+	}
+	if _, err := policy.Evaluate(context.Background(), "Not A Reference"); !errors.Is(err, ErrInvalidImage) {
+		t.Fatalf("expected invalid reference error, got %v", err)
+	}
+}
+
+func TestPolicy_RequireDigest(t *testing.T) {
+	policy, err := NewPolicy(Options{RequireDigest: true})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	if _, err := policy.Evaluate(context.Background(), "alpine:3.19"); !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("expected tag reference to be rejected, got %v", err)
+	}
+
+	pinned := "alpine@sha256:" + strings.Repeat("a", 64)
+	decision, err := policy.Evaluate(context.Background(), pinned)
+	if err != nil {
+		t.Fatalf("expected pinned reference to be allowed: %v", err)
+	}
+	if decision.Image != pinned || decision.Digest != "sha256:"+strings.Repeat("a", 64) {
+		t.Fatalf("unexpected decision %+v", decision)
+	}
+}
+
+func TestPolicy_ResolvesAndVerifiesSignatures(t *testing.T) {
+	trusted, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	untrusted, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	srv, digest := newTestRegistry(t, trusted)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	image := host + "/acme/app:1.0"
+
+	policy, err := NewPolicy(Options{
+		RequireDigest:      true,
+		ResolveDigest:      true,
+		PublicKeyFiles:     []string{writePublicKey(t, trusted)},
+		InsecureRegistries: []string{host},
+	})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	decision, err := policy.Evaluate(context.Background(), image)
+	if err != nil {
+		t.Fatalf("expected signed image to be allowed: %v", err)
+	}
+	if decision.Digest != digest || decision.Image != image+"@"+digest {
+		t.Fatalf("expected image pinned to %s, got %+v", digest, decision)
+	}
+
+	// Verified tags are deployed by digest even without IMAGE_RESOLVE_DIGEST,
+	// so re-pushing the tag cannot swap the image after verification
+	verifyOnly, err := NewPolicy(Options{
+		PublicKeyFiles:     []string{writePublicKey(t, trusted)},
+		InsecureRegistries: []string{host},
+	})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	decision, err = verifyOnly.Evaluate(context.Background(), image)
+	if err != nil {
+		t.Fatalf("expected signed image to be allowed: %v", err)
+	}
+	if decision.Image != image+"@"+digest {
+		t.Fatalf("expected the verified digest to be deployed, got %+v", decision)
+	}
+
+	other, err := NewPolicy(Options{
+		PublicKeyFiles:     []string{writePublicKey(t, untrusted)},
+		InsecureRegistries: []string{host},
+	})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	if _, err := other.Evaluate(context.Background(), image); !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("expected signature from an untrusted key to be rejected, got %v", err)
+	}
+
+	unsignedSrv, _ := newTestRegistry(t, nil)
+	unsignedHost := strings.TrimPrefix(unsignedSrv.URL, "http://")
+	unsigned, err := NewPolicy(Options{
+		PublicKeyFiles:     []string{writePublicKey(t, trusted)},
+		InsecureRegistries: []string{unsignedHost},
+	})
+	if err != nil {
+		t.Fatalf("new policy: %v", err)
+	}
+	if _, err := unsigned.Evaluate(context.Background(), unsignedHost+"/acme/app:1.0"); !errors.Is(err, ErrPolicyViolation) {
+		t.Fatalf("expected unsigned image to be rejected, got %v", err)
+	}
+}
+
+func TestRegistryClient_TokensAreScopedToTheRegistry(t *testing.T) {
+	srv, digest := newTestRegistry(t, nil)
+	host := strings.TrimPrefix(srv.URL, "http://")
+
+	var presented []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		presented = append(presented, r.Header.Get("Authorization"))
+		http.NotFound(w, r)
+	}))
+	t.Cleanup(other.Close)
+	otherHost := strings.TrimPrefix(other.URL, "http://")
+
+	client := newRegistryClient([]string{host, otherHost})
+	named, _ := reference.ParseNormalizedNamed(host + "/acme/app:1.0")
+	if resolved, err := client.manifestDigest(context.Background(), named, "1.0"); err != nil || resolved != digest {
+		t.Fatalf("resolve digest: %s (%v)", resolved, err)
+	}
+
+	// Same repository path on another host
+	otherNamed, _ := reference.ParseNormalizedNamed(otherHost + "/acme/app:1.0")
+	if _, err := client.manifestDigest(context.Background(), otherNamed, "1.0"); !errors.Is(err, errNotFound) {
+		t.Fatalf("expected not found from the other registry, got %v", err)
+	}
+	for _, authorization := range presented {
+		if authorization != "" {
+			t.Fatalf("expected no token to be sent to another registry, got %q", authorization)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+)
+
+const maxRegistryResponse = 4 << 20
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// errNotFound is returned when a registry reports a missing manifest or blob
+var errNotFound = errors.New("not found in registry")
+
+// registryClient is a minimal OCI distribution client that supports
+// bearer token authentication, anonymous or with a stored registry login
+type registryClient struct {
+	http     *http.Client
+	insecure map[string]bool
+	login    func(image string) (username, password string)
+
+	mu     sync.Mutex
+	tokens map[string]string // by registry host and repository
+}
+
+func newRegistryClient(insecure []string) *registryClient {
+	hosts := make(map[string]bool, len(insecure))
+	for _, host := range insecure {
+		hosts[strings.TrimSpace(host)] = true
+	}
+	return &registryClient{
+		http:     &http.Client{Timeout: 30 * time.Second},
+		insecure: hosts,
+		tokens:   make(map[string]string),
+	}
+}
+
+// manifestDigest returns the content digest of the manifest ref points to
+func (c *registryClient) manifestDigest(ctx context.Context, named reference.Named, ref string) (string, error) {
+	resp, err := c.get(ctx, http.MethodHead, named, "manifests/"+ref, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	if digest := resp.Header.Get("Docker-Content-Digest"); digest != "" {
+		return digest, nil
+	}
+
+	// Some registries omit the header on HEAD; hash the manifest instead
+	body, err := c.fetch(ctx, named, "manifests/"+ref, manifestMediaTypes)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+func (c *registryClient) manifest(ctx context.Context, named reference.Named, ref string) ([]byte, error) {
+	return c.fetch(ctx, named, "manifests/"+ref, manifestMediaTypes)
+}
+
+// blob fetches a blob and checks it against its digest
+func (c *registryClient) blob(ctx context.Context, named reference.Named, digest string) ([]byte, error) {
+	body, err := c.fetch(ctx, named, "blobs/"+digest, nil)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(body)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return body, nil
+}
+
+func (c *registryClient) fetch(ctx context.Context, named reference.Named, path string, accept []string) ([]byte, error) {
+	resp, err := c.get(ctx, http.MethodGet, named, path, accept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, maxRegistryResponse))
+}
+
+func (c *registryClient) get(ctx context.Context, method string, named reference.Named, path string, accept []string) (*http.Response, error) {
+	domain := reference.Domain(named)
+	repo := reference.Path(named)
+	host := domain
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	scheme := "https"
+	if c.insecure[domain] {
+		scheme = "http"
+	}
+	endpoint := fmt.Sprintf("%s://%s/v2/%s/%s", scheme, host, repo, path)
+
+	resp, err := c.do(ctx, method, endpoint, accept, c.token(named))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+		token, err := c.authenticate(ctx, challenge, named)
+		if err != nil {
+			return nil, err
+		}
+		if resp, err = c.do(ctx, method, endpoint, accept, token); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s/%s: %w", named.Name(), path, errNotFound)
+	case resp.StatusCode >= 300:
+		resp.Body.Close()
+		return nil, fmt.Errorf("registry returned %d for %s/%s", resp.StatusCode, named.Name(), path)
+	}
+	return resp, nil
+}
+
+func (c *registryClient) do(ctx context.Context, method, endpoint string, accept []string, token string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	for _, mediaType := range accept {
+		req.Header.Add("Accept", mediaType)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("registry request failed: %w", err)
+	}
+	return resp, nil
+}
+
+func (c *registryClient) token(named reference.Named) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokens[tokenKey(named)]
+}
+
+// tokenKey scopes cached tokens to the registry that issued them, so a token
+// is never sent to another registry serving the same repository path
+func tokenKey(named reference.Named) string {
+	return reference.Domain(named) + "/" + reference.Path(named)
+}
+
+// authenticate answers a Bearer challenge with a pull token, presenting the
+// registry login for the repository when one is stored
+func (c *registryClient) authenticate(ctx context.Context, challenge string, named reference.Named) (string, error) {
+	repo := reference.Path(named)
+	scheme, params, ok := strings.Cut(challenge, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("registry requires unsupported authentication %q", challenge)
+	}
+	values := parseChallenge(params)
+	realm := values["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("registry challenge has no realm")
+	}
+
+	query := url.Values{}
+	if service := values["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+repo+":pull")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if c.login != nil {
+		if username, password := c.login(named.Name()); username != "" {
+			req.SetBasicAuth(username, password)
+		}
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("registry token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("registry token request returned %d", resp.StatusCode)
+	}
+
+	var payload struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxRegistryResponse)).Decode(&payload); err != nil {
+		return "", fmt.Errorf("invalid registry token response: %w", err)
+	}
+	token := payload.Token
+	if token == "" {
+		token = payload.AccessToken
+	}
+
+	c.mu.Lock()
+	c.tokens[tokenKey(named)] = token
+	c.mu.Unlock()
+	return token, nil
+}
+
+// parseChallenge parses the key="value" pairs of a WWW-Authenticate header
+func parseChallenge(params string) map[string]string {
+	values := make(map[string]string)
+	for params != "" {
+		key, rest, ok := strings.Cut(strings.TrimLeft(params, ", "), "=")
+		if !ok {
+			break
+		}
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				break
+			}
+			value, params = rest[1:end+1], rest[end+2:]
+		} else {
+			value, params, _ = strings.Cut(rest, ",")
+		}
+		values[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return values
+}
@@ -0,0 +1,150 @@
+package logstore
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// Source is where the collector reads function logs from
+type Source interface {
+	GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error)
+	GetFunctionLogs(ctx context.Context, request types.LogRequest) (<-chan types.LogMessage, error)
+}
+
+// FunctionsFunc returns the annotations of every deployed function by name
+type FunctionsFunc func() (map[string]map[string]string, error)
+
+// Collector follows the output of every function replica into the store. Each
+// replica is resumed after its last stored line, so nothing is written twice
+// when the gateway restarts.
+type Collector struct {
+	store     *Store
+	source    Source
+	functions FunctionsFunc
+	interval  time.Duration
+	logger    *logrus.Logger
+
+	mu        sync.Mutex
+	following map[string]bool // by function/instance
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+}
+
+// NewCollector creates a collector that looks for new replicas every interval
+func NewCollector(store *Store, source Source, functions FunctionsFunc, interval time.Duration, logger *logrus.Logger) *Collector {
+	return &Collector{
+		store:     store,
+		source:    source,
+		functions: functions,
+		interval:  interval,
+		logger:    logger,
+		following: make(map[string]bool),
+	}
+}
+
+// Start collects logs until ctx is cancelled or Stop is called
+func (c *Collector) Start(ctx context.Context) {
+	ctx, c.cancel = context.WithCancel(ctx)
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+
+		c.logger.Infof("Function log collection started (interval: %s)", c.interval)
+		for {
+			c.collect(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends log collection and waits for the replicas being followed
+func (c *Collector) Stop() {
+	if c.cancel != nil {
+		c.cancel()
+	}
+	c.wg.Wait()
+}
+
+// collect applies retention settings, starts following new replicas and
+// prunes expired logs
+func (c *Collector) collect(ctx context.Context) {
+	functions, err := c.functions()
+	if err != nil {
+		c.logger.Warnf("Failed to list functions for log collection: %v", err)
+		return
+	}
+
+	for name, annotations := range functions {
+		retention, err := ParseRetention(annotations, c.store.defaults)
+		if err != nil {
+			c.logger.Warnf("Ignoring log retention of %s: %v", name, err)
+			retention = c.store.defaults
+		}
+		c.store.SetRetention(name, retention)
+
+		containers, err := c.source.GetFunctionContainers(ctx, name)
+		if err != nil {
+			c.logger.Debugf("Failed to list replicas of %s for log collection: %v", name, err)
+			continue
+		}
+		for _, container := range containers {
+			key := name + "/" + container.Name
+			c.mu.Lock()
+			if c.following[key] {
+				c.mu.Unlock()
+				continue
+			}
+			c.following[key] = true
+			c.mu.Unlock()
+
+			c.wg.Add(1)
+			go func(instance, key string) {
+				defer c.wg.Done()
+				defer func() {
+					c.mu.Lock()
+					delete(c.following, key)
+					c.mu.Unlock()
+				}()
+				c.follow(ctx, name, instance)
+			}(container.Name, key)
+		}
+	}
+
+	c.store.Prune(time.Now())
+}
+
+// follow stores a replica's output until it stops or ctx is cancelled
+func (c *Collector) follow(ctx context.Context, functionName, instance string) {
+	request := types.LogRequest{Name: functionName, Instance: instance, Tail: -1, Follow: true}
+	since := c.store.LastTimestamp(functionName, instance)
+	if !since.IsZero() {
+		request.Since = &since
+	}
+
+	messages, err := c.source.GetFunctionLogs(ctx, request)
+	if err != nil {
+		c.logger.Debugf("Failed to follow logs of %s: %v", instance, err)
+		return
+	}
+	for message := range messages {
+		// Since is inclusive, so the last stored line comes back
+		if !message.Timestamp.After(since) {
+			continue
+		}
+		if err := c.store.Append(message); err != nil {
+			c.logger.Warnf("Failed to store logs of %s: %v", instance, err)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package logstore
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeSource struct {
+	mu       sync.Mutex
+	lines    []types.LogMessage
+	requests []types.LogRequest
+}
+
+func (f *fakeSource) GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error) {
+	return []*types.Container{{ID: "c0", Name: "api-0"}}, nil
+}
+
+func (f *fakeSource) GetFunctionLogs(ctx context.Context, request types.LogRequest) (<-chan types.LogMessage, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, request)
+	messages := make(chan types.LogMessage, len(f.lines))
+	for _, line := range f.lines {
+		messages <- line
+	}
+	close(messages)
+	return messages, nil
+}
+
+func TestCollector_ResumesAfterLastStoredLine(t *testing.T) {
+	s, err := Open(t.TempDir(), Retention{}, logrus.New())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+
+	base := time.Now().Add(-time.Minute)
+	source := &fakeSource{lines: []types.LogMessage{logLine("api-0", base, "one"), logLine("api-0", base.Add(time.Second), "two")}}
+	functions := func() (map[string]map[string]string, error) {
+		return map[string]map[string]string{"api": {AnnotationRetentionAge: "1h"}}, nil
+	}
+	collector := NewCollector(s, source, functions, time.Hour, logrus.New())
+
+	// The source replays the last stored line, as Docker's inclusive since does
+	for i := 0; i < 2; i++ {
+		collector.collect(context.Background())
+		collector.wg.Wait()
+	}
+
+	if results, _ := s.Query(Query{Function: "api"}); len(results) != 2 {
+		t.Fatalf("expected each line stored once, got %+v", results)
+	}
+	if len(source.requests) != 2 || source.requests[1].Since == nil || !source.requests[1].Since.Equal(base.Add(time.Second)) || !source.requests[1].Follow {
+		t.Fatalf("expected the second pass to follow from the last stored line, got %+v", source.requests)
+	}
+	if s.retention("api").MaxAge != time.Hour {
+		t.Fatalf("expected the function's retention annotation to apply")
+	}
+}
@@ -0,0 +1,547 @@
+// Package logstore keeps function output on disk, so logs outlive the
+// containers that wrote them and gateway restarts.
+package logstore
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// AnnotationRetentionSize caps the stored logs of a function, e.g. "64Mi"
+	AnnotationRetentionSize = "com.docker-faas.logs.retention.size"
+	// AnnotationRetentionAge is how long the logs of a function are kept, e.g. "72h"
+	AnnotationRetentionAge = "com.docker-faas.logs.retention.age"
+
+	segmentSuffix = ".log"
+	indexSuffix   = ".idx"
+
+	// segmentsPerRetention splits a function's size allowance into segments,
+	// so reaching it drops only the oldest part of the logs
+	segmentsPerRetention = 8
+	minSegmentSize       = 64 << 10
+	// defaultSegmentSize is used for functions without a size limit
+	defaultSegmentSize = 16 << 20
+)
+
+// callIDPattern finds the call ID in lines where a function logs it
+var callIDPattern = regexp.MustCompile(`(?i)(?:x-call-id|call[_-]?id)["']?\s*[:=]\s*["']?([A-Za-z0-9._-]+)`)
+
+// Retention bounds the stored logs of a function; zero values are unbounded
+type Retention struct {
+	MaxSize int64
+	MaxAge  time.Duration
+}
+
+// ParseRetention reads a function's retention annotations, falling back to
+// the defaults for those that are not set
+func ParseRetention(annotations map[string]string, defaults Retention) (Retention, error) {
+	retention := defaults
+	if raw := strings.TrimSpace(annotations[AnnotationRetentionSize]); raw != "" {
+		size, err := provider.ParseMemoryQuantity(raw)
+		if err != nil {
+			return retention, fmt.Errorf("invalid %s: %q", AnnotationRetentionSize, raw)
+		}
+		retention.MaxSize = size
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationRetentionAge]); raw != "" {
+		age, err := time.ParseDuration(raw)
+		if err != nil || age < 0 {
+			return retention, fmt.Errorf("invalid %s: %q", AnnotationRetentionAge, raw)
+		}
+		retention.MaxAge = age
+	}
+	return retention, nil
+}
+
+// Query selects stored log lines; empty fields match everything
+type Query struct {
+	Function string
+	Instance string
+	CallID   string
+	Text     string // case-insensitive substring
+	Since    time.Time
+	Until    time.Time
+	Limit    int // most recent lines returned; 0 for all
+}
+
+// segmentIndex summarizes a segment so queries can skip it without reading it
+type segmentIndex struct {
+	First     time.Time            `json:"first"`
+	Last      time.Time            `json:"last"`
+	Size      int64                `json:"size"`
+	Instances map[string]time.Time `json:"instances"` // last line of each replica
+	CallIDs   map[string]bool      `json:"callIds,omitempty"`
+}
+
+func (i *segmentIndex) add(message types.LogMessage, size int) {
+	if i.First.IsZero() || message.Timestamp.Before(i.First) {
+		i.First = message.Timestamp
+	}
+	if message.Timestamp.After(i.Last) {
+		i.Last = message.Timestamp
+	}
+	i.Size += int64(size)
+	if message.Timestamp.After(i.Instances[message.Instance]) {
+		i.Instances[message.Instance] = message.Timestamp
+	}
+	if message.CallID != "" {
+		i.CallIDs[message.CallID] = true
+	}
+}
+
+// segment is one file of a function's logs, named after when it was started
+type segment struct {
+	path  string
+	index segmentIndex
+}
+
+func newSegment(path string) *segment {
+	return &segment{path: path, index: segmentIndex{Instances: map[string]time.Time{}, CallIDs: map[string]bool{}}}
+}
+
+// functionLogs holds the segments of one function, oldest first. The last
+// segment is the one written to.
+type functionLogs struct {
+	dir      string
+	segments []*segment
+	file     *os.File
+}
+
+func (f *functionLogs) size() int64 {
+	var total int64
+	for _, s := range f.segments {
+		total += s.index.Size
+	}
+	return total
+}
+
+// Store keeps function logs in rotating segment files under one directory per
+// function, bounded by a retention size and age per function
+type Store struct {
+	path     string
+	defaults Retention
+	logger   *logrus.Logger
+
+	mu         sync.Mutex
+	functions  map[string]*functionLogs
+	retentions map[string]Retention
+}
+
+// Open opens the log store at path, indexing the logs already stored there
+func Open(path string, defaults Retention, logger *logrus.Logger) (*Store, error) {
+	if err := os.MkdirAll(path, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create log store directory: %w", err)
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read log store directory: %w", err)
+	}
+
+	s := &Store{
+		path:       path,
+		defaults:   defaults,
+		logger:     logger,
+		functions:  make(map[string]*functionLogs),
+		retentions: make(map[string]Retention),
+	}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		logs, err := loadFunction(filepath.Join(path, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if len(logs.segments) > 0 {
+			s.functions[entry.Name()] = logs
+		}
+	}
+	return s, nil
+}
+
+// loadFunction indexes the segments of a function. Segments whose saved index
+// is missing or out of date, such as the one written to when the gateway
+// stopped, are scanned.
+func loadFunction(dir string) (*functionLogs, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"+segmentSuffix))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	logs := &functionLogs{dir: dir}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read log segment %s: %w", path, err)
+		}
+		seg := newSegment(path)
+		if data, err := os.ReadFile(indexPath(path)); err == nil && json.Unmarshal(data, &seg.index) == nil && seg.index.Size == info.Size() {
+			if seg.index.Instances == nil {
+				seg.index.Instances = map[string]time.Time{}
+			}
+			if seg.index.CallIDs == nil {
+				seg.index.CallIDs = map[string]bool{}
+			}
+		} else {
+			seg = newSegment(path)
+			err := scanSegment(path, func(message types.LogMessage, size int) bool {
+				seg.index.add(message, size)
+				return true
+			})
+			if err != nil {
+				return nil, fmt.Errorf("failed to index log segment %s: %w", path, err)
+			}
+		}
+		logs.segments = append(logs.segments, seg)
+	}
+	return logs, nil
+}
+
+// scanSegment calls fn for every line of a segment until it returns false
+func scanSegment(path string, fn func(message types.LogMessage, size int) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 && line[len(line)-1] == '\n' {
+			var message types.LogMessage
+			if json.Unmarshal(line, &message) == nil && !fn(message, len(line)) {
+				return nil
+			}
+		}
+		if err != nil {
+			// A partly written last line is dropped
+			return nil
+		}
+	}
+}
+
+func indexPath(segmentPath string) string {
+	return strings.TrimSuffix(segmentPath, segmentSuffix) + indexSuffix
+}
+
+// SetRetention sets the retention of a function
+func (s *Store) SetRetention(functionName string, retention Retention) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retentions[functionName] = retention
+}
+
+func (s *Store) retention(functionName string) Retention {
+	if retention, ok := s.retentions[functionName]; ok {
+		return retention
+	}
+	return s.defaults
+}
+
+// Append stores log lines. Lines that mention a call ID are indexed by it.
+func (s *Store) Append(messages ...types.LogMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stored := make(map[string]int)
+	for _, message := range messages {
+		if message.Name == "" || message.Name != filepath.Base(message.Name) || strings.HasPrefix(message.Name, ".") {
+			return fmt.Errorf("invalid function name %q", message.Name)
+		}
+		if message.CallID == "" {
+			if match := callIDPattern.FindStringSubmatch(message.Text); match != nil {
+				message.CallID = match[1]
+			}
+		}
+		data, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		logs, seg, err := s.activeSegment(message.Name, len(data))
+		if err != nil {
+			return err
+		}
+		if _, err := logs.file.Write(data); err != nil {
+			return fmt.Errorf("failed to write logs of %s: %w", message.Name, err)
+		}
+		seg.index.add(message, len(data))
+		stored[message.Name]++
+	}
+
+	for functionName, lines := range stored {
+		metrics.RecordFunctionLogLines(functionName, lines)
+		s.enforceSize(functionName)
+	}
+	return nil
+}
+
+// activeSegment returns the segment a line of the given size is written to,
+// starting a new one when the current one is full
+func (s *Store) activeSegment(functionName string, size int) (*functionLogs, *segment, error) {
+	logs, ok := s.functions[functionName]
+	if !ok {
+		logs = &functionLogs{dir: filepath.Join(s.path, functionName)}
+		s.functions[functionName] = logs
+	}
+
+	limit := int64(defaultSegmentSize)
+	if maxSize := s.retention(functionName).MaxSize; maxSize > 0 {
+		limit = max(maxSize/segmentsPerRetention, minSegmentSize)
+	}
+	if n := len(logs.segments); n > 0 && logs.file != nil && logs.segments[n-1].index.Size+int64(size) <= limit {
+		return logs, logs.segments[n-1], nil
+	}
+	if n := len(logs.segments); n > 0 && logs.file == nil && logs.segments[n-1].index.Size+int64(size) <= limit {
+		// Continue the segment written before the gateway restarted
+		file, err := os.OpenFile(logs.segments[n-1].path, os.O_WRONLY|os.O_APPEND, 0o640)
+		if err == nil {
+			logs.file = file
+			return logs, logs.segments[n-1], nil
+		}
+	}
+
+	if err := s.closeActive(logs); err != nil {
+		s.logger.Warnf("Failed to save log index of %s: %v", functionName, err)
+	}
+	if err := os.MkdirAll(logs.dir, 0o750); err != nil {
+		return nil, nil, fmt.Errorf("failed to create log directory for %s: %w", functionName, err)
+	}
+	seg := newSegment(filepath.Join(logs.dir, fmt.Sprintf("%020d%s", time.Now().UnixNano(), segmentSuffix)))
+	file, err := os.OpenFile(seg.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create log segment for %s: %w", functionName, err)
+	}
+	logs.file = file
+	logs.segments = append(logs.segments, seg)
+	return logs, seg, nil
+}
+
+// closeActive closes the segment being written and saves its index
+func (s *Store) closeActive(logs *functionLogs) error {
+	if logs.file == nil {
+		return nil
+	}
+	err := logs.file.Close()
+	logs.file = nil
+	if err != nil {
+		return err
+	}
+	seg := logs.segments[len(logs.segments)-1]
+	data, err := json.Marshal(seg.index)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(indexPath(seg.path), data, 0o640)
+}
+
+// enforceSize drops the oldest segments of a function over its size limit
+func (s *Store) enforceSize(functionName string) {
+	logs := s.functions[functionName]
+	maxSize := s.retention(functionName).MaxSize
+	if logs == nil || maxSize <= 0 {
+		return
+	}
+	for len(logs.segments) > 1 && logs.size() > maxSize {
+		s.removeSegment(logs, 0)
+	}
+}
+
+// removeSegment deletes one segment of a function
+func (s *Store) removeSegment(logs *functionLogs, i int) {
+	seg := logs.segments[i]
+	if i == len(logs.segments)-1 && logs.file != nil {
+		logs.file.Close()
+		logs.file = nil
+	}
+	for _, path := range []string{seg.path, indexPath(seg.path)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			s.logger.Warnf("Failed to remove log segment %s: %v", path, err)
+		}
+	}
+	logs.segments = append(logs.segments[:i], logs.segments[i+1:]...)
+}
+
+// Prune drops the segments of every function whose lines are all older than
+// its retention age, including the logs of removed functions
+func (s *Store) Prune(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for functionName, logs := range s.functions {
+		maxAge := s.retention(functionName).MaxAge
+		if maxAge > 0 {
+			cutoff := now.Add(-maxAge)
+			for i := 0; i < len(logs.segments); {
+				if logs.segments[i].index.Last.Before(cutoff) {
+					s.removeSegment(logs, i)
+					continue
+				}
+				i++
+			}
+		}
+		if len(logs.segments) == 0 {
+			os.Remove(logs.dir)
+			delete(s.functions, functionName)
+		}
+	}
+}
+
+// LastTimestamp returns the time of the last stored line of a replica
+func (s *Store) LastTimestamp(functionName, instance string) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var last time.Time
+	if logs, ok := s.functions[functionName]; ok {
+		for _, seg := range logs.segments {
+			if t := seg.index.Instances[instance]; t.After(last) {
+				last = t
+			}
+		}
+	}
+	return last
+}
+
+// Query searches the stored logs, returning matching lines in time order.
+// Segments are read without holding the store lock, so queries do not block
+// log collection, and at most Limit lines are held in memory.
+func (s *Store) Query(query Query) ([]types.LogMessage, error) {
+	type candidate struct{ function, path string }
+
+	s.mu.Lock()
+	names := make([]string, 0, len(s.functions))
+	for name := range s.functions {
+		if query.Function == "" || name == query.Function {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	var candidates []candidate
+	for _, name := range names {
+		for _, seg := range s.functions[name].segments {
+			if seg.matches(query) {
+				candidates = append(candidates, candidate{function: name, path: seg.path})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	text := strings.ToLower(query.Text)
+	results := &newestLines{limit: query.Limit}
+	for _, c := range candidates {
+		err := scanSegment(c.path, func(message types.LogMessage, size int) bool {
+			if (query.Instance == "" || message.Instance == query.Instance) &&
+				(query.CallID == "" || message.CallID == query.CallID) &&
+				(query.Since.IsZero() || !message.Timestamp.Before(query.Since)) &&
+				(query.Until.IsZero() || !message.Timestamp.After(query.Until)) &&
+				(text == "" || strings.Contains(strings.ToLower(message.Text), text)) {
+				results.add(message)
+			}
+			return true
+		})
+		// Segments removed by retention since the snapshot are skipped
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("failed to read logs of %s: %w", c.function, err)
+		}
+	}
+	return results.sorted(), nil
+}
+
+// newestLines keeps the newest limit lines it is given (all when limit is 0)
+// in a min-heap on time; ties are broken by arrival, later lines being newer
+type newestLines struct {
+	limit int
+	seq   int
+	lines []sequencedLine
+}
+
+type sequencedLine struct {
+	message types.LogMessage
+	seq     int
+}
+
+func (n *newestLines) Len() int { return len(n.lines) }
+func (n *newestLines) Less(i, j int) bool {
+	if !n.lines[i].message.Timestamp.Equal(n.lines[j].message.Timestamp) {
+		return n.lines[i].message.Timestamp.Before(n.lines[j].message.Timestamp)
+	}
+	return n.lines[i].seq < n.lines[j].seq
+}
+func (n *newestLines) Swap(i, j int) { n.lines[i], n.lines[j] = n.lines[j], n.lines[i] }
+func (n *newestLines) Push(x any)    { n.lines = append(n.lines, x.(sequencedLine)) }
+func (n *newestLines) Pop() any {
+	last := n.lines[len(n.lines)-1]
+	n.lines = n.lines[:len(n.lines)-1]
+	return last
+}
+
+func (n *newestLines) add(message types.LogMessage) {
+	n.seq++
+	heap.Push(n, sequencedLine{message: message, seq: n.seq})
+	if n.limit > 0 && len(n.lines) > n.limit {
+		heap.Pop(n)
+	}
+}
+
+// sorted returns the kept lines in time order
+func (n *newestLines) sorted() []types.LogMessage {
+	sort.Sort(n)
+	messages := make([]types.LogMessage, len(n.lines))
+	for i, line := range n.lines {
+		messages[i] = line.message
+	}
+	return messages
+}
+
+// matches reports whether the segment may hold lines for the query
+func (seg *segment) matches(query Query) bool {
+	if seg.index.Size == 0 {
+		return false
+	}
+	if !query.Since.IsZero() && seg.index.Last.Before(query.Since) {
+		return false
+	}
+	if !query.Until.IsZero() && seg.index.First.After(query.Until) {
+		return false
+	}
+	if query.Instance != "" {
+		if _, ok := seg.index.Instances[query.Instance]; !ok {
+			return false
+		}
+	}
+	return query.CallID == "" || seg.index.CallIDs[query.CallID]
+}
+
+// Close saves the indexes of the segments being written
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for _, logs := range s.functions {
+		if err := s.closeActive(logs); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,154 @@
+package logstore
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func logLine(instance string, at time.Time, text string) types.LogMessage {
+	return types.LogMessage{Name: "api", Instance: instance, Timestamp: at, Text: text, Stream: "stdout"}
+}
+
+func TestStore_QuerySurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	base := time.Now().Add(-time.Hour)
+
+	s, err := Open(dir, Retention{}, logrus.New())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if err := s.Append(
+		logLine("api-0", base, "starting"),
+		logLine("api-1", base.Add(time.Second), "handling X-Call-Id: abc123"),
+		logLine("api-0", base.Add(2*time.Second), "Request FAILED"),
+	); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	s, err = Open(dir, Retention{}, logrus.New())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer s.Close()
+
+	if last := s.LastTimestamp("api", "api-0"); !last.Equal(base.Add(2 * time.Second)) {
+		t.Fatalf("expected last line of api-0 at +2s, got %v", last.Sub(base))
+	}
+
+	results, err := s.Query(Query{Function: "api", Text: "failed"})
+	if err != nil || len(results) != 1 || results[0].Instance != "api-0" {
+		t.Fatalf("expected a case-insensitive text match, got %+v (%v)", results, err)
+	}
+	results, _ = s.Query(Query{CallID: "abc123"})
+	if len(results) != 1 || results[0].Instance != "api-1" || results[0].CallID != "abc123" {
+		t.Fatalf("expected the line indexed by call ID, got %+v", results)
+	}
+	results, _ = s.Query(Query{Function: "api", Instance: "api-0", Since: base.Add(time.Second)})
+	if len(results) != 1 || results[0].Text != "Request FAILED" {
+		t.Fatalf("expected one api-0 line after +1s, got %+v", results)
+	}
+	results, _ = s.Query(Query{Function: "api", Limit: 2})
+	if len(results) != 2 || results[1].Text != "Request FAILED" {
+		t.Fatalf("expected the two most recent lines, got %+v", results)
+	}
+
+	// Writing continues in the segment left by the previous run
+	if err := s.Append(logLine("api-0", base.Add(3*time.Second), "again")); err != nil {
+		t.Fatalf("append after reopen: %v", err)
+	}
+	if results, _ := s.Query(Query{Function: "api"}); len(results) != 4 {
+		t.Fatalf("expected four lines, got %d", len(results))
+	}
+}
+
+func TestStore_QueryLimitAcrossFunctions(t *testing.T) {
+	s, err := Open(t.TempDir(), Retention{}, logrus.New())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+
+	// Lines are numbered by time, alternating between the functions
+	base := time.Now().Add(-time.Hour)
+	for i := 0; i < 10; i++ {
+		line := logLine("api-0", base.Add(time.Duration(i)*time.Second), fmt.Sprintf("api %d", i))
+		if i%2 == 1 {
+			line.Name, line.Instance, line.Text = "web", "web-0", fmt.Sprintf("web %d", i)
+		}
+		if err := s.Append(line); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+
+	results, err := s.Query(Query{Limit: 3})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	var texts []string
+	for _, message := range results {
+		texts = append(texts, message.Text)
+	}
+	if strings.Join(texts, ",") != "web 7,api 8,web 9" {
+		t.Fatalf("expected the three newest lines in time order, got %v", texts)
+	}
+}
+
+func TestStore_Retention(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, Retention{}, logrus.New())
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	defer s.Close()
+	s.SetRetention("api", Retention{MaxSize: 256 << 10, MaxAge: time.Hour})
+
+	now := time.Now()
+	text := strings.Repeat("x", 1024)
+	for i := 0; i < 1024; i++ {
+		if err := s.Append(logLine("api-0", now.Add(time.Duration(i)*time.Millisecond), fmt.Sprintf("%d %s", i, text))); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if size := s.functions["api"].size(); size > 256<<10 {
+		t.Fatalf("expected logs to be capped at 256KiB, got %d bytes", size)
+	}
+	results, _ := s.Query(Query{Function: "api"})
+	if len(results) == 0 || !strings.HasPrefix(results[len(results)-1].Text, "1023 ") {
+		t.Fatalf("expected the newest lines to be kept")
+	}
+
+	s.Prune(now.Add(2 * time.Hour))
+	if results, _ := s.Query(Query{Function: "api"}); len(results) != 0 {
+		t.Fatalf("expected expired logs to be pruned, got %d lines", len(results))
+	}
+	if _, err := os.Stat(filepath.Join(dir, "api")); !os.IsNotExist(err) {
+		t.Fatalf("expected the function's log directory to be removed, got %v", err)
+	}
+}
+
+func TestParseRetention(t *testing.T) {
+	defaults := Retention{MaxSize: 1 << 20, MaxAge: time.Hour}
+	retention, err := ParseRetention(map[string]string{AnnotationRetentionSize: "2Mi"}, defaults)
+	if err != nil || retention.MaxSize != 2<<20 || retention.MaxAge != time.Hour {
+		t.Fatalf("unexpected retention %+v (%v)", retention, err)
+	}
+	for _, annotations := range []map[string]string{
+		{AnnotationRetentionSize: "lots"},
+		{AnnotationRetentionAge: "-1h"},
+	} {
+		if _, err := ParseRetention(annotations, defaults); err == nil {
+			t.Fatalf("expected error for %v", annotations)
+		}
+	}
+}
@@ -72,6 +72,186 @@ var (
 		[]string{"function_name"},
 	)
 
+	// FunctionRateLimitedTotal tracks invocations rejected by rate limits or quotas
+	FunctionRateLimitedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "function_rate_limited_total",
+			Help: "Total number of function invocations rejected by rate limits or quotas",
+		},
+		[]string{"function_name", "reason"},
+	)
+
+	// FunctionInflightRequests tracks requests currently being served by function replicas
+	FunctionInflightRequests = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_inflight_requests",
+			Help: "Number of requests currently in flight to function replicas",
+		},
+		[]string{"function_name"},
+	)
+
+	// FunctionQueuedRequests tracks requests waiting for a replica with spare capacity
+	FunctionQueuedRequests = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_queued_requests",
+			Help: "Number of requests waiting in the gateway queue for a function replica",
+		},
+		[]string{"function_name"},
+	)
+
+	// AccessDeniedTotal tracks requests rejected by IP allow/deny rules
+	AccessDeniedTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "gateway_access_denied_total",
+			Help: "Total number of requests rejected by IP allow/deny rules",
+		},
+		[]string{"scope", "name"},
+	)
+
+	// ImagePolicyRejectionsTotal tracks deployments rejected by the image trust policy
+	ImagePolicyRejectionsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "image_policy_rejections_total",
+			Help: "Total number of deployments rejected by the image trust policy",
+		},
+		[]string{"function_name"},
+	)
+
+	// FunctionContainerEventsTotal tracks container lifecycle events per function
+	FunctionContainerEventsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "function_container_events_total",
+			Help: "Total number of function container events by type",
+		},
+		[]string{"function_name", "event"},
+	)
+
+	// FunctionCrashLoopsTotal tracks replicas detected as crash looping
+	FunctionCrashLoopsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "function_crash_loops_total",
+			Help: "Total number of function replicas detected as crash looping",
+		},
+		[]string{"function_name"},
+	)
+
+	// FunctionLogLinesStoredTotal tracks log lines kept in the log store
+	FunctionLogLinesStoredTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "function_log_lines_stored_total",
+			Help: "Total number of function log lines written to the log store",
+		},
+		[]string{"function_name"},
+	)
+
+	// FunctionReplicaCPUPercent tracks the CPU usage of function replicas
+	FunctionReplicaCPUPercent = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_cpu_percent",
+			Help: "CPU usage of a function replica in percent of one CPU",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// FunctionReplicaMemoryUsageBytes tracks the memory usage of function replicas
+	FunctionReplicaMemoryUsageBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_memory_usage_bytes",
+			Help: "Memory used by a function replica, excluding the page cache",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// FunctionReplicaMemoryLimitBytes tracks the memory limit of function replicas
+	FunctionReplicaMemoryLimitBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_memory_limit_bytes",
+			Help: "Memory limit of a function replica",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// FunctionReplicaNetworkReceiveBytes tracks the bytes received by function replicas
+	FunctionReplicaNetworkReceiveBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_network_receive_bytes",
+			Help: "Bytes received by a function replica since it started",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// FunctionReplicaNetworkTransmitBytes tracks the bytes sent by function replicas
+	FunctionReplicaNetworkTransmitBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_network_transmit_bytes",
+			Help: "Bytes sent by a function replica since it started",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// FunctionReplicaBlockReadBytes tracks the bytes read from block devices by function replicas
+	FunctionReplicaBlockReadBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_block_read_bytes",
+			Help: "Bytes read from block devices by a function replica since it started",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// FunctionReplicaBlockWriteBytes tracks the bytes written to block devices by function replicas
+	FunctionReplicaBlockWriteBytes = promauto.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "function_replica_block_write_bytes",
+			Help: "Bytes written to block devices by a function replica since it started",
+		},
+		[]string{"function_name", "replica"},
+	)
+
+	// PipelineInvocationsTotal tracks pipeline runs by outcome
+	PipelineInvocationsTotal = promauto.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "pipeline_invocations_total",
+			Help: "Total number of pipeline runs",
+		},
+		[]string{"pipeline_name", "status"},
+	)
+
+	// PipelineDurationSeconds tracks the duration of pipeline runs
+	PipelineDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pipeline_duration_seconds",
+			Help:    "Duration of pipeline runs in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"pipeline_name"},
+	)
+
+	// PipelineStepDurationSeconds tracks the duration of pipeline steps
+	PipelineStepDurationSeconds = promauto.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "pipeline_step_duration_seconds",
+			Help:    "Duration of pipeline steps in seconds",
+			Buckets: prometheus.DefBuckets,
+		},
+		[]string{"pipeline_name", "step", "status"},
+	)
+
+	// ImageGCRemovedImagesTotal tracks built images removed by image garbage collection
+	ImageGCRemovedImagesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "image_gc_removed_images_total",
+			Help: "Total number of built images removed by image garbage collection",
+		},
+	)
+
+	// ImageGCReclaimedBytesTotal tracks the disk space freed by image garbage collection
+	ImageGCReclaimedBytesTotal = promauto.NewCounter(
+		prometheus.CounterOpts{
+			Name: "image_gc_reclaimed_bytes_total",
+			Help: "Total bytes of disk space reclaimed by image garbage collection",
+		},
+	)
+
 	// DBOperationsTotal tracks database operations
 	DBOperationsTotal = promauto.NewCounterVec(
 		prometheus.CounterOpts{
@@ -119,6 +299,27 @@ func RecordFunctionInvocation(functionName string, statusCode int, duration floa
 	}
 }
 
+// RecordFunctionRateLimited records an invocation rejected by a rate limit or quota
+func RecordFunctionRateLimited(functionName, reason string) {
+	FunctionRateLimitedTotal.WithLabelValues(functionName, reason).Inc()
+}
+
+// SetFunctionConcurrency updates the in-flight and queued request gauges for a function
+func SetFunctionConcurrency(functionName string, inflight, queued int) {
+	FunctionInflightRequests.WithLabelValues(functionName).Set(float64(inflight))
+	FunctionQueuedRequests.WithLabelValues(functionName).Set(float64(queued))
+}
+
+// RecordAccessDenied records a request rejected by a route or function IP rule
+func RecordAccessDenied(scope, name string) {
+	AccessDeniedTotal.WithLabelValues(scope, name).Inc()
+}
+
+// RecordImagePolicyRejection records a deployment rejected by the image trust policy
+func RecordImagePolicyRejection(functionName string) {
+	ImagePolicyRejectionsTotal.WithLabelValues(functionName).Inc()
+}
+
 // RecordGatewayRestart increments the gateway restart counter.
 func RecordGatewayRestart() {
 	GatewayRestartsTotal.Inc()
@@ -156,4 +357,73 @@ func UpdateFunctionReplicas(functionName string, replicas int) {
 // DeleteFunctionMetrics removes metrics for a deleted function
 func DeleteFunctionMetrics(functionName string) {
 	FunctionReplicas.DeleteLabelValues(functionName)
+	FunctionInflightRequests.DeleteLabelValues(functionName)
+	FunctionQueuedRequests.DeleteLabelValues(functionName)
+	FunctionRateLimitedTotal.DeletePartialMatch(prometheus.Labels{"function_name": functionName})
+}
+
+// RecordFunctionContainerEvent records a container lifecycle event of a function
+func RecordFunctionContainerEvent(functionName, event string) {
+	FunctionContainerEventsTotal.WithLabelValues(functionName, event).Inc()
+}
+
+// RecordFunctionCrashLoop records a function replica entering a crash loop
+func RecordFunctionCrashLoop(functionName string) {
+	FunctionCrashLoopsTotal.WithLabelValues(functionName).Inc()
+}
+
+// RecordFunctionLogLines records log lines written to the log store
+func RecordFunctionLogLines(functionName string, lines int) {
+	FunctionLogLinesStoredTotal.WithLabelValues(functionName).Add(float64(lines))
+}
+
+// RecordPipelineInvocation records a finished pipeline run
+func RecordPipelineInvocation(pipelineName, status string, duration float64) {
+	PipelineInvocationsTotal.WithLabelValues(pipelineName, status).Inc()
+	PipelineDurationSeconds.WithLabelValues(pipelineName).Observe(duration)
+}
+
+// RecordPipelineStep records a pipeline step that invoked its function
+func RecordPipelineStep(pipelineName, step, status string, duration float64) {
+	PipelineStepDurationSeconds.WithLabelValues(pipelineName, step, status).Observe(duration)
+}
+
+// DeletePipelineMetrics removes metrics for a deleted pipeline
+func DeletePipelineMetrics(pipelineName string) {
+	PipelineInvocationsTotal.DeletePartialMatch(prometheus.Labels{"pipeline_name": pipelineName})
+	PipelineDurationSeconds.DeleteLabelValues(pipelineName)
+	PipelineStepDurationSeconds.DeletePartialMatch(prometheus.Labels{"pipeline_name": pipelineName})
+}
+
+// UpdateReplicaStats records the latest resource usage sample of a function replica
+func UpdateReplicaStats(functionName, replica string, cpuPercent float64, memoryUsage, memoryLimit, networkRx, networkTx, blockRead, blockWrite uint64) {
+	FunctionReplicaCPUPercent.WithLabelValues(functionName, replica).Set(cpuPercent)
+	FunctionReplicaMemoryUsageBytes.WithLabelValues(functionName, replica).Set(float64(memoryUsage))
+	FunctionReplicaMemoryLimitBytes.WithLabelValues(functionName, replica).Set(float64(memoryLimit))
+	FunctionReplicaNetworkReceiveBytes.WithLabelValues(functionName, replica).Set(float64(networkRx))
+	FunctionReplicaNetworkTransmitBytes.WithLabelValues(functionName, replica).Set(float64(networkTx))
+	FunctionReplicaBlockReadBytes.WithLabelValues(functionName, replica).Set(float64(blockRead))
+	FunctionReplicaBlockWriteBytes.WithLabelValues(functionName, replica).Set(float64(blockWrite))
+}
+
+// DeleteReplicaStats removes the resource usage gauges of a replica that is gone
+func DeleteReplicaStats(functionName, replica string) {
+	for _, gauge := range []*prometheus.GaugeVec{
+		FunctionReplicaCPUPercent,
+		FunctionReplicaMemoryUsageBytes,
+		FunctionReplicaMemoryLimitBytes,
+		FunctionReplicaNetworkReceiveBytes,
+		FunctionReplicaNetworkTransmitBytes,
+		FunctionReplicaBlockReadBytes,
+		FunctionReplicaBlockWriteBytes,
+	} {
+		gauge.DeleteLabelValues(functionName, replica)
+	}
+}
+
+// RecordImageGC records the images removed and space reclaimed by an image
+// garbage collection run
+func RecordImageGC(removed int, reclaimedBytes int64) {
+	ImageGCRemovedImagesTotal.Add(float64(removed))
+	ImageGCReclaimedBytesTotal.Add(float64(reclaimedBytes))
 }
@@ -0,0 +1,277 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+
+	"github.com/docker-faas/docker-faas/pkg/clientip"
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+)
+
+// functionRoutePrefixes are checked by the gateway, where per-function
+// annotations can replace the route rules. Pipelines are checked against the
+// rules of each of their functions.
+var functionRoutePrefixes = []string{"/function/", "/async-function/", "/pipeline/"}
+
+// adminPathPrefix holds the management API, which the rules file may restrict
+// but never make public
+const adminPathPrefix = "/system/"
+
+// AccessRule controls access to a path. A path ending in "/" matches
+// everything below it; otherwise it matches the exact path and its subpaths,
+// or only the path itself when Exact is set.
+type AccessRule struct {
+	Path   string   `yaml:"path"`
+	Exact  bool     `yaml:"exact"`
+	Allow  []string `yaml:"allow"`
+	Deny   []string `yaml:"deny"`
+	Public bool     `yaml:"public"`
+}
+
+type accessRulesFile struct {
+	Routes []AccessRule `yaml:"routes"`
+}
+
+type compiledAccessRule struct {
+	path   string
+	exact  bool
+	ips    clientip.Rules
+	public bool
+}
+
+// AccessPolicy holds the route rules used for IP filtering and for deciding
+// which paths skip authentication. The two are decided separately: a rule
+// that only lists IPs does not change whether its path is public. Rules from
+// a file are reloadable.
+type AccessPolicy struct {
+	base   []AccessRule
+	file   string
+	logger *logrus.Logger
+
+	mu      sync.RWMutex
+	rules   []compiledAccessRule
+	modTime time.Time
+}
+
+// DefaultAccessRules returns the built-in public routes
+func DefaultAccessRules(requireFunctionAuth bool) []AccessRule {
+	rules := []AccessRule{
+		{Path: "/healthz", Exact: true, Public: true},
+		{Path: "/auth/login", Exact: true, Public: true},
+	}
+	if !requireFunctionAuth {
+		// Allow unauthenticated function invocation for OpenFaaS compatibility.
+		// Pipelines only invoke functions, so they are as open as the functions.
+		rules = append(rules,
+			AccessRule{Path: "/function/", Public: true},
+			AccessRule{Path: "/pipeline/", Public: true},
+		)
+	}
+	return rules
+}
+
+// NewAccessPolicy compiles the base rules merged with the rules in file, if set
+func NewAccessPolicy(base []AccessRule, file string, logger *logrus.Logger) (*AccessPolicy, error) {
+	p := &AccessPolicy{base: base, file: file, logger: logger}
+	if err := p.Reload(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// Reload re-reads the rules file and replaces the active rules
+func (p *AccessPolicy) Reload() error {
+	rules := append([]AccessRule(nil), p.base...)
+	var modTime time.Time
+	if p.file != "" {
+		info, err := os.Stat(p.file)
+		if err != nil {
+			return fmt.Errorf("failed to read access rules: %w", err)
+		}
+		modTime = info.ModTime()
+
+		data, err := os.ReadFile(p.file)
+		if err != nil {
+			return fmt.Errorf("failed to read access rules: %w", err)
+		}
+		var parsed accessRulesFile
+		if err := yaml.Unmarshal(data, &parsed); err != nil {
+			return fmt.Errorf("failed to parse access rules %s: %w", p.file, err)
+		}
+		for _, rule := range parsed.Routes {
+			if rule.Public && coversAdminPaths(rule) {
+				return fmt.Errorf("access rule %s: routes under %s cannot be made public", rule.Path, adminPathPrefix)
+			}
+		}
+		rules = mergeAccessRules(rules, parsed.Routes)
+	}
+
+	compiled, err := compileAccessRules(rules)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	p.rules = compiled
+	p.modTime = modTime
+	p.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the rules file when it changes, keeping the previous rules
+// if the new file is invalid
+func (p *AccessPolicy) Watch(ctx context.Context, interval time.Duration) {
+	if p.file == "" || interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			info, err := os.Stat(p.file)
+			if err != nil {
+				p.logger.Errorf("Access rules unavailable, keeping previous rules: %v", err)
+				continue
+			}
+			p.mu.RLock()
+			unchanged := info.ModTime().Equal(p.modTime)
+			p.mu.RUnlock()
+			if unchanged {
+				continue
+			}
+			if err := p.Reload(); err != nil {
+				p.logger.Errorf("Access rules reload failed, keeping previous rules: %v", err)
+				continue
+			}
+			p.logger.Infof("Reloaded access rules from %s", p.file)
+		}
+	}
+}
+
+// Public reports whether a path skips authentication: whether any public
+// rule matches it
+func (p *AccessPolicy) Public(path string) bool {
+	_, ok := p.match(path, func(rule compiledAccessRule) bool { return rule.public })
+	return ok
+}
+
+// RouteRules returns the IP rules of the most specific route with IP rules
+// matching path
+func (p *AccessPolicy) RouteRules(path string) (clientip.Rules, string, bool) {
+	rule, ok := p.match(path, func(rule compiledAccessRule) bool { return !rule.ips.Empty() })
+	if !ok {
+		return clientip.Rules{}, "", false
+	}
+	return rule.ips, rule.path, true
+}
+
+// Middleware rejects requests from client IPs the matching route does not allow
+func (p *AccessPolicy) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range functionRoutePrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		rules, route, ok := p.RouteRules(r.URL.Path)
+		if ok {
+			if ip := clientip.FromRequest(r); !rules.Allowed(ip) {
+				p.logger.Warnf("Access to %s denied for %s by route %s", r.URL.Path, ip, route)
+				metrics.RecordAccessDenied("route", route)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// match returns the most specific rule matching path that satisfies include
+func (p *AccessPolicy) match(path string, include func(compiledAccessRule) bool) (compiledAccessRule, bool) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	// Rules are sorted longest path first, so the first match is the most specific
+	for _, rule := range p.rules {
+		if include(rule) && pathMatches(rule.path, rule.exact, path) {
+			return rule, true
+		}
+	}
+	return compiledAccessRule{}, false
+}
+
+func pathMatches(rulePath string, exact bool, path string) bool {
+	if exact {
+		return path == rulePath
+	}
+	if strings.HasSuffix(rulePath, "/") {
+		return strings.HasPrefix(path, rulePath)
+	}
+	return path == rulePath || strings.HasPrefix(path, rulePath+"/")
+}
+
+// coversAdminPaths reports whether a rule matches any path of the management API
+func coversAdminPaths(rule AccessRule) bool {
+	if strings.HasPrefix(rule.Path, adminPathPrefix) {
+		return true
+	}
+	return !rule.Exact && (pathMatches(rule.Path, false, adminPathPrefix) || pathMatches(rule.Path, false, strings.TrimSuffix(adminPathPrefix, "/")))
+}
+
+// mergeAccessRules overlays rules onto base. A rule for an existing path
+// replaces its IP lists; a path stays public if either rule marks it public,
+// and a built-in exact match stays exact.
+func mergeAccessRules(base, overrides []AccessRule) []AccessRule {
+	merged := append([]AccessRule(nil), base...)
+	for _, override := range overrides {
+		replaced := false
+		for i := range merged {
+			if merged[i].Path == override.Path {
+				merged[i].Allow = override.Allow
+				merged[i].Deny = override.Deny
+				merged[i].Public = merged[i].Public || override.Public
+				merged[i].Exact = merged[i].Exact || override.Exact
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+func compileAccessRules(rules []AccessRule) ([]compiledAccessRule, error) {
+	compiled := make([]compiledAccessRule, 0, len(rules))
+	for _, rule := range rules {
+		if !strings.HasPrefix(rule.Path, "/") {
+			return nil, fmt.Errorf("access rule path %q must start with /", rule.Path)
+		}
+		ips, err := clientip.NewRules(rule.Allow, rule.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("access rule %s: %w", rule.Path, err)
+		}
+		compiled = append(compiled, compiledAccessRule{path: rule.Path, exact: rule.Exact, ips: ips, public: rule.Public})
+	}
+	sort.SliceStable(compiled, func(i, j int) bool {
+		return len(compiled[i].path) > len(compiled[j].path)
+	})
+	return compiled, nil
+}
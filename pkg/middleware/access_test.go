@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAccessPolicy(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(&bytes.Buffer{})
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(policy *AccessPolicy, path, remoteAddr string) int {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		policy.Middleware(handler).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	t.Run("RestrictsSystemRoutes", func(t *testing.T) {
+		rules := append(DefaultAccessRules(true), AccessRule{Path: "/system/", Allow: []string{"10.0.0.0/8"}})
+		policy, err := NewAccessPolicy(rules, "", logger)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, request(policy, "/system/functions", "10.1.2.3:5000"))
+		assert.Equal(t, http.StatusForbidden, request(policy, "/system/functions", "203.0.113.7:5000"))
+		assert.Equal(t, http.StatusOK, request(policy, "/healthz", "203.0.113.7:5000"))
+		// Function routes are checked by the gateway so annotations can apply
+		assert.Equal(t, http.StatusOK, request(policy, "/function/echo", "203.0.113.7:5000"))
+		assert.Equal(t, http.StatusOK, request(policy, "/pipeline/thumbnails", "203.0.113.7:5000"))
+	})
+
+	t.Run("MostSpecificRuleWins", func(t *testing.T) {
+		policy, err := NewAccessPolicy([]AccessRule{
+			{Path: "/system/", Allow: []string{"10.0.0.0/8"}},
+			{Path: "/system/metrics", Allow: []string{"192.0.2.0/24"}},
+		}, "", logger)
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, request(policy, "/system/metrics", "192.0.2.10:5000"))
+		assert.Equal(t, http.StatusForbidden, request(policy, "/system/info", "192.0.2.10:5000"))
+	})
+
+	t.Run("PublicRoutes", func(t *testing.T) {
+		policy, err := NewAccessPolicy(DefaultAccessRules(false), "", logger)
+		require.NoError(t, err)
+
+		assert.True(t, policy.Public("/healthz"))
+		assert.True(t, policy.Public("/auth/login"))
+		assert.True(t, policy.Public("/function/echo"))
+		assert.True(t, policy.Public("/pipeline/thumbnails"))
+		assert.False(t, policy.Public("/system/functions"))
+		assert.False(t, policy.Public("/auth/logout"))
+	})
+
+	t.Run("BuiltInPublicRoutesAreExact", func(t *testing.T) {
+		policy, err := NewAccessPolicy(DefaultAccessRules(true), "", logger)
+		require.NoError(t, err)
+
+		assert.False(t, policy.Public("/healthz/anything"))
+		assert.False(t, policy.Public("/auth/login/x"))
+		assert.False(t, policy.Public("/function/echo"))
+		assert.False(t, policy.Public("/pipeline/thumbnails"))
+	})
+
+	t.Run("IPRulesDoNotChangePublicRoutes", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "access.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("routes:\n  - path: /function/echo/\n    deny: [203.0.113.0/24]\n  - path: /healthz\n    allow: [10.0.0.0/8]\n  - path: /\n    deny: [198.51.100.0/24]\n"), 0600))
+
+		policy, err := NewAccessPolicy(DefaultAccessRules(false), file, logger)
+		require.NoError(t, err)
+		assert.True(t, policy.Public("/function/echo/"), "an IP-only rule inherits public from the broader rule")
+		assert.True(t, policy.Public("/healthz"))
+		assert.False(t, policy.Public("/system/info"))
+
+		// A public rule without IPs does not hide the IP rules of broader routes
+		assert.Equal(t, http.StatusForbidden, request(policy, "/auth/login", "198.51.100.1:5000"))
+		assert.Equal(t, http.StatusForbidden, request(policy, "/healthz", "198.51.100.1:5000"))
+	})
+
+	t.Run("RulesFileCannotMakeSystemPublic", func(t *testing.T) {
+		for _, path := range []string{"/system/", "/system", "/system/info", "/"} {
+			file := filepath.Join(t.TempDir(), "access.yaml")
+			require.NoError(t, os.WriteFile(file, []byte("routes:\n  - path: "+path+"\n    public: true\n"), 0600))
+			_, err := NewAccessPolicy(DefaultAccessRules(true), file, logger)
+			assert.Error(t, err, "public rule for %s", path)
+		}
+
+		file := filepath.Join(t.TempDir(), "access.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("routes:\n  - path: /function/echo\n    public: true\n"), 0600))
+		policy, err := NewAccessPolicy(DefaultAccessRules(true), file, logger)
+		require.NoError(t, err)
+		assert.True(t, policy.Public("/function/echo"))
+	})
+
+	t.Run("ReloadsRulesFile", func(t *testing.T) {
+		file := filepath.Join(t.TempDir(), "access.yaml")
+		require.NoError(t, os.WriteFile(file, []byte("routes:\n  - path: /system/\n    deny: [203.0.113.0/24]\n"), 0600))
+
+		policy, err := NewAccessPolicy(DefaultAccessRules(true), file, logger)
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusForbidden, request(policy, "/system/info", "203.0.113.7:5000"))
+
+		require.NoError(t, os.WriteFile(file, []byte("routes:\n  - path: /system/\n    allow: [203.0.113.0/24]\n"), 0600))
+		future := time.Now().Add(time.Minute)
+		require.NoError(t, os.Chtimes(file, future, future))
+		require.NoError(t, policy.Reload())
+		assert.Equal(t, http.StatusOK, request(policy, "/system/info", "203.0.113.7:5000"))
+		assert.Equal(t, http.StatusForbidden, request(policy, "/system/info", "198.51.100.1:5000"))
+
+		require.NoError(t, os.WriteFile(file, []byte("routes:\n  - path: /system/\n    allow: [not-a-cidr]\n"), 0600))
+		assert.Error(t, policy.Reload())
+		assert.Equal(t, http.StatusOK, request(policy, "/system/info", "203.0.113.7:5000"), "invalid rules must keep the previous rules")
+	})
+}
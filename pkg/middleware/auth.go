@@ -1,6 +1,7 @@
 package middleware
 
 import (
+	"context"
 	"crypto/subtle"
 	"net/http"
 	"strconv"
@@ -9,8 +10,24 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/docker-faas/docker-faas/pkg/auth"
+	"github.com/docker-faas/docker-faas/pkg/tlsconfig"
 )
 
+// identityKey carries the authenticated gateway identity on the request context
+type identityKey struct{}
+
+// IdentityFromRequest returns the gateway identity the request was
+// authenticated as by Basic Auth, a token or a client certificate
+func IdentityFromRequest(r *http.Request) (string, bool) {
+	identity, ok := r.Context().Value(identityKey{}).(string)
+	return identity, ok
+}
+
+// WithIdentity returns a copy of the request authenticated as identity
+func WithIdentity(r *http.Request, identity string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, identity))
+}
+
 // BasicAuthMiddleware provides basic authentication
 type BasicAuthMiddleware struct {
 	username            string
@@ -19,11 +36,16 @@ type BasicAuthMiddleware struct {
 	requireFunctionAuth bool
 	rateLimiter         *authRateLimiter
 	tokenManager        *auth.Manager
+	certIdentities      map[string]string
+	accessPolicy        *AccessPolicy
 	logger              *logrus.Logger
 }
 
 // NewBasicAuthMiddleware creates a new basic auth middleware
 func NewBasicAuthMiddleware(username, password string, enabled bool, requireFunctionAuth bool, rateLimiter *authRateLimiter, tokenManager *auth.Manager, logger *logrus.Logger) *BasicAuthMiddleware {
+	// The built-in rules always compile, so the error can be ignored
+	accessPolicy, _ := NewAccessPolicy(DefaultAccessRules(requireFunctionAuth), "", logger)
+
 	return &BasicAuthMiddleware{
 		username:            username,
 		password:            password,
@@ -31,10 +53,23 @@ func NewBasicAuthMiddleware(username, password string, enabled bool, requireFunc
 		requireFunctionAuth: requireFunctionAuth,
 		rateLimiter:         rateLimiter,
 		tokenManager:        tokenManager,
+		accessPolicy:        accessPolicy,
 		logger:              logger,
 	}
 }
 
+// SetAccessPolicy replaces the built-in public routes with the routes of an access policy
+func (m *BasicAuthMiddleware) SetAccessPolicy(policy *AccessPolicy) {
+	m.accessPolicy = policy
+}
+
+// SetClientCertIdentities maps verified client certificate names (CN or SAN)
+// to gateway identities. Requests presenting a mapped certificate are
+// authenticated as that identity and authorized like a token for it.
+func (m *BasicAuthMiddleware) SetClientCertIdentities(identities map[string]string) {
+	m.certIdentities = identities
+}
+
 // Middleware returns the middleware function
 func (m *BasicAuthMiddleware) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -44,27 +79,30 @@ func (m *BasicAuthMiddleware) Middleware(next http.Handler) http.Handler {
 			return
 		}
 
-		// Skip auth for health check endpoint
-		if r.URL.Path == "/healthz" {
+		// Skip auth for public routes (health check, login, and functions
+		// when REQUIRE_AUTH_FOR_FUNCTIONS is off)
+		if m.accessPolicy.Public(r.URL.Path) {
 			next.ServeHTTP(w, r)
 			return
 		}
-		// Allow login endpoint without auth
-		if r.URL.Path == "/auth/login" {
-			next.ServeHTTP(w, r)
-			return
-		}
-		// Allow unauthenticated function invocation for OpenFaaS compatibility.
-		if !m.requireFunctionAuth && strings.HasPrefix(r.URL.Path, "/function/") {
-			next.ServeHTTP(w, r)
+
+		// Accept a verified client certificate mapped to a gateway identity
+		if identity, ok := tlsconfig.ClientIdentity(r.TLS, m.certIdentities); ok {
+			if !m.authorized(identity) {
+				m.logger.Warnf("Client certificate identity %s from %s is not authorized", identity, clientKey(r))
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			m.logger.Debugf("Authenticated %s as %s via client certificate", clientKey(r), identity)
+			next.ServeHTTP(w, WithIdentity(r, identity))
 			return
 		}
 
 		// Check bearer token first when provided
 		if token := bearerToken(r.Header.Get("Authorization")); token != "" && m.tokenManager != nil {
-			if _, ok := m.tokenManager.Validate(token); ok {
+			if username, ok := m.tokenManager.Validate(token); ok && m.authorized(username) {
 				m.rateLimiter.reset(clientKey(r))
-				next.ServeHTTP(w, r)
+				next.ServeHTTP(w, WithIdentity(r, username))
 				return
 			}
 			if allowed, retryAfter := m.rateLimiter.allow(clientKey(r)); !allowed {
@@ -104,17 +142,24 @@ func (m *BasicAuthMiddleware) Middleware(next http.Handler) http.Handler {
 				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
 				return
 			}
-			m.logger.Warnf("Authentication failed for user: %s from %s", username, r.RemoteAddr)
+			m.logger.Warnf("Authentication failed for user: %s from %s", username, clientKey(r))
 			m.unauthorized(w)
 			return
 		}
 
 		// Authentication successful
 		m.rateLimiter.reset(clientKey(r))
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, WithIdentity(r, username))
 	})
 }
 
+// authorized reports whether an identity may use the protected routes. The
+// gateway has a single administrator role, held by the Basic Auth user that
+// login issues tokens for; certificate identities must map to the same user.
+func (m *BasicAuthMiddleware) authorized(identity string) bool {
+	return subtle.ConstantTimeCompare([]byte(identity), []byte(m.username)) == 1
+}
+
 func (m *BasicAuthMiddleware) unauthorized(w http.ResponseWriter) {
 	w.Header().Set("WWW-Authenticate", `Basic realm="docker-faas"`)
 	w.WriteHeader(http.StatusUnauthorized)
@@ -2,6 +2,9 @@ package middleware
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/base64"
 	"net/http"
 	"net/http/httptest"
@@ -101,6 +104,18 @@ func TestBasicAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusOK, rr.Code)
 	})
 
+	t.Run("PipelineBypassWhenFunctionsArePublic", func(t *testing.T) {
+		middleware := NewBasicAuthMiddleware("admin", "secret", true, false, nil, nil, logger)
+		wrappedHandler := middleware.Middleware(handler)
+
+		req := httptest.NewRequest("POST", "/pipeline/thumbnails", nil)
+		rr := httptest.NewRecorder()
+
+		wrappedHandler.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusOK, rr.Code)
+	})
+
 	t.Run("FunctionRequiresAuthWhenEnabled", func(t *testing.T) {
 		middleware := NewBasicAuthMiddleware("admin", "secret", true, true, nil, nil, logger)
 		wrappedHandler := middleware.Middleware(handler)
@@ -129,6 +144,26 @@ func TestBasicAuthMiddleware(t *testing.T) {
 		assert.Equal(t, http.StatusTooManyRequests, rr2.Code)
 	})
 
+	t.Run("RateLimitIgnoresSpoofedForwardedFor", func(t *testing.T) {
+		limiter := NewAuthRateLimiter(1, time.Minute)
+		middleware := NewBasicAuthMiddleware("admin", "secret", true, true, limiter, nil, logger)
+		wrappedHandler := middleware.Middleware(handler)
+
+		for i, forwarded := range []string{"1.1.1.1", "2.2.2.2"} {
+			req := httptest.NewRequest("GET", "/test", nil)
+			req.RemoteAddr = "203.0.113.7:5000"
+			req.Header.Set("X-Forwarded-For", forwarded)
+			rr := httptest.NewRecorder()
+			wrappedHandler.ServeHTTP(rr, req)
+
+			if i == 0 {
+				assert.Equal(t, http.StatusUnauthorized, rr.Code)
+			} else {
+				assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+			}
+		}
+	})
+
 	t.Run("LoginBypass", func(t *testing.T) {
 		middleware := NewBasicAuthMiddleware("admin", "secret", true, true, nil, nil, logger)
 		wrappedHandler := middleware.Middleware(handler)
@@ -158,5 +193,54 @@ func TestBasicAuthMiddleware(t *testing.T) {
 		wrappedHandler.ServeHTTP(rr, req)
 
 		assert.Equal(t, http.StatusOK, rr.Code)
+
+		// Tokens only carry the administrator role of the user they were issued to
+		other, _, err := manager.Issue("someone")
+		if err != nil {
+			t.Fatalf("issue token: %v", err)
+		}
+		req = httptest.NewRequest("GET", "/test", nil)
+		req.Header.Set("Authorization", "Bearer "+other)
+		rr = httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	})
+
+	t.Run("ClientCertificateAuth", func(t *testing.T) {
+		middleware := NewBasicAuthMiddleware("admin", "secret", true, true, nil, nil, logger)
+		middleware.SetClientCertIdentities(map[string]string{"ci-bot": "admin", "reader": "viewer"})
+		var identity string
+		wrappedHandler := middleware.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			identity, _ = IdentityFromRequest(r)
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		verified := func(commonName string) *tls.ConnectionState {
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+			return &tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/test", nil)
+		req.TLS = verified("ci-bot")
+		rr := httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "admin", identity)
+
+		// A mapped identity without the administrator role is refused
+		req = httptest.NewRequest("GET", "/system/functions", nil)
+		req.TLS = verified("reader")
+		rr = httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusForbidden, rr.Code)
+
+		req = httptest.NewRequest("GET", "/test", nil)
+		req.TLS = verified("unknown")
+		rr = httptest.NewRecorder()
+		wrappedHandler.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
 	})
 }
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/docker-faas/docker-faas/pkg/clientip"
 	"github.com/docker-faas/docker-faas/pkg/metrics"
 	"github.com/sirupsen/logrus"
 )
@@ -29,6 +30,11 @@ func (rw *responseWriter) Flush() {
 	}
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 // LoggingMiddleware logs HTTP requests
 type LoggingMiddleware struct {
 	logger *logrus.Logger
@@ -60,6 +66,7 @@ func (m *LoggingMiddleware) Middleware(next http.Handler) http.Handler {
 			"status":      rw.statusCode,
 			"duration":    duration,
 			"remote_addr": r.RemoteAddr,
+			"client_ip":   clientip.FromRequest(r),
 			"user_agent":  r.UserAgent(),
 		}).Info("HTTP request")
 
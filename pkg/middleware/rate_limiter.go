@@ -1,11 +1,11 @@
 package middleware
 
 import (
-	"net"
 	"net/http"
-	"strings"
 	"sync"
 	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/clientip"
 )
 
 type authRateLimiter struct {
@@ -69,16 +69,7 @@ func (l *authRateLimiter) reset(key string) {
 	l.mu.Unlock()
 }
 
+// clientKey identifies the caller by the client IP resolved from trusted proxies
 func clientKey(r *http.Request) string {
-	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
-		parts := strings.Split(forwarded, ",")
-		if len(parts) > 0 {
-			return strings.TrimSpace(parts[0])
-		}
-	}
-	host, _, err := net.SplitHostPort(r.RemoteAddr)
-	if err == nil && host != "" {
-		return host
-	}
-	return r.RemoteAddr
+	return clientip.FromRequest(r)
 }
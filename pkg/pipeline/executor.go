@@ -0,0 +1,293 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// Call is one step's invocation of a function
+type Call struct {
+	Step     string
+	Function string
+	Method   string
+	Header   http.Header
+	Body     []byte
+}
+
+// Response is a function's buffered response
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Invoker invokes a function. Errors mean no response was received; HTTP
+// error statuses are returned as responses.
+type Invoker func(ctx context.Context, call Call) (*Response, error)
+
+// Input is the request a pipeline was invoked with
+type Input struct {
+	Method string
+	Header http.Header
+	Body   []byte
+}
+
+// Executor runs pipelines through an invoker and records them in a history
+type Executor struct {
+	invoke  Invoker
+	history *History
+}
+
+// NewExecutor creates an executor; history may be nil
+func NewExecutor(invoke Invoker, history *History) *Executor {
+	return &Executor{invoke: invoke, history: history}
+}
+
+// stepResult is the outcome of a step, readable once done is closed
+type stepResult struct {
+	done     chan struct{}
+	status   string
+	message  string
+	response *Response
+}
+
+// Run executes a validated pipeline. Independent steps run concurrently; each
+// step starts once its dependencies finish. The returned response is the last
+// step's and is nil when that step produced none.
+func (e *Executor) Run(ctx context.Context, p *types.Pipeline, id string, async bool, input Input) (*Response, types.PipelineRun) {
+	start := time.Now()
+	state := &runState{run: types.PipelineRun{
+		ID:        id,
+		Pipeline:  p.Name,
+		Async:     async,
+		Status:    StatusRunning,
+		StartedAt: start,
+		Steps:     make([]types.PipelineStepRun, len(p.Steps)),
+	}}
+	for i, step := range p.Steps {
+		state.run.Steps[i] = types.PipelineStepRun{Name: step.Name, Function: step.Function, Status: StatusPending}
+	}
+	if e.history != nil {
+		e.history.add(state)
+	}
+
+	if timeout, _ := parseTimeout(p.Timeout); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	runCtx, cancelRun := context.WithCancel(ctx)
+	defer cancelRun()
+
+	index := make(map[string]int, len(p.Steps))
+	results := make([]*stepResult, len(p.Steps))
+	for i, step := range p.Steps {
+		index[step.Name] = i
+		results[i] = &stepResult{done: make(chan struct{})}
+	}
+
+	var (
+		failOnce sync.Once
+		wg       sync.WaitGroup
+	)
+	fail := func(message string) {
+		failOnce.Do(func() {
+			state.update(func(run *types.PipelineRun) { run.Error = message })
+			cancelRun()
+		})
+	}
+
+	for i := range p.Steps {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer close(results[i].done)
+			e.runStep(runCtx, p, i, input, index, results, state, fail)
+		}(i)
+	}
+	wg.Wait()
+
+	// The run fails when a step stopped it or the last step did not succeed
+	last := results[len(results)-1]
+	status := StatusSucceeded
+	state.update(func(run *types.PipelineRun) {
+		if last.status != StatusSucceeded && run.Error == "" {
+			run.Error = fmt.Sprintf("step %s %s", p.Steps[len(p.Steps)-1].Name, last.status)
+		}
+		if run.Error != "" {
+			status = StatusFailed
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				run.Error = fmt.Sprintf("pipeline timed out after %s", p.Timeout)
+			}
+		}
+		run.Status = status
+		run.FinishedAt = time.Now()
+		run.DurationMs = run.FinishedAt.Sub(start).Milliseconds()
+	})
+
+	metrics.RecordPipelineInvocation(p.Name, status, time.Since(start).Seconds())
+	return last.response, state.snapshot()
+}
+
+// runStep waits for a step's dependencies, then invokes its function
+func (e *Executor) runStep(ctx context.Context, p *types.Pipeline, i int, input Input, index map[string]int, results []*stepResult, state *runState, fail func(string)) {
+	step := p.Steps[i]
+	result := results[i]
+	finish := func(status string, code int, started time.Time, message string) {
+		result.status = status
+		result.message = message
+		state.update(func(run *types.PipelineRun) {
+			run.Steps[i].Status = status
+			run.Steps[i].StatusCode = code
+			run.Steps[i].Error = message
+			if !started.IsZero() {
+				run.Steps[i].DurationMs = time.Since(started).Milliseconds()
+			}
+		})
+		if !started.IsZero() {
+			metrics.RecordPipelineStep(p.Name, step.Name, status, time.Since(started).Seconds())
+		}
+	}
+
+	deps := dependencies(p.Steps, i)
+	for _, dep := range deps {
+		if dep == InputStep {
+			continue
+		}
+		parent := results[index[dep]]
+		<-parent.done
+		if !proceedAfter(parent.status, p.Steps[index[dep]]) {
+			finish(StatusSkipped, 0, time.Time{}, fmt.Sprintf("dependency %s %s", dep, parent.status))
+			return
+		}
+	}
+	if ctx.Err() != nil {
+		finish(StatusSkipped, 0, time.Time{}, "pipeline run was stopped")
+		return
+	}
+
+	call := buildCall(p, step, deps, input, index, results)
+	stepCtx := ctx
+	timeout, _ := parseTimeout(step.Timeout)
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		stepCtx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	started := time.Now()
+	state.update(func(run *types.PipelineRun) {
+		run.Steps[i].Status = StatusRunning
+		run.Steps[i].StartedAt = started
+	})
+
+	resp, err := e.invoke(stepCtx, call)
+	result.response = resp
+	switch {
+	case err != nil && errors.Is(stepCtx.Err(), context.DeadlineExceeded):
+		result.response = &Response{StatusCode: http.StatusGatewayTimeout, Header: make(http.Header)}
+		finish(StatusTimedOut, http.StatusGatewayTimeout, started, "step timed out")
+	case err != nil && ctx.Err() != nil:
+		result.response = nil
+		finish(StatusCancelled, 0, started, "pipeline run was stopped")
+		return
+	case err != nil:
+		result.response = nil
+		finish(StatusFailed, 0, started, err.Error())
+	case resp.StatusCode >= http.StatusBadRequest:
+		finish(StatusFailed, resp.StatusCode, started, fmt.Sprintf("function returned status %d", resp.StatusCode))
+	default:
+		finish(StatusSucceeded, resp.StatusCode, started, "")
+		return
+	}
+
+	if step.OnError != OnErrorContinue {
+		fail(fmt.Sprintf("step %s %s: %s", step.Name, result.status, result.message))
+	}
+}
+
+// proceedAfter reports whether a dependent step may run after a dependency
+func proceedAfter(status string, dep types.PipelineStep) bool {
+	switch status {
+	case StatusSucceeded:
+		return true
+	case StatusFailed, StatusTimedOut:
+		return dep.OnError == OnErrorContinue
+	default:
+		return false
+	}
+}
+
+// buildCall prepares a step's request. A step fed by the pipeline input
+// repeats the caller's method; other steps POST their dependencies' output.
+// A step with several dependencies receives a JSON object keyed by step name.
+func buildCall(p *types.Pipeline, step types.PipelineStep, deps []string, input Input, index map[string]int, results []*stepResult) Call {
+	call := Call{Step: step.Name, Function: step.Function, Method: http.MethodPost, Header: input.Header.Clone()}
+	if call.Header == nil {
+		call.Header = make(http.Header)
+	}
+
+	output := func(dep string) (*Response, []byte) {
+		if dep == InputStep {
+			return nil, input.Body
+		}
+		resp := results[index[dep]].response
+		if resp == nil {
+			return nil, nil
+		}
+		return resp, resp.Body
+	}
+
+	if len(deps) == 1 {
+		resp, body := output(deps[0])
+		call.Body = body
+		if deps[0] == InputStep {
+			call.Method = input.Method
+		}
+		if resp != nil {
+			propagateHeaders(call.Header, resp.Header, p.PropagateHeaders)
+			if contentType := resp.Header.Get("Content-Type"); contentType != "" {
+				call.Header.Set("Content-Type", contentType)
+			} else {
+				call.Header.Del("Content-Type")
+			}
+		}
+		return call
+	}
+
+	combined := make(map[string]any, len(deps))
+	for _, dep := range deps {
+		resp, body := output(dep)
+		if resp != nil {
+			propagateHeaders(call.Header, resp.Header, p.PropagateHeaders)
+		}
+		if json.Valid(body) {
+			combined[dep] = json.RawMessage(body)
+		} else {
+			combined[dep] = string(body)
+		}
+	}
+	call.Body, _ = json.Marshal(combined)
+	call.Header.Set("Content-Type", "application/json")
+	return call
+}
+
+// propagateHeaders copies the configured response headers onto a request
+func propagateHeaders(dst, src http.Header, names []string) {
+	for _, name := range names {
+		if values := src.Values(name); len(values) > 0 {
+			dst.Del(name)
+			for _, value := range values {
+				dst.Add(name, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// fakeInvoker answers calls per function and records what each step received
+type fakeInvoker struct {
+	mu       sync.Mutex
+	calls    map[string]Call
+	handlers map[string]func(ctx context.Context, call Call) (*Response, error)
+}
+
+func newFakeInvoker() *fakeInvoker {
+	return &fakeInvoker{
+		calls:    make(map[string]Call),
+		handlers: make(map[string]func(ctx context.Context, call Call) (*Response, error)),
+	}
+}
+
+func (f *fakeInvoker) invoke(ctx context.Context, call Call) (*Response, error) {
+	f.mu.Lock()
+	f.calls[call.Step] = call
+	handler := f.handlers[call.Function]
+	f.mu.Unlock()
+
+	if handler != nil {
+		return handler(ctx, call)
+	}
+	// By default functions upper-case their input
+	header := http.Header{"Content-Type": []string{"text/plain"}}
+	return &Response{StatusCode: http.StatusOK, Header: header, Body: []byte(strings.ToUpper(string(call.Body)))}, nil
+}
+
+func (f *fakeInvoker) call(step string) (Call, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	call, ok := f.calls[step]
+	return call, ok
+}
+
+func stepStatuses(run types.PipelineRun) map[string]string {
+	statuses := make(map[string]string, len(run.Steps))
+	for _, step := range run.Steps {
+		statuses[step.Name] = step.Status
+	}
+	return statuses
+}
+
+func TestExecutor_Chain(t *testing.T) {
+	invoker := newFakeInvoker()
+	invoker.handlers["trace"] = func(ctx context.Context, call Call) (*Response, error) {
+		header := http.Header{"Content-Type": []string{"application/json"}, "X-Trace": []string{"abc"}, "X-Internal": []string{"1"}}
+		return &Response{StatusCode: http.StatusOK, Header: header, Body: []byte(`{"traced":true}`)}, nil
+	}
+	history := NewHistory(10)
+	executor := NewExecutor(invoker.invoke, history)
+
+	p := &types.Pipeline{
+		Name:             "chain",
+		PropagateHeaders: []string{"X-Trace"},
+		Steps: []types.PipelineStep{
+			{Name: "upper", Function: "upper"},
+			{Name: "trace", Function: "trace"},
+			{Name: "echo", Function: "upper"},
+		},
+	}
+	input := Input{Method: http.MethodPut, Header: http.Header{"Content-Type": []string{"text/plain"}, "Authorization": []string{"Bearer t"}}, Body: []byte("hello")}
+	resp, run := executor.Run(context.Background(), p, "call-1", false, input)
+
+	if resp == nil || string(resp.Body) != `{"TRACED":TRUE}` {
+		t.Fatalf("unexpected response: %+v", resp)
+	}
+	if run.Status != StatusSucceeded || run.Error != "" {
+		t.Fatalf("expected run to succeed, got %+v", run)
+	}
+	for _, step := range run.Steps {
+		if step.Status != StatusSucceeded || step.StatusCode != http.StatusOK || step.StartedAt.IsZero() {
+			t.Fatalf("unexpected step record: %+v", step)
+		}
+	}
+
+	first, _ := invoker.call("upper")
+	if first.Method != http.MethodPut || string(first.Body) != "hello" {
+		t.Fatalf("expected the first step to receive the caller's request, got %+v", first)
+	}
+	second, _ := invoker.call("trace")
+	if second.Method != http.MethodPost || string(second.Body) != "HELLO" || second.Header.Get("Authorization") != "Bearer t" {
+		t.Fatalf("expected the second step to receive the first step's output, got %+v", second)
+	}
+	third, _ := invoker.call("echo")
+	if third.Header.Get("X-Trace") != "abc" || third.Header.Get("X-Internal") != "" || third.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected only configured headers to propagate, got %v", third.Header)
+	}
+
+	recorded, ok := history.Get("chain", "call-1")
+	if !ok || recorded.Status != StatusSucceeded || len(recorded.Steps) != 3 {
+		t.Fatalf("expected the run to be recorded, got %+v", recorded)
+	}
+}
+
+func TestExecutor_FanIn(t *testing.T) {
+	invoker := newFakeInvoker()
+	invoker.handlers["json"] = func(ctx context.Context, call Call) (*Response, error) {
+		return &Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: []byte(`{"n":1}`)}, nil
+	}
+	invoker.handlers["echo"] = func(ctx context.Context, call Call) (*Response, error) {
+		return &Response{StatusCode: http.StatusOK, Header: http.Header{}, Body: call.Body}, nil
+	}
+	executor := NewExecutor(invoker.invoke, nil)
+
+	p := &types.Pipeline{
+		Name: "fan-in",
+		Steps: []types.PipelineStep{
+			{Name: "a", Function: "json"},
+			{Name: "b", Function: "upper", DependsOn: []string{"input"}},
+			{Name: "merge", Function: "echo", DependsOn: []string{"a", "b", "input"}},
+		},
+	}
+	resp, run := executor.Run(context.Background(), p, "call-2", false, Input{Method: http.MethodPost, Body: []byte("x")})
+	if run.Status != StatusSucceeded {
+		t.Fatalf("expected run to succeed, got %+v", run)
+	}
+	if string(resp.Body) != `{"a":{"n":1},"b":"X","input":"x"}` {
+		t.Fatalf("unexpected merged body: %s", resp.Body)
+	}
+	merge, _ := invoker.call("merge")
+	if merge.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected merged input to be JSON, got %v", merge.Header)
+	}
+}
+
+func TestExecutor_OnError(t *testing.T) {
+	invoker := newFakeInvoker()
+	slowStarted := make(chan struct{})
+	invoker.handlers["broken"] = func(ctx context.Context, call Call) (*Response, error) {
+		if call.Step == "broken" {
+			<-slowStarted
+		}
+		return &Response{StatusCode: http.StatusInternalServerError, Header: http.Header{}, Body: []byte("boom")}, nil
+	}
+	invoker.handlers["slow"] = func(ctx context.Context, call Call) (*Response, error) {
+		close(slowStarted)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	executor := NewExecutor(invoker.invoke, nil)
+
+	// A failing step stops the run: running steps are cancelled and the rest skipped
+	p := &types.Pipeline{
+		Name: "fail",
+		Steps: []types.PipelineStep{
+			{Name: "slow", Function: "slow", DependsOn: []string{"input"}},
+			{Name: "broken", Function: "broken", DependsOn: []string{"input"}},
+			{Name: "after", Function: "upper"},
+		},
+	}
+	resp, run := executor.Run(context.Background(), p, "call-3", false, Input{})
+	if resp != nil || run.Status != StatusFailed || !strings.Contains(run.Error, "step broken failed") {
+		t.Fatalf("expected run to fail at the broken step, got %+v (%+v)", run, resp)
+	}
+	expected := map[string]string{"slow": StatusCancelled, "broken": StatusFailed, "after": StatusSkipped}
+	if statuses := stepStatuses(run); !equalStatuses(statuses, expected) {
+		t.Fatalf("unexpected step statuses: %v", statuses)
+	}
+
+	// With onError continue the failed step's response is passed on
+	p = &types.Pipeline{
+		Name: "continue",
+		Steps: []types.PipelineStep{
+			{Name: "lenient", Function: "broken", OnError: OnErrorContinue},
+			{Name: "after", Function: "upper"},
+		},
+	}
+	resp, run = executor.Run(context.Background(), p, "call-4", false, Input{})
+	if run.Status != StatusSucceeded || resp == nil || string(resp.Body) != "BOOM" {
+		t.Fatalf("expected run to continue past the failure, got %+v (%+v)", run, resp)
+	}
+	if run.Steps[0].Status != StatusFailed || run.Steps[0].StatusCode != http.StatusInternalServerError {
+		t.Fatalf("expected the failure to be recorded, got %+v", run.Steps[0])
+	}
+}
+
+func TestExecutor_Timeouts(t *testing.T) {
+	invoker := newFakeInvoker()
+	invoker.handlers["slow"] = func(ctx context.Context, call Call) (*Response, error) {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(5 * time.Second):
+			return nil, errors.New("step was not timed out")
+		}
+	}
+	executor := NewExecutor(invoker.invoke, nil)
+
+	p := &types.Pipeline{
+		Name:  "step-timeout",
+		Steps: []types.PipelineStep{{Name: "slow", Function: "slow", Timeout: "20ms"}, {Name: "after", Function: "upper"}},
+	}
+	_, run := executor.Run(context.Background(), p, "call-5", false, Input{})
+	if run.Status != StatusFailed || run.Steps[0].Status != StatusTimedOut || run.Steps[0].StatusCode != http.StatusGatewayTimeout || run.Steps[1].Status != StatusSkipped {
+		t.Fatalf("expected the step to time out, got %+v", run)
+	}
+
+	p = &types.Pipeline{
+		Name:    "pipeline-timeout",
+		Timeout: "20ms",
+		Steps:   []types.PipelineStep{{Name: "slow", Function: "slow"}},
+	}
+	_, run = executor.Run(context.Background(), p, "call-6", false, Input{})
+	if run.Status != StatusFailed || run.Error != "pipeline timed out after 20ms" {
+		t.Fatalf("expected the pipeline to time out, got %+v", run)
+	}
+}
+
+func equalStatuses(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,97 @@
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// runState is a run shared between the executor and the history
+type runState struct {
+	mu  sync.Mutex
+	run types.PipelineRun
+}
+
+func (s *runState) update(fn func(run *types.PipelineRun)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn(&s.run)
+}
+
+// snapshot returns a copy that is safe to read while the run progresses
+func (s *runState) snapshot() types.PipelineRun {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run := s.run
+	run.Steps = append([]types.PipelineStepRun(nil), s.run.Steps...)
+	return run
+}
+
+// History keeps the most recent pipeline runs in memory, newest first
+type History struct {
+	mu    sync.RWMutex
+	runs  []*runState
+	limit int
+}
+
+// NewHistory creates a history holding up to limit runs across all pipelines
+func NewHistory(limit int) *History {
+	if limit <= 0 {
+		limit = 100
+	}
+	return &History{limit: limit}
+}
+
+func (h *History) add(state *runState) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.runs = append([]*runState{state}, h.runs...)
+	if len(h.runs) > h.limit {
+		h.runs = h.runs[:h.limit]
+	}
+}
+
+// List returns the recorded runs of a pipeline, newest first
+func (h *History) List(pipeline string) []types.PipelineRun {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	runs := make([]types.PipelineRun, 0)
+	for _, state := range h.runs {
+		if run := state.snapshot(); run.Pipeline == pipeline {
+			runs = append(runs, run)
+		}
+	}
+	return runs
+}
+
+// Get returns a recorded run of a pipeline by ID
+func (h *History) Get(pipeline, id string) (types.PipelineRun, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, state := range h.runs {
+		if run := state.snapshot(); run.Pipeline == pipeline && run.ID == id {
+			return run, true
+		}
+	}
+	return types.PipelineRun{}, false
+}
+
+// Forget drops the recorded runs of a deleted pipeline
+func (h *History) Forget(pipeline string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	runs := h.runs[:0]
+	for _, state := range h.runs {
+		if state.snapshot().Pipeline != pipeline {
+			runs = append(runs, state)
+		}
+	}
+	for i := len(runs); i < len(h.runs); i++ {
+		h.runs[i] = nil
+	}
+	h.runs = runs
+}
@@ -0,0 +1,141 @@
+package pipeline
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// InputStep is the dependency name of the pipeline's own request
+	InputStep = "input"
+
+	// OnErrorFail stops the run when a step fails (the default)
+	OnErrorFail = "fail"
+	// OnErrorContinue passes a failed step's response on to its dependents
+	OnErrorContinue = "continue"
+
+	// MaxSteps bounds the number of steps of a pipeline
+	MaxSteps = 32
+)
+
+// Run and step statuses
+const (
+	StatusPending   = "pending"
+	StatusRunning   = "running"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusTimedOut  = "timed_out"
+	StatusSkipped   = "skipped"
+	StatusCancelled = "cancelled"
+)
+
+var namePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// ValidateName checks the name of a pipeline or step
+func ValidateName(name string) error {
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid name %q: must start with a letter or digit and contain only letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// Validate checks a pipeline definition. Steps may only depend on earlier
+// steps, so every valid pipeline is acyclic and runs in declaration order.
+func Validate(p *types.Pipeline) error {
+	if err := ValidateName(p.Name); err != nil {
+		return err
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("pipeline %s has no steps", p.Name)
+	}
+	if len(p.Steps) > MaxSteps {
+		return fmt.Errorf("pipeline %s has %d steps, the maximum is %d", p.Name, len(p.Steps), MaxSteps)
+	}
+	if _, err := parseTimeout(p.Timeout); err != nil {
+		return fmt.Errorf("pipeline %s: %w", p.Name, err)
+	}
+	for _, header := range p.PropagateHeaders {
+		if header == "" {
+			return fmt.Errorf("pipeline %s: propagated header names must not be empty", p.Name)
+		}
+	}
+
+	seen := make(map[string]bool, len(p.Steps))
+	for _, step := range p.Steps {
+		if err := ValidateName(step.Name); err != nil {
+			return fmt.Errorf("step: %w", err)
+		}
+		if step.Name == InputStep {
+			return fmt.Errorf("step name %q is reserved for the pipeline input", InputStep)
+		}
+		if seen[step.Name] {
+			return fmt.Errorf("step %s is defined more than once", step.Name)
+		}
+		if err := ValidateName(step.Function); err != nil {
+			return fmt.Errorf("step %s: function: %w", step.Name, err)
+		}
+		deps := make(map[string]bool, len(step.DependsOn))
+		for _, dep := range step.DependsOn {
+			if dep != InputStep && !seen[dep] {
+				return fmt.Errorf("step %s depends on %q, which is not an earlier step or %q", step.Name, dep, InputStep)
+			}
+			if deps[dep] {
+				return fmt.Errorf("step %s depends on %s more than once", step.Name, dep)
+			}
+			deps[dep] = true
+		}
+		if _, err := parseTimeout(step.Timeout); err != nil {
+			return fmt.Errorf("step %s: %w", step.Name, err)
+		}
+		switch step.OnError {
+		case "", OnErrorFail, OnErrorContinue:
+		default:
+			return fmt.Errorf("step %s: onError must be %s or %s", step.Name, OnErrorFail, OnErrorContinue)
+		}
+		seen[step.Name] = true
+	}
+	return nil
+}
+
+// Functions returns the distinct functions a pipeline invokes, in step order
+func Functions(p *types.Pipeline) []string {
+	seen := make(map[string]bool, len(p.Steps))
+	var functions []string
+	for _, step := range p.Steps {
+		if !seen[step.Function] {
+			seen[step.Function] = true
+			functions = append(functions, step.Function)
+		}
+	}
+	return functions
+}
+
+// dependencies returns the steps a step waits for. Without an explicit list
+// a step depends on the previous one, and the first step on the input.
+func dependencies(steps []types.PipelineStep, i int) []string {
+	if len(steps[i].DependsOn) > 0 {
+		return steps[i].DependsOn
+	}
+	if i == 0 {
+		return []string{InputStep}
+	}
+	return []string{steps[i-1].Name}
+}
+
+// parseTimeout parses an optional positive duration
+func parseTimeout(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout %q: %w", value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("timeout %q must be positive", value)
+	}
+	return d, nil
+}
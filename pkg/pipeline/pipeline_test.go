@@ -0,0 +1,75 @@
+package pipeline
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestValidate(t *testing.T) {
+	valid := &types.Pipeline{
+		Name:    "thumbnails",
+		Timeout: "1m",
+		Steps: []types.PipelineStep{
+			{Name: "fetch", Function: "fetch"},
+			{Name: "resize", Function: "resize", Timeout: "10s"},
+			{Name: "tag", Function: "classify", DependsOn: []string{"fetch"}, OnError: OnErrorContinue},
+			{Name: "store", Function: "store", DependsOn: []string{"resize", "tag", "input"}},
+		},
+	}
+	if err := Validate(valid); err != nil {
+		t.Fatalf("expected pipeline to be valid: %v", err)
+	}
+
+	invalid := map[string]*types.Pipeline{
+		"no steps":          {Name: "p"},
+		"bad name":          {Name: "../p", Steps: []types.PipelineStep{{Name: "a", Function: "a"}}},
+		"reserved step":     {Name: "p", Steps: []types.PipelineStep{{Name: InputStep, Function: "a"}}},
+		"duplicate step":    {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a"}, {Name: "a", Function: "b"}}},
+		"bad function":      {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a/b"}}},
+		"later dependency":  {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a", DependsOn: []string{"b"}}, {Name: "b", Function: "b"}}},
+		"self dependency":   {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a", DependsOn: []string{"a"}}}},
+		"repeated dep":      {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a", DependsOn: []string{"input", "input"}}}},
+		"bad step timeout":  {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a", Timeout: "soon"}}},
+		"negative timeout":  {Name: "p", Timeout: "-1s", Steps: []types.PipelineStep{{Name: "a", Function: "a"}}},
+		"unknown onError":   {Name: "p", Steps: []types.PipelineStep{{Name: "a", Function: "a", OnError: "retry"}}},
+		"empty header name": {Name: "p", PropagateHeaders: []string{""}, Steps: []types.PipelineStep{{Name: "a", Function: "a"}}},
+	}
+	for name, p := range invalid {
+		if err := Validate(p); err == nil {
+			t.Fatalf("%s: expected validation error", name)
+		}
+	}
+
+	if functions := Functions(valid); !reflect.DeepEqual(functions, []string{"fetch", "resize", "classify", "store"}) {
+		t.Fatalf("unexpected functions: %v", functions)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history := NewHistory(2)
+	for _, id := range []string{"1", "2", "3"} {
+		history.add(&runState{run: types.PipelineRun{ID: id, Pipeline: "p"}})
+	}
+	history.add(&runState{run: types.PipelineRun{ID: "4", Pipeline: "other"}})
+
+	runs := history.List("p")
+	if len(runs) != 1 || runs[0].ID != "3" {
+		t.Fatalf("expected only the newest run within the limit, got %+v", runs)
+	}
+	if _, ok := history.Get("p", "1"); ok {
+		t.Fatal("expected the oldest run to be evicted")
+	}
+	if _, ok := history.Get("other", "3"); ok {
+		t.Fatal("expected runs to be looked up per pipeline")
+	}
+
+	history.Forget("p")
+	if runs := history.List("p"); len(runs) != 0 {
+		t.Fatalf("expected runs of a forgotten pipeline to be dropped, got %+v", runs)
+	}
+	if _, ok := history.Get("other", "4"); !ok {
+		t.Fatal("expected runs of other pipelines to be kept")
+	}
+}
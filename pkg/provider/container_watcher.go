@@ -0,0 +1,410 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/errdefs"
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// defaultEventHistory is how many events are kept per function
+	defaultEventHistory = 100
+	// watcherMinBackoff and watcherMaxBackoff bound reconnect delays
+	watcherMinBackoff = time.Second
+	watcherMaxBackoff = 30 * time.Second
+)
+
+// containerEventsAPI is the subset of the Docker client the watcher uses
+type containerEventsAPI interface {
+	Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error)
+	ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error)
+	ContainerInspect(ctx context.Context, containerID string) (container.InspectResponse, error)
+}
+
+// ContainerWatcher keeps the state of function containers current by
+// subscribing to the Docker events stream, so lookups do not need to call the
+// Docker API. Lifecycle events are recorded per function.
+type ContainerWatcher struct {
+	api     containerEventsAPI
+	network string
+	history int
+	backoff time.Duration // initial reconnect delay
+	crashes *crashTracker // fed with die and start events when set
+	logger  *logrus.Logger
+
+	mu         sync.RWMutex
+	synced     bool
+	containers map[string]*watchedContainer // by container ID
+	events     map[string][]faasTypes.FunctionEvent
+}
+
+type watchedContainer struct {
+	function  string
+	container *faasTypes.Container
+}
+
+// newContainerWatcher creates a watcher; Run must be called to start it
+func newContainerWatcher(api containerEventsAPI, network string, history int, logger *logrus.Logger) *ContainerWatcher {
+	if history <= 0 {
+		history = defaultEventHistory
+	}
+	return &ContainerWatcher{
+		api:        api,
+		network:    network,
+		history:    history,
+		backoff:    watcherMinBackoff,
+		logger:     logger,
+		containers: make(map[string]*watchedContainer),
+		events:     make(map[string][]faasTypes.FunctionEvent),
+	}
+}
+
+// Run follows the events stream until ctx is cancelled. The cache is rebuilt
+// from a container listing after every (re)subscription, so events missed
+// while disconnected are not lost.
+func (w *ContainerWatcher) Run(ctx context.Context) {
+	backoff := w.backoff
+	for {
+		err := w.follow(ctx)
+		if w.Synced() {
+			// The stream was healthy, so start over with a short delay
+			backoff = w.backoff
+		}
+		w.setSynced(false)
+		if ctx.Err() != nil {
+			return
+		}
+		w.logger.Warnf("Container event stream interrupted, reconnecting in %s: %v", backoff, err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > watcherMaxBackoff {
+			backoff = watcherMaxBackoff
+		}
+	}
+}
+
+// follow subscribes, resyncs and applies events until the stream fails
+func (w *ContainerWatcher) follow(ctx context.Context) error {
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Subscribe before listing so no change between the two is missed
+	messages, errs := w.api.Events(streamCtx, events.ListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("type", string(events.ContainerEventType)),
+			filters.Arg("label", LabelFunction),
+		),
+	})
+	if err := w.resync(streamCtx); err != nil {
+		return err
+	}
+	w.logger.Debug("Container watcher synchronized")
+
+	for {
+		select {
+		case msg, ok := <-messages:
+			if !ok {
+				return errors.New("event stream closed")
+			}
+			w.handle(streamCtx, msg)
+		case err := <-errs:
+			return err
+		}
+	}
+}
+
+// resync replaces the cache with the current function containers
+func (w *ContainerWatcher) resync(ctx context.Context) error {
+	summaries, err := w.api.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelFunction)),
+	})
+	if err != nil {
+		return err
+	}
+
+	containers := make(map[string]*watchedContainer, len(summaries))
+	for _, summary := range summaries {
+		watched, err := w.inspect(ctx, summary.ID)
+		if err != nil {
+			if errdefs.IsNotFound(err) {
+				continue
+			}
+			return err
+		}
+		containers[summary.ID] = watched
+	}
+
+	w.mu.Lock()
+	w.containers = containers
+	w.synced = true
+	for functionName := range w.events {
+		w.pruneEvents(functionName)
+	}
+	w.mu.Unlock()
+
+	if w.crashes != nil {
+		ids := make(map[string]bool, len(containers))
+		for id := range containers {
+			ids[id] = true
+		}
+		w.crashes.retain(ids)
+	}
+	return nil
+}
+
+// SyncFunction refreshes the cached containers of one function from the
+// Docker API, so changes made by the gateway are visible immediately
+func (w *ContainerWatcher) SyncFunction(ctx context.Context, functionName string) {
+	summaries, err := w.api.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelFunction+"="+functionName)),
+	})
+	if err != nil {
+		w.logger.Debugf("Failed to refresh containers for %s: %v", functionName, err)
+		return
+	}
+
+	fresh := make(map[string]*watchedContainer, len(summaries))
+	for _, summary := range summaries {
+		if watched, err := w.inspect(ctx, summary.ID); err == nil {
+			fresh[summary.ID] = watched
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for id, watched := range w.containers {
+		if watched.function == functionName {
+			delete(w.containers, id)
+		}
+	}
+	for id, watched := range fresh {
+		w.containers[id] = watched
+	}
+	w.pruneEvents(functionName)
+}
+
+func (w *ContainerWatcher) inspect(ctx context.Context, id string) (*watchedContainer, error) {
+	info, err := w.api.ContainerInspect(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	functionName := ""
+	if info.Config != nil {
+		functionName = info.Config.Labels[LabelFunction]
+	}
+	return &watchedContainer{function: functionName, container: containerFromInspect(info, w.network)}, nil
+}
+
+// handle applies one container event to the cache and the event history
+func (w *ContainerWatcher) handle(ctx context.Context, msg events.Message) {
+	if msg.Type != events.ContainerEventType {
+		return
+	}
+	id := msg.Actor.ID
+	functionName := msg.Actor.Attributes[LabelFunction]
+	if functionName == "" {
+		return
+	}
+
+	action := string(msg.Action)
+	if health, ok := strings.CutPrefix(action, string(events.ActionHealthStatus)+": "); ok {
+		w.record(functionName, msg, string(events.ActionHealthStatus), health)
+	} else {
+		switch msg.Action {
+		case events.ActionDie, events.ActionOOM, events.ActionRestart:
+			w.record(functionName, msg, action, "")
+		}
+	}
+
+	w.trackCrashes(functionName, msg)
+
+	switch msg.Action {
+	case events.ActionDestroy:
+		w.mu.Lock()
+		delete(w.containers, id)
+		w.pruneEvents(functionName)
+		w.mu.Unlock()
+	case events.ActionCreate, events.ActionStart, events.ActionRestart, events.ActionDie,
+		events.ActionStop, events.ActionKill, events.ActionOOM, events.ActionPause,
+		events.ActionUnPause, events.ActionRename, events.ActionConnect, events.ActionDisconnect:
+		w.refresh(ctx, id)
+	default:
+		if strings.HasPrefix(action, string(events.ActionHealthStatus)) {
+			w.refresh(ctx, id)
+		}
+	}
+}
+
+// refresh re-inspects a single container, dropping it once it is gone
+func (w *ContainerWatcher) refresh(ctx context.Context, id string) {
+	watched, err := w.inspect(ctx, id)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			if watched, ok := w.containers[id]; ok {
+				delete(w.containers, id)
+				w.pruneEvents(watched.function)
+			}
+		} else {
+			w.logger.Debugf("Failed to inspect container %s: %v", id, err)
+		}
+		return
+	}
+	w.containers[id] = watched
+}
+
+// trackCrashes feeds the crash tracker with the restarts of a replica
+func (w *ContainerWatcher) trackCrashes(functionName string, msg events.Message) {
+	if w.crashes == nil {
+		return
+	}
+	id, name := msg.Actor.ID, msg.Actor.Attributes["name"]
+	switch msg.Action {
+	case events.ActionOOM:
+		w.crashes.oomKilled(functionName, id, name)
+	case events.ActionDie:
+		w.crashes.died(functionName, id, name, eventExitCode(msg))
+	case events.ActionStart:
+		w.crashes.started(functionName, id, name, eventTime(msg))
+	case events.ActionDestroy:
+		w.crashes.forget(id)
+	}
+}
+
+func (w *ContainerWatcher) record(functionName string, msg events.Message, action, health string) {
+	event := faasTypes.FunctionEvent{
+		Time:      eventTime(msg),
+		Action:    action,
+		Container: msg.Actor.Attributes["name"],
+		Health:    health,
+	}
+	if msg.Action == events.ActionDie {
+		event.ExitCode = eventExitCode(msg)
+	}
+	metrics.RecordFunctionContainerEvent(functionName, action)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	history := append(w.events[functionName], event)
+	if over := len(history) - w.history; over > 0 {
+		history = append([]faasTypes.FunctionEvent(nil), history[over:]...)
+	}
+	w.events[functionName] = history
+}
+
+func eventTime(msg events.Message) time.Time {
+	if msg.TimeNano == 0 {
+		return time.Unix(msg.Time, 0)
+	}
+	return time.Unix(0, msg.TimeNano)
+}
+
+// eventExitCode returns the exit code carried by a die event
+func eventExitCode(msg events.Message) *int {
+	code, err := strconv.Atoi(msg.Actor.Attributes["exitCode"])
+	if err != nil {
+		return nil
+	}
+	return &code
+}
+
+func (w *ContainerWatcher) setSynced(synced bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.synced = synced
+}
+
+// Synced reports whether the cache reflects the current container state
+func (w *ContainerWatcher) Synced() bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.synced
+}
+
+// FunctionContainers returns the cached containers of a function sorted by
+// name; ok is false while the cache is not synchronized
+func (w *ContainerWatcher) FunctionContainers(functionName string) (result []*faasTypes.Container, ok bool) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if !w.synced {
+		return nil, false
+	}
+
+	result = []*faasTypes.Container{}
+	for _, watched := range w.containers {
+		if watched.function == functionName {
+			copied := *watched.container
+			result = append(result, &copied)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, true
+}
+
+// pruneEvents drops the event history of a function once none of its
+// containers remain, so removed functions do not accumulate. Callers must
+// hold w.mu.
+func (w *ContainerWatcher) pruneEvents(functionName string) {
+	if _, ok := w.events[functionName]; !ok {
+		return
+	}
+	for _, watched := range w.containers {
+		if watched.function == functionName {
+			return
+		}
+	}
+	delete(w.events, functionName)
+}
+
+// FunctionEvents returns the recorded events of a function, oldest first
+func (w *ContainerWatcher) FunctionEvents(functionName string) []faasTypes.FunctionEvent {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return append([]faasTypes.FunctionEvent{}, w.events[functionName]...)
+}
+
+// EnableContainerWatcher serves container lookups from an event-driven cache.
+// The watcher runs until ctx is cancelled; until its first sync completes,
+// lookups fall back to the Docker API. Its events also feed crash loop detection.
+func (p *DockerProvider) EnableContainerWatcher(ctx context.Context, history int) *ContainerWatcher {
+	p.watcher = newContainerWatcher(p.client, p.network, history, p.logger)
+	p.watcher.crashes = p.crashes
+	go p.watcher.Run(ctx)
+	return p.watcher
+}
+
+// GetFunctionEvents returns the recent container events of a function
+func (p *DockerProvider) GetFunctionEvents(functionName string) []faasTypes.FunctionEvent {
+	if p.watcher == nil {
+		return nil
+	}
+	return p.watcher.FunctionEvents(functionName)
+}
+
+// syncWatcher refreshes the cached containers of a function after the
+// provider changed them, rather than waiting for the events to arrive
+func (p *DockerProvider) syncWatcher(ctx context.Context, functionName string) {
+	if p.watcher != nil && p.watcher.Synced() {
+		p.watcher.SyncFunction(ctx, functionName)
+	}
+}
@@ -0,0 +1,272 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/errdefs"
+	"github.com/sirupsen/logrus"
+)
+
+type fakeEventsAPI struct {
+	mu            sync.Mutex
+	containers    map[string]container.InspectResponse
+	subscriptions []chan events.Message
+	errs          []chan error
+}
+
+func newFakeEventsAPI() *fakeEventsAPI {
+	return &fakeEventsAPI{containers: make(map[string]container.InspectResponse)}
+}
+
+func (f *fakeEventsAPI) put(id, functionName, status, health string) {
+	info := container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:      id,
+			Name:    "/" + id,
+			Created: time.Now().Format(time.RFC3339Nano),
+			State:   &container.State{Status: container.ContainerState(status), Running: status == "running"},
+		},
+		Config: &container.Config{Labels: map[string]string{LabelFunction: functionName}},
+	}
+	if health != "" {
+		info.State.Health = &container.Health{Status: container.HealthStatus(health)}
+	}
+	f.mu.Lock()
+	f.containers[id] = info
+	f.mu.Unlock()
+}
+
+func (f *fakeEventsAPI) remove(id string) {
+	f.mu.Lock()
+	delete(f.containers, id)
+	f.mu.Unlock()
+}
+
+func (f *fakeEventsAPI) Events(ctx context.Context, options events.ListOptions) (<-chan events.Message, <-chan error) {
+	messages := make(chan events.Message)
+	errs := make(chan error, 1)
+	f.mu.Lock()
+	f.subscriptions = append(f.subscriptions, messages)
+	f.errs = append(f.errs, errs)
+	f.mu.Unlock()
+	return messages, errs
+}
+
+func (f *fakeEventsAPI) ContainerList(ctx context.Context, options container.ListOptions) ([]container.Summary, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	result := make([]container.Summary, 0, len(f.containers))
+	for id, info := range f.containers {
+		for _, label := range options.Filters.Get("label") {
+			if label == LabelFunction || label == LabelFunction+"="+info.Config.Labels[LabelFunction] {
+				result = append(result, container.Summary{ID: id})
+			}
+		}
+	}
+	return result, nil
+}
+
+func (f *fakeEventsAPI) ContainerInspect(ctx context.Context, id string) (container.InspectResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	info, ok := f.containers[id]
+	if !ok {
+		return container.InspectResponse{}, errdefs.NotFound(errors.New("no such container"))
+	}
+	return info, nil
+}
+
+func (f *fakeEventsAPI) subscription(t *testing.T, n int) (chan events.Message, chan error) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		f.mu.Lock()
+		if len(f.subscriptions) >= n {
+			messages, errs := f.subscriptions[n-1], f.errs[n-1]
+			f.mu.Unlock()
+			return messages, errs
+		}
+		f.mu.Unlock()
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("expected %d event subscriptions", n)
+	return nil, nil
+}
+
+func containerEvent(id, functionName string, action events.Action, attributes map[string]string) events.Message {
+	attrs := map[string]string{LabelFunction: functionName, "name": id}
+	for k, v := range attributes {
+		attrs[k] = v
+	}
+	return events.Message{
+		Type:     events.ContainerEventType,
+		Action:   action,
+		Actor:    events.Actor{ID: id, Attributes: attrs},
+		TimeNano: time.Now().UnixNano(),
+	}
+}
+
+func waitSynced(t *testing.T, w *ContainerWatcher) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !w.Synced() {
+		if time.Now().After(deadline) {
+			t.Fatalf("watcher did not synchronize")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func quietLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestContainerWatcher_AppliesEvents(t *testing.T) {
+	api := newFakeEventsAPI()
+	api.put("echo-0", "echo", "running", "")
+	api.put("other-0", "other", "running", "")
+
+	w := newContainerWatcher(api, "faas-net", 2, quietLogger())
+	if _, ok := w.FunctionContainers("echo"); ok {
+		t.Fatalf("expected no cached state before the first sync")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	messages, _ := api.subscription(t, 1)
+	waitSynced(t, w)
+
+	containers, _ := w.FunctionContainers("echo")
+	if len(containers) != 1 || containers[0].Name != "echo-0" || containers[0].Status != "running" {
+		t.Fatalf("unexpected initial containers: %+v", containers)
+	}
+
+	api.put("echo-1", "echo", "running", "starting")
+	messages <- containerEvent("echo-1", "echo", events.ActionStart, nil)
+	api.put("echo-0", "echo", "exited", "")
+	messages <- containerEvent("echo-0", "echo", events.ActionOOM, nil)
+	messages <- containerEvent("echo-0", "echo", events.ActionDie, map[string]string{"exitCode": "137"})
+	api.put("echo-1", "echo", "running", "healthy")
+	messages <- containerEvent("echo-1", "echo", events.ActionHealthStatus+": healthy", nil)
+	// The channel is unbuffered, so the repeated destroy is only received
+	// once every earlier event has been handled
+	api.remove("other-0")
+	messages <- containerEvent("other-0", "other", events.ActionDestroy, nil)
+	messages <- containerEvent("other-0", "other", events.ActionDestroy, nil)
+
+	containers, _ = w.FunctionContainers("echo")
+	if len(containers) != 2 || containers[0].Status != "exited" || containers[1].Health != "healthy" {
+		t.Fatalf("unexpected containers after events: %+v", containers)
+	}
+	if others, _ := w.FunctionContainers("other"); len(others) != 0 {
+		t.Fatalf("expected destroyed container to be dropped, got %+v", others)
+	}
+
+	// History is bounded, so the oom event is discarded
+	history := w.FunctionEvents("echo")
+	if len(history) != 2 {
+		t.Fatalf("expected 2 events, got %+v", history)
+	}
+	if history[0].Action != "die" || history[0].ExitCode == nil || *history[0].ExitCode != 137 || history[0].Container != "echo-0" {
+		t.Fatalf("unexpected die event: %+v", history[0])
+	}
+	if history[1].Action != "health_status" || history[1].Health != "healthy" {
+		t.Fatalf("unexpected health event: %+v", history[1])
+	}
+}
+
+func TestContainerWatcher_PrunesEventsOfRemovedFunctions(t *testing.T) {
+	api := newFakeEventsAPI()
+	api.put("echo-0", "echo", "running", "")
+	api.put("echo-1", "echo", "running", "")
+
+	w := newContainerWatcher(api, "faas-net", 0, quietLogger())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	messages, _ := api.subscription(t, 1)
+	waitSynced(t, w)
+
+	for _, id := range []string{"echo-0", "echo-1"} {
+		api.put(id, "echo", "exited", "")
+		messages <- containerEvent(id, "echo", events.ActionDie, map[string]string{"exitCode": "0"})
+	}
+
+	// History is kept while a replica of the function remains
+	api.remove("echo-0")
+	messages <- containerEvent("echo-0", "echo", events.ActionDestroy, nil)
+	messages <- containerEvent("echo-0", "echo", events.ActionDestroy, nil)
+	if history := w.FunctionEvents("echo"); len(history) != 2 {
+		t.Fatalf("expected the history kept for the remaining replica, got %+v", history)
+	}
+
+	api.remove("echo-1")
+	messages <- containerEvent("echo-1", "echo", events.ActionDestroy, nil)
+	messages <- containerEvent("echo-1", "echo", events.ActionDestroy, nil)
+	w.mu.RLock()
+	_, kept := w.events["echo"]
+	w.mu.RUnlock()
+	if kept {
+		t.Fatalf("expected the history of a function without containers to be dropped")
+	}
+}
+
+func TestContainerWatcher_ResyncsAfterStreamError(t *testing.T) {
+	api := newFakeEventsAPI()
+	api.put("echo-0", "echo", "running", "")
+
+	w := newContainerWatcher(api, "faas-net", 0, quietLogger())
+	w.backoff = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	_, errs := api.subscription(t, 1)
+	waitSynced(t, w)
+
+	// Changes made while disconnected are picked up by the resync
+	api.remove("echo-0")
+	api.put("echo-1", "echo", "running", "")
+	errs <- errors.New("connection reset")
+
+	api.subscription(t, 2)
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		containers, ok := w.FunctionContainers("echo")
+		if ok && len(containers) == 1 && containers[0].Name == "echo-1" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected cache to be rebuilt after reconnecting, got %+v", containers)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestContainerWatcher_SyncFunction(t *testing.T) {
+	api := newFakeEventsAPI()
+	api.put("echo-0", "echo", "running", "")
+	w := newContainerWatcher(api, "faas-net", 0, quietLogger())
+	if err := w.resync(context.Background()); err != nil {
+		t.Fatalf("resync: %v", err)
+	}
+
+	api.remove("echo-0")
+	api.put("echo-1", "echo", "created", "")
+	w.SyncFunction(context.Background(), "echo")
+
+	containers, _ := w.FunctionContainers("echo")
+	if len(containers) != 1 || containers[0].Name != "echo-1" || containers[0].Status != "created" {
+		t.Fatalf("unexpected containers after sync: %+v", containers)
+	}
+}
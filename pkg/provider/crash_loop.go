@@ -0,0 +1,308 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// StatusCrashLoopBackoff is reported as the status of a crash-looping replica
+// while it is kept out of routing
+const StatusCrashLoopBackoff = "crash-loop-backoff"
+
+// CrashLoopPolicy decides when restarting replicas are crash looping and how
+// long they are kept out of routing
+type CrashLoopPolicy struct {
+	Threshold  int           // restarts within Window that mark a crash loop; 0 disables detection
+	Window     time.Duration // how long restarts are remembered
+	Backoff    time.Duration // first routing backoff, doubled on every further restart
+	MaxBackoff time.Duration
+	LogLines   int // log lines reported for a degraded function
+}
+
+// DefaultCrashLoopPolicy returns the crash loop policy used when none is set
+func DefaultCrashLoopPolicy() CrashLoopPolicy {
+	return CrashLoopPolicy{
+		Threshold:  3,
+		Window:     5 * time.Minute,
+		Backoff:    10 * time.Second,
+		MaxBackoff: 5 * time.Minute,
+		LogLines:   20,
+	}
+}
+
+// replicaRestarts is the restart history of one container
+type replicaRestarts struct {
+	function     string
+	name         string
+	exited       bool // died and not started since
+	restarts     []time.Time
+	exitCode     *int
+	oom          bool // an oom event preceded the pending exit
+	oomKilled    bool
+	backoffs     int
+	backoffUntil time.Time
+}
+
+// crashTracker follows the restarts of function replicas. It is fed by the
+// container watcher's die and start events; a start after a die is a restart.
+type crashTracker struct {
+	mu       sync.Mutex
+	policy   CrashLoopPolicy
+	replicas map[string]*replicaRestarts // by container ID
+}
+
+func newCrashTracker(policy CrashLoopPolicy) *crashTracker {
+	return &crashTracker{policy: policy, replicas: make(map[string]*replicaRestarts)}
+}
+
+func (t *crashTracker) setPolicy(policy CrashLoopPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.policy = policy
+}
+
+func (t *crashTracker) currentPolicy() CrashLoopPolicy {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.policy
+}
+
+// replica returns the history of a container, creating it when detection is
+// enabled; callers hold t.mu
+func (t *crashTracker) replica(functionName, id, name string) *replicaRestarts {
+	if t.policy.Threshold <= 0 {
+		return nil
+	}
+	r, ok := t.replicas[id]
+	if !ok {
+		r = &replicaRestarts{function: functionName}
+		t.replicas[id] = r
+	}
+	if name != "" {
+		r.name = name
+	}
+	return r
+}
+
+// oomKilled records an oom event, which Docker sends before the die event
+func (t *crashTracker) oomKilled(functionName, id, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if r := t.replica(functionName, id, name); r != nil {
+		r.oom = true
+	}
+}
+
+// died records the exit of a replica
+func (t *crashTracker) died(functionName, id, name string, exitCode *int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.replica(functionName, id, name)
+	if r == nil {
+		return
+	}
+	r.exited = true
+	if exitCode != nil && (*exitCode != 0 || r.oom) {
+		code := *exitCode
+		r.exitCode = &code
+		r.oomKilled = r.oom
+	}
+	r.oom = false
+}
+
+// started records a replica starting. Starting again after an exit counts as
+// a restart at the time of the event; once Threshold restarts fall within
+// Window the replica is crash looping and each restart backs it off.
+func (t *crashTracker) started(functionName, id, name string, at time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r := t.replica(functionName, id, name)
+	if r == nil || !r.exited {
+		return
+	}
+	r.exited = false
+	r.restarts = append(r.restarts, at)
+
+	cutoff := at.Add(-t.policy.Window)
+	for len(r.restarts) > 0 && r.restarts[0].Before(cutoff) {
+		r.restarts = r.restarts[1:]
+	}
+	if len(r.restarts) < t.policy.Threshold {
+		r.backoffs = 0
+		r.backoffUntil = time.Time{}
+		return
+	}
+	if r.backoffs == 0 {
+		metrics.RecordFunctionCrashLoop(functionName)
+	}
+	r.backoffs++
+	r.backoffUntil = at.Add(crashLoopBackoff(t.policy, r.backoffs))
+}
+
+// forget drops the history of a removed container
+func (t *crashTracker) forget(id string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.replicas, id)
+}
+
+// retain drops the history of containers not in ids, whose destroy events
+// may have been missed while the event stream was down
+func (t *crashTracker) retain(ids map[string]bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for id := range t.replicas {
+		if !ids[id] {
+			delete(t.replicas, id)
+		}
+	}
+}
+
+// annotate marks a function's crash-looping replicas. Replicas in backoff
+// get StatusCrashLoopBackoff so they are not routed to.
+func (t *crashTracker) annotate(containers []*faasTypes.Container, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.policy.Threshold <= 0 {
+		return
+	}
+
+	cutoff := now.Add(-t.policy.Window)
+	for _, c := range containers {
+		r, ok := t.replicas[c.ID]
+		if !ok || countSince(r.restarts, cutoff) < t.policy.Threshold {
+			continue
+		}
+		c.CrashLoop = true
+		if now.Before(r.backoffUntil) {
+			until := r.backoffUntil
+			c.BackoffUntil = &until
+			c.Status = StatusCrashLoopBackoff
+		}
+	}
+}
+
+// countSince counts the times not before cutoff
+func countSince(times []time.Time, cutoff time.Time) int {
+	count := 0
+	for _, at := range times {
+		if !at.Before(cutoff) {
+			count++
+		}
+	}
+	return count
+}
+
+// crashLoopBackoff is the routing backoff after the given number of crash-loop
+// restarts: Backoff doubled per restart, capped at MaxBackoff
+func crashLoopBackoff(policy CrashLoopPolicy, backoffs int) time.Duration {
+	backoff := policy.Backoff
+	for i := 1; i < backoffs && backoff < policy.MaxBackoff; i++ {
+		backoff *= 2
+	}
+	if policy.MaxBackoff > 0 && backoff > policy.MaxBackoff {
+		backoff = policy.MaxBackoff
+	}
+	return backoff
+}
+
+// status summarizes the crash-looping replicas of a function, or returns nil
+// when there are none. The ID of the replica that restarted most recently is
+// returned alongside, so its logs can be read.
+func (t *crashTracker) status(functionName string, now time.Time) (*faasTypes.CrashLoopStatus, string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var status *faasTypes.CrashLoopStatus
+	latestID := ""
+	var latest time.Time
+	ids := make([]string, 0)
+	for id, r := range t.replicas {
+		if r.function == functionName {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+
+	cutoff := now.Add(-t.policy.Window)
+	for _, id := range ids {
+		r := t.replicas[id]
+		restarts := countSince(r.restarts, cutoff)
+		if restarts < t.policy.Threshold {
+			continue
+		}
+
+		if status == nil {
+			status = &faasTypes.CrashLoopStatus{Replicas: []string{}}
+		}
+		status.Replicas = append(status.Replicas, r.name)
+		status.Restarts += restarts
+		if last := r.restarts[len(r.restarts)-1]; latestID == "" || last.After(latest) {
+			latestID, latest = id, last
+			status.ExitCode = r.exitCode
+			status.OOMKilled = r.oomKilled
+		}
+		if now.Before(r.backoffUntil) && (status.BackoffUntil == nil || r.backoffUntil.After(*status.BackoffUntil)) {
+			until := r.backoffUntil
+			status.BackoffUntil = &until
+		}
+	}
+	if status != nil {
+		sort.Strings(status.Replicas)
+	}
+	return status, latestID
+}
+
+// SetCrashLoopPolicy configures crash loop detection
+func (p *DockerProvider) SetCrashLoopPolicy(policy CrashLoopPolicy) {
+	p.crashes.setPolicy(policy)
+}
+
+// CrashLoopStatus reports the function's crash-looping replicas with the last
+// exit code of the most recently restarted one, or nil when the function is
+// healthy. With includeLogs the log tail of that replica is read from Docker.
+// Restarts are only seen through the container watcher.
+func (p *DockerProvider) CrashLoopStatus(ctx context.Context, functionName string, includeLogs bool) *faasTypes.CrashLoopStatus {
+	status, containerID := p.crashes.status(functionName, time.Now())
+	if status == nil {
+		return nil
+	}
+
+	if lines := p.crashes.currentPolicy().LogLines; includeLogs && lines > 0 {
+		logTail, err := p.containerLogTail(ctx, containerID, lines)
+		if err != nil {
+			p.logger.Debugf("Failed to read logs of crash-looping replica of %s: %v", functionName, err)
+		}
+		status.LogTail = logTail
+	}
+	return status
+}
+
+// containerLogTail returns the last lines of a container's combined output
+func (p *DockerProvider) containerLogTail(ctx context.Context, containerID string, lines int) (string, error) {
+	reader, err := p.client.ContainerLogs(ctx, containerID, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Tail:       strconv.Itoa(lines),
+	})
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	var logs bytes.Buffer
+	if _, err := stdcopy.StdCopy(&logs, &logs, reader); err != nil {
+		return "", err
+	}
+	return logs.String(), nil
+}
@@ -0,0 +1,126 @@
+package provider
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/events"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// restartReplica records an exit of the replica followed by its restart
+func restartReplica(tracker *crashTracker, exitCode int, at time.Time) {
+	tracker.died("api", "c1", "api-0", &exitCode)
+	tracker.started("api", "c1", "api-0", at)
+}
+
+func annotateReplica(tracker *crashTracker, now time.Time) *faasTypes.Container {
+	c := &faasTypes.Container{ID: "c1", Name: "api-0", Status: "running"}
+	tracker.annotate([]*faasTypes.Container{c}, now)
+	return c
+}
+
+func TestCrashTracker_DetectsCrashLoopWithBackoff(t *testing.T) {
+	tracker := newCrashTracker(CrashLoopPolicy{Threshold: 3, Window: time.Minute, Backoff: 10 * time.Second, MaxBackoff: 30 * time.Second})
+	start := time.Now()
+
+	// The first start is not a restart
+	tracker.started("api", "c1", "api-0", start)
+	restartReplica(tracker, 1, start.Add(time.Second))
+	restartReplica(tracker, 1, start.Add(2*time.Second))
+	if c := annotateReplica(tracker, start.Add(2*time.Second)); c.CrashLoop || c.Status != "running" {
+		t.Fatalf("expected two restarts to stay below the threshold, got %+v", c)
+	}
+
+	restartReplica(tracker, 1, start.Add(3*time.Second))
+	c := annotateReplica(tracker, start.Add(3*time.Second))
+	if !c.CrashLoop || c.Status != StatusCrashLoopBackoff || c.BackoffUntil == nil || !c.BackoffUntil.Equal(start.Add(13*time.Second)) {
+		t.Fatalf("expected crash loop with a 10s backoff, got %+v", c)
+	}
+
+	// The backoff doubles on every further restart up to the maximum
+	restartReplica(tracker, 1, start.Add(4*time.Second))
+	if c := annotateReplica(tracker, start.Add(4*time.Second)); !c.BackoffUntil.Equal(start.Add(24 * time.Second)) {
+		t.Fatalf("expected a 20s backoff, got %v", c.BackoffUntil.Sub(start))
+	}
+	restartReplica(tracker, 1, start.Add(5*time.Second))
+	if c := annotateReplica(tracker, start.Add(5*time.Second)); !c.BackoffUntil.Equal(start.Add(35 * time.Second)) {
+		t.Fatalf("expected the backoff to be capped at 30s, got %v", c.BackoffUntil.Sub(start))
+	}
+
+	// Once the backoff expires the replica is routed to again, still flagged
+	c = annotateReplica(tracker, start.Add(40*time.Second))
+	if !c.CrashLoop || c.Status != "running" || c.BackoffUntil != nil {
+		t.Fatalf("expected replica to leave backoff, got %+v", c)
+	}
+
+	status, id := tracker.status("api", start.Add(40*time.Second))
+	if status == nil || id != "c1" || len(status.Replicas) != 1 || status.Replicas[0] != "api-0" || status.Restarts != 5 {
+		t.Fatalf("unexpected crash loop status: %+v (%s)", status, id)
+	}
+	if status.ExitCode == nil || *status.ExitCode != 1 {
+		t.Fatalf("expected the last non-zero exit code, got %v", status.ExitCode)
+	}
+
+	// Restarts age out of the window and the function recovers
+	if c := annotateReplica(tracker, start.Add(2*time.Minute)); c.CrashLoop {
+		t.Fatalf("expected crash loop to clear after the window, got %+v", c)
+	}
+	if status, _ := tracker.status("api", start.Add(2*time.Minute)); status != nil {
+		t.Fatalf("expected no crash loop status, got %+v", status)
+	}
+}
+
+func TestCrashTracker_ForgetsRemovedReplicas(t *testing.T) {
+	tracker := newCrashTracker(DefaultCrashLoopPolicy())
+	now := time.Now()
+	restartReplica(tracker, 1, now)
+	tracker.started("other", "c2", "other-0", now)
+	tracker.started("gone", "c3", "gone-0", now)
+
+	tracker.forget("c1")
+	tracker.retain(map[string]bool{"c1": true, "c2": true})
+	if len(tracker.replicas) != 1 || tracker.replicas["c2"] == nil {
+		t.Fatalf("expected only c2 to be kept, got %v", tracker.replicas)
+	}
+}
+
+func TestContainerWatcher_FeedsCrashTracker(t *testing.T) {
+	api := newFakeEventsAPI()
+	api.put("echo-0", "echo", "running", "")
+
+	w := newContainerWatcher(api, "faas-net", 0, quietLogger())
+	w.crashes = newCrashTracker(CrashLoopPolicy{Threshold: 2, Window: time.Minute, Backoff: time.Minute, MaxBackoff: time.Minute})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx)
+	messages, _ := api.subscription(t, 1)
+	waitSynced(t, w)
+
+	messages <- containerEvent("echo-0", "echo", events.ActionStart, nil)
+	for i := 0; i < 2; i++ {
+		messages <- containerEvent("echo-0", "echo", events.ActionOOM, nil)
+		messages <- containerEvent("echo-0", "echo", events.ActionDie, map[string]string{"exitCode": "137"})
+		messages <- containerEvent("echo-0", "echo", events.ActionStart, nil)
+	}
+	// Stopping the replica is not a restart; the channel is unbuffered, so
+	// the repeated event is only received once the first has been handled
+	messages <- containerEvent("echo-0", "echo", events.ActionDie, map[string]string{"exitCode": "0"})
+	messages <- containerEvent("echo-0", "echo", events.ActionDie, map[string]string{"exitCode": "0"})
+
+	status, id := w.crashes.status("echo", time.Now())
+	if status == nil || id != "echo-0" || status.Restarts != 2 || status.BackoffUntil == nil {
+		t.Fatalf("expected two restarts to mark a crash loop, got %+v (%s)", status, id)
+	}
+	if status.ExitCode == nil || *status.ExitCode != 137 || !status.OOMKilled {
+		t.Fatalf("expected the oom kill to be reported, got %+v", status)
+	}
+
+	messages <- containerEvent("echo-0", "echo", events.ActionDestroy, nil)
+	messages <- containerEvent("echo-0", "echo", events.ActionDestroy, nil)
+	if status, _ := w.crashes.status("echo", time.Now()); status != nil {
+		t.Fatalf("expected a destroyed replica to be forgotten, got %+v", status)
+	}
+}
@@ -3,7 +3,6 @@ package provider
 import (
 	"context"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
 	"sort"
@@ -13,7 +12,6 @@ import (
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
@@ -40,6 +38,8 @@ const (
 	LabelNetworkType = "com.docker-faas.network.type"
 	// LabelNetworkFunction is the label key for function-specific networks
 	LabelNetworkFunction = "com.docker-faas.network.function"
+	// LabelConfigHash is the label key for the fingerprint of a container's deployment
+	LabelConfigHash = "com.docker-faas.config-hash"
 )
 
 // DockerProvider manages Docker containers for functions
@@ -51,6 +51,15 @@ type DockerProvider struct {
 	gatewayID        string
 	connectGateway   bool
 	debugBindAddress string
+	securityPolicy   *SecurityPolicy
+	networkDriver    string
+	registryAuth     RegistryAuth
+	pulls            *pullTracker
+	watcher          *ContainerWatcher
+	activity         *functionActivity
+	crashes          *crashTracker
+	drainer          Drainer
+	drainGrace       time.Duration
 }
 
 type replicaScalePlan struct {
@@ -61,6 +70,11 @@ type replicaScalePlan struct {
 
 // NewDockerProvider creates a new Docker provider
 func NewDockerProvider(dockerHost, networkName, debugBindAddress string, logger *logrus.Logger) (*DockerProvider, error) {
+	return newDockerProvider(dockerHost, networkName, debugBindAddress, "bridge", logger)
+}
+
+// newDockerProvider creates a Docker provider whose networks use the given driver
+func newDockerProvider(dockerHost, networkName, debugBindAddress, networkDriver string, logger *logrus.Logger) (*DockerProvider, error) {
 	var cli *client.Client
 	var err error
 
@@ -101,6 +115,12 @@ func NewDockerProvider(dockerHost, networkName, debugBindAddress string, logger
 		gatewayID:        gatewayID,
 		connectGateway:   connectGateway,
 		debugBindAddress: debugBindAddress,
+		securityPolicy:   DefaultSecurityPolicy(),
+		networkDriver:    networkDriver,
+		pulls:            newPullTracker(),
+		activity:         newFunctionActivity(),
+		crashes:          newCrashTracker(DefaultCrashLoopPolicy()),
+		drainGrace:       DefaultDrainGracePeriod,
 	}
 
 	// Ensure network exists
@@ -143,8 +163,10 @@ func (p *DockerProvider) ensureNetwork(ctx context.Context, networkName string,
 
 		p.logger.Infof("Creating network: %s", networkName)
 		_, err = p.client.NetworkCreate(ctx, networkName, network.CreateOptions{
-			Driver: "bridge",
-			Labels: networkLabels,
+			Driver: p.networkDriver,
+			// Overlay networks must be attachable for the gateway container to join
+			Attachable: p.networkDriver == "overlay",
+			Labels:     networkLabels,
 		})
 		if err != nil {
 			return fmt.Errorf("failed to create network: %w", err)
@@ -178,10 +200,10 @@ func (p *DockerProvider) CheckNetwork(ctx context.Context) error {
 // DeployFunction deploys a function with specified replicas
 func (p *DockerProvider) DeployFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) error {
 	p.logger.Infof("Deploying function: %s with %d replicas", deployment.Service, replicas)
+	defer p.activity.begin(deployment.Service)()
 
-	// Pull image
-	if err := p.pullImage(ctx, deployment.Image); err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+	if err := p.ensureImage(ctx, deployment); err != nil {
+		return err
 	}
 
 	// Create containers for each replica
@@ -192,30 +214,11 @@ func (p *DockerProvider) DeployFunction(ctx context.Context, deployment *faasTyp
 			return fmt.Errorf("failed to create container %s: %w", containerName, err)
 		}
 	}
+	p.syncWatcher(ctx, deployment.Service)
 
 	return nil
 }
 
-// pullImage pulls the Docker image
-func (p *DockerProvider) pullImage(ctx context.Context, imageStr string) error {
-	if p.imageExists(ctx, imageStr) {
-		p.logger.Infof("Using local image: %s", imageStr)
-		return nil
-	}
-
-	p.logger.Infof("Pulling image: %s", imageStr)
-
-	reader, err := p.client.ImagePull(ctx, imageStr, image.PullOptions{})
-	if err != nil {
-		return err
-	}
-	defer reader.Close()
-
-	// Consume the output to ensure the pull completes
-	_, err = io.Copy(io.Discard, reader)
-	return err
-}
-
 func (p *DockerProvider) imageExists(ctx context.Context, imageStr string) bool {
 	_, _, err := p.client.ImageInspectWithRaw(ctx, imageStr)
 	if err == nil {
@@ -228,40 +231,57 @@ func (p *DockerProvider) imageExists(ctx context.Context, imageStr string) bool
 	return false
 }
 
-func (p *DockerProvider) resolveSecretsHostPath(ctx context.Context) string {
-	basePath := p.secretManager.GetBasePath()
+// resolveHostPath maps a path inside the gateway container to the matching
+// host path so it can be bind-mounted into function containers.
+func (p *DockerProvider) resolveHostPath(ctx context.Context, path string) string {
 	if p.gatewayID == "" {
-		return basePath
+		return path
 	}
 
 	inspect, err := p.client.ContainerInspect(ctx, p.gatewayID)
 	if err != nil {
-		p.logger.Debugf("Failed to inspect gateway container for secrets mount: %v", err)
-		return basePath
+		p.logger.Debugf("Failed to inspect gateway container for mount of %s: %v", path, err)
+		return path
 	}
 
 	for _, m := range inspect.Mounts {
-		if m.Destination != secrets.ContainerSecretsPath && m.Destination != basePath {
+		rel, ok := mountRelativePath(m.Destination, path)
+		if !ok {
 			continue
 		}
+		source := ""
 		if m.Type == "bind" && m.Source != "" {
-			return m.Source
-		}
-		if m.Type == "volume" && m.Name != "" {
+			source = m.Source
+		} else if m.Type == "volume" && m.Name != "" {
 			vol, err := p.client.VolumeInspect(ctx, m.Name)
 			if err == nil && vol.Mountpoint != "" {
-				return vol.Mountpoint
+				source = vol.Mountpoint
 			}
 			if err != nil {
 				p.logger.Debugf("Volume inspect failed for %s: %v", m.Name, err)
 			}
 		}
-		if m.Source != "" {
-			return m.Source
+		if source == "" {
+			source = m.Source
+		}
+		if source != "" {
+			return filepath.Join(source, rel)
 		}
 	}
 
-	return basePath
+	return path
+}
+
+// mountRelativePath returns path relative to a mount destination when it lies within it
+func mountRelativePath(destination, path string) (string, bool) {
+	if destination == "" {
+		return "", false
+	}
+	rel, err := filepath.Rel(filepath.Clean(destination), filepath.Clean(path))
+	if err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", false
+	}
+	return rel, true
 }
 
 // createContainer creates and starts a function container
@@ -292,6 +312,7 @@ func (p *DockerProvider) createContainer(ctx context.Context, deployment *faasTy
 	containerLabels[LabelType] = "function"
 	containerLabels[LabelReplica] = fmt.Sprintf("%d", replicaIndex)
 	containerLabels[LabelNetwork] = networkName
+	containerLabels[LabelConfigHash] = deploymentHash(deployment)
 
 	// Add custom labels
 	for k, v := range deployment.Labels {
@@ -314,6 +335,12 @@ func (p *DockerProvider) createContainer(ctx context.Context, deployment *faasTy
 		Env:    env,
 	}
 
+	stopSettings, err := ParseStopSettings(deployment.Annotations)
+	if err != nil {
+		return err
+	}
+	applyStopSettings(containerConfig, stopSettings)
+
 	if deployment.Debug {
 		containerConfig.ExposedPorts = nat.PortSet{
 			"40000/tcp": {},
@@ -346,14 +373,13 @@ func (p *DockerProvider) createContainer(ctx context.Context, deployment *faasTy
 		}
 	}
 
-	// Apply resource limits if specified
-	if deployment.Limits != nil {
-		if deployment.Limits.Memory != "" {
-			hostConfig.Resources.Memory = parseMemory(deployment.Limits.Memory)
-		}
-		if deployment.Limits.CPU != "" {
-			hostConfig.Resources.NanoCPUs = parseCPU(deployment.Limits.CPU)
-		}
+	// Apply resource limits and requests
+	if err := applyResources(hostConfig, deployment.Limits, deployment.Requests); err != nil {
+		return fmt.Errorf("invalid resources: %w", err)
+	}
+
+	if err := p.securityPolicy.apply(containerConfig, hostConfig, deployment.Security); err != nil {
+		return fmt.Errorf("invalid security profile: %w", err)
 	}
 
 	// Apply read-only root filesystem if specified
@@ -361,34 +387,40 @@ func (p *DockerProvider) createContainer(ctx context.Context, deployment *faasTy
 		hostConfig.ReadonlyRootfs = true
 	}
 
-	// Mount secrets if specified
-	if len(deployment.Secrets) > 0 {
-		created, err := p.secretManager.EnsureSecrets(deployment.Secrets)
-		if err != nil {
-			return fmt.Errorf("failed to ensure secrets: %w", err)
+	// Mount volumes, then secrets; both are appended so neither replaces the other
+	if len(deployment.Volumes) > 0 {
+		if err := p.securityPolicy.ValidateVolumes(deployment.Volumes, deployment.Security); err != nil {
+			return fmt.Errorf("invalid volumes: %w", err)
 		}
-		if len(created) > 0 {
-			p.logger.Warnf("Auto-created missing secrets for %s: %s", deployment.Service, strings.Join(created, ", "))
+		if err := checkVolumeOwnership(ctx, p.client, deployment.Service, deployment.Volumes); err != nil {
+			return err
+		}
+		mounts, err := volumeMounts(deployment.Service, deployment.Volumes)
+		if err != nil {
+			return fmt.Errorf("invalid volumes: %w", err)
 		}
+		hostConfig.Mounts = append(hostConfig.Mounts, mounts...)
+	}
 
-		// Validate secrets exist
-		if err := p.secretManager.ValidateSecrets(deployment.Secrets); err != nil {
-			return fmt.Errorf("secret validation failed: %w", err)
+	// Mount secrets if specified
+	if len(deployment.Secrets) > 0 {
+		if err := p.prepareSecrets(deployment); err != nil {
+			return err
 		}
 
-		// Create bind mounts for each secret
-		mounts := make([]mount.Mount, 0, len(deployment.Secrets))
-		hostSecretsPath := p.resolveSecretsHostPath(ctx)
-		for _, secretName := range deployment.Secrets {
-			secretPath := filepath.Join(hostSecretsPath, secretName)
-			mounts = append(mounts, mount.Mount{
-				Type:     mount.TypeBind,
-				Source:   secretPath,
-				Target:   fmt.Sprintf("%s/%s", secrets.ContainerSecretsPath, secretName),
-				ReadOnly: true,
-			})
+		// Materialize the function's secrets directory (decrypted when encryption is enabled)
+		secretsDir, err := p.secretManager.MaterializeFunctionSecrets(deployment.Service, deployment.Secrets)
+		if err != nil {
+			return fmt.Errorf("failed to materialize secrets: %w", err)
 		}
-		hostConfig.Mounts = mounts
+
+		// Mount the whole directory so atomic secret updates reach running replicas
+		hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   p.resolveHostPath(ctx, secretsDir),
+			Target:   secrets.ContainerSecretsPath,
+			ReadOnly: true,
+		})
 
 		p.logger.Infof("Mounting %d secrets for function %s", len(deployment.Secrets), deployment.Service)
 	}
@@ -418,8 +450,30 @@ func (p *DockerProvider) createContainer(ctx context.Context, deployment *faasTy
 	return nil
 }
 
+// prepareSecrets auto-creates missing secrets when enabled and checks that
+// every secret the function references exists
+func (p *DockerProvider) prepareSecrets(deployment *faasTypes.FunctionDeployment) error {
+	if p.secretManager.AutoCreateEnabled() {
+		created, err := p.secretManager.EnsureSecrets(deployment.Secrets)
+		if err != nil {
+			return fmt.Errorf("failed to ensure secrets: %w", err)
+		}
+		if len(created) > 0 {
+			p.logger.Warnf("Auto-created missing secrets for %s: %s", deployment.Service, strings.Join(created, ", "))
+		}
+	}
+
+	// Validate secrets exist
+	if err := p.secretManager.ValidateSecrets(deployment.Secrets); err != nil {
+		return fmt.Errorf("secret validation failed: %w", err)
+	}
+	return nil
+}
+
 // UpdateFunction updates a function deployment
 func (p *DockerProvider) UpdateFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) error {
+	defer p.activity.begin(deployment.Service)()
+
 	// For simplicity, we remove old containers and create new ones
 	if err := p.RemoveFunction(ctx, deployment.Service); err != nil {
 		p.logger.Warnf("Failed to remove old containers: %v", err)
@@ -431,26 +485,23 @@ func (p *DockerProvider) UpdateFunction(ctx context.Context, deployment *faasTyp
 // RemoveFunction removes all containers for a function
 func (p *DockerProvider) RemoveFunction(ctx context.Context, functionName string) error {
 	p.logger.Infof("Removing function: %s", functionName)
+	defer p.activity.begin(functionName)()
 
 	containers, err := p.listFunctionContainers(ctx, functionName)
 	if err != nil {
 		return fmt.Errorf("failed to list containers: %w", err)
 	}
 
-	for _, c := range containers {
-		// Stop container
-		timeout := int(10) // 10 seconds
-		if err := p.client.ContainerStop(ctx, c.ID, container.StopOptions{Timeout: &timeout}); err != nil {
-			p.logger.Warnf("Failed to stop container %s: %v", c.ID, err)
-		}
+	// Drain replicas before stopping them with their configured signal and timeout
+	if err := p.retireContainers(ctx, functionName, containers); err != nil {
+		p.logger.Warnf("Failed to remove containers of %s: %v", functionName, err)
+	}
 
-		// Remove container
-		if err := p.client.ContainerRemove(ctx, c.ID, container.RemoveOptions{Force: true}); err != nil {
-			p.logger.Warnf("Failed to remove container %s: %v", c.ID, err)
-		} else {
-			p.logger.Infof("Removed container: %s", c.ID[:12])
-		}
+	if err := p.secretManager.RemoveFunctionSecrets(functionName); err != nil {
+		p.logger.Warnf("Failed to remove materialized secrets for %s: %v", functionName, err)
 	}
+	p.pulls.forget(functionName)
+	p.syncWatcher(ctx, functionName)
 
 	return nil
 }
@@ -458,6 +509,7 @@ func (p *DockerProvider) RemoveFunction(ctx context.Context, functionName string
 // ScaleFunction scales a function to the specified replica count
 func (p *DockerProvider) ScaleFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, targetReplicas int) error {
 	p.logger.Infof("Scaling function %s to %d replicas", deployment.Service, targetReplicas)
+	defer p.activity.begin(deployment.Service)()
 
 	containers, err := p.listFunctionContainers(ctx, deployment.Service)
 	if err != nil {
@@ -474,11 +526,8 @@ func (p *DockerProvider) ScaleFunction(ctx context.Context, deployment *faasType
 		}
 	}
 
-	for _, existing := range plan.activeToRemove {
-		name := containerSummaryName(existing)
-		if err := p.removeContainerSummary(ctx, existing); err != nil {
-			return fmt.Errorf("failed to remove excess container %s: %w", name, err)
-		}
+	if err := p.retireContainers(ctx, deployment.Service, plan.activeToRemove); err != nil {
+		return fmt.Errorf("failed to remove excess replicas: %w", err)
 	}
 
 	for _, replicaIndex := range plan.missingReplicaIndices {
@@ -488,6 +537,13 @@ func (p *DockerProvider) ScaleFunction(ctx context.Context, deployment *faasType
 		}
 	}
 
+	if targetReplicas == 0 {
+		if err := p.secretManager.RemoveFunctionSecrets(deployment.Service); err != nil {
+			p.logger.Warnf("Failed to remove materialized secrets for %s: %v", deployment.Service, err)
+		}
+	}
+	p.syncWatcher(ctx, deployment.Service)
+
 	return nil
 }
 
@@ -528,6 +584,13 @@ func (p *DockerProvider) listFunctionContainers(ctx context.Context, functionNam
 
 // GetFunctionContainers retrieves container information for a function
 func (p *DockerProvider) GetFunctionContainers(ctx context.Context, functionName string) ([]*faasTypes.Container, error) {
+	if p.watcher != nil {
+		if cached, ok := p.watcher.FunctionContainers(functionName); ok {
+			p.crashes.annotate(cached, time.Now())
+			return cached, nil
+		}
+	}
+
 	containers, err := p.listFunctionContainers(ctx, functionName)
 	if err != nil {
 		return nil, err
@@ -541,45 +604,68 @@ func (p *DockerProvider) GetFunctionContainers(ctx context.Context, functionName
 			continue
 		}
 
-		ipAddress := ""
-		if info.NetworkSettings != nil {
-			networkName := p.network
-			if info.Config != nil && info.Config.Labels != nil {
-				if labelNetwork, ok := info.Config.Labels[LabelNetwork]; ok && labelNetwork != "" {
-					networkName = labelNetwork
-				}
+		fc := containerFromInspect(info, p.network)
+		fc.Name = strings.TrimPrefix(c.Names[0], "/")
+		fc.Status = c.Status
+		fc.Created = time.Unix(c.Created, 0)
+		result = append(result, fc)
+	}
+	p.crashes.annotate(result, time.Now())
+
+	return result, nil
+}
+
+// containerFromInspect describes a function container from its inspect data;
+// Status is the container state, e.g. running or exited
+func containerFromInspect(info container.InspectResponse, defaultNetwork string) *faasTypes.Container {
+	ipAddress := ""
+	if info.NetworkSettings != nil {
+		networkName := defaultNetwork
+		if info.Config != nil && info.Config.Labels != nil {
+			if labelNetwork, ok := info.Config.Labels[LabelNetwork]; ok && labelNetwork != "" {
+				networkName = labelNetwork
 			}
+		}
 
-			if ep, ok := info.NetworkSettings.Networks[networkName]; ok {
+		if ep, ok := info.NetworkSettings.Networks[networkName]; ok {
+			ipAddress = ep.IPAddress
+		} else {
+			for _, ep := range info.NetworkSettings.Networks {
 				ipAddress = ep.IPAddress
-			} else {
-				for _, ep := range info.NetworkSettings.Networks {
-					ipAddress = ep.IPAddress
-					break
-				}
+				break
 			}
 		}
+	}
 
-		ports := make(map[string]string)
-		if info.NetworkSettings != nil {
-			for port, bindings := range info.NetworkSettings.Ports {
-				if len(bindings) > 0 {
-					ports[string(port)] = bindings[0].HostPort
-				}
+	ports := make(map[string]string)
+	if info.NetworkSettings != nil {
+		for port, bindings := range info.NetworkSettings.Ports {
+			if len(bindings) > 0 {
+				ports[string(port)] = bindings[0].HostPort
 			}
 		}
-
-		result = append(result, &faasTypes.Container{
-			ID:        c.ID,
-			Name:      strings.TrimPrefix(c.Names[0], "/"),
-			IPAddress: ipAddress,
-			Status:    c.Status,
-			Ports:     ports,
-			Created:   time.Unix(c.Created, 0),
-		})
 	}
 
-	return result, nil
+	fc := &faasTypes.Container{
+		ID:        info.ID,
+		Name:      strings.TrimPrefix(info.Name, "/"),
+		IPAddress: ipAddress,
+		Ports:     ports,
+		Resources: containerResources(info.HostConfig),
+	}
+	if created, err := time.Parse(time.RFC3339Nano, info.Created); err == nil {
+		fc.Created = created
+	}
+	fc.RestartCount = info.RestartCount
+	if info.State != nil {
+		fc.ExitCode = info.State.ExitCode
+		fc.OOMKilled = info.State.OOMKilled
+		fc.Status = string(info.State.Status)
+		if info.State.Health != nil {
+			fc.Health = string(info.State.Health.Status)
+		}
+	}
+	return fc
 }
 
 func (p *DockerProvider) removeStaleContainerByName(ctx context.Context, name string) error {
@@ -612,8 +698,8 @@ func (p *DockerProvider) removeStaleContainerByName(ctx context.Context, name st
 
 func (p *DockerProvider) removeContainerSummary(ctx context.Context, summary container.Summary) error {
 	if isContainerRunningSummary(summary) {
-		timeout := int(10)
-		if err := p.client.ContainerStop(ctx, summary.ID, container.StopOptions{Timeout: &timeout}); err != nil && !errdefs.IsNotFound(err) && !isContainerNotFoundErr(err) {
+		// Docker uses the container's own stop signal and timeout
+		if err := p.client.ContainerStop(ctx, summary.ID, container.StopOptions{}); err != nil && !errdefs.IsNotFound(err) && !isContainerNotFoundErr(err) {
 			return fmt.Errorf("failed to stop container: %w", err)
 		}
 	}
@@ -625,38 +711,6 @@ func (p *DockerProvider) removeContainerSummary(ctx context.Context, summary con
 	return nil
 }
 
-// GetContainerLogs retrieves logs from a function container
-func (p *DockerProvider) GetContainerLogs(ctx context.Context, functionName string, tail int) (string, error) {
-	containers, err := p.listFunctionContainers(ctx, functionName)
-	if err != nil {
-		return "", err
-	}
-
-	if len(containers) == 0 {
-		return "", fmt.Errorf("no containers found for function: %s", functionName)
-	}
-
-	// Get logs from the first container
-	options := container.LogsOptions{
-		ShowStdout: true,
-		ShowStderr: true,
-		Tail:       fmt.Sprintf("%d", tail),
-	}
-
-	reader, err := p.client.ContainerLogs(ctx, containers[0].ID, options)
-	if err != nil {
-		return "", fmt.Errorf("failed to get container logs: %w", err)
-	}
-	defer reader.Close()
-
-	logs, err := io.ReadAll(reader)
-	if err != nil {
-		return "", fmt.Errorf("failed to read logs: %w", err)
-	}
-
-	return string(logs), nil
-}
-
 // Close closes the Docker client
 func (p *DockerProvider) Close() error {
 	return p.client.Close()
@@ -682,6 +736,14 @@ func (p *DockerProvider) GetSecretManager() *secrets.SecretManager {
 	return p.secretManager
 }
 
+// SetSecurityPolicy sets the policy applied to function security profiles
+func (p *DockerProvider) SetSecurityPolicy(policy *SecurityPolicy) {
+	if policy == nil {
+		policy = DefaultSecurityPolicy()
+	}
+	p.securityPolicy = policy
+}
+
 // CleanupFunctionNetwork removes a managed per-function network if unused.
 func (p *DockerProvider) CleanupFunctionNetwork(ctx context.Context, functionName, networkName string) error {
 	if networkName == "" {
@@ -989,68 +1051,14 @@ func isNetworkInUseErr(err error) bool {
 }
 
 func parseMemory(mem string) int64 {
-	// Parser for memory strings supporting both Docker and Kubernetes formats:
-	// Docker: "128m", "1g", "256k"
-	// Kubernetes: "128Mi", "1Gi", "256Ki"
-	mem = strings.TrimSpace(mem)
-	if mem == "" {
-		return 0
-	}
-
-	memLower := strings.ToLower(mem)
-	multiplier := int64(1)
-
-	// Check for Kubernetes binary units (Ki, Mi, Gi) - case insensitive
-	if strings.HasSuffix(memLower, "ki") {
-		multiplier = 1024
-		mem = mem[:len(mem)-2]
-	} else if strings.HasSuffix(memLower, "mi") {
-		multiplier = 1024 * 1024
-		mem = mem[:len(mem)-2]
-	} else if strings.HasSuffix(memLower, "gi") {
-		multiplier = 1024 * 1024 * 1024
-		mem = mem[:len(mem)-2]
-	} else if strings.HasSuffix(memLower, "k") {
-		// Docker format
-		multiplier = 1024
-		mem = mem[:len(mem)-1]
-	} else if strings.HasSuffix(memLower, "m") {
-		// Docker format
-		multiplier = 1024 * 1024
-		mem = mem[:len(mem)-1]
-	} else if strings.HasSuffix(memLower, "g") {
-		// Docker format
-		multiplier = 1024 * 1024 * 1024
-		mem = mem[:len(mem)-1]
-	}
-
-	var value int64
-	fmt.Sscanf(mem, "%d", &value)
-	return value * multiplier
+	// Supports both Docker ("128m", "1g") and Kubernetes ("128Mi", "1Gi") formats.
+	// Malformed values are rejected by ValidateResources before deploy.
+	value, _ := ParseMemoryQuantity(mem)
+	return value
 }
 
 func parseCPU(cpu string) int64 {
-	// Parser for CPU strings supporting both Docker and Kubernetes formats:
-	// Docker: "0.5", "1", "2" (CPU cores as decimal)
-	// Kubernetes: "500m", "1000m" (millicores)
-	cpu = strings.TrimSpace(cpu)
-	if cpu == "" {
-		return 0
-	}
-
-	cpuLower := strings.ToLower(cpu)
-
-	// Check for Kubernetes millicore format
-	if strings.HasSuffix(cpuLower, "m") {
-		cpu = cpu[:len(cpu)-1]
-		var millicores int64
-		fmt.Sscanf(cpu, "%d", &millicores)
-		// Convert millicores to nano CPUs (1 millicore = 0.001 CPU = 1,000,000 nano CPUs)
-		return millicores * 1e6
-	}
-
-	// Docker decimal format
-	var value float64
-	fmt.Sscanf(cpu, "%f", &value)
-	return int64(value * 1e9) // Convert to nano CPUs
+	// Supports both Docker cores ("0.5") and Kubernetes millicores ("500m").
+	value, _ := ParseCPUQuantity(cpu)
+	return value
 }
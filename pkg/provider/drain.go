@@ -0,0 +1,146 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+const (
+	// AnnotationDrainGracePeriod bounds how long a replica is drained of
+	// in-flight requests before it is stopped
+	AnnotationDrainGracePeriod = "com.docker-faas.drain.grace-period"
+	// AnnotationStopSignal is the signal sent to stop a function's containers
+	AnnotationStopSignal = "com.docker-faas.stop.signal"
+	// AnnotationStopTimeout is how long a stopped container may take to exit
+	// before it is killed
+	AnnotationStopTimeout = "com.docker-faas.stop.timeout"
+
+	// LabelDrainGracePeriod records a function's drain grace period on its containers
+	LabelDrainGracePeriod = "com.docker-faas.drain.grace-period"
+
+	// DefaultDrainGracePeriod is used for functions that do not set one
+	DefaultDrainGracePeriod = 30 * time.Second
+)
+
+var stopSignalPattern = regexp.MustCompile(`^([0-9]+|(SIG)?[A-Z][A-Z0-9+-]*)$`)
+
+// Drainer takes replicas out of routing and waits for their in-flight requests
+type Drainer interface {
+	Drain(ctx context.Context, functionName, containerID string, grace time.Duration) int
+	Undrain(containerID string)
+}
+
+// StopSettings is how a function's replicas are drained and stopped. Unset
+// durations are negative.
+type StopSettings struct {
+	GracePeriod time.Duration
+	Signal      string
+	Timeout     time.Duration
+}
+
+// ParseStopSettings reads the drain grace period, stop signal and stop
+// timeout annotations of a function
+func ParseStopSettings(annotations map[string]string) (StopSettings, error) {
+	settings := StopSettings{GracePeriod: -1, Timeout: -1}
+
+	if raw := strings.TrimSpace(annotations[AnnotationDrainGracePeriod]); raw != "" {
+		value, err := time.ParseDuration(raw)
+		if err != nil || value < 0 {
+			return settings, fmt.Errorf("invalid %s: %q", AnnotationDrainGracePeriod, raw)
+		}
+		settings.GracePeriod = value
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationStopSignal]); raw != "" {
+		if !stopSignalPattern.MatchString(raw) {
+			return settings, fmt.Errorf("invalid %s: %q", AnnotationStopSignal, raw)
+		}
+		settings.Signal = raw
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationStopTimeout]); raw != "" {
+		value, err := time.ParseDuration(raw)
+		if err != nil || value < 0 || value%time.Second != 0 {
+			return settings, fmt.Errorf("invalid %s: %q (whole seconds)", AnnotationStopTimeout, raw)
+		}
+		settings.Timeout = value
+	}
+
+	return settings, nil
+}
+
+// SetDrainer sets the router that drains replicas before they are stopped
+func (p *DockerProvider) SetDrainer(drainer Drainer) {
+	p.drainer = drainer
+}
+
+// SetDrainGracePeriod sets the drain grace period of functions that do not
+// set their own
+func (p *DockerProvider) SetDrainGracePeriod(grace time.Duration) {
+	p.drainGrace = grace
+}
+
+// applyStopSettings configures a container's stop signal and timeout and
+// records its drain grace period
+func applyStopSettings(config *container.Config, settings StopSettings) {
+	if settings.Signal != "" {
+		config.StopSignal = settings.Signal
+	}
+	if settings.Timeout >= 0 {
+		timeout := int(settings.Timeout / time.Second)
+		config.StopTimeout = &timeout
+	}
+	if settings.GracePeriod >= 0 {
+		config.Labels[LabelDrainGracePeriod] = settings.GracePeriod.String()
+	}
+}
+
+// drainGracePeriod returns the drain grace period recorded in a container's
+// or service's labels
+func (p *DockerProvider) drainGracePeriod(labels map[string]string) time.Duration {
+	if raw, ok := labels[LabelDrainGracePeriod]; ok {
+		if grace, err := time.ParseDuration(raw); err == nil && grace >= 0 {
+			return grace
+		}
+	}
+	return p.drainGrace
+}
+
+// retireContainers takes replicas out of routing, waits for their in-flight
+// requests up to each one's grace period, and then stops and removes them
+// with their configured stop signal and timeout
+func (p *DockerProvider) retireContainers(ctx context.Context, functionName string, summaries []container.Summary) error {
+	if p.drainer != nil {
+		var wg sync.WaitGroup
+		for _, summary := range summaries {
+			if !isContainerRunningSummary(summary) {
+				continue
+			}
+			wg.Add(1)
+			go func(summary container.Summary) {
+				defer wg.Done()
+				if remaining := p.drainer.Drain(ctx, functionName, summary.ID, p.drainGracePeriod(summary.Labels)); remaining > 0 {
+					p.logger.Warnf("Stopping %s with %d requests still in flight", containerSummaryName(summary), remaining)
+				}
+			}(summary)
+		}
+		wg.Wait()
+	}
+
+	// Finish removing the drained replicas even if the caller gave up
+	stopCtx := context.WithoutCancel(ctx)
+	var firstErr error
+	for _, summary := range summaries {
+		if err := p.removeContainerSummary(stopCtx, summary); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove container %s: %w", containerSummaryName(summary), err)
+		}
+		if p.drainer != nil {
+			p.drainer.Undrain(summary.ID)
+		}
+	}
+	return firstErr
+}
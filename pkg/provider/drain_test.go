@@ -0,0 +1,58 @@
+package provider
+
+import (
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+)
+
+func TestParseStopSettings(t *testing.T) {
+	settings, err := ParseStopSettings(map[string]string{
+		AnnotationDrainGracePeriod: "45s",
+		AnnotationStopSignal:       "SIGQUIT",
+		AnnotationStopTimeout:      "20s",
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if settings.GracePeriod != 45*time.Second || settings.Signal != "SIGQUIT" || settings.Timeout != 20*time.Second {
+		t.Fatalf("unexpected settings: %#v", settings)
+	}
+
+	settings, err = ParseStopSettings(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if settings.GracePeriod != -1 || settings.Signal != "" || settings.Timeout != -1 {
+		t.Fatalf("expected unset settings, got %#v", settings)
+	}
+
+	invalid := []map[string]string{
+		{AnnotationDrainGracePeriod: "-5s"},
+		{AnnotationDrainGracePeriod: "soon"},
+		{AnnotationStopSignal: "sig term"},
+		{AnnotationStopTimeout: "1500ms"},
+	}
+	for _, annotations := range invalid {
+		if _, err := ParseStopSettings(annotations); err == nil {
+			t.Fatalf("expected error for %v", annotations)
+		}
+	}
+}
+
+func TestDrainGracePeriodFromLabel(t *testing.T) {
+	config := &container.Config{Labels: map[string]string{}}
+	applyStopSettings(config, StopSettings{GracePeriod: 5 * time.Second, Signal: "15", Timeout: 3 * time.Second})
+	if config.StopSignal != "15" || config.StopTimeout == nil || *config.StopTimeout != 3 {
+		t.Fatalf("unexpected stop settings: signal=%q timeout=%v", config.StopSignal, config.StopTimeout)
+	}
+
+	p := &DockerProvider{drainGrace: DefaultDrainGracePeriod}
+	if grace := p.drainGracePeriod(config.Labels); grace != 5*time.Second {
+		t.Fatalf("expected the labelled grace period, got %v", grace)
+	}
+	if grace := p.drainGracePeriod(nil); grace != DefaultDrainGracePeriod {
+		t.Fatalf("expected the default grace period, got %v", grace)
+	}
+}
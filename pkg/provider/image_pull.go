@@ -0,0 +1,211 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/pkg/jsonmessage"
+
+	"github.com/docker-faas/docker-faas/pkg/registryauth"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// PullPolicyAlways pulls the image on every deploy and update
+	PullPolicyAlways = "Always"
+	// PullPolicyIfNotPresent pulls the image only when it is missing locally
+	PullPolicyIfNotPresent = "IfNotPresent"
+	// PullPolicyNever uses the local image and fails when it is missing
+	PullPolicyNever = "Never"
+
+	// Image pull outcomes reported in ImagePullStatus
+	PullStatusPulled  = "pulled"
+	PullStatusPresent = "present"
+	PullStatusFailed  = "failed"
+
+	// maxPullEvents bounds the progress lines kept per pull
+	maxPullEvents = 20
+)
+
+// ErrImagePull is returned when a function's image cannot be pulled
+var ErrImagePull = errors.New("image pull failed")
+
+// RegistryAuth resolves the registry login for an image
+type RegistryAuth interface {
+	Lookup(image string) (*registryauth.Auth, error)
+}
+
+// ValidatePullPolicy checks a function pull policy; empty selects IfNotPresent
+func ValidatePullPolicy(policy string) error {
+	switch policy {
+	case "", PullPolicyAlways, PullPolicyIfNotPresent, PullPolicyNever:
+		return nil
+	default:
+		return fmt.Errorf("invalid pull policy %q: must be %s, %s or %s", policy, PullPolicyAlways, PullPolicyIfNotPresent, PullPolicyNever)
+	}
+}
+
+// pullPolicy returns the effective pull policy of a deployment
+func pullPolicy(deployment *faasTypes.FunctionDeployment) string {
+	if deployment.PullPolicy == "" {
+		return PullPolicyIfNotPresent
+	}
+	return deployment.PullPolicy
+}
+
+// pullTracker remembers the most recent pull of each function
+type pullTracker struct {
+	mu       sync.Mutex
+	statuses map[string]*faasTypes.ImagePullStatus
+}
+
+func newPullTracker() *pullTracker {
+	return &pullTracker{statuses: make(map[string]*faasTypes.ImagePullStatus)}
+}
+
+func (t *pullTracker) record(functionName string, status *faasTypes.ImagePullStatus) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.statuses[functionName] = status
+}
+
+func (t *pullTracker) get(functionName string) *faasTypes.ImagePullStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	status, ok := t.statuses[functionName]
+	if !ok {
+		return nil
+	}
+	copied := *status
+	copied.Events = append([]string(nil), status.Events...)
+	return &copied
+}
+
+func (t *pullTracker) forget(functionName string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.statuses, functionName)
+}
+
+// SetRegistryAuth sets the source of registry logins used for pulls
+func (p *DockerProvider) SetRegistryAuth(auth RegistryAuth) {
+	p.registryAuth = auth
+}
+
+// ImagePullStatus returns the outcome of the function's most recent image pull
+func (p *DockerProvider) ImagePullStatus(functionName string) *faasTypes.ImagePullStatus {
+	return p.pulls.get(functionName)
+}
+
+// registryLogin resolves the encoded login for an image, if one is stored
+func (p *DockerProvider) registryLogin(imageStr string) (*registryauth.Auth, error) {
+	if p.registryAuth == nil {
+		return nil, nil
+	}
+	auth, err := p.registryAuth.Lookup(imageStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve registry credentials: %w", err)
+	}
+	return auth, nil
+}
+
+// ensureImage makes the deployment's image available according to its pull
+// policy and records the outcome for the function status
+func (p *DockerProvider) ensureImage(ctx context.Context, deployment *faasTypes.FunctionDeployment) error {
+	status := &faasTypes.ImagePullStatus{
+		Image:     deployment.Image,
+		Policy:    pullPolicy(deployment),
+		StartedAt: time.Now(),
+	}
+	err := p.pullImage(ctx, deployment.Image, status)
+	status.DurationMs = time.Since(status.StartedAt).Milliseconds()
+	if err != nil {
+		status.Status = PullStatusFailed
+		status.Error = err.Error()
+	}
+	p.pulls.record(deployment.Service, status)
+
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrImagePull, deployment.Image, err)
+	}
+	return nil
+}
+
+// pullImage pulls the Docker image unless the policy allows a local copy
+func (p *DockerProvider) pullImage(ctx context.Context, imageStr string, status *faasTypes.ImagePullStatus) error {
+	if status.Policy != PullPolicyAlways && p.imageExists(ctx, imageStr) {
+		p.logger.Infof("Using local image: %s", imageStr)
+		status.Status = PullStatusPresent
+		return nil
+	}
+	if status.Policy == PullPolicyNever {
+		return fmt.Errorf("image is not present locally and the pull policy is %s", PullPolicyNever)
+	}
+
+	auth, err := p.registryLogin(imageStr)
+	if err != nil {
+		return err
+	}
+	options := image.PullOptions{}
+	if auth != nil {
+		options.RegistryAuth = auth.Encoded
+		status.Registry = auth.Server
+	}
+
+	p.logger.Infof("Pulling image: %s", imageStr)
+	reader, err := p.client.ImagePull(ctx, imageStr, options)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := readPullProgress(reader, status); err != nil {
+		return err
+	}
+	status.Status = PullStatusPulled
+	return nil
+}
+
+// readPullProgress consumes a pull stream, keeping summary lines and the
+// resolved digest. Errors reported inside the stream fail the pull.
+func readPullProgress(stream io.Reader, status *faasTypes.ImagePullStatus) error {
+	decoder := json.NewDecoder(stream)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return fmt.Errorf("failed to read pull progress: %w", err)
+		}
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if msg.ErrorMessage != "" {
+			return errors.New(msg.ErrorMessage)
+		}
+		if digest, ok := strings.CutPrefix(msg.Status, "Digest: "); ok {
+			status.Digest = digest
+		}
+		// Per-layer download and extract progress is noisy; keep layer
+		// completions and the overall status lines
+		if msg.Status == "" || (msg.ID != "" && msg.Status != "Pull complete" && msg.Status != "Already exists") {
+			continue
+		}
+		line := msg.Status
+		if msg.ID != "" {
+			line = msg.ID + ": " + line
+		}
+		status.Events = append(status.Events, line)
+		if over := len(status.Events) - maxPullEvents; over > 0 {
+			status.Events = status.Events[over:]
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package provider
+
+import (
+	"strings"
+	"testing"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestReadPullProgress(t *testing.T) {
+	stream := strings.Join([]string{
+		`{"status":"Pulling from acme/api","id":"1.0"}`,
+		`{"status":"Downloading","progressDetail":{"current":10,"total":100},"id":"a1b2"}`,
+		`{"status":"Pull complete","progressDetail":{},"id":"a1b2"}`,
+		`{"status":"Digest: sha256:abc"}`,
+		`{"status":"Status: Downloaded newer image for acme/api:1.0"}`,
+	}, "\n")
+
+	status := &faasTypes.ImagePullStatus{}
+	if err := readPullProgress(strings.NewReader(stream), status); err != nil {
+		t.Fatalf("read progress: %v", err)
+	}
+	if status.Digest != "sha256:abc" {
+		t.Fatalf("expected digest to be recorded, got %q", status.Digest)
+	}
+	expected := []string{"a1b2: Pull complete", "Digest: sha256:abc", "Status: Downloaded newer image for acme/api:1.0"}
+	if strings.Join(status.Events, "|") != strings.Join(expected, "|") {
+		t.Fatalf("unexpected events: %q", status.Events)
+	}
+
+	failed := `{"status":"Pulling from acme/private"}` + "\n" +
+		`{"errorDetail":{"message":"pull access denied"},"error":"pull access denied"}`
+	if err := readPullProgress(strings.NewReader(failed), &faasTypes.ImagePullStatus{}); err == nil || !strings.Contains(err.Error(), "pull access denied") {
+		t.Fatalf("expected in-stream error to fail the pull, got %v", err)
+	}
+}
+
+func TestValidatePullPolicy(t *testing.T) {
+	for _, policy := range []string{"", PullPolicyAlways, PullPolicyIfNotPresent, PullPolicyNever} {
+		if err := ValidatePullPolicy(policy); err != nil {
+			t.Fatalf("expected %q to be valid: %v", policy, err)
+		}
+	}
+	if err := ValidatePullPolicy("always"); err == nil {
+		t.Fatalf("expected policies to be case sensitive")
+	}
+}
@@ -0,0 +1,498 @@
+package provider
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/client"
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// AnnotationLocalCommand overrides the command the local provider runs
+	// for a function; it defaults to the function's fprocess
+	AnnotationLocalCommand = "com.docker-faas.local.command"
+	// AnnotationLocalMode selects fork (per request) or http (long-running) mode
+	AnnotationLocalMode = "com.docker-faas.local.mode"
+
+	// defaultLocalLogLines is how many log lines each replica retains
+	defaultLocalLogLines = 1000
+)
+
+// localBaseEnv lists the gateway environment variables passed through to
+// function processes; everything else, including gateway credentials, is withheld
+var localBaseEnv = []string{"PATH", "HOME", "TMPDIR", "LANG", "TZ", "SYSTEMROOT"}
+
+// LocalOptions configures the local process provider
+type LocalOptions struct {
+	// SecretsPath is the secret store directory; empty uses the default
+	SecretsPath string
+	// WorkDir is the working directory of function processes; empty uses the
+	// gateway's working directory
+	WorkDir string
+	// BindAddress is the loopback address replicas listen on
+	BindAddress string
+	// ExecTimeout bounds each fork mode invocation unless the function sets exec_timeout
+	ExecTimeout time.Duration
+	// LogLines is how many log lines each replica retains
+	LogLines int
+}
+
+// LocalProvider runs each function replica as a local child process behind
+// a built-in watchdog, for development and testing without a Docker daemon
+type LocalProvider struct {
+	opts          LocalOptions
+	logger        *logrus.Logger
+	secretManager *secrets.SecretManager
+
+	mu        sync.Mutex
+	functions map[string]*localFunction
+}
+
+type localFunction struct {
+	deployment *faasTypes.FunctionDeployment
+	replicas   map[int]*localReplica
+}
+
+type localReplica struct {
+	id       string
+	name     string
+	created  time.Time
+	watchdog *localWatchdog
+}
+
+// NewLocalProvider creates a provider that runs functions as local processes
+func NewLocalProvider(opts LocalOptions, logger *logrus.Logger) (*LocalProvider, error) {
+	secretManager, err := secrets.NewSecretManager(opts.SecretsPath, logger)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize secret manager: %w", err)
+	}
+	if opts.BindAddress == "" {
+		opts.BindAddress = "127.0.0.1"
+	}
+	if opts.LogLines <= 0 {
+		opts.LogLines = defaultLocalLogLines
+	}
+
+	return &LocalProvider{
+		opts:          opts,
+		logger:        logger,
+		secretManager: secretManager,
+		functions:     make(map[string]*localFunction),
+	}, nil
+}
+
+// HealthCheck always succeeds; there is no daemon to reach
+func (p *LocalProvider) HealthCheck(ctx context.Context) error {
+	return nil
+}
+
+// CheckNetwork always succeeds; replicas listen on the loopback interface
+func (p *LocalProvider) CheckNetwork(ctx context.Context) error {
+	return nil
+}
+
+// DeployFunction starts the specified number of replicas, replacing any
+// that are already running
+func (p *LocalProvider) DeployFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) error {
+	p.logger.Infof("Deploying local function: %s with %d replicas", deployment.Service, replicas)
+
+	if _, _, err := localCommand(deployment); err != nil {
+		return err
+	}
+	if deployment.Limits != nil || deployment.Security != nil {
+		p.logger.Warnf("Resource limits and security profiles are not enforced for local function %s", deployment.Service)
+	}
+	if len(deployment.Volumes) > 0 {
+		p.logger.Warnf("Volumes are not mounted for local function %s", deployment.Service)
+	}
+
+	p.RemoveFunction(ctx, deployment.Service)
+
+	fn := &localFunction{deployment: deployment, replicas: make(map[int]*localReplica)}
+	p.mu.Lock()
+	p.functions[deployment.Service] = fn
+	p.mu.Unlock()
+
+	return p.ScaleFunction(ctx, deployment, replicas)
+}
+
+// UpdateFunction replaces the function's replicas
+func (p *LocalProvider) UpdateFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) error {
+	return p.DeployFunction(ctx, deployment, replicas)
+}
+
+// RemoveFunction stops every replica of a function
+func (p *LocalProvider) RemoveFunction(ctx context.Context, functionName string) error {
+	p.mu.Lock()
+	fn, ok := p.functions[functionName]
+	delete(p.functions, functionName)
+	p.mu.Unlock()
+	if !ok {
+		return nil
+	}
+
+	p.logger.Infof("Removing local function: %s", functionName)
+	for _, replica := range fn.replicas {
+		replica.watchdog.stop(ctx)
+	}
+	if len(fn.deployment.Secrets) > 0 {
+		if err := p.secretManager.RemoveFunctionSecrets(functionName); err != nil {
+			p.logger.Warnf("Failed to remove secrets for %s: %v", functionName, err)
+		}
+	}
+	return nil
+}
+
+// ScaleFunction starts or stops replicas to reach the target count. The
+// replicas to change are chosen under p.mu, but processes are started and
+// stopped without it, as starting one can take up to localStartTimeout.
+func (p *LocalProvider) ScaleFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, targetReplicas int) error {
+	p.mu.Lock()
+	fn, ok := p.functions[deployment.Service]
+	if !ok {
+		fn = &localFunction{deployment: deployment, replicas: make(map[int]*localReplica)}
+		p.functions[deployment.Service] = fn
+	}
+	var stopping []*localReplica
+	for index, replica := range fn.replicas {
+		if index >= targetReplicas {
+			stopping = append(stopping, replica)
+			delete(fn.replicas, index)
+		}
+	}
+	var missing []int
+	for index := 0; index < targetReplicas; index++ {
+		if _, running := fn.replicas[index]; !running {
+			missing = append(missing, index)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, replica := range stopping {
+		replica.watchdog.stop(ctx)
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	env, err := p.processEnv(fn.deployment)
+	if err != nil {
+		return err
+	}
+	started := make(map[int]*localReplica, len(missing))
+	for _, index := range missing {
+		replica, startErr := p.startReplica(fn.deployment, env, index)
+		if startErr != nil {
+			err = fmt.Errorf("failed to start replica %s-%d: %w", deployment.Service, index, startErr)
+			break
+		}
+		started[index] = replica
+	}
+
+	// The function may have been removed, redeployed or scaled by another
+	// call meanwhile; replicas that are no longer wanted are stopped
+	var unwanted []*localReplica
+	p.mu.Lock()
+	for index, replica := range started {
+		if _, taken := fn.replicas[index]; taken || p.functions[deployment.Service] != fn {
+			unwanted = append(unwanted, replica)
+			continue
+		}
+		fn.replicas[index] = replica
+	}
+	p.mu.Unlock()
+
+	for _, replica := range unwanted {
+		replica.watchdog.stop(ctx)
+	}
+	return err
+}
+
+func (p *LocalProvider) startReplica(deployment *faasTypes.FunctionDeployment, env []string, index int) (*localReplica, error) {
+	mode, argv, err := localCommand(deployment)
+	if err != nil {
+		return nil, err
+	}
+	execTimeout := p.opts.ExecTimeout
+	if value := deployment.EnvVars["exec_timeout"]; value != "" {
+		if execTimeout, err = time.ParseDuration(value); err != nil {
+			return nil, fmt.Errorf("invalid exec_timeout %q: %w", value, err)
+		}
+	}
+
+	watchdog := &localWatchdog{
+		mode:        mode,
+		argv:        argv,
+		env:         env,
+		dir:         p.opts.WorkDir,
+		execTimeout: execTimeout,
+		logs:        newLogBuffer(p.opts.LogLines),
+	}
+	if err := watchdog.start(p.opts.BindAddress); err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 6)
+	rand.Read(id)
+	replica := &localReplica{
+		id:       "local-" + hex.EncodeToString(id),
+		name:     fmt.Sprintf("%s-%d", deployment.Service, index),
+		created:  time.Now(),
+		watchdog: watchdog,
+	}
+	p.logger.Infof("Local replica started: %s (port %d)", replica.name, watchdog.port())
+	return replica, nil
+}
+
+// processEnv builds the environment of a function's processes, materializing
+// its secrets and exposing their directory as secret_mount_path
+func (p *LocalProvider) processEnv(deployment *faasTypes.FunctionDeployment) ([]string, error) {
+	env := []string{}
+	for _, key := range localBaseEnv {
+		if value, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+value)
+		}
+	}
+	for k, v := range deployment.EnvVars {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	if deployment.EnvProcess != "" {
+		env = append(env, fmt.Sprintf("fprocess=%s", deployment.EnvProcess))
+	}
+
+	if len(deployment.Secrets) > 0 {
+		if p.secretManager.AutoCreateEnabled() {
+			created, err := p.secretManager.EnsureSecrets(deployment.Secrets)
+			if err != nil {
+				return nil, fmt.Errorf("failed to ensure secrets: %w", err)
+			}
+			if len(created) > 0 {
+				p.logger.Warnf("Auto-created missing secrets for %s: %s", deployment.Service, strings.Join(created, ", "))
+			}
+		}
+		if err := p.secretManager.ValidateSecrets(deployment.Secrets); err != nil {
+			return nil, fmt.Errorf("secret validation failed: %w", err)
+		}
+		secretsDir, err := p.secretManager.MaterializeFunctionSecrets(deployment.Service, deployment.Secrets)
+		if err != nil {
+			return nil, fmt.Errorf("failed to materialize secrets: %w", err)
+		}
+		env = append(env, "secret_mount_path="+secretsDir)
+	}
+	return env, nil
+}
+
+// localCommand resolves the mode and command line of a function
+func localCommand(deployment *faasTypes.FunctionDeployment) (string, []string, error) {
+	command := deployment.Annotations[AnnotationLocalCommand]
+	if command == "" {
+		command = deployment.EnvProcess
+	}
+	argv := strings.Fields(command)
+	if len(argv) == 0 {
+		return "", nil, fmt.Errorf("function %s needs an envProcess or a %s annotation to run locally", deployment.Service, AnnotationLocalCommand)
+	}
+
+	mode := deployment.Annotations[AnnotationLocalMode]
+	switch mode {
+	case "":
+		mode = LocalModeFork
+	case LocalModeFork, LocalModeHTTP:
+	default:
+		return "", nil, fmt.Errorf("invalid %s %q: must be %s or %s", AnnotationLocalMode, mode, LocalModeFork, LocalModeHTTP)
+	}
+	return mode, argv, nil
+}
+
+// GetFunctionContainers lists a function's replicas
+func (p *LocalProvider) GetFunctionContainers(ctx context.Context, functionName string) ([]*faasTypes.Container, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	fn, ok := p.functions[functionName]
+	if !ok {
+		return []*faasTypes.Container{}, nil
+	}
+
+	result := make([]*faasTypes.Container, 0, len(fn.replicas))
+	for _, index := range sortedReplicaIndices(fn) {
+		replica := fn.replicas[index]
+		status := "running"
+		if !replica.watchdog.running() {
+			status = "exited"
+		}
+		result = append(result, &faasTypes.Container{
+			ID:        replica.id,
+			Name:      replica.name,
+			IPAddress: p.opts.BindAddress,
+			Port:      replica.watchdog.port(),
+			Status:    status,
+			Created:   replica.created,
+		})
+	}
+	return result, nil
+}
+
+// GetFunctionLogs merges the retained output of all of the function's
+// replicas. With Follow new lines are polled for until ctx is done.
+func (p *LocalProvider) GetFunctionLogs(ctx context.Context, request faasTypes.LogRequest) (<-chan faasTypes.LogMessage, error) {
+	p.mu.Lock()
+	fn, ok := p.functions[request.Name]
+	if !ok || len(fn.replicas) == 0 {
+		p.mu.Unlock()
+		return nil, fmt.Errorf("no containers found for function: %s", request.Name)
+	}
+	replicas := make([]*localReplica, 0, len(fn.replicas))
+	for _, index := range sortedReplicaIndices(fn) {
+		if replica := fn.replicas[index]; request.Instance == "" || replica.name == request.Instance {
+			replicas = append(replicas, replica)
+		}
+	}
+	p.mu.Unlock()
+	if len(replicas) == 0 {
+		return nil, fmt.Errorf("no container %s found for function: %s", request.Instance, request.Name)
+	}
+
+	var since time.Time
+	if request.Since != nil {
+		since = *request.Since
+	}
+	last := make([]uint64, len(replicas))
+	history := make([]faasTypes.LogMessage, 0)
+	for i, replica := range replicas {
+		entries := replica.watchdog.logs.read(0, since)
+		if n := len(entries); n > 0 {
+			last[i] = entries[n-1].seq
+		}
+		history = append(history, localLogMessages(request.Name, replica.name, entries)...)
+	}
+
+	out := make(chan faasTypes.LogMessage)
+	go func() {
+		defer close(out)
+		send := func(messages []faasTypes.LogMessage) bool {
+			for _, message := range messages {
+				select {
+				case out <- message:
+				case <-ctx.Done():
+					return false
+				}
+			}
+			return true
+		}
+
+		if !send(mergeLogMessages(history, request.Tail)) || !request.Follow {
+			return
+		}
+		ticker := time.NewTicker(localLogPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			batch := make([]faasTypes.LogMessage, 0)
+			for i, replica := range replicas {
+				entries := replica.watchdog.logs.read(last[i], time.Time{})
+				if n := len(entries); n > 0 {
+					last[i] = entries[n-1].seq
+				}
+				batch = append(batch, localLogMessages(request.Name, replica.name, entries)...)
+			}
+			if !send(mergeLogMessages(batch, -1)) {
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func localLogMessages(functionName, instance string, entries []logEntry) []faasTypes.LogMessage {
+	messages := make([]faasTypes.LogMessage, 0, len(entries))
+	for _, entry := range entries {
+		messages = append(messages, faasTypes.LogMessage{
+			Name:      functionName,
+			Instance:  instance,
+			Timestamp: entry.time,
+			Text:      entry.text,
+			Stream:    entry.stream,
+		})
+	}
+	return messages
+}
+
+func sortedReplicaIndices(fn *localFunction) []int {
+	indices := make([]int, 0, len(fn.replicas))
+	for index := range fn.replicas {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+	return indices
+}
+
+// CleanupFunctionNetwork is a no-op; local functions have no networks
+func (p *LocalProvider) CleanupFunctionNetwork(ctx context.Context, functionName, networkName string) error {
+	return nil
+}
+
+// Close stops every running function
+func (p *LocalProvider) Close() error {
+	p.mu.Lock()
+	names := make([]string, 0, len(p.functions))
+	for name := range p.functions {
+		names = append(names, name)
+	}
+	p.mu.Unlock()
+
+	for _, name := range names {
+		p.RemoveFunction(context.Background(), name)
+	}
+	return nil
+}
+
+// DockerClient returns nil; features that need Docker are unavailable
+func (p *LocalProvider) DockerClient() *client.Client {
+	return nil
+}
+
+// GetGatewayID returns an empty ID; the gateway is not a container
+func (p *LocalProvider) GetGatewayID() string {
+	return ""
+}
+
+// CanConnectGateway reports false; there are no networks to join
+func (p *LocalProvider) CanConnectGateway() bool {
+	return false
+}
+
+// ImagePullStatus returns nil; local functions have no images
+func (p *LocalProvider) ImagePullStatus(functionName string) *faasTypes.ImagePullStatus {
+	return nil
+}
+
+// GetFunctionEvents returns nil; local processes are not watched
+func (p *LocalProvider) GetFunctionEvents(functionName string) []faasTypes.FunctionEvent {
+	return nil
+}
+
+// CrashLoopStatus returns nil; the watchdog does not restart local processes
+func (p *LocalProvider) CrashLoopStatus(ctx context.Context, functionName string, includeLogs bool) *faasTypes.CrashLoopStatus {
+	return nil
+}
+
+// GetSecretManager returns the secret manager
+func (p *LocalProvider) GetSecretManager() *secrets.SecretManager {
+	return p.secretManager
+}
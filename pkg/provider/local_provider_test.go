@@ -0,0 +1,156 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/router"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func newTestLocalProvider(t *testing.T) *LocalProvider {
+	t.Helper()
+	for _, tool := range []string{"cat", "sh"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s is not available", tool)
+		}
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	p, err := NewLocalProvider(LocalOptions{SecretsPath: t.TempDir(), ExecTimeout: 5 * time.Second}, logger)
+	if err != nil {
+		t.Fatalf("new local provider: %v", err)
+	}
+	if err := p.GetSecretManager().SetRuntimePath(t.TempDir()); err != nil {
+		t.Fatalf("set runtime path: %v", err)
+	}
+	t.Cleanup(func() { p.Close() })
+	return p
+}
+
+func invokeLocal(t *testing.T, rt *router.Router, name, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	resp, err := rt.RouteRequest(context.Background(), name, req)
+	if err != nil {
+		t.Fatalf("route request: %v", err)
+	}
+	defer resp.Body.Close()
+	out, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(out)
+}
+
+func TestLocalProvider_DeployInvokeScale(t *testing.T) {
+	p := newTestLocalProvider(t)
+	rt := router.NewRouter(p, logrus.New(), 5*time.Second, 5*time.Second, 5*time.Second)
+	ctx := context.Background()
+
+	if err := p.GetSecretManager().CreateSecret("api-key", "s3cr3t"); err != nil {
+		t.Fatalf("create secret: %v", err)
+	}
+	deployment := &faasTypes.FunctionDeployment{
+		Service:    "echo",
+		Image:      "unused",
+		EnvProcess: "cat",
+		Secrets:    []string{"api-key"},
+	}
+	if err := p.DeployFunction(ctx, deployment, 2); err != nil {
+		t.Fatalf("deploy: %v", err)
+	}
+
+	containers, err := p.GetFunctionContainers(ctx, "echo")
+	if err != nil || len(containers) != 2 {
+		t.Fatalf("expected 2 replicas, got %d (%v)", len(containers), err)
+	}
+	if containers[0].Port == 0 || containers[0].Port == containers[1].Port || containers[0].Status != "running" {
+		t.Fatalf("expected running replicas on distinct ports, got %+v %+v", containers[0], containers[1])
+	}
+
+	if code, body := invokeLocal(t, rt, "echo", "hello"); code != http.StatusOK || body != "hello" {
+		t.Fatalf("expected echoed body, got %d %q", code, body)
+	}
+
+	// A configured command replaces fprocess; sh runs the request body as a
+	// script, which can see env vars, request metadata and secrets
+	deployment = &faasTypes.FunctionDeployment{
+		Service:     "echo",
+		Image:       "unused",
+		EnvVars:     map[string]string{"GREETING": "hi"},
+		Secrets:     []string{"api-key"},
+		Annotations: map[string]string{AnnotationLocalCommand: "sh"},
+	}
+	if err := p.UpdateFunction(ctx, deployment, 1); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	script := `echo "$GREETING $Http_Method"; cat "$secret_mount_path/api-key"; echo oops >&2`
+	if code, body := invokeLocal(t, rt, "echo", script); code != http.StatusOK || body != "hi POST\ns3cr3t" {
+		t.Fatalf("unexpected response %d %q", code, body)
+	}
+	messages, err := p.GetFunctionLogs(ctx, faasTypes.LogRequest{Name: "echo", Tail: 10})
+	if err != nil {
+		t.Fatalf("logs: %v", err)
+	}
+	var logs []string
+	stderr := false
+	for message := range messages {
+		logs = append(logs, message.Text)
+		if message.Text == "oops" && message.Stream == "stderr" && message.Instance == "echo-0" {
+			stderr = true
+		}
+	}
+	if !stderr {
+		t.Fatalf("expected stderr in logs, got %q", logs)
+	}
+
+	if code, _ := invokeLocal(t, rt, "echo", "exit 3"); code != http.StatusInternalServerError {
+		t.Fatalf("expected failing command to return 500, got %d", code)
+	}
+
+	if err := p.ScaleFunction(ctx, deployment, 0); err != nil {
+		t.Fatalf("scale: %v", err)
+	}
+	if containers, _ := p.GetFunctionContainers(ctx, "echo"); len(containers) != 0 {
+		t.Fatalf("expected no replicas after scaling to zero, got %d", len(containers))
+	}
+	if err := p.RemoveFunction(ctx, "echo"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+}
+
+func TestLocalProvider_RequiresCommand(t *testing.T) {
+	p := newTestLocalProvider(t)
+	err := p.DeployFunction(context.Background(), &faasTypes.FunctionDeployment{Service: "nothing", Image: "alpine"}, 1)
+	if err == nil {
+		t.Fatalf("expected deploy without a command to fail")
+	}
+
+	err = p.DeployFunction(context.Background(), &faasTypes.FunctionDeployment{
+		Service:     "bad-mode",
+		EnvProcess:  "cat",
+		Annotations: map[string]string{AnnotationLocalMode: "daemon"},
+	}, 1)
+	if err == nil {
+		t.Fatalf("expected invalid mode to fail")
+	}
+}
+
+func TestCappedBuffer(t *testing.T) {
+	killed := 0
+	b := &cappedBuffer{max: 8, exceeded: func() { killed++ }}
+	b.Write([]byte("hello "))
+	if n, err := b.Write([]byte("world")); n != 5 || err != nil {
+		t.Fatalf("expected writes past the cap to be discarded without error, got %d %v", n, err)
+	}
+	b.Write([]byte("!"))
+	if !b.overflowed || killed != 1 || b.buf.String() != "hello " {
+		t.Fatalf("expected one overflow keeping %q, got %v %d %q", "hello ", b.overflowed, killed, b.buf.String())
+	}
+}
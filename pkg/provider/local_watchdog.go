@@ -0,0 +1,368 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// LocalModeFork runs the command once per request, like the classic watchdog
+	LocalModeFork = "fork"
+	// LocalModeHTTP runs the command once per replica as an HTTP server on $PORT
+	LocalModeHTTP = "http"
+
+	// localHealthPath is the watchdog health endpoint
+	localHealthPath = "/_/health"
+	// localStartTimeout bounds how long an HTTP mode process may take to listen
+	localStartTimeout = 10 * time.Second
+	// localLogPollInterval is how often followed logs are checked for new lines
+	localLogPollInterval = 250 * time.Millisecond
+	// localMaxForkOutput bounds the output of a fork mode invocation, which is
+	// buffered so a failure can still be reported with an error status
+	localMaxForkOutput = 32 << 20
+)
+
+// localWatchdog is a watchdog-compatible HTTP shim serving one replica. In
+// fork mode each request runs the function command with the body on stdin;
+// in HTTP mode requests are proxied to a long-running child process.
+type localWatchdog struct {
+	mode        string
+	argv        []string
+	env         []string
+	dir         string
+	execTimeout time.Duration
+	logs        *logBuffer
+
+	listener net.Listener
+	server   *http.Server
+
+	mu      sync.Mutex
+	process *exec.Cmd
+	exited  chan struct{}
+	proxy   *httputil.ReverseProxy
+}
+
+// start listens on a free loopback port and, in HTTP mode, launches the
+// function process
+func (w *localWatchdog) start(bindAddress string) error {
+	if w.mode == LocalModeHTTP {
+		if err := w.startProcess(bindAddress); err != nil {
+			return err
+		}
+	}
+
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, "0"))
+	if err != nil {
+		w.stopProcess()
+		return fmt.Errorf("failed to listen: %w", err)
+	}
+	w.listener = listener
+	w.server = &http.Server{Handler: w, ReadHeaderTimeout: 10 * time.Second}
+	go w.server.Serve(listener)
+	return nil
+}
+
+// port returns the port the shim listens on
+func (w *localWatchdog) port() int {
+	return w.listener.Addr().(*net.TCPAddr).Port
+}
+
+// running reports whether the replica can serve requests
+func (w *localWatchdog) running() bool {
+	if w.mode != LocalModeHTTP {
+		return true
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	select {
+	case <-w.exited:
+		return false
+	default:
+		return true
+	}
+}
+
+// stop shuts the shim down and terminates the function process
+func (w *localWatchdog) stop(ctx context.Context) {
+	if w.server != nil {
+		w.server.Shutdown(ctx)
+	}
+	w.stopProcess()
+}
+
+func (w *localWatchdog) startProcess(bindAddress string) error {
+	upstream, err := freePort(bindAddress)
+	if err != nil {
+		return err
+	}
+
+	cmd := exec.Command(w.argv[0], w.argv[1:]...)
+	cmd.Dir = w.dir
+	cmd.Env = append(append([]string{}, w.env...), "PORT="+strconv.Itoa(upstream))
+	cmd.Stdout = w.logs.stdout
+	cmd.Stderr = w.logs.stderr
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start %s: %w", w.argv[0], err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		err := cmd.Wait()
+		if err != nil {
+			fmt.Fprintf(w.logs.stderr, "process exited: %v\n", err)
+		}
+		close(exited)
+	}()
+
+	target := &url.URL{Scheme: "http", Host: net.JoinHostPort(bindAddress, strconv.Itoa(upstream))}
+	w.mu.Lock()
+	w.process = cmd
+	w.exited = exited
+	w.proxy = httputil.NewSingleHostReverseProxy(target)
+	w.mu.Unlock()
+
+	if err := waitForListener(target.Host, exited); err != nil {
+		w.stopProcess()
+		return err
+	}
+	return nil
+}
+
+func (w *localWatchdog) stopProcess() {
+	w.mu.Lock()
+	cmd, exited := w.process, w.exited
+	w.mu.Unlock()
+	if cmd == nil || cmd.Process == nil {
+		return
+	}
+
+	select {
+	case <-exited:
+		return
+	default:
+	}
+	cmd.Process.Kill()
+	<-exited
+}
+
+// ServeHTTP implements the watchdog protocol
+func (w *localWatchdog) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == localHealthPath {
+		if !w.running() {
+			http.Error(rw, "function process has exited", http.StatusServiceUnavailable)
+			return
+		}
+		rw.Write([]byte("OK"))
+		return
+	}
+
+	if w.mode == LocalModeHTTP {
+		if !w.running() {
+			http.Error(rw, "function process has exited", http.StatusBadGateway)
+			return
+		}
+		w.proxy.ServeHTTP(rw, r)
+		return
+	}
+	w.fork(rw, r)
+}
+
+// fork runs the command for a single request, passing the body on stdin and
+// the request metadata as Http_* environment variables
+func (w *localWatchdog) fork(rw http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	if w.execTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, w.execTimeout)
+		defer cancel()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stdout := &cappedBuffer{max: localMaxForkOutput, exceeded: cancel}
+	cmd := exec.CommandContext(ctx, w.argv[0], w.argv[1:]...)
+	cmd.Dir = w.dir
+	cmd.Env = append(append([]string{}, w.env...), requestEnv(r)...)
+	cmd.Stdin = r.Body
+	cmd.Stdout = stdout
+	cmd.Stderr = w.logs.stderr
+
+	err := cmd.Run()
+	if stdout.overflowed {
+		fmt.Fprintf(w.logs.stderr, "function output exceeded %d bytes\n", localMaxForkOutput)
+		http.Error(rw, "function output too large", http.StatusBadGateway)
+		return
+	}
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			fmt.Fprintf(w.logs.stderr, "function timed out after %s\n", w.execTimeout)
+			http.Error(rw, "function timed out", http.StatusGatewayTimeout)
+			return
+		}
+		fmt.Fprintf(w.logs.stderr, "function failed: %v\n", err)
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if contentType := envValue(w.env, "content_type"); contentType != "" {
+		rw.Header().Set("Content-Type", contentType)
+	}
+	rw.WriteHeader(http.StatusOK)
+	io.Copy(rw, &stdout.buf)
+}
+
+// cappedBuffer buffers up to max bytes; on overflow it discards further
+// output and calls exceeded, which kills the process
+type cappedBuffer struct {
+	buf        bytes.Buffer
+	max        int
+	overflowed bool
+	exceeded   func()
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if b.overflowed {
+		return len(p), nil
+	}
+	if b.buf.Len()+len(p) > b.max {
+		b.overflowed = true
+		b.exceeded()
+		return len(p), nil
+	}
+	return b.buf.Write(p)
+}
+
+// requestEnv maps a request to the classic watchdog's environment variables
+func requestEnv(r *http.Request) []string {
+	env := []string{
+		"Http_Method=" + r.Method,
+		"Http_Path=" + r.URL.Path,
+		"Http_Query=" + r.URL.RawQuery,
+	}
+	if r.ContentLength >= 0 {
+		env = append(env, "Http_ContentLength="+strconv.FormatInt(r.ContentLength, 10))
+	}
+	for name, values := range r.Header {
+		env = append(env, "Http_"+strings.ReplaceAll(name, "-", "_")+"="+strings.Join(values, ","))
+	}
+	return env
+}
+
+func envValue(env []string, key string) string {
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// freePort reserves a free loopback port for a child process
+func freePort(bindAddress string) (int, error) {
+	listener, err := net.Listen("tcp", net.JoinHostPort(bindAddress, "0"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to allocate port: %w", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
+
+// waitForListener waits until the child process accepts connections
+func waitForListener(address string, exited <-chan struct{}) error {
+	deadline := time.Now().Add(localStartTimeout)
+	for time.Now().Before(deadline) {
+		conn, err := net.DialTimeout("tcp", address, 200*time.Millisecond)
+		if err == nil {
+			conn.Close()
+			return nil
+		}
+		select {
+		case <-exited:
+			return fmt.Errorf("function process exited before listening on %s", address)
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	return fmt.Errorf("function process did not listen on %s within %s", address, localStartTimeout)
+}
+
+// logBuffer keeps the most recent lines written by a replica
+type logBuffer struct {
+	mu      sync.Mutex
+	entries []logEntry
+	next    uint64
+	max     int
+	stdout  *logStream
+	stderr  *logStream
+}
+
+// logEntry is one line of replica output; seq numbers lines in write order
+type logEntry struct {
+	seq    uint64
+	time   time.Time
+	stream string
+	text   string
+}
+
+// logStream is the stdout or stderr of a replica
+type logStream struct {
+	buffer  *logBuffer
+	name    string
+	partial []byte
+}
+
+func newLogBuffer(max int) *logBuffer {
+	b := &logBuffer{max: max}
+	b.stdout = &logStream{buffer: b, name: "stdout"}
+	b.stderr = &logStream{buffer: b, name: "stderr"}
+	return b
+}
+
+func (s *logStream) Write(p []byte) (int, error) {
+	b := s.buffer
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	data := append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		b.next++
+		b.entries = append(b.entries, logEntry{seq: b.next, time: now, stream: s.name, text: string(data[:i])})
+		data = data[i+1:]
+	}
+	s.partial = append([]byte(nil), data...)
+	if over := len(b.entries) - b.max; over > 0 {
+		b.entries = append([]logEntry(nil), b.entries[over:]...)
+	}
+	return len(p), nil
+}
+
+// read returns the retained lines numbered above after and written no
+// earlier than since
+func (b *logBuffer) read(after uint64, since time.Time) []logEntry {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	entries := make([]logEntry, 0)
+	for _, entry := range b.entries {
+		if entry.seq > after && !entry.time.Before(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
@@ -0,0 +1,249 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// containerLogsAPI is the subset of the Docker client used to read logs
+type containerLogsAPI interface {
+	ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error)
+}
+
+// logSource is a replica whose logs are read
+type logSource struct {
+	id       string
+	instance string
+}
+
+// GetFunctionLogs merges the logs of all of a function's replicas, ordered by
+// timestamp with the tail applied across replicas. With Follow the channel
+// then carries new lines of those replicas until ctx is done or they all stop.
+func (p *DockerProvider) GetFunctionLogs(ctx context.Context, request faasTypes.LogRequest) (<-chan faasTypes.LogMessage, error) {
+	containers, err := p.listFunctionContainers(ctx, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if len(containers) == 0 {
+		return nil, fmt.Errorf("no containers found for function: %s", request.Name)
+	}
+
+	sources := make([]logSource, 0, len(containers))
+	for _, c := range containers {
+		if name := containerSummaryName(c); request.Instance == "" || name == request.Instance {
+			sources = append(sources, logSource{id: c.ID, instance: name})
+		}
+	}
+	if len(sources) == 0 {
+		return nil, fmt.Errorf("no container %s found for function: %s", request.Instance, request.Name)
+	}
+	sort.Slice(sources, func(i, j int) bool { return sources[i].instance < sources[j].instance })
+	return streamContainerLogs(ctx, p.client, request, sources, p.logger), nil
+}
+
+// streamContainerLogs sends the merged history of the sources and, when
+// following, their new lines. The channel is closed when the stream ends.
+func streamContainerLogs(ctx context.Context, api containerLogsAPI, request faasTypes.LogRequest, sources []logSource, logger *logrus.Logger) <-chan faasTypes.LogMessage {
+	start := time.Now()
+	history := make([]faasTypes.LogMessage, 0)
+	last := make(map[string]time.Time, len(sources))
+	if request.Tail != 0 {
+		for _, source := range sources {
+			messages, err := readContainerLogs(ctx, api, request, source)
+			if err != nil {
+				// Replicas removed since they were listed have no logs left
+				logger.Debugf("Failed to read logs of %s: %v", source.instance, err)
+				continue
+			}
+			if n := len(messages); n > 0 {
+				last[source.id] = messages[n-1].Timestamp
+			}
+			history = append(history, messages...)
+		}
+		history = mergeLogMessages(history, request.Tail)
+	}
+
+	out := make(chan faasTypes.LogMessage)
+	go func() {
+		defer close(out)
+		for _, message := range history {
+			select {
+			case out <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !request.Follow {
+			return
+		}
+
+		// Continue each replica after the last line already sent for it
+		var wg sync.WaitGroup
+		for _, source := range sources {
+			since, ok := last[source.id]
+			if !ok {
+				since = start
+			}
+			wg.Add(1)
+			go func(source logSource, since time.Time) {
+				defer wg.Done()
+				if err := followContainerLogs(ctx, api, request.Name, source, since, out); err != nil && ctx.Err() == nil {
+					logger.Debugf("Stopped following logs of %s: %v", source.instance, err)
+				}
+			}(source, since)
+		}
+		wg.Wait()
+	}()
+	return out
+}
+
+// readContainerLogs returns the requested history of one replica
+func readContainerLogs(ctx context.Context, api containerLogsAPI, request faasTypes.LogRequest, source logSource) ([]faasTypes.LogMessage, error) {
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Tail:       logTail(request.Tail),
+	}
+	if request.Since != nil {
+		options.Since = formatLogTime(*request.Since)
+	}
+
+	reader, err := api.ContainerLogs(ctx, source.id, options)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	messages := make([]faasTypes.LogMessage, 0)
+	err = demuxLogLines(reader, func(stream, line string) error {
+		messages = append(messages, parseLogLine(request.Name, source.instance, stream, line))
+		return nil
+	})
+	return messages, err
+}
+
+// followContainerLogs sends the lines a replica writes after since
+func followContainerLogs(ctx context.Context, api containerLogsAPI, functionName string, source logSource, since time.Time, out chan<- faasTypes.LogMessage) error {
+	reader, err := api.ContainerLogs(ctx, source.id, container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Follow:     true,
+		Since:      formatLogTime(since),
+	})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	return demuxLogLines(reader, func(stream, line string) error {
+		message := parseLogLine(functionName, source.instance, stream, line)
+		// Since is inclusive, so the last line already sent comes back
+		if !message.Timestamp.After(since) {
+			return nil
+		}
+		select {
+		case out <- message:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// demuxLogLines splits a multiplexed Docker log stream into lines
+func demuxLogLines(reader io.Reader, emit func(stream, line string) error) error {
+	stdout := &logLineWriter{stream: "stdout", emit: emit}
+	stderr := &logLineWriter{stream: "stderr", emit: emit}
+	if _, err := stdcopy.StdCopy(stdout, stderr, reader); err != nil {
+		return err
+	}
+	if err := stdout.flush(); err != nil {
+		return err
+	}
+	return stderr.flush()
+}
+
+// logLineWriter emits every complete line written to it
+type logLineWriter struct {
+	stream  string
+	partial []byte
+	emit    func(stream, line string) error
+}
+
+func (w *logLineWriter) Write(p []byte) (int, error) {
+	data := append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			break
+		}
+		if err := w.emit(w.stream, string(data[:i])); err != nil {
+			return 0, err
+		}
+		data = data[i+1:]
+	}
+	w.partial = append([]byte(nil), data...)
+	return len(p), nil
+}
+
+// flush emits a final line that has no newline
+func (w *logLineWriter) flush() error {
+	if len(w.partial) == 0 {
+		return nil
+	}
+	line := string(w.partial)
+	w.partial = nil
+	return w.emit(w.stream, line)
+}
+
+// parseLogLine splits the timestamp Docker prefixes to each line
+func parseLogLine(functionName, instance, stream, line string) faasTypes.LogMessage {
+	message := faasTypes.LogMessage{Name: functionName, Instance: instance, Stream: stream, Text: line}
+	if raw, text, ok := strings.Cut(line, " "); ok {
+		if timestamp, err := time.Parse(time.RFC3339Nano, raw); err == nil {
+			message.Timestamp = timestamp
+			message.Text = text
+		}
+	}
+	return message
+}
+
+// mergeLogMessages orders lines from several replicas by time and keeps the
+// last tail of them; a negative tail keeps all
+func mergeLogMessages(messages []faasTypes.LogMessage, tail int) []faasTypes.LogMessage {
+	sort.SliceStable(messages, func(i, j int) bool {
+		return messages[i].Timestamp.Before(messages[j].Timestamp)
+	})
+	if tail >= 0 && len(messages) > tail {
+		messages = messages[len(messages)-tail:]
+	}
+	return messages
+}
+
+// logTail converts a line count to the Docker tail option
+func logTail(tail int) string {
+	if tail < 0 {
+		return "all"
+	}
+	return strconv.Itoa(tail)
+}
+
+// formatLogTime formats a time for the Docker since option with nanosecond precision
+func formatLogTime(t time.Time) string {
+	return fmt.Sprintf("%d.%09d", t.Unix(), t.Nanosecond())
+}
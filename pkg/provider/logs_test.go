@@ -0,0 +1,123 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/sirupsen/logrus"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type logLine struct {
+	stream stdcopy.StdType
+	time   time.Time
+	text   string
+}
+
+type fakeLogsAPI struct {
+	mu       sync.Mutex
+	history  map[string][]logLine
+	live     map[string][]logLine
+	requests []container.LogsOptions
+}
+
+func multiplexLogs(lines []logLine) []byte {
+	var buf bytes.Buffer
+	for _, line := range lines {
+		fmt.Fprintf(stdcopy.NewStdWriter(&buf, line.stream), "%s %s\n", line.time.Format(time.RFC3339Nano), line.text)
+	}
+	return buf.Bytes()
+}
+
+func (f *fakeLogsAPI) ContainerLogs(ctx context.Context, containerID string, options container.LogsOptions) (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.requests = append(f.requests, options)
+	if !options.Follow {
+		return io.NopCloser(bytes.NewReader(multiplexLogs(f.history[containerID]))), nil
+	}
+
+	// A followed stream stays open until the client goes away
+	reader, writer := io.Pipe()
+	data := multiplexLogs(append(f.history[containerID], f.live[containerID]...))
+	go func() {
+		writer.Write(data)
+		<-ctx.Done()
+		writer.CloseWithError(ctx.Err())
+	}()
+	return reader, nil
+}
+
+func TestStreamContainerLogs_MergesReplicas(t *testing.T) {
+	base := time.Now().Add(-time.Minute)
+	api := &fakeLogsAPI{history: map[string][]logLine{
+		"a": {{stdcopy.Stdout, base, "a1"}, {stdcopy.Stderr, base.Add(2 * time.Second), "a2"}},
+		"b": {{stdcopy.Stdout, base.Add(time.Second), "b1"}, {stdcopy.Stdout, base.Add(3 * time.Second), "b2"}},
+	}}
+	sources := []logSource{{id: "a", instance: "api-0"}, {id: "b", instance: "api-1"}}
+
+	messages := streamContainerLogs(context.Background(), api, faasTypes.LogRequest{Name: "api", Tail: 3}, sources, logrus.New())
+	var got []faasTypes.LogMessage
+	for message := range messages {
+		got = append(got, message)
+	}
+
+	if len(got) != 3 || got[0].Text != "b1" || got[1].Text != "a2" || got[2].Text != "b2" {
+		t.Fatalf("expected the last three lines across replicas in time order, got %+v", got)
+	}
+	if got[1].Instance != "api-0" || got[1].Stream != "stderr" || !got[1].Timestamp.Equal(base.Add(2*time.Second)) || got[1].Name != "api" {
+		t.Fatalf("unexpected message: %+v", got[1])
+	}
+	if api.requests[0].Tail != "3" || !api.requests[0].Timestamps {
+		t.Fatalf("unexpected log options: %+v", api.requests[0])
+	}
+}
+
+func TestStreamContainerLogs_FollowStopsWithContext(t *testing.T) {
+	base := time.Now().Add(-time.Minute)
+	api := &fakeLogsAPI{
+		history: map[string][]logLine{"a": {{stdcopy.Stdout, base, "old"}}},
+		live:    map[string][]logLine{"a": {{stdcopy.Stdout, base.Add(time.Second), "new"}}},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	messages := streamContainerLogs(ctx, api, faasTypes.LogRequest{Name: "api", Tail: -1, Follow: true}, []logSource{{id: "a", instance: "api-0"}}, logrus.New())
+
+	// The line already sent from history is not repeated by the followed stream
+	for _, want := range []string{"old", "new"} {
+		select {
+		case message := <-messages:
+			if message.Text != want {
+				t.Fatalf("expected %q, got %+v", want, message)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected %q", want)
+		}
+	}
+
+	cancel()
+	select {
+	case message, ok := <-messages:
+		if ok {
+			t.Fatalf("expected the stream to end, got %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the stream to close after cancellation")
+	}
+}
+
+func TestParseServiceLogLine(t *testing.T) {
+	line := "2024-05-01T10:00:00.5Z com.docker.swarm.node.id=n1,com.docker.swarm.service.id=s1,com.docker.swarm.task.id=t1 hello world"
+	message := parseServiceLogLine("api", map[string]string{"t1": "api.2"}, "stdout", line)
+	if message.Instance != "api.2" || message.Text != "hello world" || message.Timestamp.IsZero() {
+		t.Fatalf("unexpected message: %+v", message)
+	}
+}
@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// cpuSharesPerCPU is the Docker share weight of one full CPU
+	cpuSharesPerCPU = 1024
+	// minCPUShares is the smallest share value the kernel accepts
+	minCPUShares = 2
+)
+
+var cpusetPattern = regexp.MustCompile(`^\d+(-\d+)?(,\d+(-\d+)?)*$`)
+
+// memoryUnits maps suffixes to multipliers. Docker ("m") and Kubernetes
+// ("Mi") suffixes are both binary; longest suffixes are matched first.
+var memoryUnits = []struct {
+	suffix     string
+	multiplier float64
+}{
+	{"ki", 1 << 10}, {"mi", 1 << 20}, {"gi", 1 << 30}, {"ti", 1 << 40},
+	{"k", 1 << 10}, {"m", 1 << 20}, {"g", 1 << 30}, {"t", 1 << 40},
+	{"b", 1},
+}
+
+// ParseMemoryQuantity parses a memory quantity such as "256m", "1Gi" or a
+// plain byte count. An empty string is zero.
+func ParseMemoryQuantity(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	number, multiplier := value, 1.0
+	lower := strings.ToLower(value)
+	for _, unit := range memoryUnits {
+		if strings.HasSuffix(lower, unit.suffix) {
+			number, multiplier = value[:len(value)-len(unit.suffix)], unit.multiplier
+			break
+		}
+	}
+
+	parsed, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+	if err != nil || parsed < 0 || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+		return 0, fmt.Errorf("invalid memory quantity %q", value)
+	}
+	bytes := parsed * multiplier
+	if bytes > math.MaxInt64 {
+		return 0, fmt.Errorf("memory quantity %q is too large", value)
+	}
+	return int64(bytes), nil
+}
+
+// ParseCPUQuantity parses a CPU quantity in cores ("0.5") or millicores
+// ("500m") and returns nano CPUs. An empty string is zero.
+func ParseCPUQuantity(value string) (int64, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(strings.ToLower(value), "m") {
+		millicores, err := strconv.ParseInt(value[:len(value)-1], 10, 64)
+		if err != nil || millicores < 0 {
+			return 0, fmt.Errorf("invalid CPU quantity %q", value)
+		}
+		return millicores * 1e6, nil
+	}
+
+	cores, err := strconv.ParseFloat(value, 64)
+	if err != nil || cores < 0 || math.IsInf(cores, 0) || math.IsNaN(cores) {
+		return 0, fmt.Errorf("invalid CPU quantity %q", value)
+	}
+	return int64(math.Round(cores * 1e9)), nil
+}
+
+// ValidateResources checks that limits and requests are well formed and
+// consistent with each other
+func ValidateResources(limits *faasTypes.FunctionLimits, requests *faasTypes.FunctionResources) error {
+	return applyResources(&container.HostConfig{}, limits, requests)
+}
+
+// applyResources maps limits and requests onto the container resources
+func applyResources(hostConfig *container.HostConfig, limits *faasTypes.FunctionLimits, requests *faasTypes.FunctionResources) error {
+	resources := &hostConfig.Resources
+
+	if limits != nil {
+		memory, err := ParseMemoryQuantity(limits.Memory)
+		if err != nil {
+			return fmt.Errorf("limits.memory: %w", err)
+		}
+		resources.Memory = memory
+
+		nanoCPUs, err := ParseCPUQuantity(limits.CPU)
+		if err != nil {
+			return fmt.Errorf("limits.cpu: %w", err)
+		}
+		resources.NanoCPUs = nanoCPUs
+
+		if swap := strings.TrimSpace(limits.MemorySwap); swap != "" {
+			if memory == 0 {
+				return fmt.Errorf("limits.memorySwap requires limits.memory")
+			}
+			if swap == "-1" {
+				resources.MemorySwap = -1
+			} else {
+				memorySwap, err := ParseMemoryQuantity(swap)
+				if err != nil {
+					return fmt.Errorf("limits.memorySwap: %w", err)
+				}
+				if memorySwap < memory {
+					return fmt.Errorf("limits.memorySwap must be at least limits.memory")
+				}
+				resources.MemorySwap = memorySwap
+			}
+		}
+
+		if cpuset := strings.TrimSpace(limits.CPUSet); cpuset != "" {
+			if !cpusetPattern.MatchString(cpuset) {
+				return fmt.Errorf("limits.cpuset: invalid CPU list %q", limits.CPUSet)
+			}
+			resources.CpusetCpus = cpuset
+		}
+
+		if limits.BlkioWeight != 0 {
+			if limits.BlkioWeight < 10 || limits.BlkioWeight > 1000 {
+				return fmt.Errorf("limits.blkioWeight must be between 10 and 1000")
+			}
+			resources.BlkioWeight = limits.BlkioWeight
+		}
+
+		if limits.OOMKillDisable {
+			// Without a memory limit the container could exhaust host memory
+			if memory == 0 {
+				return fmt.Errorf("limits.oomKillDisable requires limits.memory")
+			}
+			disable := true
+			resources.OomKillDisable = &disable
+		}
+
+		if limits.OOMScoreAdj < 0 || limits.OOMScoreAdj > 1000 {
+			return fmt.Errorf("limits.oomScoreAdj must be between 0 and 1000")
+		}
+		hostConfig.OomScoreAdj = limits.OOMScoreAdj
+	}
+
+	if requests != nil {
+		reservation, err := ParseMemoryQuantity(requests.Memory)
+		if err != nil {
+			return fmt.Errorf("requests.memory: %w", err)
+		}
+		if resources.Memory > 0 && reservation > resources.Memory {
+			return fmt.Errorf("requests.memory must not exceed limits.memory")
+		}
+		resources.MemoryReservation = reservation
+
+		nanoCPUs, err := ParseCPUQuantity(requests.CPU)
+		if err != nil {
+			return fmt.Errorf("requests.cpu: %w", err)
+		}
+		if resources.NanoCPUs > 0 && nanoCPUs > resources.NanoCPUs {
+			return fmt.Errorf("requests.cpu must not exceed limits.cpu")
+		}
+		if nanoCPUs > 0 {
+			resources.CPUShares = max(nanoCPUs*cpuSharesPerCPU/1e9, minCPUShares)
+		}
+	}
+	return nil
+}
+
+// containerResources reports the resource settings applied to a container
+func containerResources(hostConfig *container.HostConfig) *faasTypes.ContainerResources {
+	if hostConfig == nil {
+		return nil
+	}
+	resources := hostConfig.Resources
+	report := &faasTypes.ContainerResources{
+		Memory:            resources.Memory,
+		MemoryReservation: resources.MemoryReservation,
+		MemorySwap:        resources.MemorySwap,
+		NanoCPUs:          resources.NanoCPUs,
+		CPUShares:         resources.CPUShares,
+		CPUSet:            resources.CpusetCpus,
+		BlkioWeight:       resources.BlkioWeight,
+		OOMScoreAdj:       hostConfig.OomScoreAdj,
+	}
+	if resources.OomKillDisable != nil {
+		report.OOMKillDisable = *resources.OomKillDisable
+	}
+	if resources.PidsLimit != nil {
+		report.PidsLimit = *resources.PidsLimit
+	}
+	return report
+}
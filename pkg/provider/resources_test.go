@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestApplyResources(t *testing.T) {
+	hostConfig := &container.HostConfig{}
+	limits := &faasTypes.FunctionLimits{
+		Memory:         "512Mi",
+		CPU:            "2",
+		MemorySwap:     "1g",
+		CPUSet:         "0-1,3",
+		BlkioWeight:    300,
+		OOMKillDisable: true,
+		OOMScoreAdj:    500,
+	}
+	requests := &faasTypes.FunctionResources{Memory: "256m", CPU: "500m"}
+	if err := applyResources(hostConfig, limits, requests); err != nil {
+		t.Fatalf("apply resources: %v", err)
+	}
+
+	report := containerResources(hostConfig)
+	expected := faasTypes.ContainerResources{
+		Memory:            512 << 20,
+		MemoryReservation: 256 << 20,
+		MemorySwap:        1 << 30,
+		NanoCPUs:          2e9,
+		CPUShares:         512,
+		CPUSet:            "0-1,3",
+		BlkioWeight:       300,
+		OOMKillDisable:    true,
+		OOMScoreAdj:       500,
+	}
+	if *report != expected {
+		t.Fatalf("unexpected resources:\n got %+v\nwant %+v", *report, expected)
+	}
+
+	small := &container.HostConfig{}
+	if err := applyResources(small, nil, &faasTypes.FunctionResources{CPU: "1m"}); err != nil {
+		t.Fatalf("apply resources: %v", err)
+	}
+	if small.CPUShares != minCPUShares {
+		t.Fatalf("expected tiny CPU requests to get the minimum shares, got %d", small.CPUShares)
+	}
+}
+
+func TestValidateResources_RejectsInvalidValues(t *testing.T) {
+	invalid := []struct {
+		name     string
+		limits   *faasTypes.FunctionLimits
+		requests *faasTypes.FunctionResources
+	}{
+		{"malformed memory", &faasTypes.FunctionLimits{Memory: "lots"}, nil},
+		{"negative memory", &faasTypes.FunctionLimits{Memory: "-1m"}, nil},
+		{"malformed cpu", &faasTypes.FunctionLimits{CPU: "two"}, nil},
+		{"fractional millicores", &faasTypes.FunctionLimits{CPU: "0.5m"}, nil},
+		{"swap without memory", &faasTypes.FunctionLimits{MemorySwap: "1g"}, nil},
+		{"swap below memory", &faasTypes.FunctionLimits{Memory: "1g", MemorySwap: "512m"}, nil},
+		{"malformed cpuset", &faasTypes.FunctionLimits{CPUSet: "0-"}, nil},
+		{"blkio weight out of range", &faasTypes.FunctionLimits{BlkioWeight: 5}, nil},
+		{"oom kill disabled without memory", &faasTypes.FunctionLimits{OOMKillDisable: true}, nil},
+		{"negative oom score", &faasTypes.FunctionLimits{OOMScoreAdj: -500}, nil},
+		{"malformed memory request", nil, &faasTypes.FunctionResources{Memory: "12x"}},
+		{"request above limit", &faasTypes.FunctionLimits{Memory: "128m"}, &faasTypes.FunctionResources{Memory: "256m"}},
+		{"cpu request above limit", &faasTypes.FunctionLimits{CPU: "0.5"}, &faasTypes.FunctionResources{CPU: "1"}},
+	}
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := ValidateResources(tc.limits, tc.requests); err == nil {
+				t.Fatalf("expected validation error")
+			}
+		})
+	}
+
+	if err := ValidateResources(&faasTypes.FunctionLimits{Memory: "1.5Gi", MemorySwap: "-1"}, nil); err != nil {
+		t.Fatalf("expected valid resources, got %v", err)
+	}
+}
@@ -0,0 +1,305 @@
+package provider
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// ErrSecurityPolicy is returned when a security profile requests an option
+// the gateway policy does not permit
+var ErrSecurityPolicy = errors.New("not permitted by the gateway security policy")
+
+const (
+	seccompDefault    = "default"
+	profileUnconfined = "unconfined"
+	apparmorDefault   = "docker-default"
+)
+
+var (
+	profileNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]*$`)
+
+	validUlimits = map[string]bool{
+		"core": true, "cpu": true, "data": true, "fsize": true, "locks": true,
+		"memlock": true, "msgqueue": true, "nice": true, "nofile": true, "nproc": true,
+		"rss": true, "rtprio": true, "rttime": true, "sigpending": true, "stack": true,
+	}
+
+	tmpfsFlags   = map[string]bool{"ro": true, "rw": true, "noexec": true, "exec": true, "nosuid": true, "suid": true, "nodev": true, "dev": true}
+	tmpfsOptions = map[string]bool{"size": true, "mode": true, "uid": true, "gid": true}
+)
+
+// SecurityPolicy decides which security options functions may request.
+// Every container drops all capabilities and sets no-new-privileges
+// regardless of policy; the policy only governs what may be loosened.
+type SecurityPolicy struct {
+	// AllowedCapabilities may be re-added with capAdd ("ALL" permits any)
+	AllowedCapabilities []string
+	// AllowRoot permits runAsUser and runAsGroup 0/root
+	AllowRoot bool
+	// AllowUnconfined permits the "unconfined" seccomp and AppArmor profiles
+	AllowUnconfined bool
+	// AllowInlineSeccomp permits seccomp profiles supplied as JSON
+	AllowInlineSeccomp bool
+	// SeccompProfileDir holds named seccomp profiles as <name>.json
+	SeccompProfileDir string
+	// AllowedAppArmorProfiles lists loaded AppArmor profiles functions may use
+	AllowedAppArmorProfiles []string
+	// DefaultPidsLimit applies when a function does not set one (0 = unlimited)
+	DefaultPidsLimit int64
+	// MaxPidsLimit caps the pids limit a function may request (0 = no cap)
+	MaxPidsLimit int64
+	// AllowedBindPaths lists host directories that may be bind mounted as
+	// function volumes, including anything below them (empty permits none)
+	AllowedBindPaths []string
+}
+
+// DefaultSecurityPolicy returns the policy used when none is configured
+func DefaultSecurityPolicy() *SecurityPolicy {
+	return &SecurityPolicy{AllowedCapabilities: []string{"NET_BIND_SERVICE"}}
+}
+
+// Validate checks a security profile against the policy. Errors wrapping
+// ErrSecurityPolicy mean the profile is well formed but not permitted.
+func (p *SecurityPolicy) Validate(spec *faasTypes.FunctionSecurity) error {
+	if spec == nil {
+		return nil
+	}
+
+	if err := p.validateUser(spec); err != nil {
+		return err
+	}
+	if _, err := p.capabilities(spec.CapAdd); err != nil {
+		return err
+	}
+	if _, err := p.seccompOption(spec.Seccomp); err != nil {
+		return err
+	}
+	if _, err := p.apparmorOption(spec.AppArmor); err != nil {
+		return err
+	}
+	if spec.PidsLimit != nil {
+		if *spec.PidsLimit <= 0 {
+			return fmt.Errorf("pidsLimit must be greater than 0")
+		}
+		if p.MaxPidsLimit > 0 && *spec.PidsLimit > p.MaxPidsLimit {
+			return fmt.Errorf("pidsLimit %d exceeds the maximum of %d: %w", *spec.PidsLimit, p.MaxPidsLimit, ErrSecurityPolicy)
+		}
+	}
+	for _, ulimit := range spec.Ulimits {
+		if !validUlimits[ulimit.Name] {
+			return fmt.Errorf("unknown ulimit %q", ulimit.Name)
+		}
+		if ulimit.Soft < 0 || ulimit.Hard < 0 || ulimit.Soft > ulimit.Hard {
+			return fmt.Errorf("ulimit %s must have 0 <= soft <= hard", ulimit.Name)
+		}
+	}
+	for mountPath, options := range spec.Tmpfs {
+		if err := validateTmpfs(mountPath, options); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// apply sets the profile on the container configuration. The profile is
+// validated again so stored functions cannot bypass a tightened policy.
+func (p *SecurityPolicy) apply(config *container.Config, hostConfig *container.HostConfig, spec *faasTypes.FunctionSecurity) error {
+	if p.DefaultPidsLimit > 0 {
+		limit := p.DefaultPidsLimit
+		hostConfig.Resources.PidsLimit = &limit
+	}
+	if spec == nil {
+		return nil
+	}
+	if err := p.Validate(spec); err != nil {
+		return err
+	}
+
+	if spec.RunAsUser != "" {
+		config.User = spec.RunAsUser
+		if spec.RunAsGroup != "" {
+			config.User += ":" + spec.RunAsGroup
+		}
+	}
+
+	capAdd, _ := p.capabilities(spec.CapAdd)
+	hostConfig.CapAdd = append(hostConfig.CapAdd, capAdd...)
+
+	seccomp, err := p.seccompOption(spec.Seccomp)
+	if err != nil {
+		return err
+	}
+	if seccomp != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, seccomp)
+	}
+	apparmor, _ := p.apparmorOption(spec.AppArmor)
+	if apparmor != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, apparmor)
+	}
+
+	if spec.PidsLimit != nil {
+		limit := *spec.PidsLimit
+		hostConfig.Resources.PidsLimit = &limit
+	}
+	for _, ulimit := range spec.Ulimits {
+		hostConfig.Resources.Ulimits = append(hostConfig.Resources.Ulimits, &container.Ulimit{
+			Name: ulimit.Name,
+			Soft: ulimit.Soft,
+			Hard: ulimit.Hard,
+		})
+	}
+	if len(spec.Tmpfs) > 0 {
+		if hostConfig.Tmpfs == nil {
+			hostConfig.Tmpfs = make(map[string]string, len(spec.Tmpfs))
+		}
+		for mountPath, options := range spec.Tmpfs {
+			hostConfig.Tmpfs[path.Clean(mountPath)] = options
+		}
+	}
+	return nil
+}
+
+func (p *SecurityPolicy) validateUser(spec *faasTypes.FunctionSecurity) error {
+	if spec.RunAsGroup != "" && spec.RunAsUser == "" {
+		return fmt.Errorf("runAsGroup requires runAsUser")
+	}
+	for _, value := range []string{spec.RunAsUser, spec.RunAsGroup} {
+		if strings.ContainsAny(value, ": \t") {
+			return fmt.Errorf("invalid user or group %q", value)
+		}
+	}
+	if p.AllowRoot {
+		return nil
+	}
+	if spec.RunAsUser == "0" || spec.RunAsUser == "root" {
+		return fmt.Errorf("running as root: %w", ErrSecurityPolicy)
+	}
+	if spec.RunAsGroup == "0" || spec.RunAsGroup == "root" {
+		return fmt.Errorf("running with the root group: %w", ErrSecurityPolicy)
+	}
+	return nil
+}
+
+func (p *SecurityPolicy) capabilities(requested []string) ([]string, error) {
+	allowed := make(map[string]bool, len(p.AllowedCapabilities))
+	for _, capability := range p.AllowedCapabilities {
+		allowed[normalizeCapability(capability)] = true
+	}
+
+	capabilities := make([]string, 0, len(requested))
+	for _, capability := range requested {
+		name := normalizeCapability(capability)
+		if name == "" {
+			continue
+		}
+		if !allowed[name] && !allowed["ALL"] {
+			return nil, fmt.Errorf("capability %s: %w", name, ErrSecurityPolicy)
+		}
+		capabilities = append(capabilities, name)
+	}
+	return capabilities, nil
+}
+
+func normalizeCapability(capability string) string {
+	return strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(capability)), "CAP_")
+}
+
+// seccompOption returns the Docker security option for a seccomp profile:
+// the engine default, "unconfined", inline JSON, or a named profile file
+func (p *SecurityPolicy) seccompOption(profile string) (string, error) {
+	profile = strings.TrimSpace(profile)
+	switch {
+	case profile == "" || profile == seccompDefault:
+		return "", nil
+	case profile == profileUnconfined:
+		if !p.AllowUnconfined {
+			return "", fmt.Errorf("unconfined seccomp profile: %w", ErrSecurityPolicy)
+		}
+		return "seccomp=" + profileUnconfined, nil
+	case strings.HasPrefix(profile, "{"):
+		if !p.AllowInlineSeccomp {
+			return "", fmt.Errorf("inline seccomp profile: %w", ErrSecurityPolicy)
+		}
+		return compactSeccomp([]byte(profile))
+	}
+
+	if !profileNamePattern.MatchString(profile) {
+		return "", fmt.Errorf("invalid seccomp profile name %q", profile)
+	}
+	if p.SeccompProfileDir == "" {
+		return "", fmt.Errorf("seccomp profile %s: %w", profile, ErrSecurityPolicy)
+	}
+	data, err := os.ReadFile(filepath.Join(p.SeccompProfileDir, profile+".json"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("unknown seccomp profile %q", profile)
+		}
+		return "", fmt.Errorf("failed to read seccomp profile %s: %w", profile, err)
+	}
+	return compactSeccomp(data)
+}
+
+func compactSeccomp(data []byte) (string, error) {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return "", fmt.Errorf("invalid seccomp profile JSON: %w", err)
+	}
+	return "seccomp=" + buf.String(), nil
+}
+
+func (p *SecurityPolicy) apparmorOption(profile string) (string, error) {
+	profile = strings.TrimSpace(profile)
+	switch profile {
+	case "":
+		return "", nil
+	case apparmorDefault:
+		return "apparmor=" + apparmorDefault, nil
+	case profileUnconfined:
+		if !p.AllowUnconfined {
+			return "", fmt.Errorf("unconfined AppArmor profile: %w", ErrSecurityPolicy)
+		}
+		return "apparmor=" + profileUnconfined, nil
+	}
+
+	if !profileNamePattern.MatchString(profile) {
+		return "", fmt.Errorf("invalid AppArmor profile name %q", profile)
+	}
+	for _, allowed := range p.AllowedAppArmorProfiles {
+		if allowed == profile {
+			return "apparmor=" + profile, nil
+		}
+	}
+	return "", fmt.Errorf("AppArmor profile %s: %w", profile, ErrSecurityPolicy)
+}
+
+func validateTmpfs(mountPath, options string) error {
+	if !path.IsAbs(mountPath) || path.Clean(mountPath) == "/" {
+		return fmt.Errorf("tmpfs path %q must be an absolute path below /", mountPath)
+	}
+	if _, inside := mountRelativePath(secrets.ContainerSecretsPath, mountPath); inside {
+		return fmt.Errorf("tmpfs path %q overlaps the secrets mount", mountPath)
+	}
+	if options == "" {
+		return nil
+	}
+	for _, option := range strings.Split(options, ",") {
+		key, _, hasValue := strings.Cut(strings.TrimSpace(option), "=")
+		if hasValue && tmpfsOptions[key] || !hasValue && tmpfsFlags[key] {
+			continue
+		}
+		return fmt.Errorf("unsupported tmpfs option %q for %s", option, mountPath)
+	}
+	return nil
+}
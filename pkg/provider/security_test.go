@@ -0,0 +1,132 @@
+package provider
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func TestSecurityPolicy_Apply(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "strict.json"), []byte("{\n  \"defaultAction\": \"SCMP_ACT_ERRNO\"\n}\n"), 0600); err != nil {
+		t.Fatalf("write profile: %v", err)
+	}
+	policy := &SecurityPolicy{
+		AllowedCapabilities:     []string{"NET_BIND_SERVICE", "CHOWN"},
+		SeccompProfileDir:       dir,
+		AllowedAppArmorProfiles: []string{"faas-restricted"},
+		DefaultPidsLimit:        100,
+		MaxPidsLimit:            512,
+	}
+
+	pids := int64(256)
+	spec := &faasTypes.FunctionSecurity{
+		RunAsUser:  "1000",
+		RunAsGroup: "1000",
+		CapAdd:     []string{"cap_chown"},
+		Seccomp:    "strict",
+		AppArmor:   "faas-restricted",
+		PidsLimit:  &pids,
+		Ulimits:    []faasTypes.FunctionUlimit{{Name: "nofile", Soft: 1024, Hard: 2048}},
+		Tmpfs:      map[string]string{"/tmp/": "size=64m,noexec"},
+	}
+	config := &container.Config{}
+	hostConfig := &container.HostConfig{
+		SecurityOpt: []string{"no-new-privileges:true"},
+		CapDrop:     []string{"ALL"},
+	}
+	if err := policy.apply(config, hostConfig, spec); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	if config.User != "1000:1000" {
+		t.Fatalf("expected user 1000:1000, got %q", config.User)
+	}
+	if !reflect.DeepEqual([]string(hostConfig.CapDrop), []string{"ALL"}) || !reflect.DeepEqual([]string(hostConfig.CapAdd), []string{"CHOWN"}) {
+		t.Fatalf("unexpected capabilities: drop=%v add=%v", hostConfig.CapDrop, hostConfig.CapAdd)
+	}
+	expectedOpts := []string{
+		"no-new-privileges:true",
+		`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`,
+		"apparmor=faas-restricted",
+	}
+	if !reflect.DeepEqual(hostConfig.SecurityOpt, expectedOpts) {
+		t.Fatalf("unexpected security options: %v", hostConfig.SecurityOpt)
+	}
+	if hostConfig.PidsLimit == nil || *hostConfig.PidsLimit != 256 {
+		t.Fatalf("expected pids limit 256, got %v", hostConfig.PidsLimit)
+	}
+	if len(hostConfig.Ulimits) != 1 || hostConfig.Ulimits[0].Name != "nofile" || hostConfig.Ulimits[0].Hard != 2048 {
+		t.Fatalf("unexpected ulimits: %v", hostConfig.Ulimits)
+	}
+	if hostConfig.Tmpfs["/tmp"] != "size=64m,noexec" {
+		t.Fatalf("unexpected tmpfs: %v", hostConfig.Tmpfs)
+	}
+
+	defaults := &container.HostConfig{}
+	if err := policy.apply(&container.Config{}, defaults, nil); err != nil {
+		t.Fatalf("apply without profile: %v", err)
+	}
+	if defaults.PidsLimit == nil || *defaults.PidsLimit != 100 {
+		t.Fatalf("expected default pids limit, got %v", defaults.PidsLimit)
+	}
+}
+
+func TestSecurityPolicy_Validate(t *testing.T) {
+	policy := DefaultSecurityPolicy()
+	policy.MaxPidsLimit = 128
+	tooMany := int64(1000)
+	zero := int64(0)
+
+	forbidden := []*faasTypes.FunctionSecurity{
+		{RunAsUser: "root"},
+		{RunAsUser: "1000", RunAsGroup: "0"},
+		{RunAsUser: "1000", RunAsGroup: "root"},
+		{CapAdd: []string{"SYS_ADMIN"}},
+		{Seccomp: "unconfined"},
+		{Seccomp: `{"defaultAction":"SCMP_ACT_ALLOW"}`},
+		{Seccomp: "custom"},
+		{AppArmor: "unconfined"},
+		{AppArmor: "custom"},
+		{PidsLimit: &tooMany},
+	}
+	for _, spec := range forbidden {
+		if err := policy.Validate(spec); !errors.Is(err, ErrSecurityPolicy) {
+			t.Fatalf("expected policy error for %+v, got %v", spec, err)
+		}
+	}
+
+	invalid := []*faasTypes.FunctionSecurity{
+		{RunAsGroup: "1000"},
+		{RunAsUser: "1000:0"},
+		{Seccomp: "../etc/profile"},
+		{PidsLimit: &zero},
+		{Ulimits: []faasTypes.FunctionUlimit{{Name: "bogus", Soft: 1, Hard: 1}}},
+		{Ulimits: []faasTypes.FunctionUlimit{{Name: "nofile", Soft: 10, Hard: 1}}},
+		{Tmpfs: map[string]string{"/": ""}},
+		{Tmpfs: map[string]string{"/var/openfaas/secrets": ""}},
+		{Tmpfs: map[string]string{"/tmp": "size=1m,suid,bind"}},
+	}
+	for _, spec := range invalid {
+		err := policy.Validate(spec)
+		if err == nil || errors.Is(err, ErrSecurityPolicy) {
+			t.Fatalf("expected validation error for %+v, got %v", spec, err)
+		}
+	}
+
+	allowed := &faasTypes.FunctionSecurity{RunAsUser: "app", CapAdd: []string{"NET_BIND_SERVICE"}, Seccomp: "default", AppArmor: "docker-default"}
+	if err := policy.Validate(allowed); err != nil {
+		t.Fatalf("expected profile to be allowed: %v", err)
+	}
+
+	policy.AllowRoot = true
+	if err := policy.Validate(&faasTypes.FunctionSecurity{RunAsUser: "0", RunAsGroup: "0"}); err != nil {
+		t.Fatalf("expected root to be allowed by the policy: %v", err)
+	}
+}
@@ -0,0 +1,454 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/network"
+	"github.com/sirupsen/logrus"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// Reconciliation actions reported in ReconcileReport
+	ReconcileActionCreate        = "create"
+	ReconcileActionRemove        = "remove"
+	ReconcileActionRecreate      = "recreate"
+	ReconcileActionRemoveNetwork = "remove-network"
+
+	// defaultReconcileGracePeriod leaves recently changed functions alone
+	defaultReconcileGracePeriod = 30 * time.Second
+)
+
+// DesiredFunction is a function as recorded in the store
+type DesiredFunction struct {
+	Deployment *faasTypes.FunctionDeployment
+	Replicas   int
+}
+
+// DesiredStateFunc returns the functions that should be running
+type DesiredStateFunc func() ([]DesiredFunction, error)
+
+// StateReconcilerOptions configures a StateReconciler
+type StateReconcilerOptions struct {
+	Interval      time.Duration // 0 disables periodic passes
+	GracePeriod   time.Duration // skip functions changed more recently than this
+	RemoveOrphans bool
+}
+
+// StateReconciler repairs drift between the stored functions and their
+// containers: it recreates missing or exited replicas, removes excess ones,
+// recreates containers whose image or configuration no longer matches, and
+// removes containers and networks of functions that are not in the store.
+type StateReconciler struct {
+	provider *DockerProvider
+	desired  DesiredStateFunc
+	options  StateReconcilerOptions
+	logger   *logrus.Logger
+
+	mu     sync.Mutex // one pass at a time
+	stopCh chan struct{}
+	wg     sync.WaitGroup
+}
+
+// reconcileStep is a planned action with what is needed to carry it out
+type reconcileStep struct {
+	action       faasTypes.ReconcileAction
+	deployment   *faasTypes.FunctionDeployment
+	summary      container.Summary
+	replicaIndex int
+}
+
+// NewStateReconciler creates a reconciler for the Docker provider
+func NewStateReconciler(p *DockerProvider, desired DesiredStateFunc, options StateReconcilerOptions, logger *logrus.Logger) *StateReconciler {
+	if options.GracePeriod <= 0 {
+		options.GracePeriod = defaultReconcileGracePeriod
+	}
+	return &StateReconciler{
+		provider: p,
+		desired:  desired,
+		options:  options,
+		logger:   logger,
+		stopCh:   make(chan struct{}),
+	}
+}
+
+// Reconcile compares the desired and actual state and, unless dryRun is set,
+// applies the repairs. Failed repairs are reported on their action.
+func (r *StateReconciler) Reconcile(ctx context.Context, dryRun bool) (*faasTypes.ReconcileReport, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := &faasTypes.ReconcileReport{
+		DryRun:    dryRun,
+		StartedAt: time.Now(),
+		Actions:   []faasTypes.ReconcileAction{},
+	}
+
+	desired, err := r.desired()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load functions: %w", err)
+	}
+	containers, err := r.provider.client.ContainerList(ctx, container.ListOptions{
+		All:     true,
+		Filters: filters.NewArgs(filters.Arg("label", LabelFunction)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+	networks, err := r.provider.client.NetworkList(ctx, network.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelNetworkType+"=function")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list networks: %w", err)
+	}
+
+	busy := func(functionName string) bool {
+		return r.provider.activity.changedWithin(functionName, r.options.GracePeriod)
+	}
+	steps, skipped := planReconcile(desired, containers, networks, busy, r.options.RemoveOrphans)
+	report.Skipped = skipped
+
+	pulled := make(map[string]bool)
+	touched := make(map[string]bool)
+	for _, step := range steps {
+		if !dryRun {
+			if err := r.apply(ctx, step, pulled); err != nil {
+				step.action.Error = err.Error()
+				r.logger.Warnf("Reconciliation failed to %s %s for %s: %v", step.action.Action, step.action.Container+step.action.Network, step.action.Function, err)
+			} else {
+				r.logger.Infof("Reconciliation: %s %s for %s (%s)", step.action.Action, step.action.Container+step.action.Network, step.action.Function, step.action.Reason)
+			}
+			touched[step.action.Function] = true
+		}
+		report.Actions = append(report.Actions, step.action)
+	}
+	for functionName := range touched {
+		r.provider.syncWatcher(ctx, functionName)
+	}
+
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+	return report, nil
+}
+
+// apply carries out one step; images are ensured once per function
+func (r *StateReconciler) apply(ctx context.Context, step reconcileStep, pulled map[string]bool) error {
+	p := r.provider
+	switch step.action.Action {
+	case ReconcileActionRemove:
+		return p.retireContainers(ctx, step.action.Function, []container.Summary{step.summary})
+	case ReconcileActionRemoveNetwork:
+		return p.CleanupFunctionNetwork(ctx, step.action.Function, step.action.Network)
+	case ReconcileActionRecreate:
+		if err := p.retireContainers(ctx, step.action.Function, []container.Summary{step.summary}); err != nil {
+			return err
+		}
+	}
+
+	if !pulled[step.deployment.Service] {
+		if err := p.ensureImage(ctx, step.deployment); err != nil {
+			return err
+		}
+		pulled[step.deployment.Service] = true
+	}
+	return p.createContainer(ctx, step.deployment, step.action.Container, step.replicaIndex)
+}
+
+// planReconcile works out the repairs for the given state. Functions for
+// which busy reports true are skipped, as are their orphans.
+func planReconcile(desired []DesiredFunction, containers []container.Summary, networks []network.Summary, busy func(string) bool, removeOrphans bool) ([]reconcileStep, []string) {
+	byFunction := make(map[string][]container.Summary)
+	for _, c := range containers {
+		if functionName := c.Labels[LabelFunction]; functionName != "" {
+			byFunction[functionName] = append(byFunction[functionName], c)
+		}
+	}
+
+	sort.Slice(desired, func(i, j int) bool { return desired[i].Deployment.Service < desired[j].Deployment.Service })
+	known := make(map[string]bool, len(desired))
+	steps := make([]reconcileStep, 0)
+	skipped := make([]string, 0)
+
+	for _, fn := range desired {
+		deployment := fn.Deployment
+		known[deployment.Service] = true
+		if busy(deployment.Service) {
+			skipped = append(skipped, deployment.Service)
+			continue
+		}
+		steps = append(steps, planFunction(deployment, fn.Replicas, byFunction[deployment.Service])...)
+	}
+
+	if !removeOrphans {
+		return steps, skipped
+	}
+
+	orphans := make([]string, 0)
+	for functionName := range byFunction {
+		if !known[functionName] && !busy(functionName) {
+			orphans = append(orphans, functionName)
+		}
+	}
+	sort.Strings(orphans)
+	for _, functionName := range orphans {
+		for _, c := range byFunction[functionName] {
+			steps = append(steps, reconcileStep{
+				action: faasTypes.ReconcileAction{
+					Action:    ReconcileActionRemove,
+					Function:  functionName,
+					Container: containerSummaryName(c),
+					Reason:    "function is not deployed",
+				},
+				summary: c,
+			})
+		}
+	}
+
+	sort.Slice(networks, func(i, j int) bool { return networks[i].Name < networks[j].Name })
+	for _, n := range networks {
+		functionName := n.Labels[LabelNetworkFunction]
+		if functionName == "" || known[functionName] || busy(functionName) {
+			continue
+		}
+		steps = append(steps, reconcileStep{
+			action: faasTypes.ReconcileAction{
+				Action:   ReconcileActionRemoveNetwork,
+				Function: functionName,
+				Network:  n.Name,
+				Reason:   "function is not deployed",
+			},
+		})
+	}
+
+	return steps, skipped
+}
+
+// planFunction works out the repairs for one stored function
+func planFunction(deployment *faasTypes.FunctionDeployment, replicas int, containers []container.Summary) []reconcileStep {
+	steps := make([]reconcileStep, 0)
+	remove := func(c container.Summary, reason string) {
+		steps = append(steps, reconcileStep{
+			action: faasTypes.ReconcileAction{
+				Action:    ReconcileActionRemove,
+				Function:  deployment.Service,
+				Container: containerSummaryName(c),
+				Reason:    reason,
+			},
+			summary: c,
+		})
+	}
+
+	plan := buildReplicaScalePlan(containers, replicas)
+	removed := make(map[string]bool)
+	for _, c := range plan.staleToRemove {
+		removed[c.ID] = true
+		remove(c, fmt.Sprintf("container is %s", c.State))
+	}
+	for _, c := range plan.activeToRemove {
+		removed[c.ID] = true
+		remove(c, "excess replica")
+	}
+
+	hash := deploymentHash(deployment)
+	for _, c := range containers {
+		if removed[c.ID] {
+			continue
+		}
+		replicaIndex, ok := containerReplicaIndex(c)
+		if !ok {
+			continue
+		}
+		if reason := containerDrift(c, deployment, hash); reason != "" {
+			steps = append(steps, reconcileStep{
+				action: faasTypes.ReconcileAction{
+					Action:    ReconcileActionRecreate,
+					Function:  deployment.Service,
+					Container: containerSummaryName(c),
+					Reason:    reason,
+				},
+				deployment:   deployment,
+				summary:      c,
+				replicaIndex: replicaIndex,
+			})
+		}
+	}
+
+	for _, replicaIndex := range plan.missingReplicaIndices {
+		steps = append(steps, reconcileStep{
+			action: faasTypes.ReconcileAction{
+				Action:    ReconcileActionCreate,
+				Function:  deployment.Service,
+				Container: fmt.Sprintf("%s-%d", deployment.Service, replicaIndex),
+				Reason:    "missing replica",
+			},
+			deployment:   deployment,
+			replicaIndex: replicaIndex,
+		})
+	}
+
+	return steps
+}
+
+// containerDrift explains how a container differs from its deployment.
+// Containers created before configuration hashes were recorded are only
+// checked for their image.
+func containerDrift(c container.Summary, deployment *faasTypes.FunctionDeployment, hash string) string {
+	if c.Image != deployment.Image {
+		return fmt.Sprintf("image is %s, want %s", c.Image, deployment.Image)
+	}
+	if recorded, ok := c.Labels[LabelConfigHash]; ok && recorded != hash {
+		return "configuration changed"
+	}
+	return ""
+}
+
+// deploymentHash fingerprints the parts of a deployment that shape its
+// containers, so configuration drift can be detected from a label
+func deploymentHash(deployment *faasTypes.FunctionDeployment) string {
+	fingerprint := struct {
+		Image      string
+		Network    string
+		EnvProcess string
+		EnvVars    map[string]string
+		Labels     map[string]string
+		Secrets    []string
+		Limits     *faasTypes.FunctionLimits
+		Requests   *faasTypes.FunctionResources
+		ReadOnly   bool
+		Debug      bool
+		Security   *faasTypes.FunctionSecurity
+		Volumes    []faasTypes.FunctionVolume `json:",omitempty"`
+		Drain      string                     `json:",omitempty"`
+		StopSignal string                     `json:",omitempty"`
+		StopTime   string                     `json:",omitempty"`
+	}{
+		Image:      deployment.Image,
+		Network:    deployment.Network,
+		EnvProcess: deployment.EnvProcess,
+		Limits:     deployment.Limits,
+		Requests:   deployment.Requests,
+		ReadOnly:   deployment.ReadOnlyRootFilesystem,
+		Debug:      deployment.Debug,
+		Security:   deployment.Security,
+		Volumes:    deployment.Volumes,
+		Drain:      deployment.Annotations[AnnotationDrainGracePeriod],
+		StopSignal: deployment.Annotations[AnnotationStopSignal],
+		StopTime:   deployment.Annotations[AnnotationStopTimeout],
+	}
+	// Empty and missing collections describe the same container
+	if len(deployment.EnvVars) > 0 {
+		fingerprint.EnvVars = deployment.EnvVars
+	}
+	if len(deployment.Labels) > 0 {
+		fingerprint.Labels = deployment.Labels
+	}
+	if len(deployment.Secrets) > 0 {
+		fingerprint.Secrets = deployment.Secrets
+	}
+
+	data, _ := json.Marshal(fingerprint)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// StartPeriodic runs a reconciliation pass every interval until ctx is
+// cancelled or Stop is called
+func (r *StateReconciler) StartPeriodic(ctx context.Context) {
+	if r.options.Interval <= 0 {
+		return
+	}
+
+	r.wg.Add(1)
+	go func() {
+		defer r.wg.Done()
+		ticker := time.NewTicker(r.options.Interval)
+		defer ticker.Stop()
+
+		r.logger.Infof("Function reconciliation started (interval: %s)", r.options.Interval)
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.stopCh:
+				return
+			case <-ticker.C:
+				if _, err := r.Reconcile(ctx, false); err != nil {
+					r.logger.Errorf("Periodic function reconciliation failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// Stop terminates the periodic reconciliation loop
+func (r *StateReconciler) Stop() {
+	close(r.stopCh)
+	r.wg.Wait()
+}
+
+// functionActivity records when the provider last changed each function, so
+// reconciliation does not race deploys, updates and scaling in progress
+type functionActivity struct {
+	mu      sync.Mutex
+	active  map[string]int
+	changed map[string]time.Time
+}
+
+func newFunctionActivity() *functionActivity {
+	return &functionActivity{
+		active:  make(map[string]int),
+		changed: make(map[string]time.Time),
+	}
+}
+
+// begin marks a change to a function as started; the returned func ends it
+func (a *functionActivity) begin(functionName string) func() {
+	if a == nil {
+		return func() {}
+	}
+	a.mu.Lock()
+	a.active[functionName]++
+	a.changed[functionName] = time.Now()
+	a.mu.Unlock()
+
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.active[functionName]--; a.active[functionName] <= 0 {
+			delete(a.active, functionName)
+		}
+		a.changed[functionName] = time.Now()
+	}
+}
+
+// changedWithin reports whether a function is being changed or was changed
+// within the given period
+func (a *functionActivity) changedWithin(functionName string, period time.Duration) bool {
+	if a == nil {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.active[functionName] > 0 {
+		return true
+	}
+	changed, ok := a.changed[functionName]
+	if !ok {
+		return false
+	}
+	if time.Since(changed) >= period {
+		delete(a.changed, functionName)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+package provider
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func replicaSummary(deployment *faasTypes.FunctionDeployment, replica int, state string) container.Summary {
+	name := fmt.Sprintf("%s-%d", deployment.Service, replica)
+	return container.Summary{
+		ID:    name + "-id",
+		Names: []string{"/" + name},
+		Image: deployment.Image,
+		State: state,
+		Labels: map[string]string{
+			LabelFunction:   deployment.Service,
+			LabelReplica:    fmt.Sprintf("%d", replica),
+			LabelConfigHash: deploymentHash(deployment),
+		},
+	}
+}
+
+func describeSteps(steps []reconcileStep) string {
+	lines := make([]string, 0, len(steps))
+	for _, step := range steps {
+		lines = append(lines, step.action.Action+" "+step.action.Container+step.action.Network)
+	}
+	return strings.Join(lines, ", ")
+}
+
+func TestPlanReconcile(t *testing.T) {
+	api := &faasTypes.FunctionDeployment{Service: "api", Image: "acme/api:2", EnvVars: map[string]string{"MODE": "prod"}}
+	worker := &faasTypes.FunctionDeployment{Service: "worker", Image: "acme/worker:1"}
+	desired := []DesiredFunction{
+		{Deployment: worker, Replicas: 1},
+		{Deployment: api, Replicas: 3},
+	}
+
+	oldImage := replicaSummary(api, 1, "running")
+	oldImage.Image = "acme/api:1"
+	oldConfig := replicaSummary(&faasTypes.FunctionDeployment{Service: "api", Image: "acme/api:2"}, 2, "running")
+	gone := &faasTypes.FunctionDeployment{Service: "gone", Image: "acme/gone:1"}
+
+	containers := []container.Summary{
+		replicaSummary(api, 0, "exited"),
+		oldImage,
+		oldConfig,
+		replicaSummary(worker, 0, "running"),
+		replicaSummary(worker, 1, "running"),
+		replicaSummary(gone, 0, "running"),
+	}
+	networks := []network.Summary{
+		{Name: "faas-api", Labels: map[string]string{LabelNetworkFunction: "api"}},
+		{Name: "faas-gone", Labels: map[string]string{LabelNetworkFunction: "gone"}},
+	}
+	idle := func(string) bool { return false }
+
+	steps, skipped := planReconcile(desired, containers, networks, idle, true)
+	expected := "remove api-0, recreate api-1, recreate api-2, create api-0, remove worker-1, remove gone-0, remove-network faas-gone"
+	if got := describeSteps(steps); got != expected || len(skipped) != 0 {
+		t.Fatalf("unexpected plan:\n got: %s\nwant: %s (skipped %v)", got, expected, skipped)
+	}
+	if !strings.Contains(steps[1].action.Reason, "acme/api:1") || steps[2].action.Reason != "configuration changed" {
+		t.Fatalf("unexpected drift reasons: %q, %q", steps[1].action.Reason, steps[2].action.Reason)
+	}
+	if steps[3].replicaIndex != 0 || steps[3].deployment != api {
+		t.Fatalf("expected the exited replica to be replaced, got %+v", steps[3])
+	}
+
+	// Functions being changed are left alone, and orphans are kept when disabled
+	busy := func(name string) bool { return name == "api" }
+	steps, skipped = planReconcile(desired, containers, networks, busy, false)
+	if got := describeSteps(steps); got != "remove worker-1" || len(skipped) != 1 || skipped[0] != "api" {
+		t.Fatalf("unexpected plan for busy function: %s (skipped %v)", got, skipped)
+	}
+}
+
+func TestPlanReconcile_IgnoresContainersWithoutConfigHash(t *testing.T) {
+	api := &faasTypes.FunctionDeployment{Service: "api", Image: "acme/api:1", EnvVars: map[string]string{"A": "1"}}
+	legacy := replicaSummary(api, 0, "running")
+	delete(legacy.Labels, LabelConfigHash)
+
+	steps, _ := planReconcile([]DesiredFunction{{Deployment: api, Replicas: 1}}, []container.Summary{legacy}, nil, func(string) bool { return false }, true)
+	if len(steps) != 0 {
+		t.Fatalf("expected no repairs for a container without a config hash, got %s", describeSteps(steps))
+	}
+}
+
+func TestDeploymentHash(t *testing.T) {
+	base := &faasTypes.FunctionDeployment{Service: "api", Image: "acme/api:1"}
+	same := &faasTypes.FunctionDeployment{
+		Service:     "api",
+		Image:       "acme/api:1",
+		EnvVars:     map[string]string{},
+		Annotations: map[string]string{"com.docker-faas.max-inflight": "4"},
+		PullPolicy:  PullPolicyAlways,
+	}
+	if deploymentHash(base) != deploymentHash(same) {
+		t.Fatalf("expected empty env vars, annotations and pull policy not to change the hash")
+	}
+	changed := &faasTypes.FunctionDeployment{Service: "api", Image: "acme/api:1", ReadOnlyRootFilesystem: true}
+	if deploymentHash(base) == deploymentHash(changed) {
+		t.Fatalf("expected container settings to change the hash")
+	}
+}
+
+func TestFunctionActivity(t *testing.T) {
+	activity := newFunctionActivity()
+	if activity.changedWithin("api", time.Minute) {
+		t.Fatalf("expected unknown function to be idle")
+	}
+
+	end := activity.begin("api")
+	if !activity.changedWithin("api", 0) {
+		t.Fatalf("expected function to be busy while a change is in progress")
+	}
+	end()
+	if !activity.changedWithin("api", time.Minute) {
+		t.Fatalf("expected recently changed function to be busy")
+	}
+	if activity.changedWithin("api", 0) {
+		t.Fatalf("expected function to be idle once the grace period passed")
+	}
+
+	var disabled *functionActivity
+	disabled.begin("api")()
+	if disabled.changedWithin("api", time.Minute) {
+		t.Fatalf("expected nil activity to report idle")
+	}
+}
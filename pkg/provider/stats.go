@@ -0,0 +1,99 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/docker/docker/api/types/container"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// statsAPI is the subset of the Docker client used to read container stats
+type statsAPI interface {
+	ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error)
+}
+
+// StatsReader reads the resource usage of function replicas from Docker
+type StatsReader struct {
+	api statsAPI
+}
+
+// NewStatsReader creates a stats reader using a Docker client
+func NewStatsReader(api statsAPI) *StatsReader {
+	return &StatsReader{api: api}
+}
+
+// ReplicaStats samples a replica's usage. Docker takes two readings about a
+// second apart, so the CPU percentage covers that interval.
+func (r *StatsReader) ReplicaStats(ctx context.Context, c *faasTypes.Container) (*faasTypes.ReplicaStats, error) {
+	resp, err := r.api.ContainerStats(ctx, c.ID, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stats of %s: %w", c.Name, err)
+	}
+	defer resp.Body.Close()
+
+	var v container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, fmt.Errorf("failed to decode stats of %s: %w", c.Name, err)
+	}
+	stats := replicaStats(c, v)
+	return &stats, nil
+}
+
+// replicaStats computes usage the way `docker stats` does
+func replicaStats(c *faasTypes.Container, v container.StatsResponse) faasTypes.ReplicaStats {
+	stats := faasTypes.ReplicaStats{
+		Replica:     c.Name,
+		ContainerID: c.ID,
+		Timestamp:   v.Read,
+		CPUPercent:  cpuPercent(v),
+		MemoryUsage: memoryUsage(v.MemoryStats),
+		MemoryLimit: v.MemoryStats.Limit,
+		PIDs:        v.PidsStats.Current,
+	}
+	if stats.MemoryLimit > 0 {
+		stats.MemoryPercent = float64(stats.MemoryUsage) / float64(stats.MemoryLimit) * 100
+	}
+	for _, network := range v.Networks {
+		stats.NetworkRxBytes += network.RxBytes
+		stats.NetworkTxBytes += network.TxBytes
+	}
+	for _, entry := range v.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(entry.Op) {
+		case "read":
+			stats.BlockReadBytes += entry.Value
+		case "write":
+			stats.BlockWriteBytes += entry.Value
+		}
+	}
+	return stats
+}
+
+// cpuPercent is the container's share of host CPU time between the two
+// readings, scaled so each fully used CPU counts 100
+func cpuPercent(v container.StatsResponse) float64 {
+	cpuDelta := float64(v.CPUStats.CPUUsage.TotalUsage) - float64(v.PreCPUStats.CPUUsage.TotalUsage)
+	systemDelta := float64(v.CPUStats.SystemUsage) - float64(v.PreCPUStats.SystemUsage)
+	if cpuDelta <= 0 || systemDelta <= 0 {
+		return 0
+	}
+	cpus := float64(v.CPUStats.OnlineCPUs)
+	if cpus == 0 {
+		cpus = float64(len(v.CPUStats.CPUUsage.PercpuUsage))
+	}
+	return cpuDelta / systemDelta * cpus * 100
+}
+
+// memoryUsage excludes inactive page cache, which the kernel reclaims before
+// the container is OOM killed (cgroup v1 and v2 name it differently)
+func memoryUsage(m container.MemoryStats) uint64 {
+	for _, key := range []string{"total_inactive_file", "inactive_file"} {
+		if inactive, ok := m.Stats[key]; ok && inactive < m.Usage {
+			return m.Usage - inactive
+		}
+	}
+	return m.Usage
+}
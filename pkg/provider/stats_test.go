@@ -0,0 +1,66 @@
+package provider
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeStatsAPI struct {
+	body string
+}
+
+func (f *fakeStatsAPI) ContainerStats(ctx context.Context, containerID string, stream bool) (container.StatsResponseReader, error) {
+	return container.StatsResponseReader{Body: io.NopCloser(strings.NewReader(f.body)), OSType: "linux"}, nil
+}
+
+func TestStatsReader_ReplicaStats(t *testing.T) {
+	api := &fakeStatsAPI{body: `{
+		"read": "2026-10-18T09:00:00Z",
+		"cpu_stats": {"cpu_usage": {"total_usage": 3000000000}, "system_cpu_usage": 20000000000, "online_cpus": 4},
+		"precpu_stats": {"cpu_usage": {"total_usage": 1000000000}, "system_cpu_usage": 10000000000},
+		"memory_stats": {"usage": 104857600, "limit": 268435456, "stats": {"inactive_file": 20971520}},
+		"pids_stats": {"current": 7},
+		"networks": {"eth0": {"rx_bytes": 1000, "tx_bytes": 2000}, "eth1": {"rx_bytes": 10, "tx_bytes": 20}},
+		"blkio_stats": {"io_service_bytes_recursive": [
+			{"major": 8, "minor": 0, "op": "read", "value": 4096},
+			{"major": 8, "minor": 0, "op": "write", "value": 8192},
+			{"major": 8, "minor": 16, "op": "Read", "value": 1}
+		]}
+	}`}
+
+	stats, err := NewStatsReader(api).ReplicaStats(context.Background(), &faasTypes.Container{ID: "abc", Name: "api-1"})
+	if err != nil {
+		t.Fatalf("replica stats: %v", err)
+	}
+
+	// 2s of CPU time over 10s of host time on 4 CPUs
+	if stats.CPUPercent != 80 {
+		t.Fatalf("expected 80%% CPU, got %v", stats.CPUPercent)
+	}
+	if stats.MemoryUsage != 80<<20 || stats.MemoryLimit != 256<<20 || stats.MemoryPercent != 31.25 {
+		t.Fatalf("expected page cache to be excluded from memory usage, got %+v", stats)
+	}
+	if stats.NetworkRxBytes != 1010 || stats.NetworkTxBytes != 2020 {
+		t.Fatalf("expected network I/O summed over interfaces, got %+v", stats)
+	}
+	if stats.BlockReadBytes != 4097 || stats.BlockWriteBytes != 8192 || stats.PIDs != 7 {
+		t.Fatalf("unexpected block I/O or pids: %+v", stats)
+	}
+	if stats.Replica != "api-1" || stats.ContainerID != "abc" || stats.Timestamp.IsZero() {
+		t.Fatalf("unexpected replica identity: %+v", stats)
+	}
+}
+
+func TestCPUPercent_NoPreviousReading(t *testing.T) {
+	v := container.StatsResponse{CPUStats: container.CPUStats{CPUUsage: container.CPUUsage{TotalUsage: 100}, SystemUsage: 1000, OnlineCPUs: 2}}
+	v.PreCPUStats = v.CPUStats
+	if percent := cpuPercent(v); percent != 0 {
+		t.Fatalf("expected 0%% without a CPU delta, got %v", percent)
+	}
+}
@@ -0,0 +1,811 @@
+package provider
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+	"github.com/docker/docker/errdefs"
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/registryauth"
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// LabelSecret is the label key holding the function secret name a Swarm secret backs
+	LabelSecret = "com.docker-faas.secret"
+
+	// maxSwarmSecretName is the longest name Swarm accepts for a secret
+	maxSwarmSecretName = 64
+	// taskShutdownTimeout bounds how long removal waits for tasks to stop
+	taskShutdownTimeout = 15 * time.Second
+)
+
+// SwarmOptions configures how services are rolled out
+type SwarmOptions struct {
+	// UpdateParallelism is how many tasks are replaced at once (0 replaces all)
+	UpdateParallelism uint64
+	// UpdateDelay is the pause between batches
+	UpdateDelay time.Duration
+	// UpdateMonitor is how long a new task is watched for failure
+	UpdateMonitor time.Duration
+	// UpdateFailureAction is pause, continue or rollback
+	UpdateFailureAction string
+	// UpdateOrder is stop-first or start-first
+	UpdateOrder string
+}
+
+// Validate checks the rolling update settings
+func (o SwarmOptions) Validate() error {
+	switch o.UpdateFailureAction {
+	case swarm.UpdateFailureActionPause, swarm.UpdateFailureActionContinue, swarm.UpdateFailureActionRollback:
+	default:
+		return fmt.Errorf("invalid update failure action %q: must be pause, continue or rollback", o.UpdateFailureAction)
+	}
+	switch o.UpdateOrder {
+	case swarm.UpdateOrderStopFirst, swarm.UpdateOrderStartFirst:
+	default:
+		return fmt.Errorf("invalid update order %q: must be stop-first or start-first", o.UpdateOrder)
+	}
+	if o.UpdateDelay < 0 || o.UpdateMonitor < 0 {
+		return fmt.Errorf("update delay and monitor must not be negative")
+	}
+	return nil
+}
+
+// SwarmProvider runs functions as Docker Swarm services. Networks are
+// attachable overlays and secrets are Swarm secrets; everything else is
+// shared with the Docker provider.
+type SwarmProvider struct {
+	*DockerProvider
+	opts SwarmOptions
+}
+
+// NewSwarmProvider creates a provider that talks to a Swarm manager
+func NewSwarmProvider(dockerHost, networkName string, opts SwarmOptions, logger *logrus.Logger) (*SwarmProvider, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	docker, err := newDockerProvider(dockerHost, networkName, "", "overlay", logger)
+	if err != nil {
+		return nil, err
+	}
+	return &SwarmProvider{DockerProvider: docker, opts: opts}, nil
+}
+
+// HealthCheck validates that the daemon is reachable and is a Swarm manager
+func (p *SwarmProvider) HealthCheck(ctx context.Context) error {
+	info, err := p.client.Info(ctx)
+	if err != nil {
+		return err
+	}
+	if info.Swarm.LocalNodeState != swarm.LocalNodeStateActive || !info.Swarm.ControlAvailable {
+		return fmt.Errorf("docker node is not an active swarm manager")
+	}
+	return nil
+}
+
+// DeployFunction creates the function's service, or rolls out the new spec
+// when the service already exists
+func (p *SwarmProvider) DeployFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) error {
+	p.logger.Infof("Deploying swarm service: %s with %d replicas", deployment.Service, replicas)
+
+	existing, found, err := p.findService(ctx, deployment.Service)
+	if err != nil {
+		return err
+	}
+	spec, err := p.serviceSpec(ctx, deployment, replicas)
+	if err != nil {
+		return err
+	}
+
+	auth, err := p.registryLogin(deployment.Image)
+	if err != nil {
+		return err
+	}
+	// Nodes pull the image themselves; Never skips resolving the tag to a
+	// digest so only images already on the nodes are used
+	queryRegistry := pullPolicy(deployment) != PullPolicyNever
+
+	if found {
+		return p.updateService(ctx, existing, spec, auth, queryRegistry)
+	}
+	options := swarm.ServiceCreateOptions{QueryRegistry: queryRegistry}
+	if auth != nil {
+		options.EncodedRegistryAuth = auth.Encoded
+	}
+	response, err := p.client.ServiceCreate(ctx, spec, options)
+	if err != nil {
+		return fmt.Errorf("failed to create service: %w", err)
+	}
+	for _, warning := range response.Warnings {
+		p.logger.Warnf("Service %s: %s", spec.Name, warning)
+	}
+	p.logger.Infof("Service created: %s", deployment.Service)
+	return nil
+}
+
+// UpdateFunction rolls out a new spec using the configured update policy
+func (p *SwarmProvider) UpdateFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) error {
+	return p.DeployFunction(ctx, deployment, replicas)
+}
+
+func (p *SwarmProvider) updateService(ctx context.Context, existing swarm.Service, spec swarm.ServiceSpec, auth *registryauth.Auth, queryRegistry bool) error {
+	options := swarm.ServiceUpdateOptions{QueryRegistry: queryRegistry}
+	if auth != nil {
+		options.EncodedRegistryAuth = auth.Encoded
+	}
+	response, err := p.client.ServiceUpdate(ctx, existing.ID, existing.Version, spec, options)
+	if err != nil {
+		return fmt.Errorf("failed to update service: %w", err)
+	}
+	for _, warning := range response.Warnings {
+		p.logger.Warnf("Service %s: %s", spec.Name, warning)
+	}
+
+	keep := make(map[string]bool)
+	for _, ref := range spec.TaskTemplate.ContainerSpec.Secrets {
+		keep[ref.SecretName] = true
+	}
+	// Secrets the previous tasks still use are removed on the next update
+	p.pruneSwarmSecrets(ctx, spec.Name, keep)
+	p.logger.Infof("Service updated: %s", spec.Name)
+	return nil
+}
+
+// RemoveFunction removes the function's service and its Swarm secrets
+func (p *SwarmProvider) RemoveFunction(ctx context.Context, functionName string) error {
+	p.logger.Infof("Removing swarm service: %s", functionName)
+
+	service, found, err := p.findService(ctx, functionName)
+	if err != nil {
+		return err
+	}
+	if found {
+		drained := p.drainTasks(ctx, functionName, service)
+		// Finish removing the drained service even if the caller gave up
+		removeCtx := context.WithoutCancel(ctx)
+		err := p.client.ServiceRemove(removeCtx, service.ID)
+		if err == nil || errdefs.IsNotFound(err) {
+			p.waitForTasksGone(removeCtx, service.ID)
+		}
+		if p.drainer != nil {
+			for _, id := range drained {
+				p.drainer.Undrain(id)
+			}
+		}
+		if err != nil && !errdefs.IsNotFound(err) {
+			return fmt.Errorf("failed to remove service: %w", err)
+		}
+	}
+	p.pruneSwarmSecrets(ctx, functionName, nil)
+	return nil
+}
+
+// drainTasks takes a service's running tasks out of routing and waits for
+// their in-flight requests up to the service's grace period, returning the
+// drained task IDs. Swarm chooses which tasks to stop when a service is scaled
+// down, so only removal drains.
+func (p *SwarmProvider) drainTasks(ctx context.Context, functionName string, service swarm.Service) []string {
+	if p.drainer == nil {
+		return nil
+	}
+	tasks, err := p.GetFunctionContainers(ctx, functionName)
+	if err != nil {
+		p.logger.Warnf("Failed to list tasks of %s to drain: %v", functionName, err)
+		return nil
+	}
+
+	grace := p.drainGracePeriod(service.Spec.Labels)
+	drained := make([]string, 0, len(tasks))
+	var wg sync.WaitGroup
+	for _, task := range tasks {
+		drained = append(drained, task.ID)
+		wg.Add(1)
+		go func(task *faasTypes.Container) {
+			defer wg.Done()
+			if remaining := p.drainer.Drain(ctx, functionName, task.ID, grace); remaining > 0 {
+				p.logger.Warnf("Stopping %s with %d requests still in flight", task.Name, remaining)
+			}
+		}(task)
+	}
+	wg.Wait()
+	return drained
+}
+
+// ScaleFunction changes the service's replica count, creating the service
+// if it does not exist
+func (p *SwarmProvider) ScaleFunction(ctx context.Context, deployment *faasTypes.FunctionDeployment, targetReplicas int) error {
+	service, found, err := p.findService(ctx, deployment.Service)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return p.DeployFunction(ctx, deployment, targetReplicas)
+	}
+
+	replicas := uint64(targetReplicas)
+	spec := service.Spec
+	spec.Mode = swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicas}}
+	if _, err := p.client.ServiceUpdate(ctx, service.ID, service.Version, spec, swarm.ServiceUpdateOptions{}); err != nil {
+		return fmt.Errorf("failed to scale service: %w", err)
+	}
+	return nil
+}
+
+// GetFunctionContainers lists the service's running tasks
+func (p *SwarmProvider) GetFunctionContainers(ctx context.Context, functionName string) ([]*faasTypes.Container, error) {
+	service, found, err := p.findService(ctx, functionName)
+	if err != nil || !found {
+		return []*faasTypes.Container{}, err
+	}
+
+	tasks, err := p.client.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(
+			filters.Arg("service", service.ID),
+			filters.Arg("desired-state", string(swarm.TaskStateRunning)),
+		),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Slot < tasks[j].Slot })
+
+	networkName := service.Spec.Labels[LabelNetwork]
+	resources := serviceResources(service.Spec.TaskTemplate.Resources)
+	result := make([]*faasTypes.Container, 0, len(tasks))
+	for _, task := range tasks {
+		result = append(result, &faasTypes.Container{
+			ID:        task.ID,
+			Name:      fmt.Sprintf("%s.%d", functionName, task.Slot),
+			IPAddress: taskIPAddress(task, networkName),
+			Status:    string(task.Status.State),
+			Created:   task.CreatedAt,
+			Resources: resources,
+		})
+	}
+	return result, nil
+}
+
+// GetFunctionLogs returns the service's logs across all tasks. Without
+// Follow the lines are ordered by timestamp; followed lines arrive as Swarm
+// delivers them.
+func (p *SwarmProvider) GetFunctionLogs(ctx context.Context, request faasTypes.LogRequest) (<-chan faasTypes.LogMessage, error) {
+	service, found, err := p.findService(ctx, request.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no containers found for function: %s", request.Name)
+	}
+
+	tasks, err := p.client.TaskList(ctx, swarm.TaskListOptions{
+		Filters: filters.NewArgs(filters.Arg("service", service.ID)),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tasks: %w", err)
+	}
+	instances := make(map[string]string, len(tasks))
+	for _, task := range tasks {
+		instances[task.ID] = fmt.Sprintf("%s.%d", request.Name, task.Slot)
+	}
+
+	options := container.LogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+		Details:    true,
+		Follow:     request.Follow,
+		Tail:       logTail(request.Tail),
+	}
+	if request.Since != nil {
+		options.Since = formatLogTime(*request.Since)
+	}
+	reader, err := p.client.ServiceLogs(ctx, service.ID, options)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get service logs: %w", err)
+	}
+
+	out := make(chan faasTypes.LogMessage)
+	go func() {
+		defer close(out)
+		defer reader.Close()
+
+		history := make([]faasTypes.LogMessage, 0)
+		err := demuxLogLines(reader, func(stream, line string) error {
+			message := parseServiceLogLine(request.Name, instances, stream, line)
+			if request.Instance != "" && message.Instance != request.Instance {
+				return nil
+			}
+			if !request.Follow {
+				history = append(history, message)
+				return nil
+			}
+			select {
+			case out <- message:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		if err != nil && ctx.Err() == nil {
+			p.logger.Debugf("Failed to read logs of %s: %v", request.Name, err)
+		}
+
+		for _, message := range mergeLogMessages(history, request.Tail) {
+			select {
+			case out <- message:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// parseServiceLogLine parses a service log line, whose details name the task
+// that wrote it
+func parseServiceLogLine(functionName string, instances map[string]string, stream, line string) faasTypes.LogMessage {
+	message := parseLogLine(functionName, "", stream, line)
+	details, text, ok := strings.Cut(message.Text, " ")
+	if !ok || !strings.HasPrefix(details, "com.docker.swarm.") {
+		return message
+	}
+	message.Text = text
+	for _, detail := range strings.Split(details, ",") {
+		if taskID, ok := strings.CutPrefix(detail, "com.docker.swarm.task.id="); ok {
+			message.Instance = taskID
+			if instance, ok := instances[taskID]; ok {
+				message.Instance = instance
+			}
+		}
+	}
+	return message
+}
+
+func (p *SwarmProvider) findService(ctx context.Context, name string) (swarm.Service, bool, error) {
+	service, _, err := p.client.ServiceInspectWithRaw(ctx, name, swarm.ServiceInspectOptions{})
+	if err != nil {
+		if errdefs.IsNotFound(err) {
+			return swarm.Service{}, false, nil
+		}
+		return swarm.Service{}, false, fmt.Errorf("failed to inspect service %s: %w", name, err)
+	}
+	// Inspect also matches ID prefixes; only a service with this name is ours
+	if service.Spec.Name != name {
+		return swarm.Service{}, false, nil
+	}
+	return service, true, nil
+}
+
+// serviceSpec builds the complete service spec, ensuring the function's
+// overlay network and Swarm secrets exist
+func (p *SwarmProvider) serviceSpec(ctx context.Context, deployment *faasTypes.FunctionDeployment, replicas int) (swarm.ServiceSpec, error) {
+	networkName := deployment.Network
+	if networkName == "" {
+		networkName = p.network
+	}
+	if networkName == "" {
+		return swarm.ServiceSpec{}, fmt.Errorf("network is required for function %s", deployment.Service)
+	}
+
+	spec, err := buildServiceSpec(deployment, replicas, p.securityPolicy, p.opts)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	// Named volumes are local to each node; only the manager's can be checked
+	if err := checkVolumeOwnership(ctx, p.client, deployment.Service, deployment.Volumes); err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	if deployment.Debug {
+		p.logger.Warnf("Debug ports are not published for swarm service %s", deployment.Service)
+	}
+
+	networkLabels := map[string]string{
+		LabelNetworkType:     "function",
+		LabelNetworkFunction: deployment.Service,
+	}
+	if err := p.ensureNetwork(ctx, networkName, networkLabels); err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("failed to ensure network %s: %w", networkName, err)
+	}
+	if err := p.ensureGatewayConnected(ctx, networkName); err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("failed to connect gateway to network %s: %w", networkName, err)
+	}
+	spec.Labels[LabelNetwork] = networkName
+	spec.TaskTemplate.Networks = []swarm.NetworkAttachmentConfig{{Target: networkName}}
+
+	secretRefs, err := p.swarmSecrets(ctx, deployment)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	spec.TaskTemplate.ContainerSpec.Secrets = secretRefs
+	return spec, nil
+}
+
+// buildServiceSpec maps a deployment onto a Swarm service spec without
+// networks or secrets
+func buildServiceSpec(deployment *faasTypes.FunctionDeployment, replicas int, policy *SecurityPolicy, opts SwarmOptions) (swarm.ServiceSpec, error) {
+	labels := map[string]string{
+		LabelFunction: deployment.Service,
+		LabelType:     "function",
+	}
+	for k, v := range deployment.Labels {
+		labels[k] = v
+	}
+
+	env := []string{}
+	for k, v := range deployment.EnvVars {
+		env = append(env, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(env)
+	if deployment.EnvProcess != "" {
+		env = append(env, fmt.Sprintf("fprocess=%s", deployment.EnvProcess))
+	}
+
+	// Resolve resources and the security profile through the container
+	// code paths, then translate them to their Swarm equivalents
+	config := &container.Config{}
+	hostConfig := &container.HostConfig{}
+	if err := applyResources(hostConfig, deployment.Limits, deployment.Requests); err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid resources: %w", err)
+	}
+	if err := swarmSupportsResources(hostConfig); err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid resources: %w", err)
+	}
+	if err := policy.apply(config, hostConfig, deployment.Security); err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid security profile: %w", err)
+	}
+	privileges, err := swarmPrivileges(hostConfig.SecurityOpt)
+	if err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid security profile: %w", err)
+	}
+	mounts, err := tmpfsMounts(hostConfig.Tmpfs)
+	if err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid security profile: %w", err)
+	}
+	if err := policy.ValidateVolumes(deployment.Volumes, deployment.Security); err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid volumes: %w", err)
+	}
+	volumes, err := volumeMounts(deployment.Service, deployment.Volumes)
+	if err != nil {
+		return swarm.ServiceSpec{}, fmt.Errorf("invalid volumes: %w", err)
+	}
+	mounts = append(mounts, volumes...)
+
+	constraints := make([]string, 0, len(deployment.Constraints))
+	for _, constraint := range deployment.Constraints {
+		constraint = strings.TrimSpace(constraint)
+		if constraint == "" {
+			continue
+		}
+		if !strings.Contains(constraint, "==") && !strings.Contains(constraint, "!=") {
+			return swarm.ServiceSpec{}, fmt.Errorf("invalid placement constraint %q: expected <attribute>==<value> or <attribute>!=<value>", constraint)
+		}
+		constraints = append(constraints, constraint)
+	}
+
+	reservedCPUs := int64(0)
+	if deployment.Requests != nil {
+		reservedCPUs, _ = ParseCPUQuantity(deployment.Requests.CPU)
+	}
+	pids := int64(0)
+	if hostConfig.Resources.PidsLimit != nil {
+		pids = *hostConfig.Resources.PidsLimit
+	}
+
+	stopSettings, err := ParseStopSettings(deployment.Annotations)
+	if err != nil {
+		return swarm.ServiceSpec{}, err
+	}
+	var stopGracePeriod *time.Duration
+	if stopSettings.Timeout >= 0 {
+		stopGracePeriod = &stopSettings.Timeout
+	}
+	if stopSettings.GracePeriod >= 0 {
+		labels[LabelDrainGracePeriod] = stopSettings.GracePeriod.String()
+	}
+
+	replicaCount := uint64(replicas)
+	return swarm.ServiceSpec{
+		Annotations: swarm.Annotations{Name: deployment.Service, Labels: labels},
+		TaskTemplate: swarm.TaskSpec{
+			ContainerSpec: &swarm.ContainerSpec{
+				Image:           deployment.Image,
+				Labels:          labels,
+				Env:             env,
+				User:            config.User,
+				ReadOnly:        deployment.ReadOnlyRootFilesystem,
+				Privileges:      privileges,
+				CapabilityDrop:  []string{"ALL"},
+				CapabilityAdd:   hostConfig.CapAdd,
+				Ulimits:         hostConfig.Resources.Ulimits,
+				OomScoreAdj:     int64(hostConfig.OomScoreAdj),
+				Mounts:          mounts,
+				StopSignal:      stopSettings.Signal,
+				StopGracePeriod: stopGracePeriod,
+			},
+			Resources: &swarm.ResourceRequirements{
+				Limits: &swarm.Limit{
+					NanoCPUs:    hostConfig.Resources.NanoCPUs,
+					MemoryBytes: hostConfig.Resources.Memory,
+					Pids:        pids,
+				},
+				Reservations: &swarm.Resources{
+					NanoCPUs:    reservedCPUs,
+					MemoryBytes: hostConfig.Resources.MemoryReservation,
+				},
+			},
+			Placement:     &swarm.Placement{Constraints: constraints},
+			RestartPolicy: &swarm.RestartPolicy{Condition: swarm.RestartPolicyConditionAny},
+		},
+		Mode: swarm.ServiceMode{Replicated: &swarm.ReplicatedService{Replicas: &replicaCount}},
+		UpdateConfig: &swarm.UpdateConfig{
+			Parallelism:   opts.UpdateParallelism,
+			Delay:         opts.UpdateDelay,
+			Monitor:       opts.UpdateMonitor,
+			FailureAction: opts.UpdateFailureAction,
+			Order:         opts.UpdateOrder,
+		},
+		RollbackConfig: &swarm.UpdateConfig{
+			Parallelism:   opts.UpdateParallelism,
+			Monitor:       opts.UpdateMonitor,
+			FailureAction: swarm.UpdateFailureActionPause,
+			Order:         opts.UpdateOrder,
+		},
+	}, nil
+}
+
+// swarmSupportsResources rejects limits Swarm services cannot express
+func swarmSupportsResources(hostConfig *container.HostConfig) error {
+	resources := hostConfig.Resources
+	switch {
+	case resources.MemorySwap != 0:
+		return fmt.Errorf("limits.memorySwap is not supported by swarm services")
+	case resources.CpusetCpus != "":
+		return fmt.Errorf("limits.cpuset is not supported by swarm services")
+	case resources.BlkioWeight != 0:
+		return fmt.Errorf("limits.blkioWeight is not supported by swarm services")
+	case resources.OomKillDisable != nil:
+		return fmt.Errorf("limits.oomKillDisable is not supported by swarm services")
+	}
+	return nil
+}
+
+// swarmPrivileges translates Docker security options to Swarm privileges
+func swarmPrivileges(securityOpts []string) (*swarm.Privileges, error) {
+	privileges := &swarm.Privileges{NoNewPrivileges: true}
+	for _, option := range securityOpts {
+		key, value, _ := strings.Cut(option, "=")
+		switch key {
+		case "seccomp":
+			if value == profileUnconfined {
+				privileges.Seccomp = &swarm.SeccompOpts{Mode: swarm.SeccompModeUnconfined}
+			} else {
+				privileges.Seccomp = &swarm.SeccompOpts{Mode: swarm.SeccompModeCustom, Profile: []byte(value)}
+			}
+		case "apparmor":
+			switch value {
+			case apparmorDefault:
+				privileges.AppArmor = &swarm.AppArmorOpts{Mode: swarm.AppArmorModeDefault}
+			case profileUnconfined:
+				privileges.AppArmor = &swarm.AppArmorOpts{Mode: swarm.AppArmorModeDisabled}
+			default:
+				return nil, fmt.Errorf("swarm services only support the %s and %s AppArmor profiles", apparmorDefault, profileUnconfined)
+			}
+		}
+	}
+	return privileges, nil
+}
+
+// tmpfsMounts translates tmpfs options such as "size=64m,mode=1777,noexec"
+// to Swarm tmpfs mounts
+func tmpfsMounts(tmpfs map[string]string) ([]mount.Mount, error) {
+	paths := make([]string, 0, len(tmpfs))
+	for mountPath := range tmpfs {
+		paths = append(paths, mountPath)
+	}
+	sort.Strings(paths)
+
+	mounts := make([]mount.Mount, 0, len(paths))
+	for _, mountPath := range paths {
+		options := &mount.TmpfsOptions{}
+		for _, option := range strings.Split(tmpfs[mountPath], ",") {
+			key, value, hasValue := strings.Cut(strings.TrimSpace(option), "=")
+			switch {
+			case key == "":
+			case key == "size":
+				size, err := ParseMemoryQuantity(value)
+				if err != nil {
+					return nil, fmt.Errorf("tmpfs %s: %w", mountPath, err)
+				}
+				options.SizeBytes = size
+			case key == "mode":
+				mode, err := strconv.ParseUint(value, 8, 32)
+				if err != nil {
+					return nil, fmt.Errorf("tmpfs %s: invalid mode %q", mountPath, value)
+				}
+				options.Mode = os.FileMode(mode)
+			case hasValue:
+				options.Options = append(options.Options, []string{key, value})
+			default:
+				options.Options = append(options.Options, []string{key})
+			}
+		}
+		mounts = append(mounts, mount.Mount{Type: mount.TypeTmpfs, Target: mountPath, TmpfsOptions: options})
+	}
+	return mounts, nil
+}
+
+// swarmSecrets creates a Swarm secret for each secret the function uses.
+// Swarm secrets are immutable, so names include a hash of the value and a
+// changed value produces a new secret and a rolling update.
+func (p *SwarmProvider) swarmSecrets(ctx context.Context, deployment *faasTypes.FunctionDeployment) ([]*swarm.SecretReference, error) {
+	if len(deployment.Secrets) == 0 {
+		return nil, nil
+	}
+	if err := p.prepareSecrets(deployment); err != nil {
+		return nil, err
+	}
+
+	refs := make([]*swarm.SecretReference, 0, len(deployment.Secrets))
+	for _, raw := range deployment.Secrets {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		ref, err := secrets.ParseSecretRef(raw)
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.secretManager.GetSecret(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read secret %s: %w", ref.Name, err)
+		}
+
+		name := swarmSecretName(deployment.Service, ref.Name, value)
+		id, err := p.ensureSwarmSecret(ctx, name, []byte(value), map[string]string{
+			LabelFunction: deployment.Service,
+			LabelSecret:   ref.Name,
+		})
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, &swarm.SecretReference{
+			SecretID:   id,
+			SecretName: name,
+			File: &swarm.SecretReferenceFileTarget{
+				Name: path.Join(secrets.ContainerSecretsPath, ref.Name),
+				UID:  "0",
+				GID:  "0",
+				Mode: 0444,
+			},
+		})
+	}
+	return refs, nil
+}
+
+// swarmSecretName derives a Swarm secret name from the function, secret
+// name and value
+func swarmSecretName(service, secretName, value string) string {
+	valueHash := sha256.Sum256([]byte(value))
+	suffix := hex.EncodeToString(valueHash[:])[:12]
+	name := fmt.Sprintf("%s-%s-%s", service, secretName, suffix)
+	if len(name) <= maxSwarmSecretName {
+		return name
+	}
+	nameHash := sha256.Sum256([]byte(service + "/" + secretName))
+	return fmt.Sprintf("faas-%s-%s", hex.EncodeToString(nameHash[:])[:16], suffix)
+}
+
+func (p *SwarmProvider) ensureSwarmSecret(ctx context.Context, name string, data []byte, labels map[string]string) (string, error) {
+	existing, err := p.client.SecretList(ctx, swarm.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to list swarm secrets: %w", err)
+	}
+	for _, secret := range existing {
+		if secret.Spec.Name == name {
+			return secret.ID, nil
+		}
+	}
+
+	created, err := p.client.SecretCreate(ctx, swarm.SecretSpec{
+		Annotations: swarm.Annotations{Name: name, Labels: labels},
+		Data:        data,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to create swarm secret %s: %w", name, err)
+	}
+	return created.ID, nil
+}
+
+// pruneSwarmSecrets removes the function's Swarm secrets that are not kept.
+// Secrets still referenced by running tasks are left for a later prune.
+func (p *SwarmProvider) pruneSwarmSecrets(ctx context.Context, functionName string, keep map[string]bool) {
+	existing, err := p.client.SecretList(ctx, swarm.SecretListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelFunction+"="+functionName)),
+	})
+	if err != nil {
+		p.logger.Warnf("Failed to list swarm secrets for %s: %v", functionName, err)
+		return
+	}
+	for _, secret := range existing {
+		if keep[secret.Spec.Name] {
+			continue
+		}
+		if err := p.client.SecretRemove(ctx, secret.ID); err != nil {
+			p.logger.Debugf("Swarm secret %s not removed: %v", secret.Spec.Name, err)
+		}
+	}
+}
+
+// waitForTasksGone waits briefly for a removed service's tasks to stop so
+// its secrets and network can be removed
+func (p *SwarmProvider) waitForTasksGone(ctx context.Context, serviceID string) {
+	deadline := time.Now().Add(taskShutdownTimeout)
+	for time.Now().Before(deadline) {
+		tasks, err := p.client.TaskList(ctx, swarm.TaskListOptions{
+			Filters: filters.NewArgs(filters.Arg("service", serviceID)),
+		})
+		if err != nil || len(tasks) == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+}
+
+// taskIPAddress returns the task's address on the function network
+func taskIPAddress(task swarm.Task, networkName string) string {
+	address := ""
+	for _, attachment := range task.NetworksAttachments {
+		if len(attachment.Addresses) == 0 {
+			continue
+		}
+		if attachment.Network.Spec.Name == networkName || address == "" {
+			address = attachment.Addresses[0]
+		}
+		if attachment.Network.Spec.Name == networkName {
+			break
+		}
+	}
+	if ip, _, err := net.ParseCIDR(address); err == nil {
+		return ip.String()
+	}
+	return address
+}
+
+// serviceResources reports the resources of a service's tasks
+func serviceResources(resources *swarm.ResourceRequirements) *faasTypes.ContainerResources {
+	if resources == nil {
+		return nil
+	}
+	report := &faasTypes.ContainerResources{}
+	if resources.Limits != nil {
+		report.Memory = resources.Limits.MemoryBytes
+		report.NanoCPUs = resources.Limits.NanoCPUs
+		report.PidsLimit = resources.Limits.Pids
+	}
+	if resources.Reservations != nil {
+		report.MemoryReservation = resources.Reservations.MemoryBytes
+	}
+	return report
+}
@@ -0,0 +1,157 @@
+package provider
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/swarm"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func testSwarmOptions() SwarmOptions {
+	return SwarmOptions{
+		UpdateParallelism:   1,
+		UpdateDelay:         5 * time.Second,
+		UpdateMonitor:       10 * time.Second,
+		UpdateFailureAction: swarm.UpdateFailureActionRollback,
+		UpdateOrder:         swarm.UpdateOrderStartFirst,
+	}
+}
+
+func TestBuildServiceSpec(t *testing.T) {
+	pids := int64(64)
+	deployment := &faasTypes.FunctionDeployment{
+		Service:     "hello",
+		Image:       "acme/hello:1",
+		EnvProcess:  "./handler",
+		EnvVars:     map[string]string{"B": "2", "A": "1"},
+		Labels:      map[string]string{"team": "payments"},
+		Annotations: map[string]string{AnnotationDrainGracePeriod: "45s"},
+		Constraints: []string{"node.role==worker", " ", "node.labels.zone != eu-1"},
+		Limits:      &faasTypes.FunctionLimits{Memory: "256Mi", CPU: "1"},
+		Requests:    &faasTypes.FunctionResources{Memory: "128Mi", CPU: "250m"},
+		Security: &faasTypes.FunctionSecurity{
+			RunAsUser: "1000",
+			CapAdd:    []string{"NET_BIND_SERVICE"},
+			AppArmor:  apparmorDefault,
+			PidsLimit: &pids,
+			Tmpfs:     map[string]string{"/tmp": "size=64m,mode=1777,noexec"},
+		},
+	}
+
+	spec, err := buildServiceSpec(deployment, 3, DefaultSecurityPolicy(), testSwarmOptions())
+	if err != nil {
+		t.Fatalf("build spec: %v", err)
+	}
+
+	if spec.Name != "hello" || *spec.Mode.Replicated.Replicas != 3 {
+		t.Fatalf("unexpected name or replicas: %s %d", spec.Name, *spec.Mode.Replicated.Replicas)
+	}
+	if !reflect.DeepEqual(spec.TaskTemplate.Placement.Constraints, []string{"node.role==worker", "node.labels.zone != eu-1"}) {
+		t.Fatalf("unexpected constraints: %v", spec.TaskTemplate.Placement.Constraints)
+	}
+
+	containerSpec := spec.TaskTemplate.ContainerSpec
+	if !reflect.DeepEqual(containerSpec.Env, []string{"A=1", "B=2", "fprocess=./handler"}) {
+		t.Fatalf("unexpected env: %v", containerSpec.Env)
+	}
+	if containerSpec.Labels[LabelFunction] != "hello" || containerSpec.Labels["team"] != "payments" {
+		t.Fatalf("unexpected labels: %v", containerSpec.Labels)
+	}
+	if spec.Labels[LabelDrainGracePeriod] != "45s" {
+		t.Fatalf("expected the drain grace period on the service, got %v", spec.Labels)
+	}
+	if containerSpec.User != "1000" || !containerSpec.Privileges.NoNewPrivileges ||
+		containerSpec.Privileges.AppArmor.Mode != swarm.AppArmorModeDefault {
+		t.Fatalf("unexpected security settings: %+v", containerSpec)
+	}
+	if !reflect.DeepEqual(containerSpec.CapabilityDrop, []string{"ALL"}) || !reflect.DeepEqual(containerSpec.CapabilityAdd, []string{"NET_BIND_SERVICE"}) {
+		t.Fatalf("unexpected capabilities: add %v drop %v", containerSpec.CapabilityAdd, containerSpec.CapabilityDrop)
+	}
+	expectedMount := mount.Mount{
+		Type:   mount.TypeTmpfs,
+		Target: "/tmp",
+		TmpfsOptions: &mount.TmpfsOptions{
+			SizeBytes: 64 << 20,
+			Mode:      os.FileMode(01777),
+			Options:   [][]string{{"noexec"}},
+		},
+	}
+	if len(containerSpec.Mounts) != 1 || !reflect.DeepEqual(containerSpec.Mounts[0], expectedMount) {
+		t.Fatalf("unexpected mounts: %+v", containerSpec.Mounts)
+	}
+
+	resources := spec.TaskTemplate.Resources
+	if resources.Limits.MemoryBytes != 256<<20 || resources.Limits.NanoCPUs != 1e9 || resources.Limits.Pids != 64 {
+		t.Fatalf("unexpected limits: %+v", resources.Limits)
+	}
+	if resources.Reservations.MemoryBytes != 128<<20 || resources.Reservations.NanoCPUs != 250e6 {
+		t.Fatalf("unexpected reservations: %+v", resources.Reservations)
+	}
+
+	update := spec.UpdateConfig
+	if update.Parallelism != 1 || update.Delay != 5*time.Second || update.FailureAction != swarm.UpdateFailureActionRollback || update.Order != swarm.UpdateOrderStartFirst {
+		t.Fatalf("unexpected update config: %+v", update)
+	}
+	if spec.RollbackConfig.FailureAction != swarm.UpdateFailureActionPause {
+		t.Fatalf("expected rollbacks to pause on failure, got %+v", spec.RollbackConfig)
+	}
+}
+
+func TestBuildServiceSpec_RejectsUnsupportedSettings(t *testing.T) {
+	policy := DefaultSecurityPolicy()
+	policy.AllowedAppArmorProfiles = []string{"custom"}
+
+	invalid := map[string]*faasTypes.FunctionDeployment{
+		"constraint":       {Service: "a", Constraints: []string{"node.role"}},
+		"swap":             {Service: "a", Limits: &faasTypes.FunctionLimits{Memory: "1g", MemorySwap: "2g"}},
+		"cpuset":           {Service: "a", Limits: &faasTypes.FunctionLimits{CPUSet: "0"}},
+		"apparmor profile": {Service: "a", Security: &faasTypes.FunctionSecurity{AppArmor: "custom"}},
+		"bind volume":      {Service: "a", Volumes: []faasTypes.FunctionVolume{{Type: VolumeTypeBind, Source: "/etc", Target: "/host-etc"}}},
+	}
+	for name, deployment := range invalid {
+		if _, err := buildServiceSpec(deployment, 1, policy, testSwarmOptions()); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestSwarmSecretName(t *testing.T) {
+	first := swarmSecretName("hello", "api-key", "one")
+	if !strings.HasPrefix(first, "hello-api-key-") {
+		t.Fatalf("unexpected secret name %s", first)
+	}
+	if first == swarmSecretName("hello", "api-key", "two") {
+		t.Fatalf("expected a changed value to produce a new secret name")
+	}
+	long := swarmSecretName(strings.Repeat("f", 60), "api-key", "one")
+	if len(long) > maxSwarmSecretName {
+		t.Fatalf("secret name %s exceeds %d characters", long, maxSwarmSecretName)
+	}
+}
+
+func TestTaskIPAddress(t *testing.T) {
+	task := swarm.Task{NetworksAttachments: []swarm.NetworkAttachment{
+		{Network: swarm.Network{Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "ingress"}}}, Addresses: []string{"10.0.0.4/24"}},
+		{Network: swarm.Network{Spec: swarm.NetworkSpec{Annotations: swarm.Annotations{Name: "faas-hello"}}}, Addresses: []string{"10.0.5.7/24"}},
+	}}
+	if ip := taskIPAddress(task, "faas-hello"); ip != "10.0.5.7" {
+		t.Fatalf("expected function network address, got %s", ip)
+	}
+}
+
+func TestSwarmOptionsValidate(t *testing.T) {
+	opts := testSwarmOptions()
+	if err := opts.Validate(); err != nil {
+		t.Fatalf("expected valid options: %v", err)
+	}
+	opts.UpdateOrder = "random"
+	if err := opts.Validate(); err == nil {
+		t.Fatalf("expected invalid order to be rejected")
+	}
+}
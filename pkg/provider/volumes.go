@@ -0,0 +1,304 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// VolumeTypeVolume mounts a named volume managed by the gateway
+	VolumeTypeVolume = "volume"
+	// VolumeTypeTmpfs mounts an in-memory filesystem
+	VolumeTypeTmpfs = "tmpfs"
+	// VolumeTypeBind mounts a host directory from the bind allowlist
+	VolumeTypeBind = "bind"
+
+	// LabelVolumeManaged marks named volumes created by the gateway
+	LabelVolumeManaged = "com.docker-faas.volume"
+	// LabelVolumeOwner records the function a volume was created for
+	LabelVolumeOwner = "com.docker-faas.volume.owner"
+)
+
+var (
+	// ErrVolumeNotFound is returned for volumes that do not exist
+	ErrVolumeNotFound = errors.New("volume not found")
+	// ErrVolumeExists is returned when creating a volume that already exists
+	ErrVolumeExists = errors.New("volume already exists")
+	// ErrVolumeInUse is returned when removing a volume a container still mounts
+	ErrVolumeInUse = errors.New("volume is in use")
+	// ErrVolumeNotManaged is returned for volumes the gateway did not create.
+	// Functions may not mount them, so they cannot reach other containers' data.
+	ErrVolumeNotManaged = fmt.Errorf("volume is not managed by the gateway: %w", ErrSecurityPolicy)
+	// ErrVolumeOwned is returned when a function mounts a volume owned by
+	// another function. Volumes created without an owner are shared.
+	ErrVolumeOwned = fmt.Errorf("volume is owned by another function: %w", ErrSecurityPolicy)
+
+	volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+)
+
+// volumeAPI is the subset of the Docker client used to manage volumes
+type volumeAPI interface {
+	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error)
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
+}
+
+// volumeType returns the type of a function volume, defaulting to a named volume
+func volumeType(v faasTypes.FunctionVolume) string {
+	if v.Type == "" {
+		return VolumeTypeVolume
+	}
+	return v.Type
+}
+
+// ValidateVolumeName checks the name of a named volume
+func ValidateVolumeName(name string) error {
+	if !volumeNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid volume name %q: must start with a letter or digit and contain only letters, digits, '_', '.' and '-'", name)
+	}
+	return nil
+}
+
+// ValidateVolumes checks a function's volumes against the policy. Errors
+// wrapping ErrSecurityPolicy mean the volume is well formed but not permitted.
+func (p *SecurityPolicy) ValidateVolumes(volumes []faasTypes.FunctionVolume, spec *faasTypes.FunctionSecurity) error {
+	targets := make(map[string]bool, len(volumes))
+	for _, v := range volumes {
+		target := path.Clean(v.Target)
+		if !path.IsAbs(v.Target) || target == "/" {
+			return fmt.Errorf("volume target %q must be an absolute path below /", v.Target)
+		}
+		if _, inside := mountRelativePath(secrets.ContainerSecretsPath, target); inside {
+			return fmt.Errorf("volume target %q overlaps the secrets mount", v.Target)
+		}
+		if targets[target] {
+			return fmt.Errorf("volume target %q is mounted more than once", v.Target)
+		}
+		targets[target] = true
+		if spec != nil {
+			for tmpfsPath := range spec.Tmpfs {
+				if path.Clean(tmpfsPath) == target {
+					return fmt.Errorf("volume target %q is also a security tmpfs mount", v.Target)
+				}
+			}
+		}
+
+		switch volumeType(v) {
+		case VolumeTypeVolume:
+			if err := ValidateVolumeName(v.Source); err != nil {
+				return fmt.Errorf("volume %s: %w", v.Target, err)
+			}
+		case VolumeTypeTmpfs:
+			if v.Source != "" {
+				return fmt.Errorf("tmpfs volume %s does not take a source", v.Target)
+			}
+		case VolumeTypeBind:
+			if err := p.validateBindSource(v.Source); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown volume type %q for %s: must be %s, %s or %s", v.Type, v.Target, VolumeTypeVolume, VolumeTypeTmpfs, VolumeTypeBind)
+		}
+
+		if v.Size != "" {
+			if volumeType(v) != VolumeTypeTmpfs {
+				return fmt.Errorf("volume %s: size only applies to tmpfs volumes", v.Target)
+			}
+			size, err := ParseMemoryQuantity(v.Size)
+			if err != nil {
+				return fmt.Errorf("volume %s: %w", v.Target, err)
+			}
+			if size <= 0 {
+				return fmt.Errorf("volume %s: size must be greater than 0", v.Target)
+			}
+		}
+	}
+	return nil
+}
+
+// validateBindSource permits host paths at or below an allowlisted directory
+func (p *SecurityPolicy) validateBindSource(source string) error {
+	if !filepath.IsAbs(source) {
+		return fmt.Errorf("bind source %q must be an absolute host path", source)
+	}
+	for _, allowed := range p.AllowedBindPaths {
+		if _, inside := mountRelativePath(allowed, source); inside {
+			return nil
+		}
+	}
+	return fmt.Errorf("bind source %s: %w", source, ErrSecurityPolicy)
+}
+
+// volumeMounts translates function volumes to Docker mounts. Named volumes
+// that Docker creates on first use carry the gateway's ownership labels.
+func volumeMounts(functionName string, volumes []faasTypes.FunctionVolume) ([]mount.Mount, error) {
+	mounts := make([]mount.Mount, 0, len(volumes))
+	for _, v := range volumes {
+		m := mount.Mount{Target: path.Clean(v.Target), ReadOnly: v.ReadOnly}
+		switch volumeType(v) {
+		case VolumeTypeVolume:
+			m.Type = mount.TypeVolume
+			m.Source = v.Source
+			m.VolumeOptions = &mount.VolumeOptions{Labels: managedVolumeLabels(functionName, nil)}
+		case VolumeTypeTmpfs:
+			m.Type = mount.TypeTmpfs
+			m.TmpfsOptions = &mount.TmpfsOptions{}
+			if v.Size != "" {
+				size, err := ParseMemoryQuantity(v.Size)
+				if err != nil {
+					return nil, fmt.Errorf("volume %s: %w", v.Target, err)
+				}
+				m.TmpfsOptions.SizeBytes = size
+			}
+		case VolumeTypeBind:
+			m.Type = mount.TypeBind
+			m.Source = filepath.Clean(v.Source)
+		default:
+			return nil, fmt.Errorf("unknown volume type %q for %s", v.Type, v.Target)
+		}
+		mounts = append(mounts, m)
+	}
+	return mounts, nil
+}
+
+// checkVolumeOwnership rejects named volumes that exist but were not created
+// by the gateway or are owned by another function. Missing volumes are created
+// with ownership labels on use.
+func checkVolumeOwnership(ctx context.Context, api volumeAPI, functionName string, volumes []faasTypes.FunctionVolume) error {
+	for _, v := range volumes {
+		if volumeType(v) != VolumeTypeVolume {
+			continue
+		}
+		existing, err := api.VolumeInspect(ctx, v.Source)
+		if errdefs.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to inspect volume %s: %w", v.Source, err)
+		}
+		if existing.Labels[LabelVolumeManaged] != "true" {
+			return fmt.Errorf("volume %s: %w", v.Source, ErrVolumeNotManaged)
+		}
+		if owner := existing.Labels[LabelVolumeOwner]; owner != "" && owner != functionName {
+			return fmt.Errorf("volume %s: %w", v.Source, ErrVolumeOwned)
+		}
+	}
+	return nil
+}
+
+// managedVolumeLabels returns the labels of a volume created by the gateway;
+// the ownership labels take precedence over custom ones
+func managedVolumeLabels(owner string, custom map[string]string) map[string]string {
+	labels := make(map[string]string, len(custom)+2)
+	for k, v := range custom {
+		labels[k] = v
+	}
+	labels[LabelVolumeManaged] = "true"
+	if owner != "" {
+		labels[LabelVolumeOwner] = owner
+	}
+	return labels
+}
+
+// VolumeManager creates, lists and removes the named volumes functions mount.
+// Only volumes carrying the gateway's ownership label are listed or removed.
+type VolumeManager struct {
+	api volumeAPI
+}
+
+// NewVolumeManager creates a volume manager using a Docker client
+func NewVolumeManager(api volumeAPI) *VolumeManager {
+	return &VolumeManager{api: api}
+}
+
+// List returns the gateway's volumes sorted by name
+func (m *VolumeManager) List(ctx context.Context) ([]*faasTypes.VolumeInfo, error) {
+	resp, err := m.api.VolumeList(ctx, volume.ListOptions{
+		Filters: filters.NewArgs(filters.Arg("label", LabelVolumeManaged+"=true")),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list volumes: %w", err)
+	}
+
+	volumes := make([]*faasTypes.VolumeInfo, 0, len(resp.Volumes))
+	for _, v := range resp.Volumes {
+		if v != nil {
+			volumes = append(volumes, volumeInfo(*v))
+		}
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i].Name < volumes[j].Name })
+	return volumes, nil
+}
+
+// Create creates a named volume owned by a function (empty for shared volumes)
+func (m *VolumeManager) Create(ctx context.Context, name, owner string, labels map[string]string) (*faasTypes.VolumeInfo, error) {
+	if err := ValidateVolumeName(name); err != nil {
+		return nil, err
+	}
+	if _, err := m.api.VolumeInspect(ctx, name); err == nil {
+		return nil, fmt.Errorf("volume %s: %w", name, ErrVolumeExists)
+	} else if !errdefs.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to inspect volume %s: %w", name, err)
+	}
+
+	created, err := m.api.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   name,
+		Driver: "local",
+		Labels: managedVolumeLabels(owner, labels),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create volume %s: %w", name, err)
+	}
+	return volumeInfo(created), nil
+}
+
+// Remove deletes a gateway volume. Volumes still mounted by a container are kept.
+func (m *VolumeManager) Remove(ctx context.Context, name string) error {
+	existing, err := m.api.VolumeInspect(ctx, name)
+	if errdefs.IsNotFound(err) {
+		return fmt.Errorf("volume %s: %w", name, ErrVolumeNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to inspect volume %s: %w", name, err)
+	}
+	if existing.Labels[LabelVolumeManaged] != "true" {
+		return fmt.Errorf("volume %s: %w", name, ErrVolumeNotManaged)
+	}
+
+	if err := m.api.VolumeRemove(ctx, name, false); err != nil {
+		if errdefs.IsConflict(err) {
+			return fmt.Errorf("volume %s: %w", name, ErrVolumeInUse)
+		}
+		return fmt.Errorf("failed to remove volume %s: %w", name, err)
+	}
+	return nil
+}
+
+// Check rejects named volumes a function may not mount
+func (m *VolumeManager) Check(ctx context.Context, functionName string, volumes []faasTypes.FunctionVolume) error {
+	return checkVolumeOwnership(ctx, m.api, functionName, volumes)
+}
+
+func volumeInfo(v volume.Volume) *faasTypes.VolumeInfo {
+	return &faasTypes.VolumeInfo{
+		Name:      v.Name,
+		Driver:    v.Driver,
+		Owner:     v.Labels[LabelVolumeOwner],
+		Labels:    v.Labels,
+		CreatedAt: v.CreatedAt,
+	}
+}
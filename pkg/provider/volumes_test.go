@@ -0,0 +1,204 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/errdefs"
+
+	faasTypes "github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// fakeVolumeAPI keeps volumes in memory; names in inUse cannot be removed
+type fakeVolumeAPI struct {
+	volumes map[string]volume.Volume
+	inUse   map[string]bool
+}
+
+func (f *fakeVolumeAPI) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	v := volume.Volume{Name: options.Name, Driver: options.Driver, Labels: options.Labels}
+	f.volumes[options.Name] = v
+	return v, nil
+}
+
+func (f *fakeVolumeAPI) VolumeInspect(ctx context.Context, volumeID string) (volume.Volume, error) {
+	v, ok := f.volumes[volumeID]
+	if !ok {
+		return volume.Volume{}, errdefs.NotFound(errors.New("no such volume"))
+	}
+	return v, nil
+}
+
+func (f *fakeVolumeAPI) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	var resp volume.ListResponse
+	for _, v := range f.volumes {
+		if v.Labels[LabelVolumeManaged] == "true" {
+			v := v
+			resp.Volumes = append(resp.Volumes, &v)
+		}
+	}
+	return resp, nil
+}
+
+func (f *fakeVolumeAPI) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	if f.inUse[volumeID] {
+		return errdefs.Conflict(errors.New("volume is in use"))
+	}
+	delete(f.volumes, volumeID)
+	return nil
+}
+
+func TestCheckVolumeOwnership(t *testing.T) {
+	api := &fakeVolumeAPI{volumes: map[string]volume.Volume{}, inUse: map[string]bool{}}
+	manager := NewVolumeManager(api)
+	ctx := context.Background()
+
+	if _, err := manager.Create(ctx, "a-data", "a", nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := manager.Create(ctx, "shared", "", nil); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if err := manager.Check(ctx, "a", []faasTypes.FunctionVolume{{Source: "a-data", Target: "/data"}}); err != nil {
+		t.Fatalf("expected the owner to mount its volume: %v", err)
+	}
+	// Function b may not read or overwrite a's data
+	err := manager.Check(ctx, "b", []faasTypes.FunctionVolume{{Source: "a-data", Target: "/data"}})
+	if !errors.Is(err, ErrVolumeOwned) || !errors.Is(err, ErrSecurityPolicy) {
+		t.Fatalf("expected another function's volume to be rejected, got %v", err)
+	}
+	if err := checkVolumeOwnership(ctx, api, "b", []faasTypes.FunctionVolume{{Source: "a-data", Target: "/data"}}); !errors.Is(err, ErrVolumeOwned) {
+		t.Fatalf("expected the provider check to reject another function's volume, got %v", err)
+	}
+	// Volumes created without an owner are shared
+	if err := manager.Check(ctx, "b", []faasTypes.FunctionVolume{{Source: "shared", Target: "/shared"}}); err != nil {
+		t.Fatalf("expected a shared volume to be accepted: %v", err)
+	}
+}
+
+func TestSecurityPolicy_ValidateVolumes(t *testing.T) {
+	policy := DefaultSecurityPolicy()
+	policy.AllowedBindPaths = []string{"/srv/functions"}
+
+	valid := []faasTypes.FunctionVolume{
+		{Source: "cache", Target: "/data"},
+		{Type: VolumeTypeTmpfs, Target: "/scratch", Size: "64Mi"},
+		{Type: VolumeTypeBind, Source: "/srv/functions/models", Target: "/models", ReadOnly: true},
+	}
+	if err := policy.ValidateVolumes(valid, nil); err != nil {
+		t.Fatalf("expected volumes to be valid: %v", err)
+	}
+
+	forbidden := [][]faasTypes.FunctionVolume{
+		{{Type: VolumeTypeBind, Source: "/etc", Target: "/host-etc"}},
+		{{Type: VolumeTypeBind, Source: "/srv/functions/../../etc", Target: "/host-etc"}},
+	}
+	for _, volumes := range forbidden {
+		if err := policy.ValidateVolumes(volumes, nil); !errors.Is(err, ErrSecurityPolicy) {
+			t.Fatalf("expected policy error for %+v, got %v", volumes, err)
+		}
+	}
+
+	invalid := [][]faasTypes.FunctionVolume{
+		{{Source: "cache", Target: "data"}},
+		{{Source: "cache", Target: "/"}},
+		{{Source: "cache", Target: "/var/openfaas/secrets/db"}},
+		{{Source: "../cache", Target: "/data"}},
+		{{Source: "cache", Target: "/data", Size: "1Gi"}},
+		{{Type: VolumeTypeTmpfs, Source: "cache", Target: "/data"}},
+		{{Type: VolumeTypeTmpfs, Target: "/data", Size: "lots"}},
+		{{Type: VolumeTypeBind, Source: "srv/functions", Target: "/data"}},
+		{{Type: "nfs", Source: "cache", Target: "/data"}},
+		{{Source: "a", Target: "/data"}, {Source: "b", Target: "/data/"}},
+	}
+	for _, volumes := range invalid {
+		err := policy.ValidateVolumes(volumes, nil)
+		if err == nil || errors.Is(err, ErrSecurityPolicy) {
+			t.Fatalf("expected validation error for %+v, got %v", volumes, err)
+		}
+	}
+
+	security := &faasTypes.FunctionSecurity{Tmpfs: map[string]string{"/tmp": "size=64m"}}
+	if err := policy.ValidateVolumes([]faasTypes.FunctionVolume{{Type: VolumeTypeTmpfs, Target: "/tmp"}}, security); err == nil {
+		t.Fatal("expected a volume on a security tmpfs path to be rejected")
+	}
+}
+
+func TestVolumeMounts(t *testing.T) {
+	mounts, err := volumeMounts("api", []faasTypes.FunctionVolume{
+		{Source: "cache", Target: "/data/"},
+		{Type: VolumeTypeTmpfs, Target: "/scratch", Size: "64Mi"},
+		{Type: VolumeTypeBind, Source: "/srv/functions/models", Target: "/models", ReadOnly: true},
+	})
+	if err != nil {
+		t.Fatalf("volume mounts: %v", err)
+	}
+
+	expected := []mount.Mount{
+		{
+			Type:          mount.TypeVolume,
+			Source:        "cache",
+			Target:        "/data",
+			VolumeOptions: &mount.VolumeOptions{Labels: map[string]string{LabelVolumeManaged: "true", LabelVolumeOwner: "api"}},
+		},
+		{Type: mount.TypeTmpfs, Target: "/scratch", TmpfsOptions: &mount.TmpfsOptions{SizeBytes: 64 << 20}},
+		{Type: mount.TypeBind, Source: "/srv/functions/models", Target: "/models", ReadOnly: true},
+	}
+	if !reflect.DeepEqual(mounts, expected) {
+		t.Fatalf("unexpected mounts: %+v", mounts)
+	}
+}
+
+func TestVolumeManager_Lifecycle(t *testing.T) {
+	api := &fakeVolumeAPI{
+		volumes: map[string]volume.Volume{"postgres-data": {Name: "postgres-data", Driver: "local"}},
+		inUse:   map[string]bool{},
+	}
+	manager := NewVolumeManager(api)
+	ctx := context.Background()
+
+	created, err := manager.Create(ctx, "cache", "api", map[string]string{"tier": "hot", LabelVolumeManaged: "false"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if created.Owner != "api" || created.Labels[LabelVolumeManaged] != "true" || created.Labels["tier"] != "hot" {
+		t.Fatalf("expected ownership labels to be set, got %+v", created)
+	}
+	if _, err := manager.Create(ctx, "cache", "", nil); !errors.Is(err, ErrVolumeExists) {
+		t.Fatalf("expected duplicate create to fail, got %v", err)
+	}
+
+	volumes, err := manager.List(ctx)
+	if err != nil || len(volumes) != 1 || volumes[0].Name != "cache" {
+		t.Fatalf("expected only the gateway's volume to be listed, got %+v (%v)", volumes, err)
+	}
+
+	// Volumes the gateway did not create can neither be mounted nor removed
+	foreign := []faasTypes.FunctionVolume{{Source: "postgres-data", Target: "/data"}}
+	if err := manager.Check(ctx, "api", foreign); !errors.Is(err, ErrVolumeNotManaged) || !errors.Is(err, ErrSecurityPolicy) {
+		t.Fatalf("expected a foreign volume to be rejected, got %v", err)
+	}
+	if err := manager.Remove(ctx, "postgres-data"); !errors.Is(err, ErrVolumeNotManaged) {
+		t.Fatalf("expected a foreign volume to be kept, got %v", err)
+	}
+	if err := manager.Check(ctx, "api", []faasTypes.FunctionVolume{{Source: "cache", Target: "/data"}, {Source: "new", Target: "/new"}}); err != nil {
+		t.Fatalf("expected gateway and missing volumes to be accepted: %v", err)
+	}
+
+	api.inUse["cache"] = true
+	if err := manager.Remove(ctx, "cache"); !errors.Is(err, ErrVolumeInUse) {
+		t.Fatalf("expected a mounted volume to be kept, got %v", err)
+	}
+	api.inUse["cache"] = false
+	if err := manager.Remove(ctx, "cache"); err != nil {
+		t.Fatalf("remove: %v", err)
+	}
+	if err := manager.Remove(ctx, "cache"); !errors.Is(err, ErrVolumeNotFound) {
+		t.Fatalf("expected a removed volume to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package registryauth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// dockerHubServer is the canonical name used for Docker Hub credentials
+	dockerHubServer = "docker.io"
+	// dockerHubAuthAddress is the server address Docker expects for Docker Hub logins
+	dockerHubAuthAddress = "https://index.docker.io/v1/"
+)
+
+var (
+	// ErrNotFound is returned when no credential exists for a server
+	ErrNotFound = errors.New("registry credential not found")
+	// ErrInvalidServer is returned when a server address cannot be used
+	ErrInvalidServer = errors.New("invalid registry server")
+)
+
+// dockerHubAliases are the host names that refer to Docker Hub
+var dockerHubAliases = map[string]bool{
+	"docker.io":               true,
+	"index.docker.io":         true,
+	"registry-1.docker.io":    true,
+	"registry.hub.docker.com": true,
+}
+
+// Store persists registry credentials
+type Store interface {
+	UpsertRegistryCredential(credential *types.RegistryCredential) error
+	GetRegistryCredential(server string) (*types.RegistryCredential, error)
+	ListRegistryCredentials() ([]*types.RegistryCredential, error)
+	DeleteRegistryCredential(server string) error
+}
+
+// Credentials manages registry logins and resolves the login for an image.
+// Passwords are sealed with the secrets keyring when encryption is enabled.
+type Credentials struct {
+	store Store
+
+	mu      sync.RWMutex
+	keyring *secrets.Keyring
+}
+
+// Auth is the login resolved for an image
+type Auth struct {
+	// Server is the normalized registry server the credential was stored under
+	Server string
+	// Encoded is the X-Registry-Auth value passed to the Docker API
+	Encoded string
+	// Username and Password are the plaintext login
+	Username string
+	Password string
+}
+
+// NewCredentials creates a credential manager backed by store
+func NewCredentials(store Store) *Credentials {
+	return &Credentials{store: store}
+}
+
+// EnableEncryption seals passwords written from now on with the keyring
+func (c *Credentials) EnableEncryption(keyring *secrets.Keyring) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.keyring = keyring
+}
+
+// EncryptionEnabled reports whether passwords are sealed at rest
+func (c *Credentials) EncryptionEnabled() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.keyring != nil
+}
+
+// Set creates or replaces the credential for server. It reports whether a
+// credential already existed.
+func (c *Credentials) Set(server, username, password string) (*types.RegistryCredential, bool, error) {
+	normalized, err := NormalizeServer(server)
+	if err != nil {
+		return nil, false, err
+	}
+	if username == "" || password == "" {
+		return nil, false, fmt.Errorf("username and password are required")
+	}
+
+	existed := true
+	if _, err := c.store.GetRegistryCredential(normalized); err != nil {
+		existed = false
+	}
+
+	stored, err := c.seal(normalized, password)
+	if err != nil {
+		return nil, existed, err
+	}
+	credential := &types.RegistryCredential{Server: normalized, Username: username, Password: stored}
+	if err := c.store.UpsertRegistryCredential(credential); err != nil {
+		return nil, existed, err
+	}
+
+	saved, err := c.store.GetRegistryCredential(normalized)
+	if err != nil {
+		return nil, existed, err
+	}
+	saved.Password = ""
+	return saved, existed, nil
+}
+
+// Exists reports whether a credential is stored for server
+func (c *Credentials) Exists(server string) bool {
+	normalized, err := NormalizeServer(server)
+	if err != nil {
+		return false
+	}
+	_, err = c.store.GetRegistryCredential(normalized)
+	return err == nil
+}
+
+// List returns every credential without passwords
+func (c *Credentials) List() ([]*types.RegistryCredential, error) {
+	credentials, err := c.store.ListRegistryCredentials()
+	if err != nil {
+		return nil, err
+	}
+	for _, credential := range credentials {
+		credential.Password = ""
+	}
+	return credentials, nil
+}
+
+// Delete removes the credential for server
+func (c *Credentials) Delete(server string) error {
+	normalized, err := NormalizeServer(server)
+	if err != nil {
+		return err
+	}
+	if _, err := c.store.GetRegistryCredential(normalized); err != nil {
+		return fmt.Errorf("%w: %s", ErrNotFound, normalized)
+	}
+	return c.store.DeleteRegistryCredential(normalized)
+}
+
+// Migrate re-seals passwords that are stored in plaintext or under a previous
+// master key. It returns the number of credentials rewritten.
+func (c *Credentials) Migrate() (int, error) {
+	if !c.EncryptionEnabled() {
+		return 0, nil
+	}
+	credentials, err := c.store.ListRegistryCredentials()
+	if err != nil {
+		return 0, err
+	}
+
+	migrated := 0
+	for _, credential := range credentials {
+		password, current, err := c.open(credential)
+		if err != nil {
+			return migrated, err
+		}
+		if current {
+			continue
+		}
+		if credential.Password, err = c.seal(credential.Server, password); err != nil {
+			return migrated, err
+		}
+		if err := c.store.UpsertRegistryCredential(credential); err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+	return migrated, nil
+}
+
+// Lookup returns the login for the registry an image is pulled from, or nil
+// when no credential matches. A credential stored for a host matches every
+// repository on it; one stored for host/path matches repositories below that
+// path, and the most specific credential wins.
+func (c *Credentials) Lookup(image string) (*Auth, error) {
+	named, err := reference.ParseNormalizedNamed(strings.TrimSpace(image))
+	if err != nil {
+		return nil, fmt.Errorf("invalid image reference %q: %w", image, err)
+	}
+	name := named.Name()
+
+	credentials, err := c.store.ListRegistryCredentials()
+	if err != nil {
+		return nil, err
+	}
+	var match *types.RegistryCredential
+	for _, credential := range credentials {
+		if name != credential.Server && !strings.HasPrefix(name, credential.Server+"/") {
+			continue
+		}
+		if match == nil || len(credential.Server) > len(match.Server) {
+			match = credential
+		}
+	}
+	if match == nil {
+		return nil, nil
+	}
+
+	password, _, err := c.open(match)
+	if err != nil {
+		return nil, err
+	}
+	domain := reference.Domain(named)
+	address := domain
+	if domain == dockerHubServer {
+		address = dockerHubAuthAddress
+	}
+	encoded, err := registry.EncodeAuthConfig(registry.AuthConfig{
+		Username:      match.Username,
+		Password:      password,
+		ServerAddress: address,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode registry auth: %w", err)
+	}
+	return &Auth{Server: match.Server, Encoded: encoded, Username: match.Username, Password: password}, nil
+}
+
+// NormalizeServer reduces a registry address to the form credentials are
+// stored under: no scheme, no trailing slash or /v1 suffix, lower-case host,
+// and docker.io for every Docker Hub alias. A repository path may follow the host.
+func NormalizeServer(server string) (string, error) {
+	server = strings.TrimSpace(server)
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	server = strings.TrimRight(server, "/")
+	server = strings.TrimSuffix(server, "/v1")
+	server = strings.TrimSuffix(server, "/v2")
+
+	host, path, _ := strings.Cut(server, "/")
+	host = strings.ToLower(host)
+	if host == "" || strings.ContainsAny(host, " @") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidServer, server)
+	}
+	if dockerHubAliases[host] {
+		host = dockerHubServer
+	}
+	if path == "" {
+		return host, nil
+	}
+	if _, err := reference.ParseNormalizedNamed(host + "/" + path); err != nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidServer, server)
+	}
+	return host + "/" + path, nil
+}
+
+// seal encrypts a password bound to the server it belongs to
+func (c *Credentials) seal(server, password string) (string, error) {
+	c.mu.RLock()
+	keyring := c.keyring
+	c.mu.RUnlock()
+	if keyring == nil {
+		return password, nil
+	}
+	sealed, err := keyring.Seal(sealName(server), []byte(password))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt registry password: %w", err)
+	}
+	return string(sealed), nil
+}
+
+// open returns the plaintext password and whether it is sealed with the current key
+func (c *Credentials) open(credential *types.RegistryCredential) (string, bool, error) {
+	c.mu.RLock()
+	keyring := c.keyring
+	c.mu.RUnlock()
+	data := []byte(credential.Password)
+	if keyring == nil {
+		if secrets.IsSealed(data) {
+			return "", false, fmt.Errorf("registry password for %s is encrypted but no master key is configured", credential.Server)
+		}
+		return credential.Password, false, nil
+	}
+	plaintext, current, err := keyring.Open(sealName(credential.Server), data)
+	if err != nil {
+		return "", false, err
+	}
+	return string(plaintext), current, nil
+}
+
+func sealName(server string) string {
+	return "registry:" + server
+}
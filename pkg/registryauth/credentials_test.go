@@ -0,0 +1,198 @@
+package registryauth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+
+	"github.com/docker-faas/docker-faas/pkg/secrets"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type memoryStore struct {
+	credentials map[string]*types.RegistryCredential
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{credentials: make(map[string]*types.RegistryCredential)}
+}
+
+func (s *memoryStore) UpsertRegistryCredential(credential *types.RegistryCredential) error {
+	copied := *credential
+	copied.UpdatedAt = time.Now()
+	if existing, ok := s.credentials[credential.Server]; ok {
+		copied.CreatedAt = existing.CreatedAt
+	} else {
+		copied.CreatedAt = copied.UpdatedAt
+	}
+	s.credentials[credential.Server] = &copied
+	return nil
+}
+
+func (s *memoryStore) GetRegistryCredential(server string) (*types.RegistryCredential, error) {
+	credential, ok := s.credentials[server]
+	if !ok {
+		return nil, fmt.Errorf("registry credential not found: %s", server)
+	}
+	copied := *credential
+	return &copied, nil
+}
+
+func (s *memoryStore) ListRegistryCredentials() ([]*types.RegistryCredential, error) {
+	result := make([]*types.RegistryCredential, 0, len(s.credentials))
+	for _, credential := range s.credentials {
+		copied := *credential
+		result = append(result, &copied)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Server < result[j].Server })
+	return result, nil
+}
+
+func (s *memoryStore) DeleteRegistryCredential(server string) error {
+	delete(s.credentials, server)
+	return nil
+}
+
+func testKeyring(t *testing.T, seed byte, previous ...[]byte) *secrets.Keyring {
+	t.Helper()
+	key := make([]byte, secrets.MasterKeySize)
+	for i := range key {
+		key[i] = seed
+	}
+	keyring, err := secrets.NewKeyring(key, previous...)
+	if err != nil {
+		t.Fatalf("new keyring: %v", err)
+	}
+	return keyring
+}
+
+func decodeAuth(t *testing.T, encoded string) registry.AuthConfig {
+	t.Helper()
+	data, err := base64.URLEncoding.DecodeString(encoded)
+	if err != nil {
+		t.Fatalf("decode auth: %v", err)
+	}
+	var config registry.AuthConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("unmarshal auth: %v", err)
+	}
+	return config
+}
+
+func TestNormalizeServer(t *testing.T) {
+	cases := map[string]string{
+		"https://index.docker.io/v1/": "docker.io",
+		"registry-1.docker.io":        "docker.io",
+		"GHCR.io/":                    "ghcr.io",
+		"http://localhost:5000":       "localhost:5000",
+		"ghcr.io/acme":                "ghcr.io/acme",
+	}
+	for input, expected := range cases {
+		got, err := NormalizeServer(input)
+		if err != nil || got != expected {
+			t.Fatalf("NormalizeServer(%q) = %q, %v; want %q", input, got, err, expected)
+		}
+	}
+	for _, invalid := range []string{"", "https://", "user@host"} {
+		if _, err := NormalizeServer(invalid); err == nil {
+			t.Fatalf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestLookup_MatchesMostSpecificServer(t *testing.T) {
+	c := NewCredentials(newMemoryStore())
+	for server, user := range map[string]string{
+		"ghcr.io":             "org",
+		"ghcr.io/acme":        "acme",
+		"index.docker.io":     "hub",
+		"registry.local:5000": "local",
+	} {
+		if _, _, err := c.Set(server, user, "pw-"+user); err != nil {
+			t.Fatalf("set %s: %v", server, err)
+		}
+	}
+
+	cases := map[string]string{
+		"ghcr.io/acme/api:1":            "acme",
+		"ghcr.io/acmecorp/api:1":        "org",
+		"alpine:3.19":                   "hub",
+		"registry.local:5000/tools/cli": "local",
+		"quay.io/team/app":              "",
+	}
+	for image, user := range cases {
+		auth, err := c.Lookup(image)
+		if err != nil {
+			t.Fatalf("lookup %s: %v", image, err)
+		}
+		if user == "" {
+			if auth != nil {
+				t.Fatalf("expected no credential for %s, got %s", image, auth.Server)
+			}
+			continue
+		}
+		if auth == nil || auth.Username != user || auth.Password != "pw-"+user {
+			t.Fatalf("unexpected credential for %s: %+v", image, auth)
+		}
+	}
+
+	auth, _ := c.Lookup("alpine")
+	if config := decodeAuth(t, auth.Encoded); config.ServerAddress != dockerHubAuthAddress || config.Username != "hub" {
+		t.Fatalf("unexpected Docker Hub auth config: %+v", config)
+	}
+	auth, _ = c.Lookup("ghcr.io/acme/api")
+	if config := decodeAuth(t, auth.Encoded); config.ServerAddress != "ghcr.io" {
+		t.Fatalf("expected registry host as server address, got %+v", config)
+	}
+}
+
+func TestCredentials_SealsAndMigratesPasswords(t *testing.T) {
+	store := newMemoryStore()
+	c := NewCredentials(store)
+	if _, _, err := c.Set("ghcr.io", "ci", "plain"); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+
+	oldKeyring := testKeyring(t, 1)
+	c.EnableEncryption(oldKeyring)
+	if migrated, err := c.Migrate(); err != nil || migrated != 1 {
+		t.Fatalf("expected plaintext password to be sealed, got %d (%v)", migrated, err)
+	}
+	if !secrets.IsSealed([]byte(store.credentials["ghcr.io"].Password)) {
+		t.Fatalf("expected stored password to be sealed")
+	}
+
+	oldKey := make([]byte, secrets.MasterKeySize)
+	for i := range oldKey {
+		oldKey[i] = 1
+	}
+	c.EnableEncryption(testKeyring(t, 2, oldKey))
+	if migrated, err := c.Migrate(); err != nil || migrated != 1 {
+		t.Fatalf("expected password to be re-sealed under the new key, got %d (%v)", migrated, err)
+	}
+	if migrated, _ := c.Migrate(); migrated != 0 {
+		t.Fatalf("expected migration to be idempotent")
+	}
+
+	auth, err := c.Lookup("ghcr.io/acme/api")
+	if err != nil || auth.Password != "plain" {
+		t.Fatalf("expected sealed password to decrypt, got %+v (%v)", auth, err)
+	}
+
+	listed, _ := c.List()
+	if len(listed) != 1 || listed[0].Password != "" {
+		t.Fatalf("expected listed credentials without passwords, got %+v", listed)
+	}
+
+	// Sealed values are bound to their server and cannot be moved
+	store.credentials["quay.io"] = &types.RegistryCredential{Server: "quay.io", Username: "ci", Password: store.credentials["ghcr.io"].Password}
+	if _, err := c.Lookup("quay.io/acme/api"); err == nil || !strings.Contains(err.Error(), "decrypt") {
+		t.Fatalf("expected a password sealed for another server to be rejected, got %v", err)
+	}
+}
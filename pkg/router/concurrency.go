@@ -0,0 +1,324 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+const (
+	// AnnotationMaxInflight caps concurrent requests sent to each replica of a function
+	AnnotationMaxInflight = "com.docker-faas.max-inflight"
+	// AnnotationQueueSize bounds how many requests may wait for a free replica
+	AnnotationQueueSize = "com.docker-faas.queue.size"
+	// AnnotationQueueTimeout bounds how long a request may wait for a free replica
+	AnnotationQueueTimeout = "com.docker-faas.queue.timeout"
+	// EnvMaxInflight is the OpenFaaS watchdog variable honoured when the annotation is unset
+	EnvMaxInflight = "max_inflight"
+
+	// DefaultQueueSize is the per-function queue bound when none is configured
+	DefaultQueueSize = 100
+	// DefaultQueueTimeout is the per-function queue wait when none is configured
+	DefaultQueueTimeout = 30 * time.Second
+
+	// queuePollInterval is how often the head of a queue re-checks for new replicas
+	queuePollInterval = time.Second
+)
+
+var (
+	// ErrQueueFull is returned when a function's queue has no room for another request
+	ErrQueueFull = errors.New("function queue is full")
+	// ErrQueueTimeout is returned when a queued request did not get a replica in time
+	ErrQueueTimeout = errors.New("timed out waiting for a function replica")
+)
+
+// ConcurrencyLimits is the per-function in-flight configuration
+type ConcurrencyLimits struct {
+	MaxInflight  int
+	QueueSize    int
+	QueueTimeout time.Duration
+}
+
+// ParseConcurrencyLimits reads max-inflight and queue settings from annotations,
+// falling back to the max_inflight environment variable used by the watchdog.
+// Unset queue settings (a negative size or zero timeout) use the router defaults.
+func ParseConcurrencyLimits(annotations, envVars map[string]string) (ConcurrencyLimits, error) {
+	limits := ConcurrencyLimits{QueueSize: -1}
+
+	raw, source := strings.TrimSpace(annotations[AnnotationMaxInflight]), AnnotationMaxInflight
+	if raw == "" {
+		raw, source = strings.TrimSpace(envVars[EnvMaxInflight]), EnvMaxInflight
+	}
+	if raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return limits, fmt.Errorf("invalid %s: %q", source, raw)
+		}
+		limits.MaxInflight = value
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationQueueSize]); raw != "" {
+		value, err := strconv.Atoi(raw)
+		if err != nil || value < 0 {
+			return limits, fmt.Errorf("invalid %s: %q", AnnotationQueueSize, raw)
+		}
+		limits.QueueSize = value
+	}
+	if raw := strings.TrimSpace(annotations[AnnotationQueueTimeout]); raw != "" {
+		value, err := time.ParseDuration(raw)
+		if err != nil || value <= 0 {
+			return limits, fmt.Errorf("invalid %s: %q", AnnotationQueueTimeout, raw)
+		}
+		limits.QueueTimeout = value
+	}
+
+	return limits, nil
+}
+
+type concurrencyLimitsKey struct{}
+
+// WithConcurrencyLimits attaches a function's concurrency limits to a routing context
+func WithConcurrencyLimits(ctx context.Context, limits ConcurrencyLimits) context.Context {
+	return context.WithValue(ctx, concurrencyLimitsKey{}, limits)
+}
+
+func concurrencyLimitsFrom(ctx context.Context) ConcurrencyLimits {
+	limits, _ := ctx.Value(concurrencyLimitsKey{}).(ConcurrencyLimits)
+	return limits
+}
+
+// containerLister returns the current replicas of a function
+type containerLister func(ctx context.Context, functionName string) ([]*types.Container, error)
+
+// replicaSlots tracks in-flight requests per replica and the queue of
+// requests waiting for a replica with spare capacity
+type replicaSlots struct {
+	mu        sync.Mutex
+	functions map[string]*functionSlots
+	draining  map[string]bool   // container IDs that take no new requests
+	next      map[string]uint64 // round-robin position, kept while a function is idle
+}
+
+type functionSlots struct {
+	inflight map[string]int // container ID -> in-flight requests
+	total    int
+	waiters  []chan struct{}
+}
+
+func newReplicaSlots() *replicaSlots {
+	return &replicaSlots{
+		functions: make(map[string]*functionSlots),
+		draining:  make(map[string]bool),
+		next:      make(map[string]uint64),
+	}
+}
+
+// state returns the slots of a function, creating them on first use. Callers must hold s.mu.
+func (s *replicaSlots) state(functionName string) *functionSlots {
+	state := s.functions[functionName]
+	if state == nil {
+		state = &functionSlots{inflight: make(map[string]int)}
+		s.functions[functionName] = state
+	}
+	return state
+}
+
+// track counts a request against a replica chosen without a limit
+func (s *replicaSlots) track(functionName string, container *types.Container) func() {
+	s.mu.Lock()
+	state := s.state(functionName)
+	state.inflight[container.ID]++
+	state.total++
+	s.publish(functionName, state)
+	s.mu.Unlock()
+
+	return s.releaser(functionName, container.ID)
+}
+
+// acquire waits until a replica has fewer than limits.MaxInflight requests
+// and reserves a slot on it. Requests queue in arrival order.
+func (s *replicaSlots) acquire(ctx context.Context, functionName string, limits ConcurrencyLimits, list containerLister) (*types.Container, func(), error) {
+	timer := time.NewTimer(limits.QueueTimeout)
+	defer timer.Stop()
+
+	var wake chan struct{}
+	for {
+		containers, err := list(ctx, functionName)
+		if err != nil {
+			s.leave(functionName, wake)
+			return nil, nil, err
+		}
+
+		s.mu.Lock()
+		state := s.state(functionName)
+		if wake != nil || len(state.waiters) == 0 {
+			if container := state.pick(containers, limits.MaxInflight, s.advance(functionName)); container != nil {
+				if wake != nil {
+					state.remove(wake)
+					// There may be spare capacity for the next waiter too
+					state.wakeHead()
+				}
+				state.inflight[container.ID]++
+				state.total++
+				s.publish(functionName, state)
+				s.mu.Unlock()
+				return container, s.releaser(functionName, container.ID), nil
+			}
+		}
+		if wake == nil {
+			if len(state.waiters) >= limits.QueueSize {
+				s.cleanup(functionName, state)
+				s.mu.Unlock()
+				return nil, nil, ErrQueueFull
+			}
+			wake = make(chan struct{}, 1)
+			state.waiters = append(state.waiters, wake)
+			s.publish(functionName, state)
+		}
+		var poll <-chan time.Time
+		if state.waiters[0] == wake {
+			poll = time.After(queuePollInterval)
+		}
+		s.mu.Unlock()
+
+		select {
+		case <-wake:
+		case <-poll:
+		case <-timer.C:
+			s.leave(functionName, wake)
+			return nil, nil, ErrQueueTimeout
+		case <-ctx.Done():
+			s.leave(functionName, wake)
+			return nil, nil, ctx.Err()
+		}
+	}
+}
+
+// leave removes a waiter that gave up, handing on any wake-up it received
+func (s *replicaSlots) leave(functionName string, wake chan struct{}) {
+	if wake == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.functions[functionName]
+	if state == nil {
+		return
+	}
+	state.remove(wake)
+	select {
+	case <-wake:
+		state.wakeHead()
+	default:
+	}
+	s.publish(functionName, state)
+	s.cleanup(functionName, state)
+}
+
+func (s *replicaSlots) releaser(functionName, containerID string) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			state := s.functions[functionName]
+			if state == nil {
+				return
+			}
+			if state.inflight[containerID] <= 1 {
+				delete(state.inflight, containerID)
+			} else {
+				state.inflight[containerID]--
+			}
+			state.total--
+			state.wakeHead()
+			s.publish(functionName, state)
+			s.cleanup(functionName, state)
+		})
+	}
+}
+
+// publish exports the function's gauges. Callers must hold s.mu.
+func (s *replicaSlots) publish(functionName string, state *functionSlots) {
+	metrics.SetFunctionConcurrency(functionName, state.total, len(state.waiters))
+}
+
+// advance returns the function's round-robin position and moves it on.
+// Callers must hold s.mu.
+func (s *replicaSlots) advance(functionName string) uint64 {
+	start := s.next[functionName]
+	s.next[functionName] = start + 1
+	return start
+}
+
+// forget drops the round-robin position of a removed function
+func (s *replicaSlots) forget(functionName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.next, functionName)
+}
+
+// cleanup forgets the slots of an idle function. Callers must hold s.mu.
+func (s *replicaSlots) cleanup(functionName string, state *functionSlots) {
+	if state.total == 0 && len(state.waiters) == 0 {
+		delete(s.functions, functionName)
+	}
+}
+
+// pick returns the first replica with spare capacity in round-robin order
+// from start
+func (f *functionSlots) pick(containers []*types.Container, maxInflight int, start uint64) *types.Container {
+	candidates := runningContainers(containers)
+	if len(candidates) == 0 {
+		candidates = containers
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	for i := 0; i < len(candidates); i++ {
+		container := candidates[(start+uint64(i))%uint64(len(candidates))]
+		if f.inflight[container.ID] < maxInflight {
+			return container
+		}
+	}
+	return nil
+}
+
+func (f *functionSlots) remove(wake chan struct{}) {
+	for i, waiter := range f.waiters {
+		if waiter == wake {
+			f.waiters = append(f.waiters[:i], f.waiters[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *functionSlots) wakeHead() {
+	if len(f.waiters) == 0 {
+		return
+	}
+	select {
+	case f.waiters[0] <- struct{}{}:
+	default:
+	}
+}
+
+func runningContainers(containers []*types.Container) []*types.Container {
+	running := make([]*types.Container, 0, len(containers))
+	for _, c := range containers {
+		if c.Status == "running" || c.Status == "Up" {
+			running = append(running, c)
+		}
+	}
+	return running
+}
@@ -0,0 +1,158 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+func staticContainers(containers ...*types.Container) containerLister {
+	return func(ctx context.Context, functionName string) ([]*types.Container, error) {
+		return containers, nil
+	}
+}
+
+func TestParseConcurrencyLimits(t *testing.T) {
+	limits, err := ParseConcurrencyLimits(map[string]string{
+		AnnotationMaxInflight:  "2",
+		AnnotationQueueSize:    "0",
+		AnnotationQueueTimeout: "5s",
+	}, map[string]string{EnvMaxInflight: "10"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits.MaxInflight != 2 || limits.QueueSize != 0 || limits.QueueTimeout != 5*time.Second {
+		t.Fatalf("unexpected limits: %#v", limits)
+	}
+
+	limits, err = ParseConcurrencyLimits(nil, map[string]string{EnvMaxInflight: "3"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if limits.MaxInflight != 3 || limits.QueueSize != -1 || limits.QueueTimeout != 0 {
+		t.Fatalf("expected env fallback with default queue, got %#v", limits)
+	}
+
+	invalid := []map[string]string{
+		{AnnotationMaxInflight: "-1"},
+		{AnnotationMaxInflight: "many"},
+		{AnnotationQueueSize: "lots"},
+		{AnnotationQueueTimeout: "0s"},
+	}
+	for _, annotations := range invalid {
+		if _, err := ParseConcurrencyLimits(annotations, nil); err == nil {
+			t.Fatalf("expected error for %v", annotations)
+		}
+	}
+}
+
+func TestReplicaSlots_LimitsEachReplica(t *testing.T) {
+	slots := newReplicaSlots()
+	list := staticContainers(
+		&types.Container{ID: "a", Status: "running"},
+		&types.Container{ID: "b", Status: "running"},
+	)
+	limits := ConcurrencyLimits{MaxInflight: 1, QueueSize: 1, QueueTimeout: time.Second}
+
+	first, releaseFirst, err := slots.acquire(context.Background(), "hello", limits, list)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	second, _, err := slots.acquire(context.Background(), "hello", limits, list)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if first.ID == second.ID {
+		t.Fatalf("expected requests to be spread across replicas, both went to %s", first.ID)
+	}
+
+	queued := make(chan *types.Container)
+	go func() {
+		container, _, err := slots.acquire(context.Background(), "hello", limits, list)
+		if err != nil {
+			t.Errorf("queued request failed: %v", err)
+		}
+		queued <- container
+	}()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		slots.mu.Lock()
+		waiting := len(slots.functions["hello"].waiters)
+		slots.mu.Unlock()
+		if waiting == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected third request to be queued")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if _, _, err := slots.acquire(context.Background(), "hello", limits, list); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+
+	releaseFirst()
+	select {
+	case container := <-queued:
+		if container == nil || container.ID != first.ID {
+			t.Fatalf("expected queued request to take the released replica %s, got %v", first.ID, container)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected queued request to get a replica after release")
+	}
+}
+
+func TestReplicaSlots_SequentialRequestsRoundRobin(t *testing.T) {
+	slots := newReplicaSlots()
+	list := staticContainers(
+		&types.Container{ID: "a", Status: "running"},
+		&types.Container{ID: "b", Status: "running"},
+		&types.Container{ID: "c", Status: "running"},
+	)
+	limits := ConcurrencyLimits{MaxInflight: 1, QueueSize: 1, QueueTimeout: time.Second}
+
+	// One request at a time leaves the function idle between requests
+	counts := make(map[string]int)
+	for i := 0; i < 6; i++ {
+		container, release, err := slots.acquire(context.Background(), "hello", limits, list)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		counts[container.ID]++
+		release()
+	}
+	if counts["a"] != 2 || counts["b"] != 2 || counts["c"] != 2 {
+		t.Fatalf("expected sequential requests to be spread evenly, got %v", counts)
+	}
+
+	slots.forget("hello")
+	if _, ok := slots.next["hello"]; ok {
+		t.Fatalf("expected the round-robin position of a removed function to be dropped")
+	}
+}
+
+func TestReplicaSlots_QueueTimeout(t *testing.T) {
+	slots := newReplicaSlots()
+	list := staticContainers(&types.Container{ID: "a", Status: "running"})
+	limits := ConcurrencyLimits{MaxInflight: 1, QueueSize: 5, QueueTimeout: 20 * time.Millisecond}
+
+	_, release, err := slots.acquire(context.Background(), "hello", limits, list)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, _, err := slots.acquire(context.Background(), "hello", limits, list); !errors.Is(err, ErrQueueTimeout) {
+		t.Fatalf("expected ErrQueueTimeout, got %v", err)
+	}
+
+	release()
+	slots.mu.Lock()
+	defer slots.mu.Unlock()
+	if _, ok := slots.functions["hello"]; ok {
+		t.Fatalf("expected idle function state to be dropped")
+	}
+}
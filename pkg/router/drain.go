@@ -0,0 +1,75 @@
+package router
+
+import (
+	"context"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// drainPollInterval is how often a drain re-checks a replica's in-flight count
+const drainPollInterval = 50 * time.Millisecond
+
+// Drain stops routing new requests to a replica and waits until its in-flight
+// requests finish, the grace period passes or ctx is done. It returns the
+// number of requests still in flight. The replica stays excluded from routing
+// until Undrain is called, normally once it has been removed.
+func (r *Router) Drain(ctx context.Context, functionName, containerID string, grace time.Duration) int {
+	r.slots.mu.Lock()
+	r.slots.draining[containerID] = true
+	r.slots.mu.Unlock()
+
+	deadline := time.NewTimer(grace)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+
+	for {
+		remaining := r.slots.inflightFor(functionName, containerID)
+		if remaining == 0 {
+			return 0
+		}
+		select {
+		case <-ticker.C:
+		case <-deadline.C:
+			return r.slots.inflightFor(functionName, containerID)
+		case <-ctx.Done():
+			return r.slots.inflightFor(functionName, containerID)
+		}
+	}
+}
+
+// Undrain forgets the draining state of a replica
+func (r *Router) Undrain(containerID string) {
+	r.slots.mu.Lock()
+	defer r.slots.mu.Unlock()
+	delete(r.slots.draining, containerID)
+}
+
+// inflightFor returns the requests in flight on a replica
+func (s *replicaSlots) inflightFor(functionName, containerID string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.functions[functionName]
+	if state == nil {
+		return 0
+	}
+	return state.inflight[containerID]
+}
+
+// routable drops draining replicas from a function's containers
+func (s *replicaSlots) routable(containers []*types.Container) []*types.Container {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.draining) == 0 {
+		return containers
+	}
+
+	result := make([]*types.Container, 0, len(containers))
+	for _, c := range containers {
+		if !s.draining[c.ID] {
+			result = append(result, c)
+		}
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+package router
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type staticSource []*types.Container
+
+func (s staticSource) GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error) {
+	return s, nil
+}
+
+func TestRouter_DrainWaitsForInflightRequests(t *testing.T) {
+	r := NewRouter(staticSource{
+		{ID: "a", Status: "running"},
+		{ID: "b", Status: "running"},
+	}, logrus.New(), time.Second, time.Second, time.Second)
+
+	container, release, err := r.acquireContainer(context.Background(), "hello", ConcurrencyLimits{})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	drained := make(chan int)
+	go func() {
+		drained <- r.Drain(context.Background(), "hello", container.ID, time.Minute)
+	}()
+
+	// New requests avoid the draining replica while it finishes its work
+	deadline := time.Now().Add(time.Second)
+	for {
+		containers, _ := r.functionContainers(context.Background(), "hello")
+		if len(containers) == 1 {
+			if containers[0].ID == container.ID {
+				t.Fatalf("expected draining replica %s to be excluded", container.ID)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected replica to be marked draining")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	select {
+	case remaining := <-drained:
+		t.Fatalf("expected drain to wait for the in-flight request, returned %d", remaining)
+	case <-time.After(2 * drainPollInterval):
+	}
+
+	release()
+	select {
+	case remaining := <-drained:
+		if remaining != 0 {
+			t.Fatalf("expected no requests left, got %d", remaining)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected drain to finish once the request was released")
+	}
+
+	r.Undrain(container.ID)
+	if containers, _ := r.functionContainers(context.Background(), "hello"); len(containers) != 2 {
+		t.Fatalf("expected both replicas after undrain, got %d", len(containers))
+	}
+}
+
+func TestRouter_DrainGivesUpAfterGracePeriod(t *testing.T) {
+	r := NewRouter(staticSource{{ID: "a", Status: "running"}}, logrus.New(), time.Second, time.Second, time.Second)
+
+	if _, _, err := r.acquireContainer(context.Background(), "hello", ConcurrencyLimits{}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if remaining := r.Drain(context.Background(), "hello", "a", 100*time.Millisecond); remaining != 1 {
+		t.Fatalf("expected one request left after the grace period, got %d", remaining)
+	}
+	if remaining := r.Drain(context.Background(), "hello", "idle", time.Minute); remaining != 0 {
+		t.Fatalf("expected an idle replica to drain immediately, got %d", remaining)
+	}
+}
@@ -4,27 +4,40 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"strconv"
 	"sync/atomic"
 	"time"
 
-	"github.com/docker-faas/docker-faas/pkg/provider"
+	"github.com/docker-faas/docker-faas/pkg/clientip"
 	"github.com/docker-faas/docker-faas/pkg/types"
 	"github.com/sirupsen/logrus"
 )
 
+// defaultWatchdogPort is the port the OpenFaaS watchdog listens on
+const defaultWatchdogPort = 8080
+
+// ContainerSource lists the replicas a function can be routed to
+type ContainerSource interface {
+	GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error)
+}
+
 // Router handles routing requests to function containers
 type Router struct {
-	provider     *provider.DockerProvider
+	provider     ContainerSource
 	logger       *logrus.Logger
 	readTimeout  time.Duration
 	writeTimeout time.Duration
 	execTimeout  time.Duration
 	roundRobin   map[string]*uint64 // Function name -> counter for round-robin
+	slots        *replicaSlots
+	queueSize    int
+	queueTimeout time.Duration
 }
 
 // NewRouter creates a new router instance
-func NewRouter(provider *provider.DockerProvider, logger *logrus.Logger, readTimeout, writeTimeout, execTimeout time.Duration) *Router {
+func NewRouter(provider ContainerSource, logger *logrus.Logger, readTimeout, writeTimeout, execTimeout time.Duration) *Router {
 	return &Router{
 		provider:     provider,
 		logger:       logger,
@@ -32,26 +45,79 @@ func NewRouter(provider *provider.DockerProvider, logger *logrus.Logger, readTim
 		writeTimeout: writeTimeout,
 		execTimeout:  execTimeout,
 		roundRobin:   make(map[string]*uint64),
+		slots:        newReplicaSlots(),
+		queueSize:    DefaultQueueSize,
+		queueTimeout: DefaultQueueTimeout,
 	}
 }
 
-// RouteRequest routes a request to a function container
+// SetQueueDefaults configures the queue applied to functions with a max-inflight
+// limit that do not set their own queue size or timeout
+func (r *Router) SetQueueDefaults(size int, timeout time.Duration) {
+	if size >= 0 {
+		r.queueSize = size
+	}
+	if timeout > 0 {
+		r.queueTimeout = timeout
+	}
+}
+
+// ForgetFunction drops the routing state kept for a removed function
+func (r *Router) ForgetFunction(functionName string) {
+	r.slots.forget(functionName)
+}
+
+// RouteRequest routes a request to a function container. Concurrency limits
+// attached with WithConcurrencyLimits are enforced per replica; the slot is
+// held until the response body is closed.
 func (r *Router) RouteRequest(ctx context.Context, functionName string, req *http.Request) (*http.Response, error) {
-	// Get function containers
-	containers, err := r.provider.GetFunctionContainers(ctx, functionName)
+	container, release, err := r.acquireContainer(ctx, functionName, concurrencyLimitsFrom(ctx))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get function containers: %w", err)
+		return nil, err
 	}
 
-	if len(containers) == 0 {
-		return nil, fmt.Errorf("no containers available for function: %s", functionName)
+	// Forward request to container
+	resp, err := r.forwardRequest(ctx, container, req)
+	if err != nil {
+		release()
+		return nil, err
 	}
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
 
-	// Select container using round-robin
-	container := r.selectContainer(functionName, containers)
+// acquireContainer selects a replica, waiting in the function's queue when
+// every replica is at its max-inflight limit
+func (r *Router) acquireContainer(ctx context.Context, functionName string, limits ConcurrencyLimits) (*types.Container, func(), error) {
+	if limits.MaxInflight <= 0 {
+		containers, err := r.functionContainers(ctx, functionName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(containers) == 0 {
+			return nil, nil, fmt.Errorf("no containers available for function: %s", functionName)
+		}
 
-	// Forward request to container
-	return r.forwardRequest(ctx, container, req)
+		// Select container using round-robin
+		container := r.selectContainer(functionName, containers)
+		return container, r.slots.track(functionName, container), nil
+	}
+
+	if limits.QueueSize < 0 {
+		limits.QueueSize = r.queueSize
+	}
+	if limits.QueueTimeout <= 0 {
+		limits.QueueTimeout = r.queueTimeout
+	}
+	return r.slots.acquire(ctx, functionName, limits, r.functionContainers)
+}
+
+func (r *Router) functionContainers(ctx context.Context, functionName string) ([]*types.Container, error) {
+	containers, err := r.provider.GetFunctionContainers(ctx, functionName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get function containers: %w", err)
+	}
+	return r.slots.routable(containers), nil
 }
 
 // selectContainer selects a container using round-robin load balancing
@@ -83,7 +149,11 @@ func (r *Router) selectContainer(functionName string, containers []*types.Contai
 // forwardRequest forwards an HTTP request to a container
 func (r *Router) forwardRequest(ctx context.Context, container *types.Container, req *http.Request) (*http.Response, error) {
 	// Build target URL (OpenFaaS watchdog listens on port 8080)
-	targetURL := fmt.Sprintf("http://%s:8080", container.IPAddress)
+	port := container.Port
+	if port == 0 {
+		port = defaultWatchdogPort
+	}
+	targetURL := fmt.Sprintf("http://%s", net.JoinHostPort(container.IPAddress, strconv.Itoa(port)))
 
 	// Create new request
 	proxyReq, err := http.NewRequestWithContext(ctx, req.Method, targetURL, req.Body)
@@ -98,10 +168,8 @@ func (r *Router) forwardRequest(ctx context.Context, container *types.Container,
 		}
 	}
 
-	// Add X-Forwarded headers
-	proxyReq.Header.Set("X-Forwarded-For", req.RemoteAddr)
-	proxyReq.Header.Set("X-Forwarded-Host", req.Host)
-	proxyReq.Header.Set("X-Forwarded-Proto", req.URL.Scheme)
+	// Append this hop to the X-Forwarded-* and Forwarded headers
+	clientip.ForwardHeaders(proxyReq.Header, req)
 
 	// Create HTTP client with timeouts
 	client := &http.Client{
@@ -121,6 +189,18 @@ func (r *Router) forwardRequest(ctx context.Context, container *types.Container,
 	return resp, nil
 }
 
+// releasingBody frees the replica slot once the response has been consumed
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releasingBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
 // InvokeFunction is a convenience method that wraps RouteRequest
 func (r *Router) InvokeFunction(ctx context.Context, functionName string, body io.Reader, headers map[string]string) ([]byte, int, error) {
 	// Create HTTP request
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const (
+	// BackendFile stores secrets as files under the secrets path
+	BackendFile = "file"
+	// BackendVault stores secrets in a HashiCorp Vault KV v2 engine
+	BackendVault = "vault"
+	// BackendEnv resolves secrets from gateway environment variables (read-only)
+	BackendEnv = "env"
+	// BackendDirectory resolves secrets from files mounted into the gateway (read-only)
+	BackendDirectory = "directory"
+)
+
+var (
+	// ErrSecretNotFound is returned when a secret does not exist in the backend
+	ErrSecretNotFound = errors.New("secret not found")
+	// ErrSecretExists is returned when creating a secret that already exists
+	ErrSecretExists = errors.New("secret already exists")
+	// ErrReadOnlyBackend is returned for writes against a read-only backend
+	ErrReadOnlyBackend = errors.New("secret backend is read-only")
+)
+
+// SecretBackend stores and resolves secret values
+type SecretBackend interface {
+	// Name identifies the backend type
+	Name() string
+	// ReadOnly reports whether secrets are managed outside docker-faas
+	ReadOnly() bool
+	// Get resolves a secret by backend path and optional key
+	Get(secretPath, key string) ([]byte, error)
+	// Exists reports whether a secret path and key resolve to a value
+	Exists(secretPath, key string) (bool, error)
+	// List returns the paths of all secrets known to the backend
+	List() ([]string, error)
+	// Create stores a new secret and fails if it already exists
+	Create(name string, data []byte) error
+	// Update replaces the value of an existing secret
+	Update(name string, data []byte) error
+	// Delete removes a secret
+	Delete(name string) error
+}
+
+// SecretRef is a function's reference to a backend secret.
+//
+// References take the form [name=]path[#key]. The secret is mounted at
+// /var/openfaas/secrets/<name>; name defaults to the key when one is given
+// and to the last path segment otherwise. A plain secret name is a valid
+// reference to the secret of the same name.
+type SecretRef struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Key  string `json:"key,omitempty"`
+}
+
+// ParseSecretRef parses a function secret reference
+func ParseSecretRef(ref string) (SecretRef, error) {
+	ref = strings.TrimSpace(ref)
+	parsed := SecretRef{}
+
+	if idx := strings.Index(ref, "="); idx >= 0 {
+		parsed.Name = ref[:idx]
+		ref = ref[idx+1:]
+	}
+	if idx := strings.LastIndex(ref, "#"); idx >= 0 {
+		parsed.Key = ref[idx+1:]
+		ref = ref[:idx]
+		if parsed.Key == "" {
+			return SecretRef{}, fmt.Errorf("invalid secret reference %q: empty key", ref)
+		}
+	}
+	parsed.Path = ref
+
+	if err := validateSecretPath(parsed.Path); err != nil {
+		return SecretRef{}, err
+	}
+	if parsed.Name == "" {
+		parsed.Name = parsed.Key
+	}
+	if parsed.Name == "" {
+		parsed.Name = path.Base(parsed.Path)
+	}
+	if err := validateSecretName(parsed.Name); err != nil {
+		return SecretRef{}, err
+	}
+	return parsed, nil
+}
+
+// String returns the reference in its canonical form
+func (r SecretRef) String() string {
+	ref := r.Path
+	if r.Key != "" {
+		ref += "#" + r.Key
+	}
+	if r.Name != defaultRefName(r.Path, r.Key) {
+		ref = r.Name + "=" + ref
+	}
+	return ref
+}
+
+func defaultRefName(secretPath, key string) string {
+	if key != "" {
+		return key
+	}
+	return path.Base(secretPath)
+}
+
+// validateSecretPath rejects empty, absolute and traversing backend paths
+func validateSecretPath(secretPath string) error {
+	if secretPath == "" || strings.HasPrefix(secretPath, "/") {
+		return fmt.Errorf("invalid secret path: %q", secretPath)
+	}
+	for _, segment := range strings.Split(secretPath, "/") {
+		if segment == "" || segment == "." || segment == ".." || strings.HasPrefix(segment, ".") {
+			return fmt.Errorf("invalid secret path: %q", secretPath)
+		}
+	}
+	return nil
+}
+
+func notFound(name string) error {
+	return fmt.Errorf("%w: %s", ErrSecretNotFound, name)
+}
@@ -0,0 +1,336 @@
+package secrets
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// vaultStub implements the subset of the Vault KV v2 and AppRole APIs used
+// by VaultBackend
+type vaultStub struct {
+	mu       sync.Mutex
+	secrets  map[string]map[string]interface{}
+	versions map[string]int
+	tokens   map[string]bool
+	logins   int
+}
+
+func newVaultStub(tokens ...string) *vaultStub {
+	stub := &vaultStub{
+		secrets:  make(map[string]map[string]interface{}),
+		versions: make(map[string]int),
+		tokens:   make(map[string]bool),
+	}
+	for _, token := range tokens {
+		stub.tokens[token] = true
+	}
+	return stub
+}
+
+func (v *vaultStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["role_id"] != "role" || body["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.logins++
+		token := "approle-token"
+		v.tokens[token] = true
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"auth": map[string]interface{}{"client_token": token, "lease_duration": 3600},
+		})
+		return
+	}
+
+	if !v.tokens[r.Header.Get("X-Vault-Token")] {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string][]string{"errors": {"permission denied"}})
+		return
+	}
+
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/data/"):
+		key := strings.TrimPrefix(r.URL.Path, "/v1/secret/data/")
+		switch r.Method {
+		case http.MethodGet:
+			data, ok := v.secrets[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"data": map[string]interface{}{
+					"data":     data,
+					"metadata": map[string]interface{}{"version": v.versions[key]},
+				},
+			})
+		case http.MethodPost:
+			var body struct {
+				Options map[string]int         `json:"options"`
+				Data    map[string]interface{} `json:"data"`
+			}
+			json.NewDecoder(r.Body).Decode(&body)
+			if cas, ok := body.Options["cas"]; ok && cas != v.versions[key] {
+				w.WriteHeader(http.StatusBadRequest)
+				json.NewEncoder(w).Encode(map[string][]string{"errors": {"check-and-set parameter did not match the current version"}})
+				return
+			}
+			v.secrets[key] = body.Data
+			v.versions[key]++
+			w.WriteHeader(http.StatusOK)
+		}
+	case strings.HasPrefix(r.URL.Path, "/v1/secret/metadata"):
+		key := strings.Trim(strings.TrimPrefix(r.URL.Path, "/v1/secret/metadata"), "/")
+		switch r.Method {
+		case "LIST":
+			seen := map[string]bool{}
+			prefix := key
+			if prefix != "" {
+				prefix += "/"
+			}
+			for name := range v.secrets {
+				if !strings.HasPrefix(name, prefix) {
+					continue
+				}
+				rest := strings.TrimPrefix(name, prefix)
+				if idx := strings.Index(rest, "/"); idx >= 0 {
+					rest = rest[:idx+1]
+				}
+				seen[rest] = true
+			}
+			if len(seen) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			keys := []string{}
+			for k := range seen {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case http.MethodDelete:
+			delete(v.secrets, key)
+			delete(v.versions, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func testLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+func TestParseSecretRef(t *testing.T) {
+	tests := []struct {
+		ref      string
+		expected SecretRef
+	}{
+		{"api-key", SecretRef{Name: "api-key", Path: "api-key"}},
+		{"payments/stripe", SecretRef{Name: "stripe", Path: "payments/stripe"}},
+		{"payments/db#password", SecretRef{Name: "password", Path: "payments/db", Key: "password"}},
+		{"db-password=payments/db#password", SecretRef{Name: "db-password", Path: "payments/db", Key: "password"}},
+	}
+	for _, tt := range tests {
+		ref, err := ParseSecretRef(tt.ref)
+		require.NoError(t, err, tt.ref)
+		assert.Equal(t, tt.expected, ref)
+		assert.Equal(t, tt.ref, ref.String())
+	}
+
+	for _, invalid := range []string{"", "/abs", "a/../b", "a//b", ".hidden", "name=", "path#", "../x=a"} {
+		_, err := ParseSecretRef(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestVaultBackendTokenAuth(t *testing.T) {
+	stub := newVaultStub("root")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	backend, err := NewVaultBackend(VaultConfig{Address: server.URL, Token: "root", PathPrefix: "docker-faas"}, testLogger())
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Create("api-key", []byte("v1")))
+	assert.ErrorIs(t, backend.Create("api-key", []byte("again")), ErrSecretExists)
+	assert.Equal(t, "v1", stub.secrets["docker-faas/api-key"]["value"])
+
+	stub.secrets["docker-faas/payments/db"] = map[string]interface{}{"username": "app", "password": "s3cret"}
+	stub.versions["docker-faas/payments/db"] = 1
+
+	value, err := backend.Get("payments/db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cret", string(value))
+
+	_, err = backend.Get("payments/db", "missing")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+
+	require.NoError(t, backend.Update("payments/db", []byte("extra")))
+	assert.Equal(t, "app", stub.secrets["docker-faas/payments/db"]["username"])
+	assert.Equal(t, "extra", stub.secrets["docker-faas/payments/db"]["value"])
+	assert.ErrorIs(t, backend.Update("missing", []byte("x")), ErrSecretNotFound)
+
+	names, err := backend.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api-key", "payments/db"}, names)
+
+	require.NoError(t, backend.Delete("api-key"))
+	exists, err := backend.Exists("api-key", "")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestVaultBackendAppRoleAuth(t *testing.T) {
+	stub := newVaultStub()
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	backend, err := NewVaultBackend(VaultConfig{Address: server.URL, RoleID: "role", SecretID: "secret"}, testLogger())
+	require.NoError(t, err)
+
+	require.NoError(t, backend.Create("token", []byte("abc")))
+	value, err := backend.Get("token", "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(value))
+	assert.Equal(t, 1, stub.logins)
+
+	// A revoked token triggers a fresh login
+	stub.tokens = map[string]bool{}
+	value, err = backend.Get("token", "")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", string(value))
+	assert.Equal(t, 2, stub.logins)
+
+	_, err = NewVaultBackend(VaultConfig{Address: server.URL, RoleID: "role"}, testLogger())
+	assert.Error(t, err)
+}
+
+func TestEnvBackend(t *testing.T) {
+	t.Setenv("FAAS_SECRET_API_KEY", "from-env")
+	t.Setenv("FAAS_SECRET_PAYMENTS_DB_PASSWORD", "pw")
+
+	backend := NewEnvBackend("")
+	value, err := backend.Get("api-key", "")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", string(value))
+
+	value, err = backend.Get("payments/db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "pw", string(value))
+
+	_, err = backend.Get("missing", "")
+	assert.ErrorIs(t, err, ErrSecretNotFound)
+	assert.ErrorIs(t, backend.Create("x", []byte("y")), ErrReadOnlyBackend)
+
+	names, err := backend.List()
+	require.NoError(t, err)
+	assert.Contains(t, names, "api-key")
+}
+
+func TestDirectoryBackend(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "payments", "db"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "api-key"), []byte("k"), 0400))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "payments", "db", "password"), []byte("pw"), 0400))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ".hidden"), []byte("h"), 0400))
+
+	backend, err := NewDirectoryBackend(dir)
+	require.NoError(t, err)
+
+	value, err := backend.Get("payments/db", "password")
+	require.NoError(t, err)
+	assert.Equal(t, "pw", string(value))
+
+	exists, err := backend.Exists("payments/db", "")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	names, err := backend.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"api-key", "payments/db/password"}, names)
+	assert.ErrorIs(t, backend.Delete("api-key"), ErrReadOnlyBackend)
+}
+
+func TestSecretManagerWithBackendReferences(t *testing.T) {
+	stub := newVaultStub("root")
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	backend, err := NewVaultBackend(VaultConfig{Address: server.URL, Token: "root"}, testLogger())
+	require.NoError(t, err)
+
+	sm, err := NewSecretManager(filepath.Join(t.TempDir(), "store"), testLogger())
+	require.NoError(t, err)
+	require.NoError(t, sm.SetRuntimePath(filepath.Join(t.TempDir(), "runtime")))
+	require.NoError(t, sm.SetBackend(backend))
+
+	stub.secrets["payments/db"] = map[string]interface{}{"password": "pw1"}
+	stub.versions["payments/db"] = 1
+
+	refs := []string{"db-password=payments/db#password"}
+	require.NoError(t, sm.ValidateSecrets(refs))
+	assert.Error(t, sm.ValidateSecrets([]string{"payments/db#missing"}))
+	assert.Error(t, sm.EnableEncryption(mustKeyring(t)))
+
+	dir, err := sm.MaterializeFunctionSecrets("checkout", refs)
+	require.NoError(t, err)
+	data, err := os.ReadFile(filepath.Join(dir, "db-password"))
+	require.NoError(t, err)
+	assert.Equal(t, "pw1", string(data))
+
+	stub.secrets["payments/db"]["password"] = "pw2"
+	refreshed, err := sm.RefreshMaterializedSecret("payments/db")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"checkout"}, refreshed)
+	data, err = os.ReadFile(filepath.Join(dir, "db-password"))
+	require.NoError(t, err)
+	assert.Equal(t, "pw2", string(data))
+
+	_, err = sm.MaterializeFunctionSecrets("checkout", []string{"a/token", "b/token"})
+	assert.Error(t, err)
+}
+
+func TestSecretManagerReadOnlyBackend(t *testing.T) {
+	t.Setenv("FAAS_SECRET_API_KEY", "from-env")
+
+	sm, err := NewSecretManager(filepath.Join(t.TempDir(), "store"), testLogger())
+	require.NoError(t, err)
+	require.NoError(t, sm.SetBackend(NewEnvBackend("")))
+	sm.SetAutoCreate(true)
+
+	assert.False(t, sm.AutoCreateEnabled())
+	assert.ErrorIs(t, sm.CreateSecret("new", "value"), ErrReadOnlyBackend)
+	assert.ErrorIs(t, sm.DeleteSecret("api-key"), ErrReadOnlyBackend)
+
+	value, err := sm.GetSecret("api-key")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", value)
+}
+
+func mustKeyring(t *testing.T) *Keyring {
+	t.Helper()
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	return keyring
+}
@@ -0,0 +1,257 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	// envelopeFormat marks a secret file as an encrypted envelope
+	envelopeFormat = "docker-faas-secret/v1"
+	// MasterKeySize is the required master key length in bytes (AES-256)
+	MasterKeySize = 32
+)
+
+// envelope is the on-disk representation of an encrypted secret. Each secret
+// is encrypted with its own data key, which is in turn wrapped by the master key.
+type envelope struct {
+	Format     string `json:"format"`
+	KeyID      string `json:"keyId"`
+	WrappedKey string `json:"wrappedKey"`
+	KeyNonce   string `json:"keyNonce"`
+	Nonce      string `json:"nonce"`
+	Ciphertext string `json:"ciphertext"`
+}
+
+// masterKey is a key-encryption key identified by a short fingerprint
+type masterKey struct {
+	id  string
+	key []byte
+}
+
+// Keyring holds the current master key and any previous keys that are still
+// accepted for decryption during a rotation.
+type Keyring struct {
+	current  *masterKey
+	previous map[string]*masterKey
+}
+
+// NewKeyring creates a keyring from the current master key and optional previous keys
+func NewKeyring(current []byte, previous ...[]byte) (*Keyring, error) {
+	cur, err := newMasterKey(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid master key: %w", err)
+	}
+
+	kr := &Keyring{
+		current:  cur,
+		previous: make(map[string]*masterKey),
+	}
+	for _, raw := range previous {
+		if len(raw) == 0 {
+			continue
+		}
+		prev, err := newMasterKey(raw)
+		if err != nil {
+			return nil, fmt.Errorf("invalid previous master key: %w", err)
+		}
+		if prev.id != cur.id {
+			kr.previous[prev.id] = prev
+		}
+	}
+	return kr, nil
+}
+
+// CurrentKeyID returns the fingerprint of the active master key
+func (kr *Keyring) CurrentKeyID() string {
+	return kr.current.id
+}
+
+func newMasterKey(raw []byte) (*masterKey, error) {
+	if len(raw) != MasterKeySize {
+		return nil, fmt.Errorf("master key must be %d bytes, got %d", MasterKeySize, len(raw))
+	}
+	sum := sha256.Sum256(raw)
+	key := make([]byte, len(raw))
+	copy(key, raw)
+	return &masterKey{id: hex.EncodeToString(sum[:4]), key: key}, nil
+}
+
+func (kr *Keyring) lookup(id string) *masterKey {
+	if kr.current.id == id {
+		return kr.current
+	}
+	return kr.previous[id]
+}
+
+// LoadMasterKey resolves a master key from an inline value or a key file.
+// The inline value takes precedence. Keys may be base64, hex, or raw 32 bytes.
+// Returns nil when neither source is configured.
+func LoadMasterKey(value, path string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+	if value == "" && path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read master key file: %w", err)
+		}
+		if len(data) == MasterKeySize {
+			return data, nil
+		}
+		value = strings.TrimSpace(string(data))
+	}
+	if value == "" {
+		return nil, nil
+	}
+
+	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil && len(decoded) == MasterKeySize {
+		return decoded, nil
+	}
+	if decoded, err := hex.DecodeString(value); err == nil && len(decoded) == MasterKeySize {
+		return decoded, nil
+	}
+	if len(value) == MasterKeySize {
+		return []byte(value), nil
+	}
+	return nil, fmt.Errorf("master key must decode to %d bytes (base64 or hex)", MasterKeySize)
+}
+
+// seal encrypts plaintext with a fresh data key wrapped by the current master key.
+// The secret name is bound to the ciphertext as additional authenticated data.
+func (kr *Keyring) seal(name string, plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, MasterKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+
+	keyNonce, wrappedKey, err := gcmSeal(kr.current.key, dataKey, []byte(kr.current.id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+	nonce, ciphertext, err := gcmSeal(dataKey, plaintext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt secret: %w", err)
+	}
+
+	return json.Marshal(envelope{
+		Format:     envelopeFormat,
+		KeyID:      kr.current.id,
+		WrappedKey: base64.StdEncoding.EncodeToString(wrappedKey),
+		KeyNonce:   base64.StdEncoding.EncodeToString(keyNonce),
+		Nonce:      base64.StdEncoding.EncodeToString(nonce),
+		Ciphertext: base64.StdEncoding.EncodeToString(ciphertext),
+	})
+}
+
+// open decrypts an envelope produced by seal
+func (kr *Keyring) open(name string, env *envelope) ([]byte, error) {
+	mk := kr.lookup(env.KeyID)
+	if mk == nil {
+		return nil, fmt.Errorf("secret %s is encrypted with unknown master key %s", name, env.KeyID)
+	}
+
+	wrappedKey, err := base64.StdEncoding.DecodeString(env.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	keyNonce, err := base64.StdEncoding.DecodeString(env.KeyNonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid key nonce: %w", err)
+	}
+	nonce, err := base64.StdEncoding.DecodeString(env.Nonce)
+	if err != nil {
+		return nil, fmt.Errorf("invalid nonce: %w", err)
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(env.Ciphertext)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ciphertext: %w", err)
+	}
+
+	dataKey, err := gcmOpen(mk.key, keyNonce, wrappedKey, []byte(mk.id))
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key for %s: %w", name, err)
+	}
+	plaintext, err := gcmOpen(dataKey, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secret %s: %w", name, err)
+	}
+	return plaintext, nil
+}
+
+// parseEnvelope returns the envelope stored in data, or nil if data is plaintext
+func parseEnvelope(data []byte) *envelope {
+	if len(data) == 0 || data[0] != '{' {
+		return nil
+	}
+	var env envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil
+	}
+	if env.Format != envelopeFormat {
+		return nil
+	}
+	return &env
+}
+
+func gcmSeal(key, plaintext, aad []byte) ([]byte, []byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, nil, err
+	}
+	return nonce, aead.Seal(nil, nonce, plaintext, aad), nil
+}
+
+func gcmOpen(key, nonce, ciphertext, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size")
+	}
+	return aead.Open(nil, nonce, ciphertext, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// Seal encrypts a value bound to name for storage outside the secret store
+func (kr *Keyring) Seal(name string, plaintext []byte) ([]byte, error) {
+	return kr.seal(name, plaintext)
+}
+
+// Open decrypts a value produced by Seal. Data that is not an envelope is
+// returned unchanged so values stored before encryption was enabled remain
+// readable; sealed reports whether data was an envelope under the current key.
+func (kr *Keyring) Open(name string, data []byte) (plaintext []byte, sealed bool, err error) {
+	env := parseEnvelope(data)
+	if env == nil {
+		return data, false, nil
+	}
+	plaintext, err = kr.open(name, env)
+	if err != nil {
+		return nil, false, err
+	}
+	return plaintext, env.KeyID == kr.current.id, nil
+}
+
+// IsSealed reports whether data is an encrypted envelope
+func IsSealed(data []byte) bool {
+	return parseEnvelope(data) != nil
+}
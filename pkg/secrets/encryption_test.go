@@ -0,0 +1,154 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testKey(fill byte) []byte {
+	return bytes.Repeat([]byte{fill}, MasterKeySize)
+}
+
+func newEncryptedManager(t *testing.T, keyring *Keyring) (*SecretManager, string, string) {
+	t.Helper()
+	baseDir := filepath.Join(t.TempDir(), "store")
+	runtimeDir := filepath.Join(t.TempDir(), "runtime")
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	sm, err := NewSecretManager(baseDir, logger)
+	require.NoError(t, err)
+	require.NoError(t, sm.SetRuntimePath(runtimeDir))
+	if keyring != nil {
+		require.NoError(t, sm.EnableEncryption(keyring))
+	}
+	return sm, baseDir, runtimeDir
+}
+
+func TestEncryptedSecretRoundTrip(t *testing.T) {
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	sm, baseDir, runtimeDir := newEncryptedManager(t, keyring)
+
+	require.NoError(t, sm.CreateSecret("db-password", "hunter2"))
+
+	raw, err := os.ReadFile(filepath.Join(baseDir, "db-password"))
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "hunter2")
+	assert.NotNil(t, parseEnvelope(raw))
+
+	value, err := sm.GetSecret("db-password")
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", value)
+
+	dir, err := sm.MaterializeFunctionSecrets("api", []string{"db-password"})
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(runtimeDir, "api"), dir)
+
+	materialized := filepath.Join(dir, "db-password")
+	data, err := os.ReadFile(materialized)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(data))
+	info, err := os.Stat(materialized)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0400), info.Mode().Perm())
+
+	require.NoError(t, sm.DeleteSecret("db-password"))
+	_, err = os.Stat(materialized)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestEncryptedSecretBoundToName(t *testing.T) {
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	sm, baseDir, _ := newEncryptedManager(t, keyring)
+
+	require.NoError(t, sm.CreateSecret("a", "value-a"))
+	raw, err := os.ReadFile(filepath.Join(baseDir, "a"))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(baseDir, "b"), raw, 0400))
+
+	_, err = sm.GetSecret("b")
+	assert.Error(t, err)
+}
+
+func TestMigrateSecretsEncryptsPlaintext(t *testing.T) {
+	sm, baseDir, _ := newEncryptedManager(t, nil)
+	require.NoError(t, sm.CreateSecret("legacy", "plain-value"))
+
+	keyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	require.NoError(t, sm.EnableEncryption(keyring))
+
+	migrated, err := sm.MigrateSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 1, migrated)
+
+	raw, err := os.ReadFile(filepath.Join(baseDir, "legacy"))
+	require.NoError(t, err)
+	assert.NotNil(t, parseEnvelope(raw))
+
+	value, err := sm.GetSecret("legacy")
+	require.NoError(t, err)
+	assert.Equal(t, "plain-value", value)
+
+	migrated, err = sm.MigrateSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 0, migrated)
+}
+
+func TestMigrateSecretsRotatesMasterKey(t *testing.T) {
+	oldKeyring, err := NewKeyring(testKey(1))
+	require.NoError(t, err)
+	sm, baseDir, _ := newEncryptedManager(t, oldKeyring)
+	require.NoError(t, sm.CreateSecret("token", "abc123"))
+
+	newKeyring, err := NewKeyring(testKey(2), testKey(1))
+	require.NoError(t, err)
+	require.NoError(t, sm.EnableEncryption(newKeyring))
+
+	rotated, err := sm.MigrateSecrets()
+	require.NoError(t, err)
+	assert.Equal(t, 1, rotated)
+
+	raw, err := os.ReadFile(filepath.Join(baseDir, "token"))
+	require.NoError(t, err)
+	env := parseEnvelope(raw)
+	require.NotNil(t, env)
+	assert.Equal(t, newKeyring.CurrentKeyID(), env.KeyID)
+
+	// The old key alone can no longer decrypt the secret
+	require.NoError(t, sm.EnableEncryption(oldKeyring))
+	_, err = sm.GetSecret("token")
+	assert.Error(t, err)
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	key := testKey(7)
+
+	loaded, err := LoadMasterKey(base64.StdEncoding.EncodeToString(key), "")
+	require.NoError(t, err)
+	assert.Equal(t, key, loaded)
+
+	keyFile := filepath.Join(t.TempDir(), "master.key")
+	require.NoError(t, os.WriteFile(keyFile, key, 0400))
+	loaded, err = LoadMasterKey("", keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, key, loaded)
+
+	loaded, err = LoadMasterKey("", "")
+	require.NoError(t, err)
+	assert.Nil(t, loaded)
+
+	_, err = LoadMasterKey("too-short", "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,240 @@
+package secrets
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FileBackend stores secrets as files in a directory, optionally encrypted
+// at rest with envelope encryption
+type FileBackend struct {
+	basePath string
+	keyring  *Keyring
+	mu       sync.RWMutex
+	logger   *logrus.Logger
+}
+
+// NewFileBackend creates a file backend rooted at basePath
+func NewFileBackend(basePath string, logger *logrus.Logger) (*FileBackend, error) {
+	if basePath == "" {
+		basePath = DefaultSecretsPath
+	}
+
+	// Create base directory if it doesn't exist
+	if err := os.MkdirAll(basePath, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	}
+
+	return &FileBackend{
+		basePath: basePath,
+		logger:   logger,
+	}, nil
+}
+
+// Name returns the backend type
+func (b *FileBackend) Name() string {
+	return BackendFile
+}
+
+// ReadOnly reports false; secrets are managed through the API
+func (b *FileBackend) ReadOnly() bool {
+	return false
+}
+
+// BasePath returns the directory secrets are stored in
+func (b *FileBackend) BasePath() string {
+	return b.basePath
+}
+
+// SetKeyring enables envelope encryption for secrets written from now on
+func (b *FileBackend) SetKeyring(keyring *Keyring) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.keyring = keyring
+}
+
+// EncryptionEnabled reports whether secrets are encrypted at rest
+func (b *FileBackend) EncryptionEnabled() bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.keyring != nil
+}
+
+// Migrate encrypts plaintext secrets and re-encrypts secrets sealed with a
+// previous master key. Returns the number of secrets rewritten.
+func (b *FileBackend) Migrate() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.keyring == nil {
+		return 0, fmt.Errorf("secret encryption is not enabled")
+	}
+
+	names, err := b.listSecretNames()
+	if err != nil {
+		return 0, err
+	}
+
+	rewritten := 0
+	for _, name := range names {
+		raw, err := os.ReadFile(filepath.Join(b.basePath, name))
+		if err != nil {
+			return rewritten, fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+
+		env := parseEnvelope(raw)
+		if env != nil && env.KeyID == b.keyring.CurrentKeyID() {
+			continue
+		}
+
+		plaintext := raw
+		if env != nil {
+			plaintext, err = b.keyring.open(name, env)
+			if err != nil {
+				return rewritten, err
+			}
+		}
+
+		if err := b.writeSecretFile(name, plaintext); err != nil {
+			return rewritten, fmt.Errorf("failed to re-encrypt secret %s: %w", name, err)
+		}
+		rewritten++
+	}
+
+	if rewritten > 0 {
+		b.logger.Infof("Re-encrypted %d secrets with master key %s", rewritten, b.keyring.CurrentKeyID())
+	}
+	return rewritten, nil
+}
+
+// Get reads and, when needed, decrypts a secret
+func (b *FileBackend) Get(secretPath, key string) ([]byte, error) {
+	if key != "" {
+		return nil, fmt.Errorf("file secret backend does not support keys (%s#%s)", secretPath, key)
+	}
+	if err := validateSecretName(secretPath); err != nil {
+		return nil, err
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	data, err := os.ReadFile(filepath.Join(b.basePath, secretPath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFound(secretPath)
+		}
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+
+	env := parseEnvelope(data)
+	if env == nil {
+		return data, nil
+	}
+	if b.keyring == nil {
+		return nil, fmt.Errorf("secret %s is encrypted but no master key is configured", secretPath)
+	}
+	return b.keyring.open(secretPath, env)
+}
+
+// Exists checks if a secret file exists
+func (b *FileBackend) Exists(secretPath, key string) (bool, error) {
+	if key != "" || validateSecretName(secretPath) != nil {
+		return false, nil
+	}
+	_, err := os.Stat(filepath.Join(b.basePath, secretPath))
+	if err == nil {
+		return true, nil
+	}
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	return false, err
+}
+
+// List lists secret files, skipping in-flight temporary files
+func (b *FileBackend) List() ([]string, error) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.listSecretNames()
+}
+
+// Create writes a new secret
+func (b *FileBackend) Create(name string, data []byte) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(b.basePath, name)); err == nil {
+		return fmt.Errorf("%w: %s", ErrSecretExists, name)
+	}
+	return b.writeSecretFile(name, data)
+}
+
+// Update replaces an existing secret
+func (b *FileBackend) Update(name string, data []byte) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(b.basePath, name)); os.IsNotExist(err) {
+		return notFound(name)
+	}
+	return b.writeSecretFile(name, data)
+}
+
+// Delete removes a secret file
+func (b *FileBackend) Delete(name string) error {
+	if err := validateSecretName(name); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	secretPath := filepath.Join(b.basePath, name)
+	if _, err := os.Stat(secretPath); os.IsNotExist(err) {
+		return notFound(name)
+	}
+	return os.Remove(secretPath)
+}
+
+// writeSecretFile stores a secret value, encrypting it when enabled. Callers must hold b.mu.
+func (b *FileBackend) writeSecretFile(name string, data []byte) error {
+	if b.keyring != nil {
+		sealed, err := b.keyring.seal(name, data)
+		if err != nil {
+			return err
+		}
+		data = sealed
+	}
+	return writeFileAtomic(filepath.Join(b.basePath, name), data, 0400)
+}
+
+// listSecretNames lists secret files. Callers must hold b.mu.
+func (b *FileBackend) listSecretNames() ([]string, error) {
+	files, err := os.ReadDir(b.basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+
+	secrets := make([]string, 0, len(files))
+	for _, file := range files {
+		if !file.IsDir() && !strings.HasPrefix(file.Name(), ".") {
+			secrets = append(secrets, file.Name())
+		}
+	}
+
+	return secrets, nil
+}
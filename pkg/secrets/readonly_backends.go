@@ -0,0 +1,234 @@
+package secrets
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultEnvPrefix is the environment variable prefix for the env backend
+	DefaultEnvPrefix = "FAAS_SECRET_"
+	// DefaultDirectoryPath is where the directory backend reads mounted secrets
+	DefaultDirectoryPath = "/run/secrets"
+)
+
+// EnvBackend resolves secrets from the gateway's environment. A reference
+// such as payments/db#password maps to FAAS_SECRET_PAYMENTS_DB_PASSWORD.
+type EnvBackend struct {
+	prefix string
+}
+
+// NewEnvBackend creates a read-only backend over environment variables
+func NewEnvBackend(prefix string) *EnvBackend {
+	if prefix == "" {
+		prefix = DefaultEnvPrefix
+	}
+	return &EnvBackend{prefix: prefix}
+}
+
+// Name returns the backend type
+func (b *EnvBackend) Name() string {
+	return BackendEnv
+}
+
+// ReadOnly reports true; values come from the gateway environment
+func (b *EnvBackend) ReadOnly() bool {
+	return true
+}
+
+// Get reads the environment variable a reference maps to
+func (b *EnvBackend) Get(secretPath, key string) ([]byte, error) {
+	if err := validateSecretPath(secretPath); err != nil {
+		return nil, err
+	}
+	value, ok := os.LookupEnv(b.envName(secretPath, key))
+	if !ok {
+		return nil, notFound(secretPath)
+	}
+	return []byte(value), nil
+}
+
+// Exists reports whether the environment variable is set
+func (b *EnvBackend) Exists(secretPath, key string) (bool, error) {
+	if validateSecretPath(secretPath) != nil {
+		return false, nil
+	}
+	_, ok := os.LookupEnv(b.envName(secretPath, key))
+	return ok, nil
+}
+
+// List returns secret names derived from prefixed environment variables
+func (b *EnvBackend) List() ([]string, error) {
+	secrets := []string{}
+	for _, entry := range os.Environ() {
+		name := strings.SplitN(entry, "=", 2)[0]
+		if !strings.HasPrefix(name, b.prefix) || name == b.prefix {
+			continue
+		}
+		secrets = append(secrets, strings.ReplaceAll(strings.ToLower(strings.TrimPrefix(name, b.prefix)), "_", "-"))
+	}
+	sort.Strings(secrets)
+	return secrets, nil
+}
+
+// Create is not supported by the env backend
+func (b *EnvBackend) Create(name string, data []byte) error {
+	return ErrReadOnlyBackend
+}
+
+// Update is not supported by the env backend
+func (b *EnvBackend) Update(name string, data []byte) error {
+	return ErrReadOnlyBackend
+}
+
+// Delete is not supported by the env backend
+func (b *EnvBackend) Delete(name string) error {
+	return ErrReadOnlyBackend
+}
+
+// envName upper-cases the reference and replaces other characters with underscores
+func (b *EnvBackend) envName(secretPath, key string) string {
+	ref := secretPath
+	if key != "" {
+		ref += "_" + key
+	}
+	return b.prefix + strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, ref)
+}
+
+// DirectoryBackend resolves secrets from files mounted into the gateway,
+// such as Docker or Kubernetes secrets. A reference path#key reads the file
+// <path>/<key> below the directory.
+type DirectoryBackend struct {
+	basePath string
+}
+
+// NewDirectoryBackend creates a read-only backend over a directory
+func NewDirectoryBackend(basePath string) (*DirectoryBackend, error) {
+	if basePath == "" {
+		basePath = DefaultDirectoryPath
+	}
+	info, err := os.Stat(basePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open secrets directory: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("secrets directory %s is not a directory", basePath)
+	}
+	return &DirectoryBackend{basePath: basePath}, nil
+}
+
+// Name returns the backend type
+func (b *DirectoryBackend) Name() string {
+	return BackendDirectory
+}
+
+// ReadOnly reports true; files are managed outside docker-faas
+func (b *DirectoryBackend) ReadOnly() bool {
+	return true
+}
+
+// Get reads a mounted secret file
+func (b *DirectoryBackend) Get(secretPath, key string) ([]byte, error) {
+	filePath, err := b.filePath(secretPath, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, notFound(secretPath)
+		}
+		return nil, fmt.Errorf("failed to read secret: %w", err)
+	}
+	return data, nil
+}
+
+// Exists reports whether the mounted secret file exists
+func (b *DirectoryBackend) Exists(secretPath, key string) (bool, error) {
+	filePath, err := b.filePath(secretPath, key)
+	if err != nil {
+		return false, nil
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return !info.IsDir(), nil
+}
+
+// List returns the relative paths of all files below the directory,
+// skipping hidden entries such as Kubernetes' ..data links
+func (b *DirectoryBackend) List() ([]string, error) {
+	secrets := []string{}
+	err := filepath.WalkDir(b.basePath, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if filePath == b.basePath {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(b.basePath, filePath)
+		if err != nil {
+			return err
+		}
+		secrets = append(secrets, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secrets: %w", err)
+	}
+	return secrets, nil
+}
+
+// Create is not supported by the directory backend
+func (b *DirectoryBackend) Create(name string, data []byte) error {
+	return ErrReadOnlyBackend
+}
+
+// Update is not supported by the directory backend
+func (b *DirectoryBackend) Update(name string, data []byte) error {
+	return ErrReadOnlyBackend
+}
+
+// Delete is not supported by the directory backend
+func (b *DirectoryBackend) Delete(name string) error {
+	return ErrReadOnlyBackend
+}
+
+func (b *DirectoryBackend) filePath(secretPath, key string) (string, error) {
+	if err := validateSecretPath(secretPath); err != nil {
+		return "", err
+	}
+	if key != "" {
+		if err := validateSecretName(key); err != nil {
+			return "", err
+		}
+		secretPath += "/" + key
+	}
+	return filepath.Join(b.basePath, filepath.FromSlash(secretPath)), nil
+}
@@ -2,9 +2,12 @@ package secrets
 
 import (
 	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
 
@@ -16,82 +19,388 @@ const (
 	DefaultSecretsPath = "/var/openfaas/secrets"
 	// ContainerSecretsPath is where secrets are mounted in containers
 	ContainerSecretsPath = "/var/openfaas/secrets"
+	// DefaultRuntimePath is where decrypted secrets are materialized for containers
+	DefaultRuntimePath = "/run/docker-faas/secrets"
+
+	// runtimeDirName is the fallback runtime directory inside the store path
+	runtimeDirName = ".runtime"
+	// refsDirName holds the secret references materialized for each function
+	refsDirName = ".refs"
 )
 
-// SecretManager manages secrets for functions
+// SecretManager manages secrets for functions. Values are resolved through
+// a SecretBackend and materialized into per-function runtime directories.
 type SecretManager struct {
-	basePath string
-	mu       sync.RWMutex
-	logger   *logrus.Logger
+	backend     SecretBackend
+	files       *FileBackend
+	runtimePath string
+	autoCreate  bool
+	mu          sync.RWMutex
+	logger      *logrus.Logger
 }
 
-// NewSecretManager creates a new secret manager
+// NewSecretManager creates a new secret manager backed by the file store
 func NewSecretManager(basePath string, logger *logrus.Logger) (*SecretManager, error) {
-	if basePath == "" {
-		basePath = DefaultSecretsPath
-	}
-
-	// Create base directory if it doesn't exist
-	if err := os.MkdirAll(basePath, 0700); err != nil {
-		return nil, fmt.Errorf("failed to create secrets directory: %w", err)
+	files, err := NewFileBackend(basePath, logger)
+	if err != nil {
+		return nil, err
 	}
 
 	return &SecretManager{
-		basePath: basePath,
-		logger:   logger,
+		backend:     files,
+		files:       files,
+		runtimePath: filepath.Join(files.BasePath(), runtimeDirName),
+		logger:      logger,
 	}, nil
 }
 
-// CreateSecret creates a new secret
-func (sm *SecretManager) CreateSecret(name, value string) error {
+// SetBackend replaces the backend secrets are resolved from
+func (sm *SecretManager) SetBackend(backend SecretBackend) error {
+	if backend == nil {
+		return fmt.Errorf("secret backend is required")
+	}
+
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	secretPath := filepath.Join(sm.basePath, name)
+	sm.backend = backend
+	if files, ok := backend.(*FileBackend); ok {
+		sm.files = files
+	}
+	sm.logger.Infof("Using %s secret backend", backend.Name())
+	return nil
+}
+
+// Backend returns the active secret backend
+func (sm *SecretManager) Backend() SecretBackend {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.backend
+}
 
-	// Check if secret already exists
-	if _, err := os.Stat(secretPath); err == nil {
-		return fmt.Errorf("secret already exists: %s", name)
+// SetRuntimePath configures where per-function secret directories are
+// materialized. With encryption enabled this should be a tmpfs mount.
+func (sm *SecretManager) SetRuntimePath(runtimePath string) error {
+	if runtimePath == "" {
+		runtimePath = DefaultRuntimePath
+	}
+	if filepath.Clean(runtimePath) == filepath.Clean(sm.GetBasePath()) {
+		return fmt.Errorf("secrets runtime path must differ from the secrets store path")
+	}
+	if err := os.MkdirAll(runtimePath, 0700); err != nil {
+		return fmt.Errorf("failed to create secrets runtime directory: %w", err)
 	}
 
-	// Decode if base64 encoded, otherwise use raw value
-	data := []byte(value)
-	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
-		data = decoded
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	sm.runtimePath = runtimePath
+	return nil
+}
+
+// EnableEncryption turns on envelope encryption at rest for the file
+// backend. Decrypted values are only written to the runtime path, which
+// should be a tmpfs mount.
+func (sm *SecretManager) EnableEncryption(keyring *Keyring) error {
+	if keyring == nil {
+		return fmt.Errorf("keyring is required")
 	}
 
-	// Write secret with restricted permissions (owner read-only)
-	if err := os.WriteFile(secretPath, data, 0400); err != nil {
-		return fmt.Errorf("failed to write secret: %w", err)
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if _, ok := sm.backend.(*FileBackend); !ok {
+		return fmt.Errorf("encryption at rest is only supported by the %s secret backend", BackendFile)
+	}
+	if !isTmpfs(sm.runtimePath) {
+		sm.logger.Warnf("Secrets runtime path %s is not a tmpfs mount; decrypted secrets may be written to disk", sm.runtimePath)
 	}
 
-	sm.logger.Infof("Created secret: %s", name)
+	sm.files.SetKeyring(keyring)
+	sm.logger.Infof("Secret encryption enabled (key %s)", keyring.CurrentKeyID())
 	return nil
 }
 
-// UpdateSecret updates an existing secret
-func (sm *SecretManager) UpdateSecret(name, value string) error {
+// SetAutoCreate controls whether secrets referenced by a deployment but not
+// yet created are auto-created with empty values. Disabled by default.
+func (sm *SecretManager) SetAutoCreate(enabled bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	sm.autoCreate = enabled
+}
+
+// AutoCreateEnabled reports whether missing secrets are auto-created
+func (sm *SecretManager) AutoCreateEnabled() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.autoCreate && !sm.backend.ReadOnly()
+}
+
+// EncryptionEnabled reports whether secrets are encrypted at rest
+func (sm *SecretManager) EncryptionEnabled() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+	return sm.files.EncryptionEnabled()
+}
+
+// MigrateSecrets encrypts plaintext secrets and re-encrypts secrets sealed
+// with a previous master key. Returns the number of secrets rewritten.
+func (sm *SecretManager) MigrateSecrets() (int, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	return sm.files.Migrate()
+}
+
+// MaterializeFunctionSecrets resolves the function's secret references and
+// writes their plaintext into the function's runtime directory, returning
+// it. The directory is mounted into every replica, so files are replaced
+// atomically and secrets no longer referenced by the function are removed.
+func (sm *SecretManager) MaterializeFunctionSecrets(functionName string, secretRefs []string) (string, error) {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	secretPath := filepath.Join(sm.basePath, name)
+	dir, err := sm.functionRuntimeDir(functionName)
+	if err != nil {
+		return "", err
+	}
+	refs, err := parseSecretRefs(secretRefs)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create function secrets directory: %w", err)
+	}
+
+	wanted := make(map[string]bool, len(refs))
+	for _, ref := range refs {
+		data, err := sm.backend.Get(ref.Path, ref.Key)
+		if err != nil {
+			return "", err
+		}
+		if err := writeFileAtomic(filepath.Join(dir, ref.Name), data, 0400); err != nil {
+			return "", fmt.Errorf("failed to materialize secret %s: %w", ref.Name, err)
+		}
+		wanted[ref.Name] = true
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", fmt.Errorf("failed to read function secrets directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !wanted[entry.Name()] {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+
+	if err := sm.writeFunctionRefs(functionName, refs); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// RefreshMaterializedSecret rewrites every materialized copy of the secret
+// at a backend path so running functions see the current value. Returns the
+// functions refreshed.
+func (sm *SecretManager) RefreshMaterializedSecret(secretPath string) ([]string, error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
 
-	// Check if secret exists
-	if _, err := os.Stat(secretPath); os.IsNotExist(err) {
-		return fmt.Errorf("secret not found: %s", name)
+	usage, err := sm.materializedRefs(secretPath)
+	if err != nil || len(usage) == 0 {
+		return nil, err
 	}
 
-	// Decode if base64 encoded, otherwise use raw value
-	data := []byte(value)
+	refreshed := make([]string, 0, len(usage))
+	for _, functionName := range sortedKeys(usage) {
+		for _, ref := range usage[functionName] {
+			data, err := sm.backend.Get(ref.Path, ref.Key)
+			if err != nil {
+				return refreshed, err
+			}
+			target := filepath.Join(sm.runtimePath, functionName, ref.Name)
+			if err := writeFileAtomic(target, data, 0400); err != nil {
+				return refreshed, fmt.Errorf("failed to refresh secret %s for %s: %w", secretPath, functionName, err)
+			}
+		}
+		refreshed = append(refreshed, functionName)
+	}
+
+	sm.logger.Infof("Refreshed secret %s for functions: %s", secretPath, strings.Join(refreshed, ", "))
+	return refreshed, nil
+}
+
+// RemoveFunctionSecrets deletes the function's materialized secrets
+func (sm *SecretManager) RemoveFunctionSecrets(functionName string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	dir, err := sm.functionRuntimeDir(functionName)
+	if err != nil {
+		return err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to remove function secrets directory: %w", err)
+	}
+	if err := os.Remove(sm.functionRefsPath(functionName)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove function secret references: %w", err)
+	}
+	return nil
+}
+
+// materializedRefs maps functions to the materialized references that
+// resolve to a backend path. Callers must hold sm.mu.
+func (sm *SecretManager) materializedRefs(secretPath string) (map[string][]SecretRef, error) {
+	entries, err := os.ReadDir(filepath.Join(sm.runtimePath, refsDirName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to list materialized secret references: %w", err)
+	}
+
+	usage := make(map[string][]SecretRef)
+	for _, entry := range entries {
+		functionName := strings.TrimSuffix(entry.Name(), ".json")
+		if entry.IsDir() || functionName == entry.Name() {
+			continue
+		}
+		refs, err := sm.readFunctionRefs(functionName)
+		if err != nil {
+			sm.logger.Warnf("Skipping secret references for %s: %v", functionName, err)
+			continue
+		}
+		for _, ref := range refs {
+			if ref.Path == secretPath {
+				usage[functionName] = append(usage[functionName], ref)
+			}
+		}
+	}
+	return usage, nil
+}
+
+// functionRuntimeDir returns the runtime directory for a function. Callers must hold sm.mu.
+func (sm *SecretManager) functionRuntimeDir(functionName string) (string, error) {
+	if functionName == "" || functionName != filepath.Base(functionName) || strings.HasPrefix(functionName, ".") {
+		return "", fmt.Errorf("invalid function name: %s", functionName)
+	}
+	return filepath.Join(sm.runtimePath, functionName), nil
+}
+
+// functionRefsPath returns where a function's materialized references are
+// recorded. It lives outside the mounted directory. Callers must hold sm.mu.
+func (sm *SecretManager) functionRefsPath(functionName string) string {
+	return filepath.Join(sm.runtimePath, refsDirName, functionName+".json")
+}
+
+// writeFunctionRefs records the references materialized for a function.
+// Callers must hold sm.mu for writing.
+func (sm *SecretManager) writeFunctionRefs(functionName string, refs []SecretRef) error {
+	if err := os.MkdirAll(filepath.Join(sm.runtimePath, refsDirName), 0700); err != nil {
+		return fmt.Errorf("failed to create secret references directory: %w", err)
+	}
+	data, err := json.Marshal(refs)
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(sm.functionRefsPath(functionName), data, 0600)
+}
+
+// readFunctionRefs loads the references materialized for a function. Callers must hold sm.mu.
+func (sm *SecretManager) readFunctionRefs(functionName string) ([]SecretRef, error) {
+	data, err := os.ReadFile(sm.functionRefsPath(functionName))
+	if err != nil {
+		return nil, err
+	}
+	var refs []SecretRef
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return nil, err
+	}
+	return refs, nil
+}
+
+func validateSecretName(name string) error {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return fmt.Errorf("invalid secret name: %s", name)
+	}
+	return nil
+}
+
+// parseSecretRefs parses references, skipping blanks and rejecting two
+// references that would mount to the same file
+func parseSecretRefs(secretRefs []string) ([]SecretRef, error) {
+	refs := make([]SecretRef, 0, len(secretRefs))
+	seen := make(map[string]string, len(secretRefs))
+	for _, raw := range secretRefs {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		ref, err := ParseSecretRef(raw)
+		if err != nil {
+			return nil, err
+		}
+		if previous, ok := seen[ref.Name]; ok && previous != ref.String() {
+			return nil, fmt.Errorf("secret references %s and %s both mount as %s", previous, ref.String(), ref.Name)
+		}
+		seen[ref.Name] = ref.String()
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+func sortedKeys(m map[string][]SecretRef) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// decodeSecretValue decodes base64 values, otherwise uses the raw value
+func decodeSecretValue(value string) []byte {
 	if decoded, err := base64.StdEncoding.DecodeString(value); err == nil {
-		data = decoded
+		return decoded
 	}
+	return []byte(value)
+}
 
-	// Remove old secret
-	os.Remove(secretPath)
+// CreateSecret creates a new secret. Backends that support nested paths
+// accept names such as payments/stripe.
+func (sm *SecretManager) CreateSecret(name, value string) error {
+	if err := validateSecretPath(name); err != nil {
+		return err
+	}
 
-	// Write new secret with restricted permissions
-	if err := os.WriteFile(secretPath, data, 0400); err != nil {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.backend.ReadOnly() {
+		return fmt.Errorf("%w: %s", ErrReadOnlyBackend, sm.backend.Name())
+	}
+	if err := sm.backend.Create(name, decodeSecretValue(value)); err != nil {
+		if errors.Is(err, ErrSecretExists) {
+			return err
+		}
+		return fmt.Errorf("failed to write secret: %w", err)
+	}
+
+	sm.logger.Infof("Created secret: %s", name)
+	return nil
+}
+
+// UpdateSecret updates an existing secret
+func (sm *SecretManager) UpdateSecret(name, value string) error {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.backend.ReadOnly() {
+		return fmt.Errorf("%w: %s", ErrReadOnlyBackend, sm.backend.Name())
+	}
+	if err := sm.backend.Update(name, decodeSecretValue(value)); err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			return err
+		}
 		return fmt.Errorf("failed to update secret: %w", err)
 	}
 
@@ -104,89 +413,123 @@ func (sm *SecretManager) DeleteSecret(name string) error {
 	sm.mu.Lock()
 	defer sm.mu.Unlock()
 
-	secretPath := filepath.Join(sm.basePath, name)
-
-	// Check if secret exists
-	if _, err := os.Stat(secretPath); os.IsNotExist(err) {
-		return fmt.Errorf("secret not found: %s", name)
+	if sm.backend.ReadOnly() {
+		return fmt.Errorf("%w: %s", ErrReadOnlyBackend, sm.backend.Name())
 	}
-
-	if err := os.Remove(secretPath); err != nil {
+	if err := sm.backend.Delete(name); err != nil {
+		if errors.Is(err, ErrSecretNotFound) {
+			return err
+		}
 		return fmt.Errorf("failed to delete secret: %w", err)
 	}
+	if usage, err := sm.materializedRefs(name); err == nil {
+		for functionName, refs := range usage {
+			for _, ref := range refs {
+				os.Remove(filepath.Join(sm.runtimePath, functionName, ref.Name))
+			}
+		}
+	}
 
 	sm.logger.Infof("Deleted secret: %s", name)
 	return nil
 }
 
-// GetSecret retrieves a secret value
-func (sm *SecretManager) GetSecret(name string) (string, error) {
+// GetSecret retrieves a secret value by reference
+func (sm *SecretManager) GetSecret(secretRef string) (string, error) {
+	ref, err := ParseSecretRef(secretRef)
+	if err != nil {
+		return "", err
+	}
+
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	secretPath := filepath.Join(sm.basePath, name)
-
-	data, err := os.ReadFile(secretPath)
+	data, err := sm.backend.Get(ref.Path, ref.Key)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return "", fmt.Errorf("secret not found: %s", name)
-		}
-		return "", fmt.Errorf("failed to read secret: %w", err)
+		return "", err
 	}
 
 	return string(data), nil
 }
 
+// writeFileAtomic writes data to a temporary file and renames it into place
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Chmod(tmpPath, perm); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
 // ListSecrets lists all available secrets
 func (sm *SecretManager) ListSecrets() ([]string, error) {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	files, err := os.ReadDir(sm.basePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to list secrets: %w", err)
-	}
+	return sm.backend.List()
+}
 
-	secrets := make([]string, 0, len(files))
-	for _, file := range files {
-		if !file.IsDir() {
-			secrets = append(secrets, file.Name())
-		}
+// SecretExists checks if a secret reference resolves
+func (sm *SecretManager) SecretExists(secretRef string) bool {
+	ref, err := ParseSecretRef(secretRef)
+	if err != nil {
+		return false
 	}
 
-	return secrets, nil
-}
-
-// SecretExists checks if a secret exists
-func (sm *SecretManager) SecretExists(name string) bool {
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
-	secretPath := filepath.Join(sm.basePath, name)
-	_, err := os.Stat(secretPath)
-	return err == nil
+	exists, err := sm.backend.Exists(ref.Path, ref.Key)
+	return err == nil && exists
 }
 
-// GetSecretPath returns the path to a secret file
+// GetSecretPath returns the path to a secret file in the file store
 func (sm *SecretManager) GetSecretPath(name string) string {
-	return filepath.Join(sm.basePath, name)
+	return filepath.Join(sm.GetBasePath(), name)
 }
 
-// GetBasePath returns the base secrets path
+// GetBasePath returns the file store secrets path
 func (sm *SecretManager) GetBasePath() string {
-	return sm.basePath
+	return sm.files.BasePath()
 }
 
-// ValidateSecrets validates that all required secrets exist
-func (sm *SecretManager) ValidateSecrets(secretNames []string) error {
+// ValidateSecrets validates that all required secret references resolve
+func (sm *SecretManager) ValidateSecrets(secretRefs []string) error {
+	refs, err := parseSecretRefs(secretRefs)
+	if err != nil {
+		return err
+	}
+
 	sm.mu.RLock()
 	defer sm.mu.RUnlock()
 
 	missing := []string{}
-	for _, name := range secretNames {
-		secretPath := filepath.Join(sm.basePath, name)
-		if _, err := os.Stat(secretPath); os.IsNotExist(err) {
-			missing = append(missing, name)
+	for _, ref := range refs {
+		exists, err := sm.backend.Exists(ref.Path, ref.Key)
+		if err != nil {
+			return fmt.Errorf("failed to check secret %s: %w", ref.String(), err)
+		}
+		if !exists {
+			missing = append(missing, ref.String())
 		}
 	}
 
@@ -197,23 +540,26 @@ func (sm *SecretManager) ValidateSecrets(secretNames []string) error {
 	return nil
 }
 
-// EnsureSecrets creates any missing secrets with empty values.
-func (sm *SecretManager) EnsureSecrets(secretNames []string) ([]string, error) {
+// EnsureSecrets creates any missing secrets with empty values. Only plain
+// secret names are created; keyed references must already exist.
+func (sm *SecretManager) EnsureSecrets(secretRefs []string) ([]string, error) {
+	refs, err := parseSecretRefs(secretRefs)
+	if err != nil {
+		return nil, err
+	}
+
 	created := []string{}
-	for _, name := range secretNames {
-		if strings.TrimSpace(name) == "" {
-			continue
-		}
-		if sm.SecretExists(name) {
+	for _, ref := range refs {
+		if ref.Key != "" || ref.Path != ref.Name || sm.SecretExists(ref.Path) {
 			continue
 		}
-		if err := sm.CreateSecret(name, ""); err != nil {
-			if sm.SecretExists(name) {
+		if err := sm.CreateSecret(ref.Path, ""); err != nil {
+			if sm.SecretExists(ref.Path) {
 				continue
 			}
 			return created, err
 		}
-		created = append(created, name)
+		created = append(created, ref.Path)
 	}
 	return created, nil
 }
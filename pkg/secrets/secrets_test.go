@@ -2,8 +2,10 @@ package secrets
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"testing"
 
 	"github.com/sirupsen/logrus"
@@ -150,3 +152,103 @@ func TestSecretManagerConcurrency(t *testing.T) {
 	assert.NoError(t, err)
 	assert.GreaterOrEqual(t, len(secrets), 10)
 }
+
+func TestFunctionSecretsRefresh(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	sm, err := NewSecretManager(filepath.Join(t.TempDir(), "store"), logger)
+	require.NoError(t, err)
+	runtimeDir := filepath.Join(t.TempDir(), "runtime")
+	require.NoError(t, sm.SetRuntimePath(runtimeDir))
+
+	require.NoError(t, sm.CreateSecret("api-key", "v1"))
+	require.NoError(t, sm.CreateSecret("other", "x"))
+
+	dir, err := sm.MaterializeFunctionSecrets("orders", []string{"api-key", "other"})
+	require.NoError(t, err)
+	_, err = sm.MaterializeFunctionSecrets("billing", []string{"other"})
+	require.NoError(t, err)
+
+	// Keep a handle on the directory as a bind mount would
+	dirInfo, err := os.Stat(dir)
+	require.NoError(t, err)
+
+	require.NoError(t, sm.UpdateSecret("api-key", "v2"))
+	refreshed, err := sm.RefreshMaterializedSecret("api-key")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"orders"}, refreshed)
+
+	data, err := os.ReadFile(filepath.Join(dir, "api-key"))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", string(data))
+
+	after, err := os.Stat(dir)
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(dirInfo, after))
+
+	// Secrets dropped from the function are removed on the next materialize
+	_, err = sm.MaterializeFunctionSecrets("orders", []string{"api-key"})
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "other"))
+	assert.True(t, os.IsNotExist(err))
+
+	require.NoError(t, sm.RemoveFunctionSecrets("orders"))
+	_, err = os.Stat(dir)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestMaterializeFunctionSecretsConcurrently(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	sm, err := NewSecretManager(filepath.Join(t.TempDir(), "store"), logger)
+	require.NoError(t, err)
+	require.NoError(t, sm.SetRuntimePath(filepath.Join(t.TempDir(), "runtime")))
+	require.NoError(t, sm.CreateSecret("a", "1"))
+	require.NoError(t, sm.CreateSecret("b", "2"))
+
+	// Redeploys race each other and the refresh of a rotated secret; the
+	// directory must end up matching the references recorded last
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		refs := []string{"a"}
+		if i%2 == 1 {
+			refs = []string{"b"}
+		}
+		go func() {
+			defer wg.Done()
+			_, err := sm.MaterializeFunctionSecrets("orders", refs)
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := sm.RefreshMaterializedSecret("a")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	usage, err := sm.materializedRefs("a")
+	require.NoError(t, err)
+	entries, err := os.ReadDir(filepath.Join(sm.runtimePath, "orders"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	if len(usage["orders"]) == 1 {
+		assert.Equal(t, "a", entries[0].Name())
+	} else {
+		assert.Equal(t, "b", entries[0].Name())
+	}
+}
+
+func TestCreateSecretRejectsPathTraversal(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	sm, err := NewSecretManager(t.TempDir(), logger)
+	require.NoError(t, err)
+
+	assert.Error(t, sm.CreateSecret("../escape", "value"))
+	assert.Error(t, sm.CreateSecret(".hidden", "value"))
+}
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package secrets
+
+import "syscall"
+
+// tmpfsMagic is the filesystem type reported by statfs for tmpfs
+const tmpfsMagic = 0x01021994
+
+// isTmpfs reports whether path lives on a tmpfs filesystem
+func isTmpfs(path string) bool {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return false
+	}
+	return int64(st.Type) == tmpfsMagic
+}
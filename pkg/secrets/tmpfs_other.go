@@ -0,0 +1,9 @@
+//go:build !linux
+// +build !linux
+
+package secrets
+
+// isTmpfs always reports false on platforms without statfs filesystem types
+func isTmpfs(path string) bool {
+	return false
+}
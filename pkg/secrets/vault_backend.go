@@ -0,0 +1,389 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultVaultMount is the default KV v2 mount path
+	DefaultVaultMount = "secret"
+	// DefaultVaultAppRoleMount is the default AppRole auth mount path
+	DefaultVaultAppRoleMount = "approle"
+	// DefaultVaultField is the KV field read when a reference has no key
+	DefaultVaultField = "value"
+
+	vaultRequestTimeout = 10 * time.Second
+)
+
+// VaultConfig configures the Vault KV v2 backend. Either Token or
+// RoleID/SecretID (AppRole) must be set.
+type VaultConfig struct {
+	Address      string
+	Token        string
+	RoleID       string
+	SecretID     string
+	AppRoleMount string
+	Namespace    string
+	Mount        string
+	PathPrefix   string
+}
+
+// VaultBackend stores secrets in a HashiCorp Vault KV v2 secrets engine
+type VaultBackend struct {
+	config      VaultConfig
+	client      *http.Client
+	token       string
+	tokenExpiry time.Time
+	mu          sync.Mutex
+	logger      *logrus.Logger
+}
+
+type vaultKVResponse struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+type vaultListResponse struct {
+	Data struct {
+		Keys []string `json:"keys"`
+	} `json:"data"`
+}
+
+type vaultLoginResponse struct {
+	Auth struct {
+		ClientToken   string `json:"client_token"`
+		LeaseDuration int    `json:"lease_duration"`
+	} `json:"auth"`
+}
+
+type vaultErrorResponse struct {
+	Errors []string `json:"errors"`
+}
+
+// vaultError is returned for unexpected Vault API responses
+type vaultError struct {
+	status int
+	errors []string
+}
+
+func (e *vaultError) Error() string {
+	if len(e.errors) == 0 {
+		return fmt.Sprintf("vault returned status %d", e.status)
+	}
+	return fmt.Sprintf("vault returned status %d: %s", e.status, strings.Join(e.errors, "; "))
+}
+
+// NewVaultBackend creates a Vault KV v2 backend
+func NewVaultBackend(config VaultConfig, logger *logrus.Logger) (*VaultBackend, error) {
+	config.Address = strings.TrimRight(config.Address, "/")
+	if config.Address == "" {
+		return nil, fmt.Errorf("vault address is required")
+	}
+	if config.Token == "" && (config.RoleID == "" || config.SecretID == "") {
+		return nil, fmt.Errorf("vault token or AppRole role ID and secret ID are required")
+	}
+	if config.Mount = strings.Trim(config.Mount, "/"); config.Mount == "" {
+		config.Mount = DefaultVaultMount
+	}
+	if config.AppRoleMount = strings.Trim(config.AppRoleMount, "/"); config.AppRoleMount == "" {
+		config.AppRoleMount = DefaultVaultAppRoleMount
+	}
+	config.PathPrefix = strings.Trim(config.PathPrefix, "/")
+
+	return &VaultBackend{
+		config: config,
+		client: &http.Client{Timeout: vaultRequestTimeout},
+		logger: logger,
+	}, nil
+}
+
+// Name returns the backend type
+func (b *VaultBackend) Name() string {
+	return BackendVault
+}
+
+// ReadOnly reports false; secrets can be managed through the API
+func (b *VaultBackend) ReadOnly() bool {
+	return false
+}
+
+// Get reads a field of a KV secret. The default field is "value".
+func (b *VaultBackend) Get(secretPath, key string) ([]byte, error) {
+	if err := validateSecretPath(secretPath); err != nil {
+		return nil, err
+	}
+
+	secret, err := b.read(secretPath)
+	if err != nil {
+		return nil, err
+	}
+
+	field := key
+	if field == "" {
+		field = DefaultVaultField
+	}
+	value, ok := secret.Data.Data[field]
+	if !ok {
+		return nil, notFound(secretPath + "#" + field)
+	}
+	if str, ok := value.(string); ok {
+		return []byte(str), nil
+	}
+	return json.Marshal(value)
+}
+
+// Exists reports whether the secret field resolves
+func (b *VaultBackend) Exists(secretPath, key string) (bool, error) {
+	_, err := b.Get(secretPath, key)
+	if err == nil {
+		return true, nil
+	}
+	if errors.Is(err, ErrSecretNotFound) {
+		return false, nil
+	}
+	return false, err
+}
+
+// List returns all secret paths below the configured prefix
+func (b *VaultBackend) List() ([]string, error) {
+	secrets := []string{}
+	if err := b.list("", &secrets); err != nil {
+		return nil, err
+	}
+	return secrets, nil
+}
+
+// Create writes a new secret with the value in the default field. Vault's
+// check-and-set guards against overwriting an existing secret.
+func (b *VaultBackend) Create(name string, data []byte) error {
+	if err := validateSecretPath(name); err != nil {
+		return err
+	}
+
+	body := map[string]interface{}{
+		"options": map[string]interface{}{"cas": 0},
+		"data":    map[string]interface{}{DefaultVaultField: string(data)},
+	}
+	if err := b.do(http.MethodPost, b.apiPath("data", name), body, nil); err != nil {
+		if isCASMismatch(err) {
+			return fmt.Errorf("%w: %s", ErrSecretExists, name)
+		}
+		return err
+	}
+	return nil
+}
+
+// Update replaces the default field of an existing secret, keeping any
+// other fields stored alongside it
+func (b *VaultBackend) Update(name string, data []byte) error {
+	if err := validateSecretPath(name); err != nil {
+		return err
+	}
+
+	secret, err := b.read(name)
+	if err != nil {
+		return err
+	}
+
+	fields := secret.Data.Data
+	if fields == nil {
+		fields = make(map[string]interface{})
+	}
+	fields[DefaultVaultField] = string(data)
+	body := map[string]interface{}{
+		"options": map[string]interface{}{"cas": secret.Data.Metadata.Version},
+		"data":    fields,
+	}
+	if err := b.do(http.MethodPost, b.apiPath("data", name), body, nil); err != nil {
+		if isCASMismatch(err) {
+			return fmt.Errorf("secret %s was modified concurrently: %w", name, err)
+		}
+		return err
+	}
+	return nil
+}
+
+// Delete removes a secret and all of its versions
+func (b *VaultBackend) Delete(name string) error {
+	if err := validateSecretPath(name); err != nil {
+		return err
+	}
+	if _, err := b.read(name); err != nil {
+		return err
+	}
+	return b.do(http.MethodDelete, b.apiPath("metadata", name), nil, nil)
+}
+
+func (b *VaultBackend) read(secretPath string) (*vaultKVResponse, error) {
+	var secret vaultKVResponse
+	if err := b.do(http.MethodGet, b.apiPath("data", secretPath), nil, &secret); err != nil {
+		if vaultStatus(err) == http.StatusNotFound {
+			return nil, notFound(secretPath)
+		}
+		return nil, err
+	}
+	if secret.Data.Data == nil {
+		return nil, notFound(secretPath)
+	}
+	return &secret, nil
+}
+
+func (b *VaultBackend) list(dir string, secrets *[]string) error {
+	var resp vaultListResponse
+	if err := b.do("LIST", b.apiPath("metadata", dir), nil, &resp); err != nil {
+		if vaultStatus(err) == http.StatusNotFound {
+			return nil
+		}
+		return err
+	}
+
+	for _, key := range resp.Data.Keys {
+		child := path.Join(dir, strings.TrimSuffix(key, "/"))
+		if strings.HasSuffix(key, "/") {
+			if err := b.list(child, secrets); err != nil {
+				return err
+			}
+			continue
+		}
+		*secrets = append(*secrets, child)
+	}
+	return nil
+}
+
+// apiPath builds a KV v2 API path for a secret below the configured prefix
+func (b *VaultBackend) apiPath(kind, secretPath string) string {
+	return path.Join(b.config.Mount, kind, b.config.PathPrefix, secretPath)
+}
+
+// do sends an authenticated request, logging in again once if an AppRole
+// token has been revoked or expired
+func (b *VaultBackend) do(method, apiPath string, body, out interface{}) error {
+	token, err := b.authToken(false)
+	if err != nil {
+		return err
+	}
+	err = b.send(method, apiPath, token, body, out)
+	if vaultStatus(err) == http.StatusForbidden && b.config.RoleID != "" {
+		if token, err = b.authToken(true); err != nil {
+			return err
+		}
+		err = b.send(method, apiPath, token, body, out)
+	}
+	return err
+}
+
+// authToken returns the static token or an AppRole token, logging in when
+// there is none, it has expired or renew is set
+func (b *VaultBackend) authToken(renew bool) (string, error) {
+	if b.config.RoleID == "" {
+		return b.config.Token, nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !renew && b.token != "" && (b.tokenExpiry.IsZero() || time.Now().Before(b.tokenExpiry)) {
+		return b.token, nil
+	}
+
+	var login vaultLoginResponse
+	body := map[string]string{
+		"role_id":   b.config.RoleID,
+		"secret_id": b.config.SecretID,
+	}
+	if err := b.send(http.MethodPost, path.Join("auth", b.config.AppRoleMount, "login"), "", body, &login); err != nil {
+		return "", fmt.Errorf("vault AppRole login failed: %w", err)
+	}
+	if login.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault AppRole login returned no token")
+	}
+
+	b.token = login.Auth.ClientToken
+	b.tokenExpiry = time.Time{}
+	if login.Auth.LeaseDuration > 0 {
+		// Log in again before the lease runs out
+		lease := time.Duration(login.Auth.LeaseDuration) * time.Second
+		b.tokenExpiry = time.Now().Add(lease * 9 / 10)
+	}
+	b.logger.Debugf("Authenticated to Vault with AppRole (lease %ds)", login.Auth.LeaseDuration)
+	return b.token, nil
+}
+
+func (b *VaultBackend) send(method, apiPath, token string, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, b.config.Address+"/v1/"+apiPath, reader)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if b.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.config.Namespace)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		var vaultErr vaultErrorResponse
+		json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return &vaultError{status: resp.StatusCode, errors: vaultErr.Errors}
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode vault response: %w", err)
+	}
+	return nil
+}
+
+func vaultStatus(err error) int {
+	if vaultErr, ok := err.(*vaultError); ok {
+		return vaultErr.status
+	}
+	return 0
+}
+
+func isCASMismatch(err error) bool {
+	vaultErr, ok := err.(*vaultError)
+	if !ok || vaultErr.status != http.StatusBadRequest {
+		return false
+	}
+	for _, msg := range vaultErr.errors {
+		if strings.Contains(msg, "check-and-set") {
+			return true
+		}
+	}
+	return false
+}
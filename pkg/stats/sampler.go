@@ -0,0 +1,259 @@
+package stats
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// sampleWorkers bounds how many functions are sampled at once
+const sampleWorkers = 8
+
+// Source lists the replicas of a function
+type Source interface {
+	GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error)
+}
+
+// Reader samples the resource usage of a replica
+type Reader interface {
+	ReplicaStats(ctx context.Context, c *types.Container) (*types.ReplicaStats, error)
+}
+
+// FunctionsFunc returns the annotations of every deployed function by name
+type FunctionsFunc func() (map[string]map[string]string, error)
+
+// Sampler periodically samples every function replica, exports the values as
+// gauges and keeps a short history per replica for sparklines
+type Sampler struct {
+	source    Source
+	reader    Reader
+	functions FunctionsFunc
+	interval  time.Duration
+	size      int
+	logger    *logrus.Logger
+
+	mu      sync.RWMutex
+	history map[string]map[string][]types.StatsSample // by function, then replica
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewSampler creates a sampler keeping up to size samples per replica
+func NewSampler(source Source, reader Reader, functions FunctionsFunc, interval time.Duration, size int, logger *logrus.Logger) *Sampler {
+	if size <= 0 {
+		size = 60
+	}
+	return &Sampler{
+		source:    source,
+		reader:    reader,
+		functions: functions,
+		interval:  interval,
+		size:      size,
+		logger:    logger,
+		history:   make(map[string]map[string][]types.StatsSample),
+	}
+}
+
+// Start samples every interval until ctx is cancelled or Stop is called
+func (s *Sampler) Start(ctx context.Context) {
+	ctx, s.cancel = context.WithCancel(ctx)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.interval)
+		defer ticker.Stop()
+
+		s.logger.Infof("Function stats sampling started (interval: %s)", s.interval)
+		for {
+			s.sample(ctx)
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// Stop ends sampling
+func (s *Sampler) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.wg.Wait()
+}
+
+// Live samples every running replica of a function now. It fails when no
+// running replica could be read.
+func (s *Sampler) Live(ctx context.Context, functionName string) ([]types.ReplicaStats, error) {
+	containers, err := s.source.GetFunctionContainers(ctx, functionName)
+	if err != nil {
+		return nil, err
+	}
+	return s.read(ctx, functionName, containers)
+}
+
+// History returns the recent samples of a function's replicas, oldest first
+func (s *Sampler) History(functionName string) map[string][]types.StatsSample {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	history := make(map[string][]types.StatsSample, len(s.history[functionName]))
+	for replica, samples := range s.history[functionName] {
+		history[replica] = append([]types.StatsSample(nil), samples...)
+	}
+	return history
+}
+
+// sample records every replica of every function and drops the history and
+// gauges of replicas that are gone
+func (s *Sampler) sample(ctx context.Context) {
+	functions, err := s.functions()
+	if err != nil {
+		s.logger.Warnf("Failed to list functions for stats sampling: %v", err)
+		return
+	}
+
+	names := make(chan string, len(functions))
+	for name := range functions {
+		names <- name
+	}
+	close(names)
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		seen = make(map[string]map[string]bool, len(functions))
+	)
+	for i := 0; i < min(sampleWorkers, len(functions)); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for name := range names {
+				replicas := s.sampleFunction(ctx, name)
+				mu.Lock()
+				seen[name] = replicas
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for name, replicas := range s.history {
+		for replica := range replicas {
+			if !seen[name][replica] {
+				delete(replicas, replica)
+				metrics.DeleteReplicaStats(name, replica)
+			}
+		}
+		if len(replicas) == 0 {
+			delete(s.history, name)
+		}
+	}
+}
+
+// sampleFunction records every replica of a function, returning the replicas
+// whose history is kept
+func (s *Sampler) sampleFunction(ctx context.Context, functionName string) map[string]bool {
+	containers, err := s.source.GetFunctionContainers(ctx, functionName)
+	if err != nil {
+		s.logger.Debugf("Failed to list replicas of %s for stats sampling: %v", functionName, err)
+		// Keep the previous samples rather than dropping them on a transient error
+		return s.replicas(functionName)
+	}
+
+	results, err := s.read(ctx, functionName, containers)
+	if err != nil {
+		s.logger.Warnf("Failed to sample %s: %v", functionName, err)
+	}
+	seen := make(map[string]bool, len(results))
+	for _, stats := range results {
+		seen[stats.Replica] = true
+		s.record(functionName, stats)
+	}
+	return seen
+}
+
+// read samples running replicas concurrently, skipping those that fail. It
+// returns an error when every running replica failed.
+func (s *Sampler) read(ctx context.Context, functionName string, containers []*types.Container) ([]types.ReplicaStats, error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []types.ReplicaStats
+		running int
+		lastErr error
+	)
+	for _, c := range containers {
+		if !strings.Contains(c.Status, "running") && !strings.Contains(c.Status, "Up") {
+			continue
+		}
+		running++
+		wg.Add(1)
+		go func(c *types.Container) {
+			defer wg.Done()
+			stats, err := s.reader.ReplicaStats(ctx, c)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				s.logger.Debugf("Failed to sample %s of %s: %v", c.Name, functionName, err)
+				lastErr = err
+				return
+			}
+			results = append(results, *stats)
+		}(c)
+	}
+	wg.Wait()
+
+	if running > 0 && len(results) == 0 {
+		return nil, fmt.Errorf("no replica of %s could be read: %w", functionName, lastErr)
+	}
+	sort.Slice(results, func(i, j int) bool { return results[i].Replica < results[j].Replica })
+	return results, nil
+}
+
+func (s *Sampler) record(functionName string, stats types.ReplicaStats) {
+	metrics.UpdateReplicaStats(functionName, stats.Replica, stats.CPUPercent, stats.MemoryUsage, stats.MemoryLimit,
+		stats.NetworkRxBytes, stats.NetworkTxBytes, stats.BlockReadBytes, stats.BlockWriteBytes)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	replicas := s.history[functionName]
+	if replicas == nil {
+		replicas = make(map[string][]types.StatsSample)
+		s.history[functionName] = replicas
+	}
+	samples := append(replicas[stats.Replica], types.StatsSample{
+		Timestamp:      stats.Timestamp,
+		CPUPercent:     stats.CPUPercent,
+		MemoryUsage:    stats.MemoryUsage,
+		NetworkRxBytes: stats.NetworkRxBytes,
+		NetworkTxBytes: stats.NetworkTxBytes,
+	})
+	if len(samples) > s.size {
+		samples = append([]types.StatsSample(nil), samples[len(samples)-s.size:]...)
+	}
+	replicas[stats.Replica] = samples
+}
+
+func (s *Sampler) replicas(functionName string) map[string]bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	replicas := make(map[string]bool, len(s.history[functionName]))
+	for replica := range s.history[functionName] {
+		replicas[replica] = true
+	}
+	return replicas
+}
@@ -0,0 +1,119 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+type fakeSource struct {
+	mu         sync.Mutex
+	containers map[string][]*types.Container
+}
+
+func (f *fakeSource) GetFunctionContainers(ctx context.Context, functionName string) ([]*types.Container, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.containers[functionName], nil
+}
+
+// fakeReader reports CPU usage growing by one per sample; "broken" replicas fail
+type fakeReader struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (f *fakeReader) ReplicaStats(ctx context.Context, c *types.Container) (*types.ReplicaStats, error) {
+	if c.Name == "broken" {
+		return nil, errors.New("no such container")
+	}
+	f.mu.Lock()
+	f.calls++
+	calls := f.calls
+	f.mu.Unlock()
+	return &types.ReplicaStats{Replica: c.Name, ContainerID: c.ID, Timestamp: time.Now(), CPUPercent: float64(calls), MemoryUsage: 1 << 20}, nil
+}
+
+func newTestSampler(source *fakeSource, reader *fakeReader, size int) *Sampler {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	functions := func() (map[string]map[string]string, error) {
+		return map[string]map[string]string{"api": {}}, nil
+	}
+	return NewSampler(source, reader, functions, time.Minute, size, logger)
+}
+
+func TestSampler_History(t *testing.T) {
+	source := &fakeSource{containers: map[string][]*types.Container{"api": {
+		{ID: "1", Name: "api-1", Status: "running"},
+		{ID: "2", Name: "api-2", Status: "exited"},
+		{ID: "3", Name: "broken", Status: "running"},
+	}}}
+	sampler := newTestSampler(source, &fakeReader{}, 3)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		sampler.sample(ctx)
+	}
+
+	history := sampler.History("api")
+	if len(history) != 1 {
+		t.Fatalf("expected only the running, readable replica in the history, got %v", history)
+	}
+	samples := history["api-1"]
+	if len(samples) != 3 || samples[0].CPUPercent != 3 || samples[2].CPUPercent != 5 {
+		t.Fatalf("expected the newest 3 samples oldest first, got %+v", samples)
+	}
+
+	live, err := sampler.Live(ctx, "api")
+	if err != nil || len(live) != 1 || live[0].Replica != "api-1" {
+		t.Fatalf("unexpected live stats: %+v (%v)", live, err)
+	}
+
+	// Replicas that are gone are dropped from the history
+	source.mu.Lock()
+	source.containers["api"] = []*types.Container{{ID: "4", Name: "api-3", Status: "Up 2 seconds"}}
+	source.mu.Unlock()
+	sampler.sample(ctx)
+
+	history = sampler.History("api")
+	if _, ok := history["api-1"]; ok || len(history["api-3"]) != 1 {
+		t.Fatalf("expected the removed replica to be dropped, got %v", history)
+	}
+}
+
+func TestSampler_SamplesEveryFunction(t *testing.T) {
+	source := &fakeSource{containers: map[string][]*types.Container{}}
+	functions := map[string]map[string]string{}
+	for i := 0; i < 3*sampleWorkers; i++ {
+		name := fmt.Sprintf("fn-%d", i)
+		functions[name] = map[string]string{}
+		source.containers[name] = []*types.Container{{ID: name, Name: name + "-0", Status: "running"}}
+	}
+	source.containers["down"] = []*types.Container{{ID: "x", Name: "broken", Status: "running"}}
+	functions["down"] = map[string]string{}
+
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	list := func() (map[string]map[string]string, error) { return functions, nil }
+	sampler := NewSampler(source, &fakeReader{}, list, time.Minute, 3, logger)
+	sampler.sample(context.Background())
+
+	for name := range functions {
+		if name != "down" && len(sampler.History(name)[name+"-0"]) != 1 {
+			t.Fatalf("expected %s to be sampled, got %v", name, sampler.History(name))
+		}
+	}
+	// A function none of whose replicas can be read is an error, not empty stats
+	if _, err := sampler.Live(context.Background(), "down"); err == nil {
+		t.Fatalf("expected live stats to fail when no replica can be read")
+	}
+}
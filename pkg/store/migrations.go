@@ -61,6 +61,153 @@ var Migrations = []Migration{
 			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
 		`,
 	},
+	{
+		Version:     3,
+		Description: "Add secret metadata table",
+		Up: `
+			CREATE TABLE IF NOT EXISTS secret_metadata (
+				name TEXT PRIMARY KEY,
+				description TEXT,
+				labels TEXT,
+				version INTEGER NOT NULL DEFAULT 1,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+		`,
+		Down: `DROP TABLE IF EXISTS secret_metadata;`,
+	},
+	{
+		Version:     4,
+		Description: "Add annotations column",
+		Up: `
+			ALTER TABLE functions ADD COLUMN annotations TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			CREATE TABLE functions_backup AS SELECT
+				id, name, image, env_process, env_vars, labels, secrets,
+				network, replicas, limits, requests, read_only, debug, created_at, updated_at
+			FROM functions;
+			DROP TABLE functions;
+			ALTER TABLE functions_backup RENAME TO functions;
+			CREATE INDEX IF NOT EXISTS idx_functions_name ON functions(name);
+			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
+		`,
+	},
+	{
+		Version:     5,
+		Description: "Add security column",
+		Up: `
+			ALTER TABLE functions ADD COLUMN security TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			CREATE TABLE functions_backup AS SELECT
+				id, name, image, env_process, env_vars, labels, annotations, secrets,
+				network, replicas, limits, requests, read_only, debug, created_at, updated_at
+			FROM functions;
+			DROP TABLE functions;
+			ALTER TABLE functions_backup RENAME TO functions;
+			CREATE INDEX IF NOT EXISTS idx_functions_name ON functions(name);
+			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
+		`,
+	},
+	{
+		Version:     6,
+		Description: "Add image digest column",
+		Up: `
+			ALTER TABLE functions ADD COLUMN image_digest TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			CREATE TABLE functions_backup AS SELECT
+				id, name, image, env_process, env_vars, labels, annotations, secrets,
+				network, replicas, limits, requests, read_only, debug, security, created_at, updated_at
+			FROM functions;
+			DROP TABLE functions;
+			ALTER TABLE functions_backup RENAME TO functions;
+			CREATE INDEX IF NOT EXISTS idx_functions_name ON functions(name);
+			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
+		`,
+	},
+	{
+		Version:     7,
+		Description: "Add placement constraints column",
+		Up: `
+			ALTER TABLE functions ADD COLUMN constraints TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			CREATE TABLE functions_backup AS SELECT
+				id, name, image, env_process, env_vars, labels, annotations, secrets,
+				network, replicas, limits, requests, read_only, debug, security, image_digest, created_at, updated_at
+			FROM functions;
+			DROP TABLE functions;
+			ALTER TABLE functions_backup RENAME TO functions;
+			CREATE INDEX IF NOT EXISTS idx_functions_name ON functions(name);
+			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
+		`,
+	},
+	{
+		Version:     8,
+		Description: "Add image pull policy column",
+		Up: `
+			ALTER TABLE functions ADD COLUMN pull_policy TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			CREATE TABLE functions_backup AS SELECT
+				id, name, image, env_process, env_vars, labels, annotations, secrets,
+				network, replicas, limits, requests, read_only, debug, security, image_digest, constraints, created_at, updated_at
+			FROM functions;
+			DROP TABLE functions;
+			ALTER TABLE functions_backup RENAME TO functions;
+			CREATE INDEX IF NOT EXISTS idx_functions_name ON functions(name);
+			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
+		`,
+	},
+	{
+		Version:     9,
+		Description: "Add registry credentials table",
+		Up: `
+			CREATE TABLE IF NOT EXISTS registry_credentials (
+				server TEXT PRIMARY KEY,
+				username TEXT NOT NULL,
+				password TEXT NOT NULL,
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+		`,
+		Down: `DROP TABLE IF EXISTS registry_credentials;`,
+	},
+	{
+		Version:     10,
+		Description: "Add function volumes column",
+		Up: `
+			ALTER TABLE functions ADD COLUMN volumes TEXT NOT NULL DEFAULT '';
+		`,
+		Down: `
+			CREATE TABLE functions_backup AS SELECT
+				id, name, image, env_process, env_vars, labels, annotations, secrets,
+				network, replicas, limits, requests, read_only, debug, security, image_digest, constraints, pull_policy, created_at, updated_at
+			FROM functions;
+			DROP TABLE functions;
+			ALTER TABLE functions_backup RENAME TO functions;
+			CREATE INDEX IF NOT EXISTS idx_functions_name ON functions(name);
+			CREATE INDEX IF NOT EXISTS idx_functions_created_at ON functions(created_at);
+		`,
+	},
+	{
+		Version:     11,
+		Description: "Add pipelines table",
+		Up: `
+			CREATE TABLE IF NOT EXISTS pipelines (
+				name TEXT PRIMARY KEY,
+				description TEXT NOT NULL DEFAULT '',
+				steps TEXT NOT NULL,
+				propagate_headers TEXT NOT NULL DEFAULT '',
+				timeout TEXT NOT NULL DEFAULT '',
+				created_at TIMESTAMP NOT NULL,
+				updated_at TIMESTAMP NOT NULL
+			);
+		`,
+		Down: `DROP TABLE IF EXISTS pipelines;`,
+	},
 }
 
 // MigrationManager handles database migrations
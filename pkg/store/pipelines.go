@@ -0,0 +1,176 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// CreatePipeline stores a new pipeline
+func (s *Store) CreatePipeline(metadata *types.PipelineMetadata) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("create_pipeline", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	INSERT INTO pipelines (name, description, steps, propagate_headers, timeout, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?)
+	`
+
+	now := time.Now()
+	if _, err = s.db.Exec(query,
+		metadata.Name,
+		metadata.Description,
+		metadata.Steps,
+		metadata.PropagateHeaders,
+		metadata.Timeout,
+		now,
+		now,
+	); err != nil {
+		return fmt.Errorf("failed to create pipeline: %w", err)
+	}
+
+	metadata.CreatedAt = now
+	metadata.UpdatedAt = now
+	return nil
+}
+
+// GetPipeline retrieves a pipeline by name
+func (s *Store) GetPipeline(name string) (metadata *types.PipelineMetadata, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("get_pipeline", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	SELECT name, description, steps, propagate_headers, timeout, created_at, updated_at
+	FROM pipelines WHERE name = ?
+	`
+
+	var result types.PipelineMetadata
+	err = s.db.QueryRow(query, name).Scan(
+		&result.Name,
+		&result.Description,
+		&result.Steps,
+		&result.PropagateHeaders,
+		&result.Timeout,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("pipeline not found: %s", name)
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to get pipeline: %w", err)
+		return nil, err
+	}
+
+	metadata = &result
+	return metadata, nil
+}
+
+// ListPipelines retrieves every pipeline
+func (s *Store) ListPipelines() (pipelines []*types.PipelineMetadata, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("list_pipelines", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	SELECT name, description, steps, propagate_headers, timeout, created_at, updated_at
+	FROM pipelines ORDER BY name
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pipelines: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var metadata types.PipelineMetadata
+		if err := rows.Scan(
+			&metadata.Name,
+			&metadata.Description,
+			&metadata.Steps,
+			&metadata.PropagateHeaders,
+			&metadata.Timeout,
+			&metadata.CreatedAt,
+			&metadata.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan pipeline: %w", err)
+		}
+		pipelines = append(pipelines, &metadata)
+	}
+
+	return pipelines, nil
+}
+
+// UpdatePipeline replaces the definition of an existing pipeline
+func (s *Store) UpdatePipeline(metadata *types.PipelineMetadata) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("update_pipeline", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	UPDATE pipelines
+	SET description = ?, steps = ?, propagate_headers = ?, timeout = ?, updated_at = ?
+	WHERE name = ?
+	`
+
+	now := time.Now()
+	result, err := s.db.Exec(query,
+		metadata.Description,
+		metadata.Steps,
+		metadata.PropagateHeaders,
+		metadata.Timeout,
+		now,
+		metadata.Name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update pipeline: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		err = fmt.Errorf("pipeline not found: %s", metadata.Name)
+		return err
+	}
+
+	metadata.UpdatedAt = now
+	return nil
+}
+
+// DeletePipeline removes a pipeline
+func (s *Store) DeletePipeline(name string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("delete_pipeline", time.Since(start).Seconds(), err)
+	}()
+
+	result, err := s.db.Exec(`DELETE FROM pipelines WHERE name = ?`, name)
+	if err != nil {
+		return fmt.Errorf("failed to delete pipeline: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		err = fmt.Errorf("pipeline not found: %s", name)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,128 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// UpsertRegistryCredential creates or replaces the credential for a registry.
+// The password is stored as given; callers seal it before saving.
+func (s *Store) UpsertRegistryCredential(credential *types.RegistryCredential) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("upsert_registry_credential", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	INSERT INTO registry_credentials (server, username, password, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?)
+	ON CONFLICT(server) DO UPDATE SET
+		username = excluded.username,
+		password = excluded.password,
+		updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	if _, err = s.db.Exec(query, credential.Server, credential.Username, credential.Password, now, now); err != nil {
+		return fmt.Errorf("failed to upsert registry credential: %w", err)
+	}
+
+	return nil
+}
+
+// GetRegistryCredential retrieves the credential for a registry server
+func (s *Store) GetRegistryCredential(server string) (credential *types.RegistryCredential, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("get_registry_credential", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	SELECT server, username, password, created_at, updated_at
+	FROM registry_credentials WHERE server = ?
+	`
+
+	var result types.RegistryCredential
+	err = s.db.QueryRow(query, server).Scan(
+		&result.Server,
+		&result.Username,
+		&result.Password,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("registry credential not found: %s", server)
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to get registry credential: %w", err)
+		return nil, err
+	}
+
+	credential = &result
+	return credential, nil
+}
+
+// ListRegistryCredentials retrieves every registry credential
+func (s *Store) ListRegistryCredentials() (credentials []*types.RegistryCredential, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("list_registry_credentials", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	SELECT server, username, password, created_at, updated_at
+	FROM registry_credentials ORDER BY server
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list registry credentials: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var credential types.RegistryCredential
+		if err := rows.Scan(
+			&credential.Server,
+			&credential.Username,
+			&credential.Password,
+			&credential.CreatedAt,
+			&credential.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan registry credential: %w", err)
+		}
+		credentials = append(credentials, &credential)
+	}
+
+	return credentials, nil
+}
+
+// DeleteRegistryCredential removes the credential for a registry server
+func (s *Store) DeleteRegistryCredential(server string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("delete_registry_credential", time.Since(start).Seconds(), err)
+	}()
+
+	result, err := s.db.Exec(`DELETE FROM registry_credentials WHERE server = ?`, server)
+	if err != nil {
+		return fmt.Errorf("failed to delete registry credential: %w", err)
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if rows == 0 {
+		err = fmt.Errorf("registry credential not found: %s", server)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/docker-faas/docker-faas/pkg/metrics"
+	"github.com/docker-faas/docker-faas/pkg/types"
+)
+
+// UpsertSecretMetadata creates secret metadata at version 1, or bumps the
+// version and replaces description and labels when it already exists
+func (s *Store) UpsertSecretMetadata(metadata *types.SecretMetadata) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("upsert_secret_metadata", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	INSERT INTO secret_metadata (name, description, labels, version, created_at, updated_at)
+	VALUES (?, ?, ?, 1, ?, ?)
+	ON CONFLICT(name) DO UPDATE SET
+		description = excluded.description,
+		labels = excluded.labels,
+		version = secret_metadata.version + 1,
+		updated_at = excluded.updated_at
+	`
+
+	now := time.Now()
+	if _, err = s.db.Exec(query, metadata.Name, metadata.Description, metadata.Labels, now, now); err != nil {
+		return fmt.Errorf("failed to upsert secret metadata: %w", err)
+	}
+
+	return nil
+}
+
+// GetSecretMetadata retrieves secret metadata by name
+func (s *Store) GetSecretMetadata(name string) (metadata *types.SecretMetadata, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("get_secret_metadata", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	SELECT name, description, labels, version, created_at, updated_at
+	FROM secret_metadata WHERE name = ?
+	`
+
+	var result types.SecretMetadata
+	var description, labels sql.NullString
+	err = s.db.QueryRow(query, name).Scan(
+		&result.Name,
+		&description,
+		&labels,
+		&result.Version,
+		&result.CreatedAt,
+		&result.UpdatedAt,
+	)
+
+	if err == sql.ErrNoRows {
+		err = fmt.Errorf("secret metadata not found: %s", name)
+		return nil, err
+	}
+	if err != nil {
+		err = fmt.Errorf("failed to get secret metadata: %w", err)
+		return nil, err
+	}
+
+	result.Description = description.String
+	result.Labels = labels.String
+	metadata = &result
+	return metadata, nil
+}
+
+// ListSecretMetadata retrieves metadata for all secrets
+func (s *Store) ListSecretMetadata() (secrets []*types.SecretMetadata, err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("list_secret_metadata", time.Since(start).Seconds(), err)
+	}()
+
+	query := `
+	SELECT name, description, labels, version, created_at, updated_at
+	FROM secret_metadata ORDER BY name
+	`
+
+	rows, err := s.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list secret metadata: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var metadata types.SecretMetadata
+		var description, labels sql.NullString
+		if err := rows.Scan(
+			&metadata.Name,
+			&description,
+			&labels,
+			&metadata.Version,
+			&metadata.CreatedAt,
+			&metadata.UpdatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("failed to scan secret metadata: %w", err)
+		}
+		metadata.Description = description.String
+		metadata.Labels = labels.String
+		secrets = append(secrets, &metadata)
+	}
+
+	return secrets, nil
+}
+
+// DeleteSecretMetadata removes secret metadata. Missing entries are ignored.
+func (s *Store) DeleteSecretMetadata(name string) (err error) {
+	start := time.Now()
+	defer func() {
+		metrics.RecordDBOperation("delete_secret_metadata", time.Since(start).Seconds(), err)
+	}()
+
+	if _, err = s.db.Exec(`DELETE FROM secret_metadata WHERE name = ?`, name); err != nil {
+		return fmt.Errorf("failed to delete secret metadata: %w", err)
+	}
+
+	return nil
+}
@@ -57,8 +57,8 @@ func (s *Store) CreateFunction(metadata *types.FunctionMetadata) (err error) {
 	}()
 
 	query := `
-	INSERT INTO functions (name, image, env_process, env_vars, labels, secrets, network, replicas, limits, requests, read_only, debug, created_at, updated_at)
-	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO functions (name, image, env_process, env_vars, labels, annotations, secrets, network, replicas, limits, requests, read_only, debug, security, image_digest, constraints, pull_policy, volumes, created_at, updated_at)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 
 	result, err := s.db.Exec(query,
@@ -67,6 +67,7 @@ func (s *Store) CreateFunction(metadata *types.FunctionMetadata) (err error) {
 		metadata.EnvProcess,
 		metadata.EnvVars,
 		metadata.Labels,
+		metadata.Annotations,
 		metadata.Secrets,
 		metadata.Network,
 		metadata.Replicas,
@@ -74,6 +75,11 @@ func (s *Store) CreateFunction(metadata *types.FunctionMetadata) (err error) {
 		metadata.Requests,
 		metadata.ReadOnly,
 		metadata.Debug,
+		metadata.Security,
+		metadata.ImageDigest,
+		metadata.Constraints,
+		metadata.PullPolicy,
+		metadata.Volumes,
 		time.Now(),
 		time.Now(),
 	)
@@ -99,7 +105,7 @@ func (s *Store) GetFunction(name string) (metadata *types.FunctionMetadata, err
 	}()
 
 	query := `
-	SELECT id, name, image, env_process, env_vars, labels, secrets, network, replicas, limits, requests, read_only, debug, created_at, updated_at
+	SELECT id, name, image, env_process, env_vars, labels, annotations, secrets, network, replicas, limits, requests, read_only, debug, security, image_digest, constraints, pull_policy, volumes, created_at, updated_at
 	FROM functions WHERE name = ?
 	`
 
@@ -111,6 +117,7 @@ func (s *Store) GetFunction(name string) (metadata *types.FunctionMetadata, err
 		&result.EnvProcess,
 		&result.EnvVars,
 		&result.Labels,
+		&result.Annotations,
 		&result.Secrets,
 		&result.Network,
 		&result.Replicas,
@@ -118,6 +125,11 @@ func (s *Store) GetFunction(name string) (metadata *types.FunctionMetadata, err
 		&result.Requests,
 		&result.ReadOnly,
 		&result.Debug,
+		&result.Security,
+		&result.ImageDigest,
+		&result.Constraints,
+		&result.PullPolicy,
+		&result.Volumes,
 		&result.CreatedAt,
 		&result.UpdatedAt,
 	)
@@ -143,7 +155,7 @@ func (s *Store) ListFunctions() (functions []*types.FunctionMetadata, err error)
 	}()
 
 	query := `
-	SELECT id, name, image, env_process, env_vars, labels, secrets, network, replicas, limits, requests, read_only, debug, created_at, updated_at
+	SELECT id, name, image, env_process, env_vars, labels, annotations, secrets, network, replicas, limits, requests, read_only, debug, security, image_digest, constraints, pull_policy, volumes, created_at, updated_at
 	FROM functions ORDER BY created_at DESC
 	`
 
@@ -162,6 +174,7 @@ func (s *Store) ListFunctions() (functions []*types.FunctionMetadata, err error)
 			&metadata.EnvProcess,
 			&metadata.EnvVars,
 			&metadata.Labels,
+			&metadata.Annotations,
 			&metadata.Secrets,
 			&metadata.Network,
 			&metadata.Replicas,
@@ -169,6 +182,11 @@ func (s *Store) ListFunctions() (functions []*types.FunctionMetadata, err error)
 			&metadata.Requests,
 			&metadata.ReadOnly,
 			&metadata.Debug,
+			&metadata.Security,
+			&metadata.ImageDigest,
+			&metadata.Constraints,
+			&metadata.PullPolicy,
+			&metadata.Volumes,
 			&metadata.CreatedAt,
 			&metadata.UpdatedAt,
 		)
@@ -190,7 +208,7 @@ func (s *Store) UpdateFunction(metadata *types.FunctionMetadata) (err error) {
 
 	query := `
 	UPDATE functions
-	SET image = ?, env_process = ?, env_vars = ?, labels = ?, secrets = ?, network = ?, replicas = ?, limits = ?, requests = ?, read_only = ?, debug = ?, updated_at = ?
+	SET image = ?, env_process = ?, env_vars = ?, labels = ?, annotations = ?, secrets = ?, network = ?, replicas = ?, limits = ?, requests = ?, read_only = ?, debug = ?, security = ?, image_digest = ?, constraints = ?, pull_policy = ?, volumes = ?, updated_at = ?
 	WHERE name = ?
 	`
 
@@ -199,6 +217,7 @@ func (s *Store) UpdateFunction(metadata *types.FunctionMetadata) (err error) {
 		metadata.EnvProcess,
 		metadata.EnvVars,
 		metadata.Labels,
+		metadata.Annotations,
 		metadata.Secrets,
 		metadata.Network,
 		metadata.Replicas,
@@ -206,6 +225,11 @@ func (s *Store) UpdateFunction(metadata *types.FunctionMetadata) (err error) {
 		metadata.Requests,
 		metadata.ReadOnly,
 		metadata.Debug,
+		metadata.Security,
+		metadata.ImageDigest,
+		metadata.Constraints,
+		metadata.PullPolicy,
+		metadata.Volumes,
 		time.Now(),
 		metadata.Name,
 	)
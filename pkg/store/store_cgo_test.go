@@ -28,13 +28,16 @@ func TestStore(t *testing.T) {
 		require.NoError(t, err)
 
 		metadata := &types.FunctionMetadata{
-			Name:       "test-func",
-			Image:      "test/image:latest",
-			EnvProcess: "python handler.py",
-			EnvVars:    envVars,
-			Labels:     labels,
-			Network:    "docker-faas-net",
-			Replicas:   2,
+			Name:        "test-func",
+			Image:       "test/image:latest",
+			EnvProcess:  "python handler.py",
+			EnvVars:     envVars,
+			Labels:      labels,
+			Network:     "docker-faas-net",
+			Replicas:    2,
+			Security:    `{"runAsUser":"1000"}`,
+			Constraints: `["node.role==worker"]`,
+			PullPolicy:  "Always",
 		}
 
 		err = store.CreateFunction(metadata)
@@ -48,6 +51,9 @@ func TestStore(t *testing.T) {
 		assert.Equal(t, "test-func", fn.Name)
 		assert.Equal(t, "test/image:latest", fn.Image)
 		assert.Equal(t, 2, fn.Replicas)
+		assert.Equal(t, `{"runAsUser":"1000"}`, fn.Security)
+		assert.Equal(t, []string{"node.role==worker"}, DecodeSlice(fn.Constraints))
+		assert.Equal(t, "Always", fn.PullPolicy)
 	})
 
 	t.Run("ListFunctions", func(t *testing.T) {
@@ -91,3 +97,108 @@ func TestStore(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestStoreSecretMetadata(t *testing.T) {
+	dbPath := "test-secrets.db"
+	defer os.Remove(dbPath)
+
+	store, err := NewStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	labels, err := EncodeMap(map[string]string{"team": "payments"})
+	require.NoError(t, err)
+
+	t.Run("CreateSetsVersionOne", func(t *testing.T) {
+		err := store.UpsertSecretMetadata(&types.SecretMetadata{Name: "api-key", Description: "Stripe key", Labels: labels})
+		require.NoError(t, err)
+
+		meta, err := store.GetSecretMetadata("api-key")
+		require.NoError(t, err)
+		assert.Equal(t, 1, meta.Version)
+		assert.Equal(t, "Stripe key", meta.Description)
+		assert.Equal(t, "payments", DecodeMap(meta.Labels)["team"])
+		assert.False(t, meta.CreatedAt.IsZero())
+	})
+
+	t.Run("UpdateBumpsVersion", func(t *testing.T) {
+		err := store.UpsertSecretMetadata(&types.SecretMetadata{Name: "api-key", Description: "Rotated key", Labels: labels})
+		require.NoError(t, err)
+
+		meta, err := store.GetSecretMetadata("api-key")
+		require.NoError(t, err)
+		assert.Equal(t, 2, meta.Version)
+		assert.Equal(t, "Rotated key", meta.Description)
+	})
+
+	t.Run("ListAndDelete", func(t *testing.T) {
+		secrets, err := store.ListSecretMetadata()
+		require.NoError(t, err)
+		assert.Len(t, secrets, 1)
+
+		require.NoError(t, store.DeleteSecretMetadata("api-key"))
+		_, err = store.GetSecretMetadata("api-key")
+		assert.Error(t, err)
+	})
+}
+
+func TestStoreRegistryCredentials(t *testing.T) {
+	dbPath := "test-registries.db"
+	defer os.Remove(dbPath)
+
+	store, err := NewStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	require.NoError(t, store.UpsertRegistryCredential(&types.RegistryCredential{Server: "ghcr.io", Username: "ci", Password: "one"}))
+	require.NoError(t, store.UpsertRegistryCredential(&types.RegistryCredential{Server: "ghcr.io", Username: "bot", Password: "two"}))
+
+	credential, err := store.GetRegistryCredential("ghcr.io")
+	require.NoError(t, err)
+	assert.Equal(t, "bot", credential.Username)
+	assert.Equal(t, "two", credential.Password)
+	assert.False(t, credential.CreatedAt.IsZero())
+
+	credentials, err := store.ListRegistryCredentials()
+	require.NoError(t, err)
+	assert.Len(t, credentials, 1)
+
+	require.NoError(t, store.DeleteRegistryCredential("ghcr.io"))
+	assert.Error(t, store.DeleteRegistryCredential("ghcr.io"))
+	_, err = store.GetRegistryCredential("ghcr.io")
+	assert.Error(t, err)
+}
+
+func TestStorePipelines(t *testing.T) {
+	dbPath := "test-pipelines.db"
+	defer os.Remove(dbPath)
+
+	store, err := NewStore(dbPath)
+	require.NoError(t, err)
+	defer store.Close()
+
+	pipeline := &types.PipelineMetadata{Name: "ingest", Steps: `[{"name":"a","function":"fetch"}]`, Timeout: "1m"}
+	require.NoError(t, store.CreatePipeline(pipeline))
+	assert.Error(t, store.CreatePipeline(pipeline))
+
+	pipeline.Description = "Fetch and store"
+	pipeline.PropagateHeaders = `["X-Trace"]`
+	require.NoError(t, store.UpdatePipeline(pipeline))
+
+	stored, err := store.GetPipeline("ingest")
+	require.NoError(t, err)
+	assert.Equal(t, "Fetch and store", stored.Description)
+	assert.Equal(t, `["X-Trace"]`, stored.PropagateHeaders)
+	assert.Equal(t, "1m", stored.Timeout)
+	assert.False(t, stored.CreatedAt.IsZero())
+
+	pipelines, err := store.ListPipelines()
+	require.NoError(t, err)
+	assert.Len(t, pipelines, 1)
+
+	require.NoError(t, store.DeletePipeline("ingest"))
+	assert.Error(t, store.DeletePipeline("ingest"))
+	assert.Error(t, store.UpdatePipeline(pipeline))
+	_, err = store.GetPipeline("ingest")
+	assert.Error(t, err)
+}
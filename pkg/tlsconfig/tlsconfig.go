@@ -0,0 +1,312 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Client certificate modes accepted by TLS_CLIENT_AUTH
+const (
+	ClientAuthNone          = "none"
+	ClientAuthRequest       = "request"
+	ClientAuthVerifyIfGiven = "verify-if-given"
+	ClientAuthRequire       = "require"
+)
+
+// Options describes the TLS listener configuration
+type Options struct {
+	CertFile     string
+	KeyFile      string
+	ClientCAFile string
+	ClientAuth   string
+	MinVersion   string
+	CipherSuites []string
+}
+
+// Reloader serves a certificate and client CA pool that are reloaded when
+// the files on disk change
+type Reloader struct {
+	opts       Options
+	minVersion uint16
+	ciphers    []uint16
+	clientAuth tls.ClientAuthType
+	logger     *logrus.Logger
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+	modTimes  map[string]time.Time
+}
+
+// NewReloader validates the options and loads the initial certificate
+func NewReloader(opts Options, logger *logrus.Logger) (*Reloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, fmt.Errorf("both a certificate and a key file are required")
+	}
+
+	minVersion, err := ParseMinVersion(opts.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	ciphers, err := ParseCipherSuites(opts.CipherSuites)
+	if err != nil {
+		return nil, err
+	}
+	clientAuth, err := ParseClientAuth(opts.ClientAuth, opts.ClientCAFile != "")
+	if err != nil {
+		return nil, err
+	}
+	if clientAuth >= tls.VerifyClientCertIfGiven && opts.ClientCAFile == "" {
+		return nil, fmt.Errorf("client auth %q requires a client CA file", opts.ClientAuth)
+	}
+
+	r := &Reloader{
+		opts:       opts,
+		minVersion: minVersion,
+		ciphers:    ciphers,
+		clientAuth: clientAuth,
+		logger:     logger,
+		modTimes:   make(map[string]time.Time),
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload reads the certificate, key and client CA files from disk
+func (r *Reloader) Reload() error {
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+
+	var pool *x509.CertPool
+	if r.opts.ClientCAFile != "" {
+		pem, err := os.ReadFile(r.opts.ClientCAFile)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA file %s", r.opts.ClientCAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = &cert
+	r.clientCAs = pool
+	r.modTimes = r.currentModTimes()
+	r.mu.Unlock()
+	return nil
+}
+
+// Changed reports whether any watched file was modified since the last load
+func (r *Reloader) Changed() bool {
+	current := r.currentModTimes()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for path, modTime := range current {
+		if !modTime.Equal(r.modTimes[path]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch polls the files and reloads them when they change, keeping the
+// previous certificate if the new files cannot be loaded
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !r.Changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.logger.Errorf("TLS reload failed, keeping previous certificate: %v", err)
+				continue
+			}
+			r.logger.Infof("Reloaded TLS certificate from %s", r.opts.CertFile)
+		}
+	}
+}
+
+// TLSConfig returns a server configuration that always presents the most
+// recently loaded certificate and client CA pool
+func (r *Reloader) TLSConfig() *tls.Config {
+	base := &tls.Config{
+		MinVersion:   r.minVersion,
+		CipherSuites: r.ciphers,
+		ClientAuth:   r.clientAuth,
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+	base.GetCertificate = func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+		return r.cert, nil
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		r.mu.RLock()
+		defer r.mu.RUnlock()
+
+		cfg := base.Clone()
+		cfg.GetConfigForClient = nil
+		cfg.ClientCAs = r.clientCAs
+		return cfg, nil
+	}
+	return base
+}
+
+func (r *Reloader) currentModTimes() map[string]time.Time {
+	modTimes := make(map[string]time.Time)
+	for _, path := range []string{r.opts.CertFile, r.opts.KeyFile, r.opts.ClientCAFile} {
+		if path == "" {
+			continue
+		}
+		if info, err := os.Stat(path); err == nil {
+			modTimes[path] = info.ModTime()
+		}
+	}
+	return modTimes
+}
+
+// ParseMinVersion converts "1.0" to "1.3" into a TLS version, defaulting to TLS 1.2
+func ParseMinVersion(value string) (uint16, error) {
+	switch strings.TrimSpace(value) {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.0":
+		return tls.VersionTLS10, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS minimum version %q (use 1.0, 1.1, 1.2 or 1.3)", value)
+	}
+}
+
+// ParseCipherSuites converts Go cipher suite names into IDs. Suites Go
+// considers insecure are rejected. An empty list keeps the Go defaults.
+func ParseCipherSuites(names []string) ([]uint16, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	available := make(map[string]uint16)
+	for _, suite := range tls.CipherSuites() {
+		available[suite.Name] = suite.ID
+	}
+
+	ids := make([]uint16, 0, len(names))
+	for _, name := range names {
+		id, ok := available[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unsupported or insecure cipher suite %q", name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+// ParseClientAuth converts a client certificate mode. When unset, client
+// certificates are verified if given whenever a client CA is configured.
+func ParseClientAuth(value string, hasClientCA bool) (tls.ClientAuthType, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "":
+		if hasClientCA {
+			return tls.VerifyClientCertIfGiven, nil
+		}
+		return tls.NoClientCert, nil
+	case ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.RequestClientCert, nil
+	case ClientAuthVerifyIfGiven:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("unsupported client auth mode %q (use none, request, verify-if-given or require)", value)
+	}
+}
+
+// ParseIdentityMap parses "certificate-name=identity" pairs
+func ParseIdentityMap(pairs []string) (map[string]string, error) {
+	identities := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		name, identity, ok := strings.Cut(pair, "=")
+		name, identity = strings.TrimSpace(name), strings.TrimSpace(identity)
+		if !ok || name == "" || identity == "" {
+			return nil, fmt.Errorf("invalid client identity mapping %q (expected name=identity)", pair)
+		}
+		identities[name] = identity
+	}
+	return identities, nil
+}
+
+// ClientIdentity returns the gateway identity mapped to a verified client
+// certificate. The common name is checked first, then DNS, email and URI SANs.
+func ClientIdentity(state *tls.ConnectionState, identities map[string]string) (string, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.PeerCertificates) == 0 || len(identities) == 0 {
+		return "", false
+	}
+
+	leaf := state.PeerCertificates[0]
+	names := []string{leaf.Subject.CommonName}
+	names = append(names, leaf.DNSNames...)
+	names = append(names, leaf.EmailAddresses...)
+	for _, uri := range leaf.URIs {
+		names = append(names, uri.String())
+	}
+
+	for _, name := range names {
+		if identity, ok := identities[name]; ok && name != "" {
+			return identity, true
+		}
+	}
+	return "", false
+}
+
+// RedirectHandler sends plain HTTP requests to the HTTPS listener on httpsPort
+func RedirectHandler(httpsPort string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		} else {
+			host = strings.Trim(host, "[]")
+		}
+		if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		if httpsPort != "" && httpsPort != "443" {
+			host = host + ":" + httpsPort
+		}
+
+		target := "https://" + host + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+}
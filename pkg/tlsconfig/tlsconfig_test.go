@@ -0,0 +1,229 @@
+package tlsconfig
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type testCert struct {
+	cert    *x509.Certificate
+	key     *ecdsa.PrivateKey
+	certPEM []byte
+	keyPEM  []byte
+}
+
+func newTestCert(t *testing.T, serial int64, commonName string, parent *testCert, isCA bool) *testCert {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(serial),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  isCA,
+	}
+	signer, signerKey := template, key
+	if parent != nil {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatalf("create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("parse certificate: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	return &testCert{
+		cert:    cert,
+		key:     key,
+		certPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		keyPEM:  pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}),
+	}
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("chtimes %s: %v", path, err)
+	}
+}
+
+func TestReloader_ServesReloadedCertificateAndVerifiesClients(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "tls.crt")
+	keyFile := filepath.Join(dir, "tls.key")
+	caFile := filepath.Join(dir, "ca.crt")
+
+	ca := newTestCert(t, 1, "test-ca", nil, true)
+	server := newTestCert(t, 2, "gateway", ca, false)
+	client := newTestCert(t, 3, "ci-bot", ca, false)
+
+	modTime := time.Now().Add(-time.Minute)
+	writeFile(t, certFile, server.certPEM, modTime)
+	writeFile(t, keyFile, server.keyPEM, modTime)
+	writeFile(t, caFile, ca.certPEM, modTime)
+
+	reloader, err := NewReloader(Options{
+		CertFile:     certFile,
+		KeyFile:      keyFile,
+		ClientCAFile: caFile,
+		ClientAuth:   ClientAuthRequire,
+		MinVersion:   "1.2",
+	}, logger)
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+
+	identities := map[string]string{"ci-bot": "deployer"}
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity, _ := ClientIdentity(r.TLS, identities)
+		w.Write([]byte(identity))
+	}))
+	srv.TLS = reloader.TLSConfig()
+	srv.StartTLS()
+	defer srv.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	clientCert, err := tls.X509KeyPair(client.certPEM, client.keyPEM)
+	if err != nil {
+		t.Fatalf("client key pair: %v", err)
+	}
+	get := func(certs []tls.Certificate) (*http.Response, error) {
+		transport := &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs}}
+		defer transport.CloseIdleConnections()
+		return (&http.Client{Transport: transport}).Get(srv.URL)
+	}
+
+	if _, err := get(nil); err == nil {
+		t.Fatalf("expected handshake without a client certificate to fail")
+	}
+
+	resp, err := get([]tls.Certificate{clientCert})
+	if err != nil {
+		t.Fatalf("request with client certificate: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "deployer" {
+		t.Fatalf("expected identity deployer, got %q", body)
+	}
+	if resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 2 {
+		t.Fatalf("expected initial server certificate")
+	}
+
+	if reloader.Changed() {
+		t.Fatalf("expected no change before files are rewritten")
+	}
+	rotated := newTestCert(t, 4, "gateway", ca, false)
+	writeFile(t, certFile, rotated.certPEM, time.Now())
+	writeFile(t, keyFile, rotated.keyPEM, time.Now())
+	if !reloader.Changed() {
+		t.Fatalf("expected rewritten files to be detected")
+	}
+	if err := reloader.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+
+	resp, err = get([]tls.Certificate{clientCert})
+	if err != nil {
+		t.Fatalf("request after reload: %v", err)
+	}
+	resp.Body.Close()
+	if resp.TLS.PeerCertificates[0].SerialNumber.Int64() != 4 {
+		t.Fatalf("expected reloaded server certificate")
+	}
+}
+
+func TestNewReloader_RejectsInvalidOptions(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	invalid := []Options{
+		{CertFile: "tls.crt"},
+		{CertFile: "tls.crt", KeyFile: "tls.key", MinVersion: "1.4"},
+		{CertFile: "tls.crt", KeyFile: "tls.key", CipherSuites: []string{"TLS_RSA_WITH_RC4_128_SHA"}},
+		{CertFile: "tls.crt", KeyFile: "tls.key", ClientAuth: ClientAuthRequire},
+	}
+	for _, opts := range invalid {
+		if _, err := NewReloader(opts, logger); err == nil {
+			t.Fatalf("expected error for %+v", opts)
+		}
+	}
+}
+
+func TestParseIdentityMap(t *testing.T) {
+	identities, err := ParseIdentityMap([]string{"ci-bot=admin", " ops.example.com = admin "})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if identities["ci-bot"] != "admin" || identities["ops.example.com"] != "admin" {
+		t.Fatalf("unexpected identities: %v", identities)
+	}
+	if _, err := ParseIdentityMap([]string{"ci-bot"}); err == nil {
+		t.Fatalf("expected error for a mapping without identity")
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	cases := map[string]string{
+		"example.com":      "https://example.com:8443/function/echo?x=1",
+		"example.com:8080": "https://example.com:8443/function/echo?x=1",
+		"[::1]:8080":       "https://[::1]:8443/function/echo?x=1",
+	}
+	for host, want := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/function/echo?x=1", nil)
+		req.Host = host
+		recorder := httptest.NewRecorder()
+		RedirectHandler("8443").ServeHTTP(recorder, req)
+
+		if recorder.Code != http.StatusPermanentRedirect {
+			t.Fatalf("expected status %d, got %d", http.StatusPermanentRedirect, recorder.Code)
+		}
+		if got := recorder.Header().Get("Location"); got != want {
+			t.Fatalf("expected redirect to %s, got %s", want, got)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Host = "example.com:80"
+	recorder := httptest.NewRecorder()
+	RedirectHandler("443").ServeHTTP(recorder, req)
+	if got := recorder.Header().Get("Location"); got != "https://example.com/" {
+		t.Fatalf("expected default port to be omitted, got %s", got)
+	}
+}
@@ -18,18 +18,65 @@ type FunctionDeployment struct {
 	Namespace              string             `json:"namespace,omitempty"`
 	ReadOnlyRootFilesystem bool               `json:"readOnlyRootFilesystem,omitempty"`
 	Debug                  bool               `json:"debug,omitempty"`
+	Security               *FunctionSecurity  `json:"security,omitempty"`
+	PullPolicy             string             `json:"pullPolicy,omitempty"` // Always, IfNotPresent (default) or Never
+	Volumes                []FunctionVolume   `json:"volumes,omitempty"`
 }
 
 // FunctionLimits defines resource limits
 type FunctionLimits struct {
-	Memory string `json:"memory,omitempty"`
-	CPU    string `json:"cpu,omitempty"`
+	Memory         string `json:"memory,omitempty"`
+	CPU            string `json:"cpu,omitempty"`
+	MemorySwap     string `json:"memorySwap,omitempty" yaml:"memorySwap"` // memory plus swap, "-1" for unlimited swap
+	CPUSet         string `json:"cpuset,omitempty" yaml:"cpuset"`         // CPUs to pin to, e.g. "0-1,3"
+	BlkioWeight    uint16 `json:"blkioWeight,omitempty" yaml:"blkioWeight"`
+	OOMKillDisable bool   `json:"oomKillDisable,omitempty" yaml:"oomKillDisable"`
+	OOMScoreAdj    int    `json:"oomScoreAdj,omitempty" yaml:"oomScoreAdj"`
 }
 
 // FunctionResources defines resource requests
 type FunctionResources struct {
-	Memory string `json:"memory,omitempty"`
-	CPU    string `json:"cpu,omitempty"`
+	Memory string `json:"memory,omitempty"` // applied as the memory reservation
+	CPU    string `json:"cpu,omitempty"`    // applied as relative CPU shares
+}
+
+// FunctionSecurity defines the container security profile of a function.
+// All capabilities are always dropped; CapAdd re-adds from the gateway allowlist.
+type FunctionSecurity struct {
+	RunAsUser  string            `json:"runAsUser,omitempty" yaml:"runAsUser"`
+	RunAsGroup string            `json:"runAsGroup,omitempty" yaml:"runAsGroup"`
+	CapAdd     []string          `json:"capAdd,omitempty" yaml:"capAdd"`
+	Seccomp    string            `json:"seccompProfile,omitempty" yaml:"seccompProfile"`   // "default", "unconfined", a profile name or inline JSON
+	AppArmor   string            `json:"apparmorProfile,omitempty" yaml:"apparmorProfile"` // profile name or "unconfined"
+	PidsLimit  *int64            `json:"pidsLimit,omitempty" yaml:"pidsLimit"`
+	Ulimits    []FunctionUlimit  `json:"ulimits,omitempty" yaml:"ulimits"`
+	Tmpfs      map[string]string `json:"tmpfs,omitempty" yaml:"tmpfs"` // mount path -> options, e.g. "size=64m"
+}
+
+// FunctionVolume defines storage mounted into every replica of a function
+type FunctionVolume struct {
+	Type     string `json:"type,omitempty" yaml:"type"`         // volume (default), tmpfs or bind
+	Source   string `json:"source,omitempty" yaml:"source"`     // volume name or host path
+	Target   string `json:"target" yaml:"target"`               // absolute path in the container
+	ReadOnly bool   `json:"readOnly,omitempty" yaml:"readOnly"` // mount read-only
+	Size     string `json:"size,omitempty" yaml:"size"`         // tmpfs size limit, e.g. "64Mi"
+}
+
+// VolumeInfo describes a named volume managed by the gateway
+type VolumeInfo struct {
+	Name      string            `json:"name"`
+	Driver    string            `json:"driver"`
+	Owner     string            `json:"owner,omitempty"` // function the volume was created for
+	Labels    map[string]string `json:"labels,omitempty"`
+	UsedBy    []string          `json:"usedBy,omitempty"` // functions that mount the volume
+	CreatedAt string            `json:"createdAt,omitempty"`
+}
+
+// FunctionUlimit defines a resource ulimit
+type FunctionUlimit struct {
+	Name string `json:"name" yaml:"name"`
+	Soft int64  `json:"soft" yaml:"soft"`
+	Hard int64  `json:"hard" yaml:"hard"`
 }
 
 // FunctionStatus represents the runtime status of a function
@@ -50,6 +97,14 @@ type FunctionStatus struct {
 	Requests               *FunctionResources `json:"requests,omitempty"`
 	ReadOnlyRootFilesystem bool               `json:"readOnlyRootFilesystem,omitempty"`
 	Debug                  bool               `json:"debug,omitempty"`
+	Security               *FunctionSecurity  `json:"security,omitempty"`
+	ImageDigest            string             `json:"imageDigest,omitempty"`
+	Constraints            []string           `json:"constraints,omitempty"`
+	PullPolicy             string             `json:"pullPolicy,omitempty"`
+	Volumes                []FunctionVolume   `json:"volumes,omitempty"`
+	ImagePull              *ImagePullStatus   `json:"imagePull,omitempty"`
+	Degraded               bool               `json:"degraded,omitempty"`
+	CrashLoop              *CrashLoopStatus   `json:"crashLoop,omitempty"`
 	CreatedAt              time.Time          `json:"createdAt,omitempty"`
 	UpdatedAt              time.Time          `json:"updatedAt,omitempty"`
 }
@@ -77,31 +132,263 @@ type SystemInfo struct {
 
 // FunctionMetadata represents stored function metadata
 type FunctionMetadata struct {
-	ID         int64     `json:"id"`
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Image       string    `json:"image"`
+	EnvProcess  string    `json:"envProcess,omitempty"`
+	EnvVars     string    `json:"envVars,omitempty"`     // JSON encoded
+	Labels      string    `json:"labels,omitempty"`      // JSON encoded
+	Annotations string    `json:"annotations,omitempty"` // JSON encoded
+	Secrets     string    `json:"secrets,omitempty"`     // JSON encoded
+	Network     string    `json:"network"`
+	Replicas    int       `json:"replicas"`
+	Limits      string    `json:"limits,omitempty"`   // JSON encoded
+	Requests    string    `json:"requests,omitempty"` // JSON encoded
+	ReadOnly    bool      `json:"readOnly"`
+	Debug       bool      `json:"debug"`
+	Security    string    `json:"security,omitempty"` // JSON encoded
+	ImageDigest string    `json:"imageDigest,omitempty"`
+	Constraints string    `json:"constraints,omitempty"` // JSON encoded
+	PullPolicy  string    `json:"pullPolicy,omitempty"`
+	Volumes     string    `json:"volumes,omitempty"` // JSON encoded
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// SecretMetadata represents stored secret metadata (never the value)
+type SecretMetadata struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Labels      string    `json:"labels,omitempty"` // JSON encoded
+	Version     int       `json:"version"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// RegistryCredential holds the login for a container registry. The password
+// is never returned by the API.
+type RegistryCredential struct {
+	Server    string    `json:"server"`
+	Username  string    `json:"username"`
+	Password  string    `json:"-"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Pipeline chains function invocations. Each step receives the output of the
+// steps it depends on; the response is the output of the last step.
+type Pipeline struct {
+	Name             string         `json:"name"`
+	Description      string         `json:"description,omitempty"`
+	Steps            []PipelineStep `json:"steps"`
+	PropagateHeaders []string       `json:"propagateHeaders,omitempty"` // response headers passed on to dependent steps
+	Timeout          string         `json:"timeout,omitempty"`          // limit for the whole run, e.g. "2m"
+	CreatedAt        time.Time      `json:"createdAt,omitempty"`
+	UpdatedAt        time.Time      `json:"updatedAt,omitempty"`
+}
+
+// PipelineStep invokes one function as part of a pipeline
+type PipelineStep struct {
+	Name      string   `json:"name"`
+	Function  string   `json:"function"`
+	DependsOn []string `json:"dependsOn,omitempty"` // earlier steps or "input"; defaults to the previous step
+	Timeout   string   `json:"timeout,omitempty"`   // e.g. "10s"
+	OnError   string   `json:"onError,omitempty"`   // fail (default) or continue
+}
+
+// PipelineMetadata represents a stored pipeline
+type PipelineMetadata struct {
+	Name             string    `json:"name"`
+	Description      string    `json:"description,omitempty"`
+	Steps            string    `json:"steps"`                      // JSON encoded
+	PropagateHeaders string    `json:"propagateHeaders,omitempty"` // JSON encoded
+	Timeout          string    `json:"timeout,omitempty"`
+	CreatedAt        time.Time `json:"createdAt"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// PipelineRun records the progress of one pipeline invocation
+type PipelineRun struct {
+	ID         string            `json:"id"` // the call ID shared by every step
+	Pipeline   string            `json:"pipeline"`
+	Async      bool              `json:"async,omitempty"`
+	Status     string            `json:"status"` // running, succeeded or failed
+	StartedAt  time.Time         `json:"startedAt"`
+	FinishedAt time.Time         `json:"finishedAt,omitempty"`
+	DurationMs int64             `json:"durationMs,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Steps      []PipelineStepRun `json:"steps"`
+}
+
+// PipelineStepRun records the timing and outcome of one pipeline step
+type PipelineStepRun struct {
 	Name       string    `json:"name"`
+	Function   string    `json:"function"`
+	Status     string    `json:"status"` // pending, running, succeeded, failed, timed_out, skipped or cancelled
+	StatusCode int       `json:"statusCode,omitempty"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	DurationMs int64     `json:"durationMs,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ImagePullStatus reports the outcome of the most recent image pull for a function
+type ImagePullStatus struct {
 	Image      string    `json:"image"`
-	EnvProcess string    `json:"envProcess,omitempty"`
-	EnvVars    string    `json:"envVars,omitempty"` // JSON encoded
-	Labels     string    `json:"labels,omitempty"`  // JSON encoded
-	Secrets    string    `json:"secrets,omitempty"` // JSON encoded
-	Network    string    `json:"network"`
-	Replicas   int       `json:"replicas"`
-	Limits     string    `json:"limits,omitempty"`   // JSON encoded
-	Requests   string    `json:"requests,omitempty"` // JSON encoded
-	ReadOnly   bool      `json:"readOnly"`
-	Debug      bool      `json:"debug"`
-	CreatedAt  time.Time `json:"createdAt"`
-	UpdatedAt  time.Time `json:"updatedAt"`
+	Policy     string    `json:"policy"`
+	Status     string    `json:"status"` // pulled, present or failed
+	Registry   string    `json:"registry,omitempty"`
+	Digest     string    `json:"digest,omitempty"`
+	Events     []string  `json:"events,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	StartedAt  time.Time `json:"startedAt"`
+	DurationMs int64     `json:"durationMs"`
 }
 
 // Container represents a running function container instance
 type Container struct {
-	ID        string            `json:"id"`
-	Name      string            `json:"name"`
-	IPAddress string            `json:"ipAddress,omitempty"`
-	Status    string            `json:"status"`
-	Ports     map[string]string `json:"ports,omitempty"` // ContainerPort -> HostPort
-	Created   time.Time         `json:"createdAt"`
+	ID        string              `json:"id"`
+	Name      string              `json:"name"`
+	IPAddress string              `json:"ipAddress,omitempty"`
+	Port      int                 `json:"port,omitempty"` // watchdog port, 8080 when unset
+	Status    string              `json:"status"`
+	Health    string              `json:"health,omitempty"` // starting, healthy or unhealthy
+	Ports     map[string]string   `json:"ports,omitempty"`  // ContainerPort -> HostPort
+	Created   time.Time           `json:"createdAt"`
+	Resources *ContainerResources `json:"resources,omitempty"`
+
+	RestartCount int        `json:"restartCount,omitempty"`
+	ExitCode     int        `json:"exitCode,omitempty"` // of the last exit
+	OOMKilled    bool       `json:"oomKilled,omitempty"`
+	CrashLoop    bool       `json:"crashLoop,omitempty"`
+	BackoffUntil *time.Time `json:"backoffUntil,omitempty"` // excluded from routing until then
+}
+
+// ReplicaStats is a resource usage sample of one function replica
+type ReplicaStats struct {
+	Replica         string    `json:"replica"`
+	ContainerID     string    `json:"containerId"`
+	Timestamp       time.Time `json:"timestamp"`
+	CPUPercent      float64   `json:"cpuPercent"`  // 100 per fully used CPU
+	MemoryUsage     uint64    `json:"memoryUsage"` // bytes, excluding the page cache
+	MemoryLimit     uint64    `json:"memoryLimit"`
+	MemoryPercent   float64   `json:"memoryPercent"`
+	NetworkRxBytes  uint64    `json:"networkRxBytes"`
+	NetworkTxBytes  uint64    `json:"networkTxBytes"`
+	BlockReadBytes  uint64    `json:"blockReadBytes"`
+	BlockWriteBytes uint64    `json:"blockWriteBytes"`
+	PIDs            uint64    `json:"pids,omitempty"`
+}
+
+// StatsSample is one point of a replica's usage history
+type StatsSample struct {
+	Timestamp      time.Time `json:"timestamp"`
+	CPUPercent     float64   `json:"cpuPercent"`
+	MemoryUsage    uint64    `json:"memoryUsage"`
+	NetworkRxBytes uint64    `json:"networkRxBytes"`
+	NetworkTxBytes uint64    `json:"networkTxBytes"`
+}
+
+// FunctionStats reports the live usage of a function's replicas and their recent history
+type FunctionStats struct {
+	Name     string                   `json:"name"`
+	Replicas []ReplicaStats           `json:"replicas"`
+	History  map[string][]StatsSample `json:"history"` // by replica, oldest first
+}
+
+// ImageGCReport describes the built images removed, or planned for removal in
+// a dry run, by image garbage collection
+type ImageGCReport struct {
+	DryRun         bool         `json:"dryRun"`
+	StartedAt      time.Time    `json:"startedAt"`
+	DurationMs     int64        `json:"durationMs"`
+	KeepRevisions  int          `json:"keepRevisions"`
+	Removed        []BuiltImage `json:"removed"`
+	Kept           []BuiltImage `json:"kept"`
+	DanglingImages int          `json:"danglingImages"` // untagged build images pruned
+	ReclaimedBytes int64        `json:"reclaimedBytes"`
+}
+
+// BuiltImage is an image created by the function builder
+type BuiltImage struct {
+	ID       string    `json:"id"`
+	Function string    `json:"function"`
+	Tags     []string  `json:"tags,omitempty"`
+	Created  time.Time `json:"created"`
+	Size     int64     `json:"size"`             // bytes not shared with other images
+	Reason   string    `json:"reason,omitempty"` // why a kept image is kept
+	Error    string    `json:"error,omitempty"`
+}
+
+// CrashLoopStatus describes the crash-looping replicas of a degraded function
+type CrashLoopStatus struct {
+	Replicas     []string   `json:"replicas"`
+	Restarts     int        `json:"restarts"` // within the detection window
+	ExitCode     *int       `json:"exitCode,omitempty"`
+	OOMKilled    bool       `json:"oomKilled"`
+	BackoffUntil *time.Time `json:"backoffUntil,omitempty"`
+	LogTail      string     `json:"logTail,omitempty"`
+}
+
+// ReconcileReport describes the repairs made, or planned in a dry run, to
+// bring function containers in line with the stored functions
+type ReconcileReport struct {
+	DryRun     bool              `json:"dryRun"`
+	StartedAt  time.Time         `json:"startedAt"`
+	DurationMs int64             `json:"durationMs"`
+	Skipped    []string          `json:"skipped,omitempty"` // functions with changes in progress
+	Actions    []ReconcileAction `json:"actions"`
+}
+
+// ReconcileAction is a single reconciliation repair
+type ReconcileAction struct {
+	Action    string `json:"action"` // create, remove, recreate or remove-network
+	Function  string `json:"function"`
+	Container string `json:"container,omitempty"`
+	Network   string `json:"network,omitempty"`
+	Reason    string `json:"reason"`
+	Error     string `json:"error,omitempty"`
+}
+
+// FunctionEvent is a container lifecycle event observed for a function
+type FunctionEvent struct {
+	Time      time.Time `json:"time"`
+	Action    string    `json:"action"` // die, oom, restart or health_status
+	Container string    `json:"container"`
+	ExitCode  *int      `json:"exitCode,omitempty"`
+	Health    string    `json:"health,omitempty"`
+}
+
+// LogRequest selects the logs to read from a function's replicas
+type LogRequest struct {
+	Name     string
+	Instance string // only this replica when set
+	Since    *time.Time
+	Tail     int // lines across all replicas; negative for all, 0 for none
+	Follow   bool
+}
+
+// LogMessage is one line of function output, in the OpenFaaS provider log format
+type LogMessage struct {
+	Name      string    `json:"name"`
+	Instance  string    `json:"instance"`
+	Timestamp time.Time `json:"timestamp"`
+	Text      string    `json:"text"`
+	Stream    string    `json:"stream,omitempty"` // stdout or stderr
+	CallID    string    `json:"callId,omitempty"`
+}
+
+// ContainerResources reports the effective resource settings of a container
+type ContainerResources struct {
+	Memory            int64  `json:"memory,omitempty"` // bytes
+	MemoryReservation int64  `json:"memoryReservation,omitempty"`
+	MemorySwap        int64  `json:"memorySwap,omitempty"`
+	NanoCPUs          int64  `json:"nanoCpus,omitempty"`
+	CPUShares         int64  `json:"cpuShares,omitempty"`
+	CPUSet            string `json:"cpuset,omitempty"`
+	BlkioWeight       uint16 `json:"blkioWeight,omitempty"`
+	OOMKillDisable    bool   `json:"oomKillDisable,omitempty"`
+	OOMScoreAdj       int    `json:"oomScoreAdj,omitempty"`
+	PidsLimit         int64  `json:"pidsLimit,omitempty"`
 }
 
 // InvocationMetrics stores metrics for function invocations
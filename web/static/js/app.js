@@ -768,6 +768,7 @@ class DockerFaaSApp {
             if (response.ok) {
                 const containers = await response.json();
                 this.renderReplicas(containers);
+                this.loadReplicaStats(functionName);
             } else {
                 document.getElementById('replicas-list').innerHTML = '<p class="text-muted">No replica information available</p>';
             }
@@ -796,10 +797,69 @@ class DockerFaaSApp {
                     ${replica.ports && Object.keys(replica.ports).length > 0 ? `<br>Ports: ${Object.entries(replica.ports).map(([containerPort, hostPort]) => `${containerPort} -> ${hostPort}`).join(', ')}` : '<br>Ports: -'}
                     ${replica.createdAt ? `<br>Created: ${this.formatDate(replica.createdAt)}` : ''}
                 </div>
+                <div class="replica-stats" data-replica="${replica.name || ''}"></div>
             </div>
         `).join('');
     }
 
+    async loadReplicaStats(functionName) {
+        try {
+            const response = await this.api(`/system/function/${encodeURIComponent(functionName)}/stats`);
+            if (!response.ok) {
+                return;
+            }
+            const stats = await response.json();
+            (stats.replicas || []).forEach(replica => {
+                const element = document.querySelector(`.replica-stats[data-replica="${CSS.escape(replica.replica)}"]`);
+                if (!element) {
+                    return;
+                }
+                const history = (stats.history && stats.history[replica.replica]) || [];
+                const memory = replica.memoryLimit
+                    ? `${this.formatBytes(replica.memoryUsage)} / ${this.formatBytes(replica.memoryLimit)}`
+                    : this.formatBytes(replica.memoryUsage);
+                element.innerHTML = `
+                    <div class="replica-stat">
+                        <span>CPU ${replica.cpuPercent.toFixed(1)}%</span>
+                        ${this.sparkline(history.map(sample => sample.cpuPercent))}
+                    </div>
+                    <div class="replica-stat">
+                        <span>Mem ${memory}</span>
+                        ${this.sparkline(history.map(sample => sample.memoryUsage))}
+                    </div>
+                `;
+            });
+        } catch (error) {
+            console.error('Error loading replica stats:', error);
+        }
+    }
+
+    sparkline(values, width = 120, height = 24) {
+        if (values.length < 2) {
+            return '';
+        }
+        const max = Math.max(...values) || 1;
+        const step = width / (values.length - 1);
+        const points = values
+            .map((value, index) => `${(index * step).toFixed(1)},${(height - (value / max) * (height - 2) - 1).toFixed(1)}`)
+            .join(' ');
+        return `<svg class="sparkline" width="${width}" height="${height}" viewBox="0 0 ${width} ${height}"><polyline points="${points}" /></svg>`;
+    }
+
+    formatBytes(bytes) {
+        if (!Number.isFinite(bytes)) {
+            return '-';
+        }
+        const units = ['B', 'KiB', 'MiB', 'GiB', 'TiB'];
+        let value = bytes;
+        let unit = 0;
+        while (value >= 1024 && unit < units.length - 1) {
+            value /= 1024;
+            unit++;
+        }
+        return `${value.toFixed(unit === 0 ? 0 : 1)} ${units[unit]}`;
+    }
+
     async scaleFunction() {
         const replicas = parseInt(document.getElementById('scale-input').value);
         if (isNaN(replicas) || replicas < 0) {